@@ -2,20 +2,52 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
+	"log/slog"
+	"os"
 
 	"github.com/soulmate-dating/auth/internal/app"
 	"github.com/soulmate-dating/auth/internal/config"
+	"github.com/soulmate-dating/auth/internal/graceful"
+	"github.com/soulmate-dating/auth/internal/logger"
 	"github.com/soulmate-dating/auth/internal/ports/grpc"
 )
 
 func main() {
 	ctx := context.Background()
+	configFile := flag.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML or TOML config file")
+	flag.Parse()
 
-	cfg, err := config.Load()
+	cfg, err := config.Load(*configFile)
 	if err != nil {
 		log.Fatalf("failed to load config: %v", err)
 	}
+	var level slog.LevelVar
+	lvl, err := logger.ParseLevel(cfg.Log.Level)
+	if err != nil {
+		log.Fatalf("failed to create logger: %v", err)
+	}
+	level.Set(lvl)
+	slog.SetDefault(logger.New(os.Stdout, &level))
+
 	appSvc := app.New(ctx, cfg)
-	grpc.Run(ctx, cfg, appSvc)
+	// Only token lifetimes, rate limits and the log level are reloaded,
+	// anything else takes a restart.
+	reload := func() {
+		cfg, err := config.Load(*configFile)
+		if err != nil {
+			slog.Error("failed to reload config, keeping the current one", slog.Any("error", err))
+			return
+		}
+		lvl, _ := logger.ParseLevel(cfg.Log.Level)
+		level.Set(lvl)
+		appSvc.Reload(cfg)
+		slog.Info("config reloaded")
+	}
+	jobs := append(appSvc.Jobs(), graceful.CaptureReload(reload))
+	grpc.Run(ctx, cfg, appSvc, appSvc, jobs...)
+	if err := appSvc.Close(); err != nil {
+		slog.Error("failed to release resources", slog.Any("error", err))
+	}
 }
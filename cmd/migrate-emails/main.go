@@ -0,0 +1,63 @@
+// Command migrate-emails computes the canonical emails of existing users. If
+// active accounts share a canonical email with an older account, it changes
+// nothing, logs their IDs and prints them as JSON, so that support can merge
+// or contact them before running it again.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/soulmate-dating/auth/internal/adapters/postgres"
+	"github.com/soulmate-dating/auth/internal/config"
+)
+
+func main() {
+	ctx := context.Background()
+	configFile := flag.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML or TOML config file")
+	dryRun := flag.Bool("dry-run", false, "report the conflicts without changing the database")
+	flag.Parse()
+
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+	conn, err := postgres.Connect(ctx, postgres.Config{
+		Host:              cfg.Postgres.Host,
+		Port:              cfg.Postgres.Port,
+		User:              cfg.Postgres.User,
+		Password:          cfg.Postgres.Password,
+		DBName:            cfg.Postgres.Database,
+		SSLMode:           cfg.Postgres.SSLMode,
+		ConnectionTimeout: cfg.Postgres.ConnectionTimeout,
+	})
+	if err != nil {
+		log.Fatalf("failed to connect to db: %v", err)
+	}
+	defer conn.Close()
+
+	repo := postgres.NewRepo(postgres.NewPool(conn))
+	conflicts, err := repo.MigrateCanonicalEmails(ctx, cfg.Account.EmailProviderRules, *dryRun)
+	if err != nil && !errors.Is(err, postgres.ErrEmailConflicts) {
+		log.Fatalf("failed to migrate emails: %v", err)
+	}
+	for _, c := range conflicts {
+		log.Printf("user %s shares the canonical email %s with user %s", c.ID, c.Canonical, c.KeptBy)
+	}
+	report := struct {
+		DryRun    bool                     `json:"dry_run"`
+		Conflicts []postgres.EmailConflict `json:"conflicts"`
+	}{DryRun: *dryRun, Conflicts: conflicts}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		log.Fatalf("failed to write report: %v", err)
+	}
+	if err != nil {
+		log.Fatalf("emails were not migrated: %d conflicts must be resolved first", len(conflicts))
+	}
+}
@@ -0,0 +1,80 @@
+package events
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+// Marshal encodes a domain event into a protobuf Envelope.
+func Marshal(id uuid.UUID, occurredAt time.Time, event domain.Event) ([]byte, error) {
+	envelope := &Envelope{
+		Id:         id.String(),
+		Type:       event.EventType(),
+		OccurredAt: timestamppb.New(occurredAt),
+	}
+	switch e := event.(type) {
+	case domain.UserCreated:
+		envelope.Payload = &Envelope_UserCreated{UserCreated: &UserCreated{
+			UserId: e.UserID.String(),
+			Email:  e.Email,
+		}}
+	case domain.UserEmailVerified:
+		envelope.Payload = &Envelope_UserEmailVerified{UserEmailVerified: &UserEmailVerified{
+			UserId: e.UserID.String(),
+			Email:  e.Email,
+		}}
+	case domain.UserEmailChanged:
+		envelope.Payload = &Envelope_UserEmailChanged{UserEmailChanged: &UserEmailChanged{
+			UserId:   e.UserID.String(),
+			OldEmail: e.OldEmail,
+			NewEmail: e.NewEmail,
+		}}
+		if !e.RevertExpiresAt.IsZero() {
+			envelope.GetUserEmailChanged().RevertExpiresAt = timestamppb.New(e.RevertExpiresAt)
+		}
+	case domain.UserDeleted:
+		envelope.Payload = &Envelope_UserDeleted{UserDeleted: &UserDeleted{
+			UserId: e.UserID.String(),
+		}}
+	case domain.EmailChangeRequested:
+		envelope.Payload = &Envelope_EmailChangeRequested{EmailChangeRequested: &EmailChangeRequested{
+			UserId:    e.UserID.String(),
+			NewEmail:  e.NewEmail,
+			ExpiresAt: timestamppb.New(e.ExpiresAt),
+		}}
+	case domain.UserStatusChanged:
+		payload := &UserStatusChanged{
+			UserId: e.UserID.String(),
+			Status: string(e.Status),
+		}
+		if e.Until != nil {
+			payload.Until = timestamppb.New(*e.Until)
+		}
+		envelope.Payload = &Envelope_UserStatusChanged{UserStatusChanged: payload}
+	case domain.WaitlistAdmitted:
+		envelope.Payload = &Envelope_WaitlistAdmitted{WaitlistAdmitted: &WaitlistAdmitted{
+			EntryId:   e.EntryID.String(),
+			Email:     e.Email,
+			ExpiresAt: timestamppb.New(e.ExpiresAt),
+		}}
+	case domain.NewDeviceLogin:
+		envelope.Payload = &Envelope_NewDeviceLogin{NewDeviceLogin: &NewDeviceLogin{
+			UserId:    e.UserID.String(),
+			Email:     e.Email,
+			Ip:        e.IP,
+			UserAgent: e.UserAgent,
+			Country:   e.Country,
+			City:      e.City,
+			At:        timestamppb.New(e.At),
+		}}
+	default:
+		return nil, fmt.Errorf("unknown event type %T", event)
+	}
+	return proto.Marshal(envelope)
+}
@@ -0,0 +1,53 @@
+// Package geoip locates IP addresses in a local MaxMind database, such as
+// GeoLite2 City or GeoLite2 Country.
+package geoip
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/oschwald/maxminddb-golang"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+// record holds the fields of a City or Country database entry that are read.
+type record struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+}
+
+type Reader struct {
+	db *maxminddb.Reader
+}
+
+// Open memory-maps the database file. An updated file is picked up on restart.
+func Open(path string) (*Reader, error) {
+	db, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open geoip database: %w", err)
+	}
+	return &Reader{db: db}, nil
+}
+
+// Locate returns the country and English city name of ip. Addresses that are
+// invalid or not in the database have an empty location.
+func (r *Reader) Locate(ip string) (domain.GeoLocation, error) {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return domain.GeoLocation{}, nil
+	}
+	var rec record
+	if err := r.db.Lookup(addr, &rec); err != nil {
+		return domain.GeoLocation{}, fmt.Errorf("look up ip: %w", err)
+	}
+	return domain.GeoLocation{Country: rec.Country.ISOCode, City: rec.City.Names["en"]}, nil
+}
+
+func (r *Reader) Close() error {
+	return r.db.Close()
+}
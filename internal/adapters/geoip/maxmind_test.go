@@ -0,0 +1,185 @@
+package geoip
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+// writeDatabase writes an IPv4 MaxMind DB with 32-bit records that holds
+// the given entries under their networks, and returns its path.
+func writeDatabase(t *testing.T, entries map[string]map[string]any) string {
+	t.Helper()
+	// The search tree starts with the root node; a record is a node index,
+	// empty until set, or data once the network is reached.
+	type node struct{ records [2]uint32 }
+	const empty = ^uint32(0)
+	nodes := []node{{[2]uint32{empty, empty}}}
+	var data []byte
+	type leaf struct {
+		node, bit int
+		offset    uint32
+	}
+	var leaves []leaf
+
+	networks := make([]string, 0, len(entries))
+	for network := range entries {
+		networks = append(networks, network)
+	}
+	sort.Strings(networks)
+	for _, network := range networks {
+		prefix := netip.MustParsePrefix(network)
+		addr := prefix.Addr().As4()
+		current := 0
+		for i := 0; i < prefix.Bits(); i++ {
+			bit := int(addr[i/8]>>(7-i%8)) & 1
+			if i == prefix.Bits()-1 {
+				leaves = append(leaves, leaf{current, bit, uint32(len(data))})
+				break
+			}
+			if nodes[current].records[bit] == empty {
+				nodes = append(nodes, node{[2]uint32{empty, empty}})
+				nodes[current].records[bit] = uint32(len(nodes) - 1)
+			}
+			current = int(nodes[current].records[bit])
+		}
+		data = append(data, encode(t, entries[network])...)
+	}
+
+	nodeCount := uint32(len(nodes))
+	for _, l := range leaves {
+		nodes[l.node].records[l.bit] = nodeCount + 16 + l.offset
+	}
+	var db []byte
+	for _, n := range nodes {
+		for _, r := range n.records {
+			if r == empty {
+				r = nodeCount
+			}
+			db = binary.BigEndian.AppendUint32(db, r)
+		}
+	}
+	db = append(db, make([]byte, 16)...)
+	db = append(db, data...)
+	db = append(db, "\xAB\xCD\xEFMaxMind.com"...)
+	db = append(db, encode(t, map[string]any{
+		"binary_format_major_version": uint16(2),
+		"binary_format_minor_version": uint16(0),
+		"database_type":               "Test-City",
+		"ip_version":                  uint16(4),
+		"node_count":                  nodeCount,
+		"record_size":                 uint16(32),
+	})...)
+
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	if err := os.WriteFile(path, db, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// encode encodes the short maps, strings and unsigned integers the tests use
+// in the MaxMind DB data format.
+func encode(t *testing.T, v any) []byte {
+	t.Helper()
+	const (
+		typeString = 2
+		typeUint16 = 5
+		typeUint32 = 6
+		typeMap    = 7
+	)
+	control := func(typ, size int) byte {
+		if size >= 29 {
+			t.Fatalf("size %d needs an extended size", size)
+		}
+		return byte(typ<<5 | size)
+	}
+	switch v := v.(type) {
+	case string:
+		return append([]byte{control(typeString, len(v))}, v...)
+	case uint16:
+		return binary.BigEndian.AppendUint16([]byte{control(typeUint16, 2)}, v)
+	case uint32:
+		return binary.BigEndian.AppendUint32([]byte{control(typeUint32, 4)}, v)
+	case map[string]any:
+		b := []byte{control(typeMap, len(v))}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			b = append(b, encode(t, k)...)
+			b = append(b, encode(t, v[k])...)
+		}
+		return b
+	}
+	t.Fatalf("can't encode %T", v)
+	return nil
+}
+
+func TestReader_Locate(t *testing.T) {
+	path := writeDatabase(t, map[string]map[string]any{
+		"198.51.100.0/24": {
+			"country": map[string]any{"iso_code": "DE"},
+			"city":    map[string]any{"names": map[string]any{"en": "Berlin", "de": "Berlin"}},
+		},
+		// Entries of a Country database have no city.
+		"192.0.2.0/25": {
+			"country": map[string]any{"iso_code": "BR"},
+		},
+	})
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := r.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	tests := []struct {
+		ip      string
+		want    domain.GeoLocation
+		wantErr bool
+	}{
+		{ip: "198.51.100.7", want: domain.GeoLocation{Country: "DE", City: "Berlin"}},
+		{ip: "192.0.2.1", want: domain.GeoLocation{Country: "BR"}},
+		{ip: "192.0.2.200"},
+		{ip: "203.0.113.9"},
+		{ip: "not-an-ip"},
+		{ip: ""},
+		{ip: "2001:db8::1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%q", tt.ip), func(t *testing.T) {
+			got, err := r.Locate(tt.ip)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Locate() error = %v, want error: %t", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Locate() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpen_InvalidFiles(t *testing.T) {
+	garbage := filepath.Join(t.TempDir(), "garbage.mmdb")
+	if err := os.WriteFile(garbage, []byte("not a database"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{filepath.Join(t.TempDir(), "missing.mmdb"), garbage} {
+		if r, err := Open(path); err == nil {
+			r.Close()
+			t.Errorf("Open(%s) succeeded", filepath.Base(path))
+		}
+	}
+}
@@ -1,53 +1,193 @@
 package jwt
 
 import (
+	"crypto/rsa"
+	"errors"
 	"fmt"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
 	"github.com/soulmate-dating/auth/internal/domain"
 )
 
-type Wrapper struct {
+// signingMethod is the only algorithm tokens are signed and accepted with,
+// except for access tokens when an access key is configured.
+var signingMethod = jwt.SigningMethodHS256
+
+// accessKeyMethod is the algorithm of access tokens signed with an access key.
+var accessKeyMethod = jwt.SigningMethodRS256
+
+type Config struct {
+	Issuer                 string
+	Audience               string
 	SecretKey              string
 	RefreshSecretKey       string
-	Issuer                 string
 	AccessTokenExpiration  time.Duration
 	RefreshTokenExpiration time.Duration
+	ServiceTokenExpiration time.Duration
+	// GuestAccessTokenExpiration and GuestRefreshTokenExpiration replace the
+	// expirations of tokens issued to guests.
+	GuestAccessTokenExpiration  time.Duration
+	GuestRefreshTokenExpiration time.Duration
+	// Leeway is the clock skew tolerated when checking exp, nbf and iat.
+	Leeway time.Duration
+	// AccessKey, if set, signs access tokens with RS256 instead of SecretKey,
+	// so that other services can verify them with the public key from JWKS.
+	AccessKey *rsa.PrivateKey
+	// PreviousAccessKeys are keys AccessKey replaced. Access tokens they signed
+	// remain valid and they stay in JWKS, so keep them until those tokens expired.
+	PreviousAccessKeys []*rsa.PublicKey
 }
 
-func NewWrapper(
-	issuer, secretKey, refreshSecretKey string,
-	accessExpirationHours, refreshExpirationHours time.Duration,
-) *Wrapper {
-	return &Wrapper{
-		SecretKey:              secretKey,
-		RefreshSecretKey:       refreshSecretKey,
-		Issuer:                 issuer,
-		AccessTokenExpiration:  accessExpirationHours,
-		RefreshTokenExpiration: refreshExpirationHours,
+// Expirations are the lifetimes of issued tokens. They can be changed while
+// the service runs and apply to tokens issued afterwards.
+type Expirations struct {
+	Access       time.Duration
+	Refresh      time.Duration
+	Service      time.Duration
+	GuestAccess  time.Duration
+	GuestRefresh time.Duration
+}
+
+// AccessFor returns the lifetime of access tokens issued to the user.
+func (e Expirations) AccessFor(user *domain.User) time.Duration {
+	if user.Guest {
+		return e.GuestAccess
 	}
+	return e.Access
+}
+
+// RefreshFor returns the lifetime of refresh tokens, and so of sessions, of the user.
+func (e Expirations) RefreshFor(user *domain.User) time.Duration {
+	if user.Guest {
+		return e.GuestRefresh
+	}
+	return e.Refresh
+}
+
+type Wrapper struct {
+	SecretKey        string
+	RefreshSecretKey string
+	Issuer           string
+	Audience         string
+	Leeway           time.Duration
+	expirations      atomic.Pointer[Expirations]
+	parser           *jwt.Parser
+	accessParser     *jwt.Parser
+	accessKey        *rsa.PrivateKey
+	accessKeyID      string
+	// publicKeys verify access tokens by kid, the current key first.
+	publicKeys []*rsa.PublicKey
+	now        func() time.Time
+}
+
+func NewWrapper(cfg Config) *Wrapper {
+	w := &Wrapper{
+		SecretKey:        cfg.SecretKey,
+		RefreshSecretKey: cfg.RefreshSecretKey,
+		Issuer:           cfg.Issuer,
+		Audience:         cfg.Audience,
+		Leeway:           cfg.Leeway,
+		// Registered claims are checked by verifyClaims, which applies the leeway.
+		parser: &jwt.Parser{ValidMethods: []string{signingMethod.Alg()}, SkipClaimsValidation: true},
+		now:    time.Now,
+	}
+	w.SetExpirations(Expirations{
+		Access:       cfg.AccessTokenExpiration,
+		Refresh:      cfg.RefreshTokenExpiration,
+		Service:      cfg.ServiceTokenExpiration,
+		GuestAccess:  cfg.GuestAccessTokenExpiration,
+		GuestRefresh: cfg.GuestRefreshTokenExpiration,
+	})
+	if cfg.AccessKey != nil {
+		w.accessKey = cfg.AccessKey
+		w.accessKeyID = KeyID(&cfg.AccessKey.PublicKey)
+		w.publicKeys = append([]*rsa.PublicKey{&cfg.AccessKey.PublicKey}, cfg.PreviousAccessKeys...)
+		w.accessParser = &jwt.Parser{ValidMethods: []string{accessKeyMethod.Alg()}, SkipClaimsValidation: true}
+	}
+	return w
+}
+
+func (w *Wrapper) Expirations() Expirations {
+	return *w.expirations.Load()
+}
+
+// SetExpirations replaces the token lifetimes, e.g. on a config reload.
+func (w *Wrapper) SetExpirations(e Expirations) {
+	w.expirations.Store(&e)
 }
 
-func (w *Wrapper) GenerateAccessToken(user *domain.User) (string, error) {
-	return w.generateToken(user, w.AccessTokenExpiration, w.SecretKey)
+// GenerateAccessToken issues an access token carrying the user's roles and,
+// in the scope claim, the permissions those roles grant.
+func (w *Wrapper) GenerateAccessToken(user *domain.User, sessionID uuid.UUID) (string, error) {
+	claims := w.newClaims(user, sessionID, domain.TokenUseAccess, w.Expirations().AccessFor(user))
+	claims.Roles = user.Roles
+	claims.Scope = strings.Join(user.Permissions, " ")
+	return w.signAccess(claims)
 }
 
-func (w *Wrapper) GenerateRefreshToken(user *domain.User) (string, error) {
-	return w.generateToken(user, w.RefreshTokenExpiration, w.RefreshSecretKey)
+func (w *Wrapper) GenerateRefreshToken(user *domain.User, sessionID uuid.UUID) (string, error) {
+	return sign(w.newClaims(user, sessionID, domain.TokenUseRefresh, w.Expirations().RefreshFor(user)), w.RefreshSecretKey)
 }
 
-func (w *Wrapper) generateToken(user *domain.User, expiration time.Duration, secretKey string) (signedToken string, err error) {
+// GenerateServiceToken issues an access token to a service client. The client
+// ID is the subject, and there is neither a session nor a refresh token.
+func (w *Wrapper) GenerateServiceToken(client *domain.ServiceClient, scopes []string) (string, error) {
+	now := w.now()
 	claims := &domain.Claims{
-		Id:    user.ID,
-		Email: user.Email,
+		ClientID: client.ID,
+		TokenUse: domain.TokenUseAccess,
+		Scope:    strings.Join(scopes, " "),
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Local().Add(expiration).Unix(),
+			Id:        domain.NewUUID().String(),
+			Subject:   client.ID,
+			Audience:  w.Audience,
 			Issuer:    w.Issuer,
+			IssuedAt:  now.Unix(),
+			NotBefore: now.Unix(),
+			ExpiresAt: now.Add(w.Expirations().Service).Unix(),
 		},
 	}
+	return w.signAccess(claims)
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+func (w *Wrapper) newClaims(user *domain.User, sessionID uuid.UUID, use string, expiration time.Duration) *domain.Claims {
+	now := w.now()
+	return &domain.Claims{
+		UserID:        user.ID,
+		Email:         user.Email,
+		SessionId:     sessionID,
+		TokenUse:      use,
+		Version:       user.TokenVersion,
+		AgeVerified:   user.AgeAttestedAt != nil,
+		EmailVerified: user.EmailVerifiedAt != nil,
+		Guest:         user.Guest,
+		StandardClaims: jwt.StandardClaims{
+			Id:        domain.NewUUID().String(),
+			Subject:   user.ID.String(),
+			Audience:  w.Audience,
+			Issuer:    w.Issuer,
+			IssuedAt:  now.Unix(),
+			NotBefore: now.Unix(),
+			ExpiresAt: now.Add(expiration).Unix(),
+		},
+	}
+}
+
+func (w *Wrapper) signAccess(claims *domain.Claims) (string, error) {
+	if w.accessKey == nil {
+		return sign(claims, w.SecretKey)
+	}
+	token := jwt.NewWithClaims(accessKeyMethod, claims)
+	token.Header["kid"] = w.accessKeyID
+	return token.SignedString(w.accessKey)
+}
+
+func sign(claims *domain.Claims, secretKey string) (signedToken string, err error) {
+	token := jwt.NewWithClaims(signingMethod, claims)
 	signedToken, err = token.SignedString([]byte(secretKey))
 	if err != nil {
 		return "", err
@@ -57,23 +197,37 @@ func (w *Wrapper) generateToken(user *domain.User, expiration time.Duration, sec
 }
 
 func (w *Wrapper) ValidateAccessToken(signedToken string) (claims *domain.Claims, err error) {
-	return w.validateToken(signedToken, w.SecretKey)
+	if w.accessKey != nil {
+		return w.validateToken(signedToken, w.accessParser, w.publicKey, domain.TokenUseAccess)
+	}
+	return w.validateToken(signedToken, w.parser, secret(w.SecretKey), domain.TokenUseAccess)
 }
 
 func (w *Wrapper) ValidateRefreshToken(signedToken string) (claims *domain.Claims, err error) {
-	return w.validateToken(signedToken, w.RefreshSecretKey)
+	return w.validateToken(signedToken, w.parser, secret(w.RefreshSecretKey), domain.TokenUseRefresh)
 }
 
-func (w *Wrapper) validateToken(signedToken, secretKey string) (claims *domain.Claims, err error) {
-	token, err := jwt.ParseWithClaims(
-		signedToken,
-		&domain.Claims{},
-		func(token *jwt.Token) (interface{}, error) {
-			return []byte(secretKey), nil
-		},
-	)
+// publicKey returns the access key or previous access key named by the kid of the token.
+func (w *Wrapper) publicKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	for _, key := range w.publicKeys {
+		if KeyID(key) == kid {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: kid %q", ErrUnknownKey, kid)
+}
+
+func secret(key string) jwt.Keyfunc {
+	return func(*jwt.Token) (interface{}, error) {
+		return []byte(key), nil
+	}
+}
+
+func (w *Wrapper) validateToken(signedToken string, parser *jwt.Parser, keyFunc jwt.Keyfunc, use string) (claims *domain.Claims, err error) {
+	token, err := parser.ParseWithClaims(signedToken, &domain.Claims{}, keyFunc)
 	if err != nil {
-		return nil, fmt.Errorf("%w: %w", domain.ErrInvalidToken, err)
+		return nil, classifyError(err)
 	}
 
 	claims, ok := token.Claims.(*domain.Claims)
@@ -81,9 +235,18 @@ func (w *Wrapper) validateToken(signedToken, secretKey string) (claims *domain.C
 		return nil, domain.ErrFailedToParseClaims
 	}
 
-	if claims.ExpiresAt < time.Now().Local().Unix() {
-		return nil, domain.ErrExpiredToken
+	v := Verifier{Issuer: w.Issuer, Audience: w.Audience, Leeway: w.Leeway, now: w.now}
+	if err := v.verifyClaims(claims, use); err != nil {
+		return nil, err
 	}
 
 	return claims, nil
 }
+
+func classifyError(err error) error {
+	var validationErr *jwt.ValidationError
+	if errors.As(err, &validationErr) && validationErr.Errors&jwt.ValidationErrorSignatureInvalid != 0 {
+		return fmt.Errorf("%w: %w: %w", domain.ErrInvalidToken, domain.ErrInvalidSignature, err)
+	}
+	return fmt.Errorf("%w: %w", domain.ErrInvalidToken, err)
+}
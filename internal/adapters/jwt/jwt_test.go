@@ -0,0 +1,506 @@
+package jwt
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+const (
+	testIssuer  = "auth-test"
+	testAud     = "api-test"
+	testSecret  = "access-secret-for-tests-only-0123456789"
+	testRefresh = "refresh-secret-for-tests-only-0123456789"
+)
+
+var testNow = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestWrapper() *Wrapper {
+	w := NewWrapper(Config{
+		Issuer:                 testIssuer,
+		Audience:               testAud,
+		SecretKey:              testSecret,
+		RefreshSecretKey:       testRefresh,
+		AccessTokenExpiration:  time.Hour,
+		RefreshTokenExpiration: 24 * time.Hour,
+		Leeway:                 30 * time.Second,
+	})
+	w.now = func() time.Time { return testNow }
+	return w
+}
+
+func validClaims(userID uuid.UUID) *domain.Claims {
+	return &domain.Claims{
+		Email:     "user@example.com",
+		SessionId: uuid.New(),
+		TokenUse:  domain.TokenUseAccess,
+		StandardClaims: jwt.StandardClaims{
+			Id:        uuid.NewString(),
+			Subject:   userID.String(),
+			Audience:  testAud,
+			Issuer:    testIssuer,
+			IssuedAt:  testNow.Unix(),
+			NotBefore: testNow.Unix(),
+			ExpiresAt: testNow.Add(time.Hour).Unix(),
+		},
+	}
+}
+
+func signWith(t *testing.T, method jwt.SigningMethod, claims *domain.Claims, key interface{}) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return token
+}
+
+func encodeSegment(s string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+func TestWrapper_GeneratedTokenCarriesRegisteredClaims(t *testing.T) {
+	w := newTestWrapper()
+	user := &domain.User{ID: uuid.New(), Email: "user@example.com", Roles: []string{"user"}, Permissions: []string{"a", "b"}}
+	sessionID := uuid.New()
+
+	token, err := w.GenerateAccessToken(user, sessionID)
+	if err != nil {
+		t.Fatalf("GenerateAccessToken() error = %v", err)
+	}
+	claims, err := w.ValidateAccessToken(token)
+	if err != nil {
+		t.Fatalf("ValidateAccessToken() error = %v", err)
+	}
+
+	if claims.Subject != user.ID.String() || claims.UserID != user.ID {
+		t.Errorf("sub = %q, user id = %v, want %v", claims.Subject, claims.UserID, user.ID)
+	}
+	if claims.Issuer != testIssuer || claims.Audience != testAud {
+		t.Errorf("iss/aud = %q/%q, want %q/%q", claims.Issuer, claims.Audience, testIssuer, testAud)
+	}
+	if claims.IssuedAt != testNow.Unix() || claims.NotBefore != testNow.Unix() {
+		t.Errorf("iat/nbf = %d/%d, want %d", claims.IssuedAt, claims.NotBefore, testNow.Unix())
+	}
+	if claims.ExpiresAt != testNow.Add(time.Hour).Unix() {
+		t.Errorf("exp = %d, want %d", claims.ExpiresAt, testNow.Add(time.Hour).Unix())
+	}
+	if _, err := uuid.Parse(claims.Id); err != nil {
+		t.Errorf("jti = %q is not a uuid: %v", claims.Id, err)
+	}
+	if claims.SessionId != sessionID || claims.Scope != "a b" {
+		t.Errorf("sid/scope = %v/%q, want %v/%q", claims.SessionId, claims.Scope, sessionID, "a b")
+	}
+}
+
+func TestWrapper_GeneratedTokensHaveUniqueIDs(t *testing.T) {
+	w := newTestWrapper()
+	user := &domain.User{ID: uuid.New()}
+	sessionID := uuid.New()
+
+	first, _ := w.GenerateAccessToken(user, sessionID)
+	second, _ := w.GenerateAccessToken(user, sessionID)
+	a, err := w.ValidateAccessToken(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := w.ValidateAccessToken(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Id == b.Id {
+		t.Errorf("two tokens share jti %q", a.Id)
+	}
+}
+
+func TestWrapper_ValidateAccessToken(t *testing.T) {
+	userID := uuid.New()
+	modify := func(f func(c *domain.Claims)) string {
+		c := validClaims(userID)
+		f(c)
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, c).SignedString([]byte(testSecret))
+		if err != nil {
+			panic(err)
+		}
+		return token
+	}
+	valid := modify(func(*domain.Claims) {})
+	parts := strings.Split(valid, ".")
+
+	tests := []struct {
+		name    string
+		token   func(t *testing.T) string
+		wantErr error
+	}{
+		{
+			name:  "valid",
+			token: func(*testing.T) string { return valid },
+		},
+		{
+			name: "expired within leeway",
+			token: func(*testing.T) string {
+				return modify(func(c *domain.Claims) { c.ExpiresAt = testNow.Add(-10 * time.Second).Unix() })
+			},
+		},
+		{
+			name: "not yet valid within leeway",
+			token: func(*testing.T) string {
+				return modify(func(c *domain.Claims) { c.NotBefore = testNow.Add(10 * time.Second).Unix() })
+			},
+		},
+		{
+			name: "expired",
+			token: func(*testing.T) string {
+				return modify(func(c *domain.Claims) { c.ExpiresAt = testNow.Add(-time.Minute).Unix() })
+			},
+			wantErr: domain.ErrExpiredToken,
+		},
+		{
+			name:    "missing exp",
+			token:   func(*testing.T) string { return modify(func(c *domain.Claims) { c.ExpiresAt = 0 }) },
+			wantErr: domain.ErrInvalidToken,
+		},
+		{
+			name: "not yet valid",
+			token: func(*testing.T) string {
+				return modify(func(c *domain.Claims) { c.NotBefore = testNow.Add(time.Minute).Unix() })
+			},
+			wantErr: domain.ErrInvalidToken,
+		},
+		{
+			name:    "missing nbf",
+			token:   func(*testing.T) string { return modify(func(c *domain.Claims) { c.NotBefore = 0 }) },
+			wantErr: domain.ErrInvalidToken,
+		},
+		{
+			name: "issued in the future",
+			token: func(*testing.T) string {
+				return modify(func(c *domain.Claims) { c.IssuedAt = testNow.Add(time.Hour).Unix() })
+			},
+			wantErr: domain.ErrInvalidToken,
+		},
+		{
+			name:    "missing iat",
+			token:   func(*testing.T) string { return modify(func(c *domain.Claims) { c.IssuedAt = 0 }) },
+			wantErr: domain.ErrInvalidToken,
+		},
+		{
+			name:    "wrong issuer",
+			token:   func(*testing.T) string { return modify(func(c *domain.Claims) { c.Issuer = "evil" }) },
+			wantErr: domain.ErrInvalidToken,
+		},
+		{
+			name:    "wrong audience",
+			token:   func(*testing.T) string { return modify(func(c *domain.Claims) { c.Audience = "other-api" }) },
+			wantErr: domain.ErrInvalidToken,
+		},
+		{
+			name:    "missing audience",
+			token:   func(*testing.T) string { return modify(func(c *domain.Claims) { c.Audience = "" }) },
+			wantErr: domain.ErrInvalidToken,
+		},
+		{
+			name:    "missing jti",
+			token:   func(*testing.T) string { return modify(func(c *domain.Claims) { c.Id = "" }) },
+			wantErr: domain.ErrInvalidToken,
+		},
+		{
+			name:    "refresh token use",
+			token:   func(*testing.T) string { return modify(func(c *domain.Claims) { c.TokenUse = domain.TokenUseRefresh }) },
+			wantErr: domain.ErrInvalidToken,
+		},
+		{
+			name:    "missing token use",
+			token:   func(*testing.T) string { return modify(func(c *domain.Claims) { c.TokenUse = "" }) },
+			wantErr: domain.ErrInvalidToken,
+		},
+		{
+			name:    "missing sub",
+			token:   func(*testing.T) string { return modify(func(c *domain.Claims) { c.Subject = "" }) },
+			wantErr: domain.ErrInvalidToken,
+		},
+		{
+			name:    "sub is not a user id",
+			token:   func(*testing.T) string { return modify(func(c *domain.Claims) { c.Subject = "admin" }) },
+			wantErr: domain.ErrInvalidToken,
+		},
+		{
+			name: "signed with another secret",
+			token: func(t *testing.T) string {
+				return signWith(t, jwt.SigningMethodHS256, validClaims(userID), []byte("attacker-secret"))
+			},
+			wantErr: domain.ErrInvalidSignature,
+		},
+		{
+			name: "refresh token used as access token",
+			token: func(t *testing.T) string {
+				return signWith(t, jwt.SigningMethodHS256, validClaims(userID), []byte(testRefresh))
+			},
+			wantErr: domain.ErrInvalidSignature,
+		},
+		{
+			name: "alg none",
+			token: func(t *testing.T) string {
+				return signWith(t, jwt.SigningMethodNone, validClaims(userID), jwt.UnsafeAllowNoneSignatureType)
+			},
+			wantErr: domain.ErrInvalidSignature,
+		},
+		{
+			name: "alg none with stripped signature",
+			token: func(*testing.T) string {
+				return encodeSegment(`{"alg":"none","typ":"JWT"}`) + "." + parts[1] + "."
+			},
+			wantErr: domain.ErrInvalidSignature,
+		},
+		{
+			name: "HS512 with the right secret",
+			token: func(t *testing.T) string {
+				return signWith(t, jwt.SigningMethodHS512, validClaims(userID), []byte(testSecret))
+			},
+			wantErr: domain.ErrInvalidSignature,
+		},
+		{
+			name: "RS256 header over HMAC signature",
+			token: func(*testing.T) string {
+				return encodeSegment(`{"alg":"RS256","typ":"JWT"}`) + "." + parts[1] + "." + parts[2]
+			},
+			wantErr: domain.ErrInvalidSignature,
+		},
+		{
+			name: "tampered payload",
+			token: func(t *testing.T) string {
+				forged := validClaims(uuid.New())
+				payload := signWith(t, jwt.SigningMethodHS256, forged, []byte("x"))
+				return parts[0] + "." + strings.Split(payload, ".")[1] + "." + parts[2]
+			},
+			wantErr: domain.ErrInvalidSignature,
+		},
+		{
+			name:    "truncated signature",
+			token:   func(*testing.T) string { return valid[:len(valid)-4] },
+			wantErr: domain.ErrInvalidSignature,
+		},
+		{
+			name:    "two segments",
+			token:   func(*testing.T) string { return parts[0] + "." + parts[1] },
+			wantErr: domain.ErrInvalidToken,
+		},
+		{
+			name:    "payload is not base64",
+			token:   func(*testing.T) string { return parts[0] + ".!!!." + parts[2] },
+			wantErr: domain.ErrInvalidToken,
+		},
+		{
+			name: "payload is not json",
+			token: func(*testing.T) string {
+				return parts[0] + "." + encodeSegment("not json") + "." + parts[2]
+			},
+			wantErr: domain.ErrInvalidToken,
+		},
+		{
+			name:    "empty",
+			token:   func(*testing.T) string { return "" },
+			wantErr: domain.ErrInvalidToken,
+		},
+	}
+
+	w := newTestWrapper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := w.ValidateAccessToken(tt.token(t))
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("ValidateAccessToken() error = %v", err)
+				}
+				if claims.UserID != userID {
+					t.Errorf("user id = %v, want %v", claims.UserID, userID)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ValidateAccessToken() error = %v, want %v", err, tt.wantErr)
+			}
+			if claims != nil {
+				t.Errorf("claims = %+v, want nil", claims)
+			}
+		})
+	}
+}
+
+func TestWrapper_TokenUseIsEnforcedWithSharedSecret(t *testing.T) {
+	w := newTestWrapper()
+	w.RefreshSecretKey = w.SecretKey
+	user := &domain.User{ID: uuid.New()}
+
+	access, err := w.GenerateAccessToken(user, uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	refresh, err := w.GenerateRefreshToken(user, uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := w.ValidateRefreshToken(access); !errors.Is(err, domain.ErrInvalidToken) {
+		t.Errorf("ValidateRefreshToken(access) error = %v, want %v", err, domain.ErrInvalidToken)
+	}
+	if _, err := w.ValidateAccessToken(refresh); !errors.Is(err, domain.ErrInvalidToken) {
+		t.Errorf("ValidateAccessToken(refresh) error = %v, want %v", err, domain.ErrInvalidToken)
+	}
+	if _, err := w.ValidateRefreshToken(refresh); err != nil {
+		t.Errorf("ValidateRefreshToken(refresh) error = %v", err)
+	}
+}
+
+func TestWrapper_ServiceToken(t *testing.T) {
+	w := newTestWrapper()
+	e := w.Expirations()
+	e.Service = 5 * time.Minute
+	w.SetExpirations(e)
+	client := &domain.ServiceClient{ID: "feed"}
+
+	token, err := w.GenerateServiceToken(client, []string{"profile:read"})
+	if err != nil {
+		t.Fatalf("GenerateServiceToken() error = %v", err)
+	}
+	claims, err := w.ValidateAccessToken(token)
+	if err != nil {
+		t.Fatalf("ValidateAccessToken() error = %v", err)
+	}
+	if !claims.IsService() || claims.Subject != "feed" || claims.UserID != uuid.Nil {
+		t.Errorf("claims = %+v, want service token for feed", claims)
+	}
+	if claims.ExpiresAt != testNow.Add(5*time.Minute).Unix() || !claims.HasScope("profile:read") {
+		t.Errorf("exp/scope = %d/%q", claims.ExpiresAt, claims.Scope)
+	}
+
+	forged := validClaims(uuid.New())
+	forged.ClientID = "feed"
+	_, err = w.ValidateAccessToken(signWith(t, jwt.SigningMethodHS256, forged, []byte(testSecret)))
+	if !errors.Is(err, domain.ErrInvalidToken) {
+		t.Errorf("ValidateAccessToken(sub != client_id) error = %v, want %v", err, domain.ErrInvalidToken)
+	}
+}
+
+func TestVerifier_VerifyAccessToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := newTestWrapper()
+	signer := NewWrapper(Config{
+		Issuer:                testIssuer,
+		Audience:              testAud,
+		SecretKey:             testSecret,
+		AccessTokenExpiration: time.Hour,
+		Leeway:                30 * time.Second,
+		AccessKey:             key,
+	})
+	signer.now = w.now
+	user := &domain.User{ID: uuid.New()}
+	token, err := signer.GenerateAccessToken(user, uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := signer.ValidateAccessToken(token); err != nil {
+		t.Fatalf("ValidateAccessToken() error = %v", err)
+	}
+
+	jwks := signer.JWKS()
+	if len(jwks.Keys) != 1 {
+		t.Fatalf("JWKS() has %d keys, want 1", len(jwks.Keys))
+	}
+	published, err := jwks.Keys[0].PublicKey()
+	if err != nil {
+		t.Fatalf("PublicKey() error = %v", err)
+	}
+	keys := func(kid string) (*rsa.PublicKey, error) {
+		if kid != jwks.Keys[0].Kid {
+			return nil, ErrUnknownKey
+		}
+		return published, nil
+	}
+	v := NewVerifier(testIssuer, testAud, 30*time.Second)
+	v.now = w.now
+
+	claims, err := v.VerifyAccessToken(token, keys)
+	if err != nil {
+		t.Fatalf("VerifyAccessToken() error = %v", err)
+	}
+	if claims.UserID != user.ID {
+		t.Errorf("user id = %v, want %v", claims.UserID, user.ID)
+	}
+
+	hmacToken, _ := w.GenerateAccessToken(user, uuid.New())
+	if _, err := v.VerifyAccessToken(hmacToken, keys); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("VerifyAccessToken(HS256) error = %v, want %v", err, ErrUnknownKey)
+	}
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	forged := jwt.NewWithClaims(jwt.SigningMethodRS256, validClaims(user.ID))
+	forged.Header["kid"] = jwks.Keys[0].Kid
+	forgedToken, _ := forged.SignedString(other)
+	if _, err := v.VerifyAccessToken(forgedToken, keys); !errors.Is(err, domain.ErrInvalidSignature) {
+		t.Errorf("VerifyAccessToken(forged) error = %v, want %v", err, domain.ErrInvalidSignature)
+	}
+	if _, err := w.ValidateAccessToken(token); !errors.Is(err, domain.ErrInvalidSignature) {
+		t.Errorf("HS256 wrapper accepted an RS256 token: %v", err)
+	}
+}
+
+func TestWrapper_KeyRotation(t *testing.T) {
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := Config{
+		Issuer:                testIssuer,
+		Audience:              testAud,
+		SecretKey:             testSecret,
+		AccessTokenExpiration: time.Hour,
+		AccessKey:             oldKey,
+	}
+	before := NewWrapper(cfg)
+	before.now = func() time.Time { return testNow }
+	user := &domain.User{ID: uuid.New()}
+	oldToken, err := before.GenerateAccessToken(user, uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.AccessKey, cfg.PreviousAccessKeys = newKey, []*rsa.PublicKey{&oldKey.PublicKey}
+	rotated := NewWrapper(cfg)
+	rotated.now = before.now
+	newToken, err := rotated.GenerateAccessToken(user, uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, token := range map[string]string{"old": oldToken, "new": newToken} {
+		if _, err := rotated.ValidateAccessToken(token); err != nil {
+			t.Errorf("ValidateAccessToken(%s) error = %v", name, err)
+		}
+	}
+	jwks := rotated.JWKS()
+	if len(jwks.Keys) != 2 || jwks.Keys[0].Kid != KeyID(&newKey.PublicKey) || jwks.Keys[1].Kid != KeyID(&oldKey.PublicKey) {
+		t.Errorf("JWKS() = %+v, want the new key and then the old one", jwks.Keys)
+	}
+
+	// Once the previous key is dropped, its tokens are rejected.
+	cfg.PreviousAccessKeys = nil
+	dropped := NewWrapper(cfg)
+	dropped.now = before.now
+	if _, err := dropped.ValidateAccessToken(oldToken); !errors.Is(err, domain.ErrInvalidToken) {
+		t.Errorf("ValidateAccessToken(old) error = %v, want %v", err, domain.ErrInvalidToken)
+	}
+}
@@ -0,0 +1,102 @@
+package jwt
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// JWK is an RSA public key in the JSON Web Key format of RFC 7517.
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// ParseAccessKey reads the PEM encoded RSA private key used to sign access tokens.
+func ParseAccessKey(pem []byte) (*rsa.PrivateKey, error) {
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(pem)
+	if err != nil {
+		return nil, fmt.Errorf("parse access key: %w", err)
+	}
+	return key, nil
+}
+
+// ParseVerificationKey reads a PEM encoded RSA public key, or the public part
+// of a private key, that access tokens were signed with.
+func ParseVerificationKey(pem []byte) (*rsa.PublicKey, error) {
+	if key, err := jwt.ParseRSAPublicKeyFromPEM(pem); err == nil {
+		return key, nil
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(pem)
+	if err != nil {
+		return nil, fmt.Errorf("parse verification key: %w", err)
+	}
+	return &key.PublicKey, nil
+}
+
+// KeyID derives the kid of a public key from the hash of its DER encoding, so
+// that it changes whenever the key is rotated.
+func KeyID(pub *rsa.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		// Marshalling a valid RSA public key cannot fail.
+		panic(err)
+	}
+	sum := sha256.Sum256(der)
+	return base64.RawURLEncoding.EncodeToString(sum[:16])
+}
+
+func NewJWK(pub *rsa.PublicKey) JWK {
+	return JWK{
+		Kty: "RSA",
+		Use: "sig",
+		Alg: accessKeyMethod.Alg(),
+		Kid: KeyID(pub),
+		N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}
+}
+
+func (k JWK) PublicKey() (*rsa.PublicKey, error) {
+	if k.Kty != "RSA" || k.Alg != accessKeyMethod.Alg() {
+		return nil, fmt.Errorf("unsupported key type %s/%s", k.Kty, k.Alg)
+	}
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("decode modulus: %w", err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("decode exponent: %w", err)
+	}
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+		return nil, errors.New("invalid exponent")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
+
+// JWKS returns the public keys access tokens can be verified with, the
+// current one first and then the previous ones whose tokens may not have
+// expired yet. It is empty if access tokens are signed with a shared secret.
+func (w *Wrapper) JWKS() JWKS {
+	keys := JWKS{Keys: make([]JWK, 0, len(w.publicKeys))}
+	for _, key := range w.publicKeys {
+		keys.Keys = append(keys.Keys, NewJWK(key))
+	}
+	return keys
+}
@@ -0,0 +1,76 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+// AddAuditEvent appends the event to its hash chain, filling in Seq, PrevHash and Hash.
+func (r *Repo) AddAuditEvent(ctx context.Context, e *domain.AuditEvent) error {
+	e.CreatedAt = e.CreatedAt.Truncate(time.Microsecond)
+	return r.do(ctx, func(s *state) error {
+		e.PrevHash = ""
+		for i := len(s.audit) - 1; i >= 0; i-- {
+			if s.audit[i].ChainID == e.ChainID {
+				e.PrevHash = s.audit[i].Hash
+				break
+			}
+		}
+		e.Seq = int64(len(s.audit) + 1)
+		e.Hash = e.ComputeHash()
+		s.audit = append(s.audit, *e)
+		return nil
+	})
+}
+
+func (r *Repo) ListAuditEvents(ctx context.Context, f domain.AuditFilter) ([]domain.AuditEvent, error) {
+	var events []domain.AuditEvent
+	err := r.do(ctx, func(s *state) error {
+		for i := len(s.audit) - 1; i >= 0 && len(events) < f.Limit; i-- {
+			e := s.audit[i]
+			switch {
+			case f.UserID != nil && !sameID(e.SubjectID, *f.UserID) && !sameID(e.ActorID, *f.UserID),
+				!f.From.IsZero() && e.CreatedAt.Before(f.From),
+				!f.To.IsZero() && !e.CreatedAt.Before(f.To),
+				f.BeforeSeq != 0 && e.Seq >= f.BeforeSeq:
+				continue
+			}
+			events = append(events, e)
+		}
+		return nil
+	})
+	return events, err
+}
+
+// ScanAuditEvents returns events in chain order starting after afterSeq.
+func (r *Repo) ScanAuditEvents(ctx context.Context, afterSeq int64, limit int) ([]domain.AuditEvent, error) {
+	var events []domain.AuditEvent
+	err := r.do(ctx, func(s *state) error {
+		for _, e := range s.audit {
+			if e.Seq > afterSeq && len(events) < limit {
+				events = append(events, e)
+			}
+		}
+		return nil
+	})
+	return events, err
+}
+
+// TamperAuditEvent changes a stored event in place, as an attacker with write
+// access to the table could. It exists to test the detection of tampering.
+func (r *Repo) TamperAuditEvent(seq int64, tamper func(e *domain.AuditEvent)) error {
+	return r.do(context.Background(), func(s *state) error {
+		if seq < 1 || seq > int64(len(s.audit)) {
+			return errors.New("no such audit event")
+		}
+		tamper(&s.audit[seq-1])
+		return nil
+	})
+}
+
+func sameID[T comparable](id *T, other T) bool {
+	return id != nil && *id == other
+}
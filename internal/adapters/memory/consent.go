@@ -0,0 +1,37 @@
+package memory
+
+import (
+	"context"
+	"slices"
+
+	"github.com/google/uuid"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+func (r *Repo) AddConsents(ctx context.Context, consents []domain.Consent) error {
+	return r.do(ctx, func(s *state) error {
+		for _, c := range consents {
+			accepted := slices.ContainsFunc(s.consents, func(o domain.Consent) bool {
+				return o.UserID == c.UserID && o.Document == c.Document && o.Version == c.Version
+			})
+			if !accepted {
+				s.consents = append(s.consents, c)
+			}
+		}
+		return nil
+	})
+}
+
+func (r *Repo) ListConsents(ctx context.Context, userID uuid.UUID) ([]domain.Consent, error) {
+	var consents []domain.Consent
+	err := r.do(ctx, func(s *state) error {
+		for _, c := range s.consents {
+			if c.UserID == userID {
+				consents = append(consents, c)
+			}
+		}
+		return nil
+	})
+	return consents, err
+}
@@ -0,0 +1,75 @@
+package memory
+
+import (
+	"context"
+	"maps"
+	"slices"
+
+	"github.com/google/uuid"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+// CreateEmailChange replaces the pending email change of the user.
+func (r *Repo) CreateEmailChange(ctx context.Context, c *domain.EmailChange) error {
+	return r.do(ctx, func(s *state) error {
+		maps.DeleteFunc(s.changes, func(_ uuid.UUID, change domain.EmailChange) bool {
+			return change.UserID == c.UserID && change.ConfirmedAt == nil
+		})
+		s.changes[c.ID] = *c
+		return nil
+	})
+}
+
+func (r *Repo) GetPendingEmailChange(ctx context.Context, userID uuid.UUID) (*domain.EmailChange, error) {
+	return r.findEmailChange(ctx, domain.ErrInvalidEmailCode, func(c domain.EmailChange) bool {
+		return c.UserID == userID && c.ConfirmedAt == nil
+	})
+}
+
+func (r *Repo) GetEmailChangeByRevertToken(ctx context.Context, tokenHash string) (*domain.EmailChange, error) {
+	return r.findEmailChange(ctx, domain.ErrInvalidRevertToken, func(c domain.EmailChange) bool {
+		return c.RevertTokenHash != nil && *c.RevertTokenHash == tokenHash
+	})
+}
+
+func (r *Repo) ListEmailChanges(ctx context.Context, userID uuid.UUID) ([]domain.EmailChange, error) {
+	var changes []domain.EmailChange
+	err := r.do(ctx, func(s *state) error {
+		for _, c := range s.changes {
+			if c.UserID == userID {
+				changes = append(changes, c)
+			}
+		}
+		return nil
+	})
+	slices.SortFunc(changes, func(a, b domain.EmailChange) int { return b.CreatedAt.Compare(a.CreatedAt) })
+	return changes, err
+}
+
+func (r *Repo) findEmailChange(ctx context.Context, notFound error, match func(c domain.EmailChange) bool) (*domain.EmailChange, error) {
+	var change *domain.EmailChange
+	err := r.do(ctx, func(s *state) error {
+		for _, c := range s.changes {
+			if match(c) {
+				change = &c
+				return nil
+			}
+		}
+		return notFound
+	})
+	return change, err
+}
+
+func (r *Repo) UpdateEmailChange(ctx context.Context, c *domain.EmailChange) error {
+	return r.do(ctx, func(s *state) error {
+		change, ok := s.changes[c.ID]
+		if !ok {
+			return nil
+		}
+		change.Attempts, change.ConfirmedAt = c.Attempts, c.ConfirmedAt
+		change.RevertTokenHash, change.RevertExpiresAt, change.RevertedAt = c.RevertTokenHash, c.RevertExpiresAt, c.RevertedAt
+		s.changes[c.ID] = change
+		return nil
+	})
+}
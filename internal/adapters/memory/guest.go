@@ -0,0 +1,47 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+func (r *Repo) UpgradeGuest(ctx context.Context, u *domain.User) error {
+	return r.do(ctx, func(s *state) error {
+		guest, ok := s.users[u.ID]
+		if !ok || !guest.Guest || guest.DeletedAt != nil {
+			return domain.ErrUserNotFound
+		}
+		for _, other := range s.users {
+			if holdsEmail(other, u.EmailCanonical) {
+				return fmt.Errorf("upgrade guest: %w", domain.ErrAlreadyExists)
+			}
+		}
+		guest.Email, guest.EmailCanonical, guest.Password = u.Email, u.EmailCanonical, u.Password
+		guest.AgeAttestedAt, guest.AgePolicyVersion = u.AgeAttestedAt, u.AgePolicyVersion
+		guest.Guest = false
+		guest.TokenVersion++
+		s.users[u.ID] = guest
+		return nil
+	})
+}
+
+func (r *Repo) ExpireGuests(ctx context.Context, createdBefore, now time.Time) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := r.do(ctx, func(s *state) error {
+		for id, u := range s.users {
+			if !u.Guest || u.DeletedAt != nil || !u.CreatedAt.Before(createdBefore) {
+				continue
+			}
+			u.DeletedAt, u.PurgeAfter = &now, &now
+			s.users[id] = u
+			ids = append(ids, id)
+		}
+		return nil
+	})
+	return ids, err
+}
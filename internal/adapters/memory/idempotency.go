@@ -0,0 +1,53 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+type replyKey struct {
+	operation, key string
+}
+
+func (r *Repo) GetIdempotencyRecord(ctx context.Context, operation, key string, now time.Time) (*domain.IdempotencyRecord, error) {
+	var record domain.IdempotencyRecord
+	err := r.do(ctx, func(s *state) error {
+		rec, ok := s.replies[replyKey{operation, key}]
+		if !ok || !rec.ExpiresAt.After(now) {
+			return domain.ErrIdempotencyKeyNotFound
+		}
+		record = rec
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (r *Repo) SaveIdempotencyRecord(ctx context.Context, rec *domain.IdempotencyRecord) error {
+	return r.do(ctx, func(s *state) error {
+		k := replyKey{rec.Operation, rec.Key}
+		if existing, ok := s.replies[k]; ok && existing.ExpiresAt.After(rec.CreatedAt) {
+			return domain.ErrIdempotencyKeyReused
+		}
+		s.replies[k] = *rec
+		return nil
+	})
+}
+
+func (r *Repo) DeleteExpiredIdempotencyRecords(ctx context.Context, before time.Time) (int64, error) {
+	var deleted int64
+	err := r.do(ctx, func(s *state) error {
+		for k, rec := range s.replies {
+			if !rec.ExpiresAt.After(before) {
+				delete(s.replies, k)
+				deleted++
+			}
+		}
+		return nil
+	})
+	return deleted, err
+}
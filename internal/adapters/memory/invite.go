@@ -0,0 +1,92 @@
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+func (r *Repo) CreateInviteCode(ctx context.Context, c *domain.InviteCode) error {
+	return r.do(ctx, func(s *state) error {
+		s.invites[c.ID] = *c
+		return nil
+	})
+}
+
+func (r *Repo) UseInviteCode(ctx context.Context, codeHash string, now time.Time) (uuid.UUID, error) {
+	var id uuid.UUID
+	err := r.do(ctx, func(s *state) error {
+		for _, c := range s.invites {
+			if c.CodeHash != codeHash || c.Uses >= c.MaxUses || c.ExpiresAt != nil && !c.ExpiresAt.After(now) {
+				continue
+			}
+			c.Uses++
+			s.invites[c.ID] = c
+			id = c.ID
+			return nil
+		}
+		return domain.ErrInvalidInviteCode
+	})
+	return id, err
+}
+
+func (r *Repo) AddToWaitlist(ctx context.Context, e *domain.WaitlistEntry) (*domain.WaitlistEntry, error) {
+	var entry domain.WaitlistEntry
+	err := r.do(ctx, func(s *state) error {
+		for _, w := range s.waitlist {
+			if w.EmailCanonical == e.EmailCanonical {
+				entry = w
+				return nil
+			}
+		}
+		entry = *e
+		s.waitlist = append(s.waitlist, entry)
+		return nil
+	})
+	return &entry, err
+}
+
+func (r *Repo) GetWaitlistEntry(ctx context.Context, canonical string) (*domain.WaitlistEntry, error) {
+	var entry domain.WaitlistEntry
+	err := r.do(ctx, func(s *state) error {
+		for _, w := range s.waitlist {
+			if w.EmailCanonical == canonical {
+				entry = w
+				return nil
+			}
+		}
+		return domain.ErrWaitlistEntryNotFound
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func (r *Repo) ListWaitlist(ctx context.Context, limit int) ([]domain.WaitlistEntry, error) {
+	var entries []domain.WaitlistEntry
+	err := r.do(ctx, func(s *state) error {
+		// Entries are appended in the order they joined.
+		for _, w := range s.waitlist {
+			if w.AdmittedAt == nil && len(entries) < limit {
+				entries = append(entries, w)
+			}
+		}
+		return nil
+	})
+	return entries, err
+}
+
+func (r *Repo) AdmitWaitlistEntry(ctx context.Context, id, inviteCodeID uuid.UUID, at time.Time) error {
+	return r.do(ctx, func(s *state) error {
+		for i := range s.waitlist {
+			if s.waitlist[i].ID == id {
+				s.waitlist[i].AdmittedAt, s.waitlist[i].InviteCodeID = &at, &inviteCodeID
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,49 @@
+package memory
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+// AddLogin appends the login to the history, filling in Seq.
+func (r *Repo) AddLogin(ctx context.Context, l *domain.Login) error {
+	return r.do(ctx, func(s *state) error {
+		s.loginSeq++
+		l.Seq = s.loginSeq
+		s.logins = append(s.logins, *l)
+		return nil
+	})
+}
+
+func (r *Repo) GetLoginOrigins(ctx context.Context, userID uuid.UUID, fingerprint, country string) (domain.LoginOrigins, error) {
+	var o domain.LoginOrigins
+	err := r.do(ctx, func(s *state) error {
+		for _, l := range s.logins {
+			if l.UserID != userID {
+				continue
+			}
+			o.HasLogins = true
+			o.KnownDevice = o.KnownDevice || l.DeviceFingerprint == fingerprint
+			o.KnownCountry = o.KnownCountry || (country != "" && l.Country == country)
+		}
+		return nil
+	})
+	return o, err
+}
+
+func (r *Repo) ListLogins(ctx context.Context, f domain.LoginFilter) ([]domain.Login, error) {
+	var logins []domain.Login
+	err := r.do(ctx, func(s *state) error {
+		for i := len(s.logins) - 1; i >= 0 && len(logins) < f.Limit; i-- {
+			l := s.logins[i]
+			if l.UserID == f.UserID && (f.BeforeSeq == 0 || l.Seq < f.BeforeSeq) {
+				logins = append(logins, l)
+			}
+		}
+		return nil
+	})
+	return logins, err
+}
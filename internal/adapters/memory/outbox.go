@@ -0,0 +1,86 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+func (r *Repo) AddOutboxMessage(ctx context.Context, m *domain.OutboxMessage) error {
+	return r.do(ctx, func(s *state) error {
+		s.outbox = append(s.outbox, outboxRow{OutboxMessage: *m, nextAttemptAt: m.CreatedAt})
+		return nil
+	})
+}
+
+func (r *Repo) ClaimOutboxMessages(ctx context.Context, limit int, claimedUntil time.Time) ([]domain.OutboxMessage, error) {
+	var messages []domain.OutboxMessage
+	err := r.do(ctx, func(s *state) error {
+		now := r.now()
+		var due []int
+		unpublished := make(map[uuid.UUID]bool)
+		for i, m := range s.outbox {
+			if m.publishedAt != nil {
+				continue
+			}
+			// Only the oldest unpublished message of an aggregate is due.
+			if !unpublished[m.AggregateID] && !m.nextAttemptAt.After(now) {
+				due = append(due, i)
+			}
+			unpublished[m.AggregateID] = true
+		}
+		sort.SliceStable(due, func(i, j int) bool { return s.outbox[due[i]].CreatedAt.Before(s.outbox[due[j]].CreatedAt) })
+		if len(due) > limit {
+			due = due[:limit]
+		}
+		for _, i := range due {
+			s.outbox[i].nextAttemptAt = claimedUntil
+			messages = append(messages, s.outbox[i].OutboxMessage)
+		}
+		return nil
+	})
+	return messages, err
+}
+
+func (r *Repo) MarkOutboxMessagePublished(ctx context.Context, id uuid.UUID) error {
+	return r.updateOutboxMessage(ctx, id, func(m *outboxRow) {
+		now := r.now().UTC()
+		m.publishedAt = &now
+	})
+}
+
+func (r *Repo) MarkOutboxMessageFailed(ctx context.Context, id uuid.UUID, reason string, nextAttemptAt time.Time) error {
+	return r.updateOutboxMessage(ctx, id, func(m *outboxRow) {
+		m.Attempts++
+		m.lastError = reason
+		m.nextAttemptAt = nextAttemptAt
+	})
+}
+
+func (r *Repo) updateOutboxMessage(ctx context.Context, id uuid.UUID, update func(m *outboxRow)) error {
+	return r.do(ctx, func(s *state) error {
+		for i := range s.outbox {
+			if s.outbox[i].ID == id {
+				update(&s.outbox[i])
+			}
+		}
+		return nil
+	})
+}
+
+// OutboxMessages returns all messages in the order they were recorded,
+// published or not.
+func (r *Repo) OutboxMessages() []domain.OutboxMessage {
+	var messages []domain.OutboxMessage
+	_ = r.do(context.Background(), func(s *state) error {
+		for _, m := range s.outbox {
+			messages = append(messages, m.OutboxMessage)
+		}
+		return nil
+	})
+	return messages
+}
@@ -0,0 +1,40 @@
+package memory
+
+import (
+	"context"
+	"time"
+)
+
+type requestWindow struct {
+	start time.Time
+	count int
+}
+
+func (r *Repo) CountRequest(ctx context.Context, key string, windowStart time.Time) (int, error) {
+	var count int
+	err := r.do(ctx, func(s *state) error {
+		w := s.requests[key]
+		if !w.start.Equal(windowStart) {
+			w = requestWindow{start: windowStart}
+		}
+		w.count++
+		s.requests[key] = w
+		count = w.count
+		return nil
+	})
+	return count, err
+}
+
+func (r *Repo) DeleteRateLimits(ctx context.Context, before time.Time) (int64, error) {
+	var deleted int64
+	err := r.do(ctx, func(s *state) error {
+		for key, w := range s.requests {
+			if w.start.Before(before) {
+				delete(s.requests, key)
+				deleted++
+			}
+		}
+		return nil
+	})
+	return deleted, err
+}
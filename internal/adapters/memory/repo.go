@@ -0,0 +1,179 @@
+// Package memory implements the repositories of the application in memory.
+// It is meant for tests and local runs without Postgres.
+package memory
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+type txKey struct{}
+
+// rolePermissions mirrors the roles seeded by the migrations.
+var rolePermissions = map[string][]string{
+	domain.RoleGuest:     {"onboarding:read", "onboarding:write"},
+	domain.RoleUser:      {"matches:read", "profile:read", "profile:write"},
+	domain.RolePremium:   {"likes:see", "likes:unlimited", "profile:boost"},
+	domain.RoleModerator: {"profile:moderate", "reports:read", "reports:resolve"},
+	domain.RoleAdmin:     {"admin", "audit:read", "users:read", "users:write"},
+}
+
+type outboxRow struct {
+	domain.OutboxMessage
+	publishedAt   *time.Time
+	nextAttemptAt time.Time
+	lastError     string
+}
+
+type state struct {
+	users     map[uuid.UUID]domain.User
+	userRoles map[uuid.UUID][]string
+	sessions  map[uuid.UUID]domain.Session
+	logins    []domain.Login
+	resets    map[string]domain.PasswordReset
+	changes   map[uuid.UUID]domain.EmailChange
+	banned    map[identifierKey]domain.BannedIdentifier
+	consents  []domain.Consent
+	invites   map[uuid.UUID]domain.InviteCode
+	waitlist  []domain.WaitlistEntry
+	replies   map[replyKey]domain.IdempotencyRecord
+	requests  map[string]requestWindow
+	clients   map[string]domain.ServiceClient
+	outbox    []outboxRow
+	audit     []domain.AuditEvent
+	// loginSeq keeps increasing when logins are purged, like a Postgres sequence.
+	loginSeq int64
+}
+
+func (s state) clone() state {
+	return state{
+		users:     maps.Clone(s.users),
+		userRoles: maps.Clone(s.userRoles),
+		sessions:  maps.Clone(s.sessions),
+		logins:    slices.Clone(s.logins),
+		resets:    maps.Clone(s.resets),
+		changes:   maps.Clone(s.changes),
+		banned:    maps.Clone(s.banned),
+		consents:  slices.Clone(s.consents),
+		invites:   maps.Clone(s.invites),
+		waitlist:  slices.Clone(s.waitlist),
+		replies:   maps.Clone(s.replies),
+		requests:  maps.Clone(s.requests),
+		clients:   maps.Clone(s.clients),
+		outbox:    slices.Clone(s.outbox),
+		audit:     slices.Clone(s.audit),
+		loginSeq:  s.loginSeq,
+	}
+}
+
+// Repo implements every repository port and the transaction manager.
+// Transactions are serialized and roll back by restoring a snapshot, and
+// statements outside a transaction run as one of their own, so callers see
+// serializable isolation.
+type Repo struct {
+	txMu  sync.Mutex
+	mu    sync.Mutex
+	state state
+	now   func() time.Time
+}
+
+func NewRepo() *Repo {
+	return &Repo{
+		state: state{
+			users:     map[uuid.UUID]domain.User{},
+			userRoles: map[uuid.UUID][]string{},
+			sessions:  map[uuid.UUID]domain.Session{},
+			resets:    map[string]domain.PasswordReset{},
+			changes:   map[uuid.UUID]domain.EmailChange{},
+			banned:    map[identifierKey]domain.BannedIdentifier{},
+			invites:   map[uuid.UUID]domain.InviteCode{},
+			replies:   map[replyKey]domain.IdempotencyRecord{},
+			requests:  map[string]requestWindow{},
+			clients:   map[string]domain.ServiceClient{},
+		},
+		now: time.Now,
+	}
+}
+
+func (r *Repo) RunInTx(ctx context.Context, f func(ctx context.Context) error) (err error) {
+	if inTx(ctx) {
+		return f(ctx)
+	}
+	r.txMu.Lock()
+	defer r.txMu.Unlock()
+
+	r.mu.Lock()
+	snapshot := r.state.clone()
+	r.mu.Unlock()
+	rollback := func() {
+		r.mu.Lock()
+		r.state = snapshot
+		r.mu.Unlock()
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			rollback()
+			panic(p)
+		}
+	}()
+
+	if err := f(context.WithValue(ctx, txKey{}, true)); err != nil {
+		rollback()
+		return err
+	}
+	return nil
+}
+
+// RunInTxWithOptions runs f like RunInTx. Transactions run one at a time, so
+// they are serializable whatever the options and never need to be retried.
+func (r *Repo) RunInTxWithOptions(ctx context.Context, _ domain.TxOptions, f func(ctx context.Context) error) error {
+	return r.RunInTx(ctx, f)
+}
+
+func inTx(ctx context.Context) bool {
+	tx, _ := ctx.Value(txKey{}).(bool)
+	return tx
+}
+
+// do runs a single statement against the state.
+func (r *Repo) do(ctx context.Context, f func(s *state) error) error {
+	if !inTx(ctx) {
+		r.txMu.Lock()
+		defer r.txMu.Unlock()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return f(&r.state)
+}
+
+// AddServiceClient registers a service client, which is done by operators in SQL
+// for the Postgres repository.
+func (r *Repo) AddServiceClient(c domain.ServiceClient) {
+	_ = r.do(context.Background(), func(s *state) error {
+		s.clients[c.ID] = c
+		return nil
+	})
+}
+
+func (r *Repo) GetServiceClient(ctx context.Context, id string) (*domain.ServiceClient, error) {
+	var client domain.ServiceClient
+	err := r.do(ctx, func(s *state) error {
+		c, ok := s.clients[id]
+		if !ok {
+			return domain.ErrClientNotFound
+		}
+		client = c
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
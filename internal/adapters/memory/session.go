@@ -0,0 +1,85 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+func (r *Repo) CreateSession(ctx context.Context, session *domain.Session) error {
+	return r.do(ctx, func(s *state) error {
+		if _, ok := s.sessions[session.ID]; ok {
+			return errors.New("create session: duplicate id")
+		}
+		s.sessions[session.ID] = *session
+		return nil
+	})
+}
+
+func (r *Repo) GetSession(ctx context.Context, id uuid.UUID) (*domain.Session, error) {
+	var session domain.Session
+	err := r.do(ctx, func(s *state) error {
+		var ok bool
+		if session, ok = s.sessions[id]; !ok {
+			return domain.ErrSessionNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *Repo) ListUserSessions(ctx context.Context, userID uuid.UUID) ([]domain.Session, error) {
+	var sessions []domain.Session
+	err := r.do(ctx, func(s *state) error {
+		for _, session := range s.sessions {
+			if session.UserID == userID {
+				sessions = append(sessions, session)
+			}
+		}
+		return nil
+	})
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].CreatedAt.After(sessions[j].CreatedAt) })
+	return sessions, err
+}
+
+// RotateSession replaces the refresh token hash only if the session still holds oldHash.
+func (r *Repo) RotateSession(ctx context.Context, id uuid.UUID, oldHash, newHash string, usedAt, expiresAt time.Time) error {
+	return r.do(ctx, func(s *state) error {
+		session, ok := s.sessions[id]
+		if !ok || session.RefreshTokenHash != oldHash || session.RevokedAt != nil {
+			return domain.ErrRefreshTokenReused
+		}
+		session.RefreshTokenHash, session.LastUsedAt, session.ExpiresAt = newHash, usedAt, expiresAt
+		s.sessions[id] = session
+		return nil
+	})
+}
+
+func (r *Repo) RevokeSession(ctx context.Context, id uuid.UUID) error {
+	return r.revokeSessions(ctx, func(session domain.Session) bool { return session.ID == id })
+}
+
+func (r *Repo) RevokeUserSessions(ctx context.Context, userID uuid.UUID) error {
+	return r.revokeSessions(ctx, func(session domain.Session) bool { return session.UserID == userID })
+}
+
+func (r *Repo) revokeSessions(ctx context.Context, match func(session domain.Session) bool) error {
+	return r.do(ctx, func(s *state) error {
+		now := r.now().UTC()
+		for id, session := range s.sessions {
+			if match(session) && session.RevokedAt == nil {
+				session.RevokedAt = &now
+				s.sessions[id] = session
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,71 @@
+package memory
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+type identifierKey struct {
+	kind, value string
+}
+
+func (r *Repo) SetUserStatus(ctx context.Context, id uuid.UUID, change domain.StatusChange) error {
+	return r.updateUser(ctx, id, func(u *domain.User) error {
+		at := change.At
+		u.Status, u.StatusReason, u.StatusActorID = change.Status, change.Reason, change.ActorID
+		u.StatusChangedAt, u.StatusUntil = &at, change.Until
+		return nil
+	})
+}
+
+func (r *Repo) AddBannedIdentifier(ctx context.Context, b *domain.BannedIdentifier) error {
+	return r.do(ctx, func(s *state) error {
+		s.banned[identifierKey{b.Kind, b.Value}] = *b
+		return nil
+	})
+}
+
+func (r *Repo) ListBannedIdentifiers(ctx context.Context, userID uuid.UUID) ([]domain.BannedIdentifier, error) {
+	var banned []domain.BannedIdentifier
+	err := r.do(ctx, func(s *state) error {
+		for _, b := range s.banned {
+			if b.UserID == userID {
+				banned = append(banned, b)
+			}
+		}
+		return nil
+	})
+	slices.SortFunc(banned, func(a, b domain.BannedIdentifier) int {
+		if c := strings.Compare(a.Kind, b.Kind); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Value, b.Value)
+	})
+	return banned, err
+}
+
+func (r *Repo) DeleteBannedIdentifiers(ctx context.Context, userID uuid.UUID) error {
+	return r.do(ctx, func(s *state) error {
+		maps.DeleteFunc(s.banned, func(_ identifierKey, b domain.BannedIdentifier) bool {
+			return b.UserID == userID
+		})
+		return nil
+	})
+}
+
+func (r *Repo) IsIdentifierBanned(ctx context.Context, kind, value string, now time.Time) (bool, error) {
+	var banned bool
+	err := r.do(ctx, func(s *state) error {
+		b, ok := s.banned[identifierKey{kind, value}]
+		banned = ok && (b.ExpiresAt == nil || b.ExpiresAt.After(now))
+		return nil
+	})
+	return banned, err
+}
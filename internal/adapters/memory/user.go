@@ -0,0 +1,308 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+func (r *Repo) CreateUser(ctx context.Context, p *domain.User) (uuid.UUID, error) {
+	err := r.do(ctx, func(s *state) error {
+		for _, u := range s.users {
+			if !p.Guest && holdsEmail(u, p.EmailCanonical) {
+				return fmt.Errorf("create user: %w", domain.ErrAlreadyExists)
+			}
+		}
+		if _, ok := s.users[p.ID]; ok {
+			return fmt.Errorf("create user: duplicate id %s", p.ID)
+		}
+		s.users[p.ID] = domain.User{
+			ID:               p.ID,
+			Email:            p.Email,
+			EmailCanonical:   p.EmailCanonical,
+			Password:         p.Password,
+			Status:           domain.StatusActive,
+			CreatedAt:        r.now().UTC(),
+			AgeAttestedAt:    p.AgeAttestedAt,
+			AgePolicyVersion: p.AgePolicyVersion,
+			Guest:            p.Guest,
+		}
+		return nil
+	})
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	return p.ID, nil
+}
+
+// holdsEmail tells whether u keeps others from using the address, like
+// users_email_canonical_idx: guests and deleted users don't.
+func holdsEmail(u domain.User, canonical string) bool {
+	return !u.Guest && u.DeletedAt == nil && u.EmailCanonical == canonical
+}
+
+func (s *state) emailHeld(canonical string) bool {
+	for _, u := range s.users {
+		if holdsEmail(u, canonical) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Repo) GetUserByEmail(ctx context.Context, canonical string) (*domain.User, error) {
+	return r.findUser(ctx, func(u domain.User) bool {
+		return u.EmailCanonical == canonical && u.DeletedAt == nil
+	})
+}
+
+func (r *Repo) GetUserByID(ctx context.Context, id uuid.UUID) (*domain.User, error) {
+	return r.findUser(ctx, func(u domain.User) bool {
+		return u.ID == id && u.DeletedAt == nil
+	})
+}
+
+func (r *Repo) GetAnyUserByID(ctx context.Context, id uuid.UUID) (*domain.User, error) {
+	return r.findUser(ctx, func(u domain.User) bool {
+		return u.ID == id
+	})
+}
+
+func (r *Repo) findUser(ctx context.Context, match func(u domain.User) bool) (*domain.User, error) {
+	var user *domain.User
+	err := r.do(ctx, func(s *state) error {
+		for _, u := range s.users {
+			if match(u) {
+				user = &u
+				return nil
+			}
+		}
+		return domain.ErrUserNotFound
+	})
+	return user, err
+}
+
+func (r *Repo) SearchUsers(ctx context.Context, search domain.UserSearch) ([]domain.User, error) {
+	var users []domain.User
+	err := r.do(ctx, func(s *state) error {
+		for _, u := range s.users {
+			if strings.HasPrefix(u.EmailCanonical, search.EmailPrefix) && search.After.Before(u) {
+				users = append(users, u)
+			}
+		}
+		return nil
+	})
+	sort.Slice(users, func(i, j int) bool {
+		return domain.UserCursor{EmailCanonical: users[i].EmailCanonical, ID: users[i].ID}.Before(users[j])
+	})
+	if len(users) > search.Limit {
+		users = users[:search.Limit]
+	}
+	return users, err
+}
+
+func (r *Repo) SoftDeleteUser(ctx context.Context, id uuid.UUID, deletedAt, purgeAfter time.Time) error {
+	return r.updateUser(ctx, id, func(u *domain.User) error {
+		if u.DeletedAt != nil {
+			return domain.ErrUserNotFound
+		}
+		u.DeletedAt, u.PurgeAfter = &deletedAt, &purgeAfter
+		return nil
+	})
+}
+
+// PurgeUsers removes the users and, like the cascading foreign keys, all their
+// rows. Their audit events are kept, without their addresses and user agents.
+func (r *Repo) PurgeUsers(ctx context.Context, before time.Time) (int64, error) {
+	var purged int64
+	err := r.do(ctx, func(s *state) error {
+		for id, u := range s.users {
+			if u.PurgeAfter == nil || u.PurgeAfter.After(before) {
+				continue
+			}
+			delete(s.users, id)
+			if !s.emailHeld(u.EmailCanonical) {
+				s.waitlist = slices.DeleteFunc(s.waitlist, func(w domain.WaitlistEntry) bool {
+					return w.EmailCanonical == u.EmailCanonical
+				})
+			}
+			delete(s.userRoles, id)
+			maps.DeleteFunc(s.sessions, func(_ uuid.UUID, session domain.Session) bool {
+				return session.UserID == id
+			})
+			maps.DeleteFunc(s.resets, func(_ string, reset domain.PasswordReset) bool {
+				return reset.UserID == id
+			})
+			maps.DeleteFunc(s.changes, func(_ uuid.UUID, change domain.EmailChange) bool {
+				return change.UserID == id
+			})
+			maps.DeleteFunc(s.replies, func(_ replyKey, rec domain.IdempotencyRecord) bool {
+				return rec.UserID == id
+			})
+			s.consents = slices.DeleteFunc(s.consents, func(c domain.Consent) bool {
+				return c.UserID == id
+			})
+			s.logins = slices.DeleteFunc(s.logins, func(l domain.Login) bool {
+				return l.UserID == id
+			})
+			s.outbox = slices.DeleteFunc(s.outbox, func(m outboxRow) bool {
+				return m.publishedAt != nil && m.AggregateID == id
+			})
+			for i, e := range s.audit {
+				if sameID(e.SubjectID, id) || sameID(e.ActorID, id) {
+					s.audit[i].IP, s.audit[i].UserAgent = "", ""
+				}
+			}
+			purged++
+		}
+		return nil
+	})
+	return purged, err
+}
+
+func (r *Repo) SetUserDisabled(ctx context.Context, id uuid.UUID, disabledAt *time.Time) error {
+	return r.updateUser(ctx, id, func(u *domain.User) error {
+		u.DisabledAt = disabledAt
+		return nil
+	})
+}
+
+func (r *Repo) RequirePasswordReset(ctx context.Context, id uuid.UUID) error {
+	return r.updateUser(ctx, id, func(u *domain.User) error {
+		u.PasswordResetRequired = true
+		return nil
+	})
+}
+
+func (r *Repo) UpdatePassword(ctx context.Context, id uuid.UUID, password string) error {
+	return r.updateUser(ctx, id, func(u *domain.User) error {
+		u.Password = password
+		u.PasswordResetRequired = false
+		return nil
+	})
+}
+
+// UpdateEmail changes the email of the user and bumps their token version.
+func (r *Repo) BumpTokenVersion(ctx context.Context, id uuid.UUID) error {
+	return r.updateUser(ctx, id, func(u *domain.User) error {
+		u.TokenVersion++
+		return nil
+	})
+}
+
+func (r *Repo) UpdateEmail(ctx context.Context, id uuid.UUID, email, canonical string) error {
+	return r.do(ctx, func(s *state) error {
+		u, ok := s.users[id]
+		if !ok {
+			return domain.ErrUserNotFound
+		}
+		for _, other := range s.users {
+			if other.ID != id && holdsEmail(other, canonical) {
+				return fmt.Errorf("update email: %w", domain.ErrAlreadyExists)
+			}
+		}
+		now := r.now().UTC()
+		u.Email, u.EmailCanonical, u.EmailVerifiedAt = email, canonical, &now
+		u.TokenVersion++
+		s.users[id] = u
+		return nil
+	})
+}
+
+func (r *Repo) updateUser(ctx context.Context, id uuid.UUID, update func(u *domain.User) error) error {
+	return r.do(ctx, func(s *state) error {
+		u, ok := s.users[id]
+		if !ok {
+			return domain.ErrUserNotFound
+		}
+		if err := update(&u); err != nil {
+			return err
+		}
+		s.users[id] = u
+		return nil
+	})
+}
+
+func (r *Repo) GetUserRoles(ctx context.Context, id uuid.UUID) ([]string, error) {
+	var roles []string
+	err := r.do(ctx, func(s *state) error {
+		roles = slices.Clone(s.userRoles[id])
+		return nil
+	})
+	return roles, err
+}
+
+func (r *Repo) SetUserRoles(ctx context.Context, id uuid.UUID, roles []string) error {
+	for _, role := range roles {
+		if _, ok := rolePermissions[role]; !ok {
+			return fmt.Errorf("add user roles: %w", domain.ErrUnknownRole)
+		}
+	}
+	return r.do(ctx, func(s *state) error {
+		roles = slices.Clone(roles)
+		slices.Sort(roles)
+		s.userRoles[id] = slices.Compact(roles)
+		return nil
+	})
+}
+
+func (r *Repo) GetUserPermissions(ctx context.Context, id uuid.UUID) ([]string, error) {
+	var permissions []string
+	err := r.do(ctx, func(s *state) error {
+		for _, role := range s.userRoles[id] {
+			permissions = append(permissions, rolePermissions[role]...)
+		}
+		return nil
+	})
+	slices.Sort(permissions)
+	return slices.Compact(permissions), err
+}
+
+func (r *Repo) CreatePasswordReset(ctx context.Context, p *domain.PasswordReset) error {
+	return r.do(ctx, func(s *state) error {
+		if _, ok := s.resets[p.TokenHash]; ok {
+			return errors.New("create password reset: duplicate token")
+		}
+		s.resets[p.TokenHash] = domain.PasswordReset{
+			TokenHash: p.TokenHash,
+			UserID:    p.UserID,
+			CreatedAt: p.CreatedAt,
+			ExpiresAt: p.ExpiresAt,
+		}
+		return nil
+	})
+}
+
+func (r *Repo) GetPasswordReset(ctx context.Context, tokenHash string) (*domain.PasswordReset, error) {
+	var reset domain.PasswordReset
+	err := r.do(ctx, func(s *state) error {
+		var ok bool
+		if reset, ok = s.resets[tokenHash]; !ok {
+			return domain.ErrInvalidResetToken
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &reset, nil
+}
+
+func (r *Repo) UsePasswordReset(ctx context.Context, tokenHash string, usedAt time.Time) error {
+	return r.do(ctx, func(s *state) error {
+		if reset, ok := s.resets[tokenHash]; ok {
+			reset.UsedAt = &usedAt
+			s.resets[tokenHash] = reset
+		}
+		return nil
+	})
+}
@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "auth"
+
+type Prometheus struct {
+	signUps               prometheus.Counter
+	loginSuccesses        prometheus.Counter
+	loginFailures         *prometheus.CounterVec
+	refreshReuses         prometheus.Counter
+	tokenValidationErrors *prometheus.CounterVec
+	passwordHashing       prometheus.Histogram
+}
+
+func NewPrometheus(reg prometheus.Registerer) *Prometheus {
+	p := &Prometheus{
+		signUps: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "signups_total",
+			Help:      "Number of successful sign-ups.",
+		}),
+		loginSuccesses: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "login_successes_total",
+			Help:      "Number of successful logins.",
+		}),
+		loginFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "login_failures_total",
+			Help:      "Number of failed logins by reason.",
+		}, []string{"reason"}),
+		refreshReuses: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "refresh_reuse_detections_total",
+			Help:      "Number of refresh tokens presented after they had already been rotated.",
+		}),
+		tokenValidationErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "token_validation_failures_total",
+			Help:      "Number of rejected tokens by reason.",
+		}, []string{"reason"}),
+		passwordHashing: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "password_hashing_duration_seconds",
+			Help:      "Time spent hashing and comparing passwords.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 2, 12),
+		}),
+	}
+	reg.MustRegister(
+		p.signUps,
+		p.loginSuccesses,
+		p.loginFailures,
+		p.refreshReuses,
+		p.tokenValidationErrors,
+		p.passwordHashing,
+	)
+	return p
+}
+
+func (p *Prometheus) SignUp() {
+	p.signUps.Inc()
+}
+
+func (p *Prometheus) LoginSucceeded() {
+	p.loginSuccesses.Inc()
+}
+
+func (p *Prometheus) LoginFailed(reason string) {
+	p.loginFailures.WithLabelValues(reason).Inc()
+}
+
+func (p *Prometheus) RefreshReuseDetected() {
+	p.refreshReuses.Inc()
+}
+
+func (p *Prometheus) TokenValidationFailed(reason string) {
+	p.tokenValidationErrors.WithLabelValues(reason).Inc()
+}
+
+func (p *Prometheus) ObservePasswordHashing(d time.Duration) {
+	p.passwordHashing.Observe(d.Seconds())
+}
@@ -0,0 +1,57 @@
+package metrics_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/soulmate-dating/auth/internal/adapters/metrics"
+)
+
+func TestPrometheus(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	p := metrics.NewPrometheus(reg)
+
+	p.SignUp()
+	p.LoginSucceeded()
+	p.LoginSucceeded()
+	p.LoginFailed("wrong_password")
+	p.RefreshReuseDetected()
+	p.TokenValidationFailed("expired")
+	p.TokenValidationFailed("expired")
+	p.ObservePasswordHashing(10 * time.Millisecond)
+
+	want := `
+# HELP auth_signups_total Number of successful sign-ups.
+# TYPE auth_signups_total counter
+auth_signups_total 1
+# HELP auth_login_successes_total Number of successful logins.
+# TYPE auth_login_successes_total counter
+auth_login_successes_total 2
+# HELP auth_login_failures_total Number of failed logins by reason.
+# TYPE auth_login_failures_total counter
+auth_login_failures_total{reason="wrong_password"} 1
+# HELP auth_refresh_reuse_detections_total Number of refresh tokens presented after they had already been rotated.
+# TYPE auth_refresh_reuse_detections_total counter
+auth_refresh_reuse_detections_total 1
+# HELP auth_token_validation_failures_total Number of rejected tokens by reason.
+# TYPE auth_token_validation_failures_total counter
+auth_token_validation_failures_total{reason="expired"} 2
+`
+	names := []string{
+		"auth_signups_total",
+		"auth_login_successes_total",
+		"auth_login_failures_total",
+		"auth_refresh_reuse_detections_total",
+		"auth_token_validation_failures_total",
+	}
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want), names...); err != nil {
+		t.Error(err)
+	}
+	if n, err := testutil.GatherAndCount(reg, "auth_password_hashing_duration_seconds"); err != nil || n != 1 {
+		t.Errorf("password hashing histogram has %d series (err %v), want 1", n, err)
+	}
+}
@@ -0,0 +1,118 @@
+// Package notifier delivers security alerts, codes and tokens to users through
+// a notification service.
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+// Log only logs the alerts, for deployments without a notification service.
+type Log struct{}
+
+func (Log) NotifyNewDeviceLogin(ctx context.Context, e domain.NewDeviceLogin) error {
+	slog.InfoContext(ctx, "new device login alert",
+		slog.String("user_id", e.UserID.String()), slog.String("country", e.Country))
+	return nil
+}
+
+// SendSecret only logs that the secret was not delivered, as the secret itself
+// must never be logged.
+func (Log) SendSecret(ctx context.Context, m domain.SecretMessage) error {
+	slog.WarnContext(ctx, "secret not delivered without a notification service",
+		slog.String("kind", m.Kind), slog.String("user_id", m.UserID.String()), slog.String("entry_id", m.EntryID.String()))
+	return nil
+}
+
+// Webhook posts the alerts as JSON to the notification service.
+type Webhook struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhook(url string, timeout time.Duration) *Webhook {
+	return &Webhook{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+type alert struct {
+	Type      string    `json:"type"`
+	UserID    uuid.UUID `json:"user_id"`
+	Email     string    `json:"email"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Country   string    `json:"country,omitempty"`
+	City      string    `json:"city,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+func (w *Webhook) NotifyNewDeviceLogin(ctx context.Context, e domain.NewDeviceLogin) error {
+	return w.post(ctx, e.EventType(), alert{
+		Type:      e.EventType(),
+		UserID:    e.UserID,
+		Email:     e.Email,
+		IP:        e.IP,
+		UserAgent: e.UserAgent,
+		Country:   e.Country,
+		City:      e.City,
+		At:        e.At,
+	})
+}
+
+type secret struct {
+	Type      string     `json:"type"`
+	UserID    *uuid.UUID `json:"user_id,omitempty"`
+	EntryID   *uuid.UUID `json:"entry_id,omitempty"`
+	Email     string     `json:"email"`
+	Secret    string     `json:"secret"`
+	ExpiresAt time.Time  `json:"expires_at"`
+}
+
+func (w *Webhook) SendSecret(ctx context.Context, m domain.SecretMessage) error {
+	return w.post(ctx, m.Kind, secret{
+		Type:      m.Kind,
+		UserID:    optionalID(m.UserID),
+		EntryID:   optionalID(m.EntryID),
+		Email:     m.Email,
+		Secret:    m.Secret,
+		ExpiresAt: m.ExpiresAt,
+	})
+}
+
+func optionalID(id uuid.UUID) *uuid.UUID {
+	if id == uuid.Nil {
+		return nil
+	}
+	return &id
+}
+
+func (w *Webhook) post(ctx context.Context, typ string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("encode %s notification: %w", typ, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create %s notification request: %w", typ, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("send %s notification: %w", typ, err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("send %s notification: notification service responded %s", typ, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+func newDeviceLogin() domain.NewDeviceLogin {
+	return domain.NewDeviceLogin{
+		UserID:    uuid.MustParse("0b6c9a52-3f0e-4f4e-9d8a-2b1c3d4e5f60"),
+		Email:     "user@example.com",
+		IP:        "198.51.100.1",
+		UserAgent: "Glimpse/2.1 (iPad)",
+		Country:   "DE",
+		City:      "Berlin",
+		At:        time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestWebhook_NotifyNewDeviceLogin(t *testing.T) {
+	var got alert
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("got %s with content type %q, want a JSON POST", r.Method, r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	e := newDeviceLogin()
+	if err := NewWebhook(srv.URL, time.Second).NotifyNewDeviceLogin(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+	want := alert{
+		Type:      domain.EventNewDeviceLogin,
+		UserID:    e.UserID,
+		Email:     e.Email,
+		IP:        e.IP,
+		UserAgent: e.UserAgent,
+		Country:   e.Country,
+		City:      e.City,
+		At:        e.At,
+	}
+	if got != want {
+		t.Errorf("posted %+v, want %+v", got, want)
+	}
+}
+
+func TestWebhook_NotifyNewDeviceLoginFails(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		timeout time.Duration
+	}{
+		{
+			name:    "error status",
+			handler: func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusServiceUnavailable) },
+			timeout: time.Second,
+		},
+		{
+			name:    "multiple choices",
+			handler: func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusMultipleChoices) },
+			timeout: time.Second,
+		},
+		{
+			name: "timeout",
+			// The server only notices the client gave up once the body was read.
+			handler: func(_ http.ResponseWriter, r *http.Request) {
+				_, _ = io.Copy(io.Discard, r.Body)
+				<-r.Context().Done()
+			},
+			timeout: 50 * time.Millisecond,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(tt.handler)
+			defer srv.Close()
+			if err := NewWebhook(srv.URL, tt.timeout).NotifyNewDeviceLogin(context.Background(), newDeviceLogin()); err == nil {
+				t.Error("NotifyNewDeviceLogin() succeeded")
+			}
+		})
+	}
+}
+
+func TestWebhook_SendSecret(t *testing.T) {
+	var got secret
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer srv.Close()
+
+	userID := uuid.MustParse("0b6c9a52-3f0e-4f4e-9d8a-2b1c3d4e5f60")
+	m := domain.SecretMessage{
+		Kind:      domain.SecretEmailChangeCode,
+		UserID:    userID,
+		Email:     "new@example.com",
+		Secret:    "123456",
+		ExpiresAt: time.Date(2024, time.March, 1, 12, 15, 0, 0, time.UTC),
+	}
+	if err := NewWebhook(srv.URL, time.Second).SendSecret(context.Background(), m); err != nil {
+		t.Fatal(err)
+	}
+	if got.Type != m.Kind || got.UserID == nil || *got.UserID != userID || got.EntryID != nil ||
+		got.Email != m.Email || got.Secret != m.Secret || !got.ExpiresAt.Equal(m.ExpiresAt) {
+		t.Errorf("posted %+v, want %+v", got, m)
+	}
+
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	if err := NewWebhook(srv.URL, time.Second).SendSecret(context.Background(), m); err == nil {
+		t.Error("SendSecret() succeeded")
+	}
+}
+
+func TestLog(t *testing.T) {
+	if err := (Log{}).NotifyNewDeviceLogin(context.Background(), newDeviceLogin()); err != nil {
+		t.Fatal(err)
+	}
+	if err := (Log{}).SendSecret(context.Background(), domain.SecretMessage{Kind: domain.SecretEmailChangeCode}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,70 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+// AddAuditEvent appends the event to its hash chain, filling in Seq, PrevHash and Hash.
+func (r *Repo) AddAuditEvent(ctx context.Context, e *domain.AuditEvent) error {
+	e.CreatedAt = e.CreatedAt.Truncate(time.Microsecond)
+	return r.pool.RunInTx(ctx, func(ctx context.Context) error {
+		conn := r.pool.GetTx(ctx)
+		if _, err := conn.Exec(ctx, lockAuditChainQuery, e.ChainID); err != nil {
+			return fmt.Errorf("lock audit chain: %w", err)
+		}
+		err := conn.QueryRow(ctx, lastAuditHashQuery, e.ChainID).Scan(&e.PrevHash)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("get last audit hash: %w", err)
+		}
+		e.Hash = e.ComputeHash()
+		err = conn.QueryRow(ctx, createAuditEventQuery,
+			e.ID, e.ChainID, e.ActorID, e.SubjectID, e.Action, e.Outcome, e.IP, e.UserAgent, e.Details, e.CreatedAt,
+			e.PrevHash, e.Hash,
+		).Scan(&e.Seq)
+		if err != nil {
+			return fmt.Errorf("create audit event: %w", err)
+		}
+		return nil
+	})
+}
+
+func (r *Repo) ListAuditEvents(ctx context.Context, f domain.AuditFilter) ([]domain.AuditEvent, error) {
+	rows, err := r.pool.GetTx(ctx).Query(ctx, listAuditEventsQuery,
+		f.UserID, nullableTime(f.From), nullableTime(f.To), f.BeforeSeq, f.Limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list audit events: %w", err)
+	}
+	return r.collectAuditEvents(rows)
+}
+
+// ScanAuditEvents returns events in chain order starting after afterSeq.
+func (r *Repo) ScanAuditEvents(ctx context.Context, afterSeq int64, limit int) ([]domain.AuditEvent, error) {
+	rows, err := r.pool.GetTx(ctx).Query(ctx, scanAuditEventsQuery, afterSeq, limit)
+	if err != nil {
+		return nil, fmt.Errorf("scan audit events: %w", err)
+	}
+	return r.collectAuditEvents(rows)
+}
+
+func (r *Repo) collectAuditEvents(rows pgx.Rows) ([]domain.AuditEvent, error) {
+	events, err := pgx.CollectRows(rows, pgx.RowToStructByName[domain.AuditEvent])
+	if err != nil {
+		return nil, fmt.Errorf("map audit events: %w", err)
+	}
+	return events, nil
+}
+
+func nullableTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,33 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+func (r *Repo) AddConsents(ctx context.Context, consents []domain.Consent) error {
+	conn := r.pool.GetTx(ctx)
+	for _, c := range consents {
+		if _, err := conn.Exec(ctx, addConsentQuery, c.UserID, c.Document, c.Version, c.AcceptedAt, c.IP); err != nil {
+			return translateError("add consent", err)
+		}
+	}
+	return nil
+}
+
+func (r *Repo) ListConsents(ctx context.Context, userID uuid.UUID) ([]domain.Consent, error) {
+	rows, err := r.pool.GetTx(ctx).Query(ctx, listConsentsQuery, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list consents: %w", err)
+	}
+	consents, err := pgx.CollectRows(rows, pgx.RowToStructByName[domain.Consent])
+	if err != nil {
+		return nil, fmt.Errorf("map consents: %w", err)
+	}
+	return consents, nil
+}
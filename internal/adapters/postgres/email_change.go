@@ -0,0 +1,83 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+// UpdateEmail changes the email of the user to a verified one and bumps their token version.
+func (r *Repo) UpdateEmail(ctx context.Context, id uuid.UUID, email, canonical string) error {
+	return r.execForUser(ctx, "update email", updateEmailQuery, id, email, canonical)
+}
+
+// CreateEmailChange replaces the pending email change of the user, so it must
+// run inside a transaction.
+func (r *Repo) CreateEmailChange(ctx context.Context, c *domain.EmailChange) error {
+	conn := r.pool.GetTx(ctx)
+	if _, err := conn.Exec(ctx, deletePendingEmailChangeQuery, c.UserID); err != nil {
+		return fmt.Errorf("delete pending email change: %w", err)
+	}
+	_, err := conn.Exec(ctx, createEmailChangeQuery, c.ID, c.UserID, c.OldEmail, c.NewEmail,
+		c.NewEmailCanonical, c.CodeHash, c.CreatedAt, c.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("create email change: %w", err)
+	}
+	return nil
+}
+
+// GetPendingEmailChange locks the unconfirmed email change of the user, so it
+// must run inside a transaction.
+func (r *Repo) GetPendingEmailChange(ctx context.Context, userID uuid.UUID) (*domain.EmailChange, error) {
+	rows, err := r.pool.GetTx(ctx).Query(ctx, getPendingEmailChangeQuery, userID)
+	if err != nil {
+		return nil, fmt.Errorf("get pending email change: %w", err)
+	}
+	return collectEmailChange(rows, domain.ErrInvalidEmailCode)
+}
+
+// GetEmailChangeByRevertToken locks the email change, so it must run inside a transaction.
+func (r *Repo) GetEmailChangeByRevertToken(ctx context.Context, tokenHash string) (*domain.EmailChange, error) {
+	rows, err := r.pool.GetTx(ctx).Query(ctx, getEmailChangeByRevertTokenQuery, tokenHash)
+	if err != nil {
+		return nil, fmt.Errorf("get email change by revert token: %w", err)
+	}
+	return collectEmailChange(rows, domain.ErrInvalidRevertToken)
+}
+
+func (r *Repo) UpdateEmailChange(ctx context.Context, c *domain.EmailChange) error {
+	_, err := r.pool.GetTx(ctx).Exec(ctx, updateEmailChangeQuery, c.ID, c.Attempts, c.ConfirmedAt,
+		c.RevertTokenHash, c.RevertExpiresAt, c.RevertedAt)
+	if err != nil {
+		return fmt.Errorf("update email change: %w", err)
+	}
+	return nil
+}
+
+func (r *Repo) ListEmailChanges(ctx context.Context, userID uuid.UUID) ([]domain.EmailChange, error) {
+	rows, err := r.pool.GetTx(ctx).Query(ctx, listEmailChangesQuery, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list email changes: %w", err)
+	}
+	changes, err := pgx.CollectRows(rows, pgx.RowToStructByName[domain.EmailChange])
+	if err != nil {
+		return nil, fmt.Errorf("map email changes: %w", err)
+	}
+	return changes, nil
+}
+
+func collectEmailChange(rows pgx.Rows, notFound error) (*domain.EmailChange, error) {
+	change, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[domain.EmailChange])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, notFound
+		}
+		return nil, fmt.Errorf("map email change: %w", err)
+	}
+	return &change, nil
+}
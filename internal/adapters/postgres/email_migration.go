@@ -0,0 +1,125 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+const (
+	prepareCanonicalEmailsQuery = `ALTER TABLE auth.users ADD COLUMN IF NOT EXISTS email_canonical TEXT;
+							ALTER TABLE auth.users DROP CONSTRAINT IF EXISTS users_email_key;
+							DROP INDEX IF EXISTS auth.users_email_canonical_idx`
+	// Guests have no email to canonicalize.
+	listUserEmailsQuery        = `SELECT id, email, deleted_at IS NOT NULL AS deleted FROM auth.users WHERE NOT guest ORDER BY created_at, id`
+	setCanonicalEmailQuery     = `UPDATE auth.users SET email_canonical = $2 WHERE id = $1`
+	finishCanonicalEmailsQuery = `ALTER TABLE auth.users ALTER COLUMN email_canonical SET NOT NULL;
+							CREATE UNIQUE INDEX users_email_canonical_idx ON auth.users (email_canonical) WHERE NOT guest AND deleted_at IS NULL`
+)
+
+// EmailConflict is an account whose canonical email is already taken by an
+// older account. Support has to resolve it, e.g. by changing or deleting one
+// of the accounts, before the migration can be applied.
+type EmailConflict struct {
+	ID        uuid.UUID `json:"id"`
+	Email     string    `json:"email"`
+	Canonical string    `json:"canonical"`
+	KeptBy    uuid.UUID `json:"kept_by"`
+}
+
+// ErrEmailConflicts is returned along with the conflicts that stopped the migration.
+var ErrEmailConflicts = errors.New("accounts share a canonical email")
+
+var errDryRun = errors.New("dry run")
+
+// MigrateCanonicalEmails computes the canonical email of every user and
+// replaces the case-sensitive unique constraint on email with a unique index on
+// it. Deleted accounts don't hold their email, so only active accounts
+// sharing a canonical email conflict. If any do, nothing is changed and the
+// conflicts are returned with ErrEmailConflicts. It is safe to rerun, e.g.
+// after resolving the conflicts or changing providerRules. With dryRun the
+// changes are rolled back and only the conflicts are reported.
+func (r *Repo) MigrateCanonicalEmails(ctx context.Context, providerRules, dryRun bool) ([]EmailConflict, error) {
+	var conflicts []EmailConflict
+	err := r.pool.RunInTx(ctx, func(ctx context.Context) error {
+		conn := r.pool.GetTx(ctx)
+		if _, err := conn.Exec(ctx, prepareCanonicalEmailsQuery); err != nil {
+			return fmt.Errorf("prepare users: %w", err)
+		}
+		rows, err := conn.Query(ctx, listUserEmailsQuery)
+		if err != nil {
+			return fmt.Errorf("list users: %w", err)
+		}
+		users, err := pgx.CollectRows(rows, pgx.RowToStructByName[userEmail])
+		if err != nil {
+			return fmt.Errorf("map users: %w", err)
+		}
+		if err := canonicalizeEmails(users, providerRules); err != nil {
+			return err
+		}
+		if conflicts = emailConflicts(users); len(conflicts) > 0 {
+			return ErrEmailConflicts
+		}
+		for _, u := range users {
+			if _, err := conn.Exec(ctx, setCanonicalEmailQuery, u.ID, u.Canonical); err != nil {
+				return fmt.Errorf("set canonical email of user %s: %w", u.ID, err)
+			}
+		}
+
+		if _, err := conn.Exec(ctx, finishCanonicalEmailsQuery); err != nil {
+			return fmt.Errorf("index canonical emails: %w", err)
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, ErrEmailConflicts):
+		return conflicts, err
+	case err != nil && !errors.Is(err, errDryRun):
+		return nil, err
+	}
+	return conflicts, nil
+}
+
+type userEmail struct {
+	ID        uuid.UUID `db:"id"`
+	Email     string    `db:"email"`
+	Deleted   bool      `db:"deleted"`
+	Canonical string    `db:"-"`
+}
+
+func canonicalizeEmails(users []userEmail, providerRules bool) error {
+	for i, u := range users {
+		email, err := domain.NormalizeEmail(u.Email, providerRules)
+		if err != nil {
+			return fmt.Errorf("normalize email of user %s: %w", u.ID, err)
+		}
+		users[i].Canonical = email.Canonical
+	}
+	return nil
+}
+
+// emailConflicts returns the active users whose canonical email is held by an
+// older active user. users are ordered from the oldest.
+func emailConflicts(users []userEmail) []EmailConflict {
+	var conflicts []EmailConflict
+	owners := make(map[string]uuid.UUID, len(users))
+	for _, u := range users {
+		if u.Deleted {
+			continue
+		}
+		if owner, ok := owners[u.Canonical]; ok {
+			conflicts = append(conflicts, EmailConflict{ID: u.ID, Email: u.Email, Canonical: u.Canonical, KeptBy: owner})
+			continue
+		}
+		owners[u.Canonical] = u.ID
+	}
+	return conflicts
+}
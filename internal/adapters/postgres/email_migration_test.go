@@ -0,0 +1,43 @@
+package postgres
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestEmailConflicts(t *testing.T) {
+	oldest, deleted, duplicate, other := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	users := []userEmail{
+		{ID: deleted, Email: "Jane.Doe@gmail.com", Deleted: true},
+		{ID: oldest, Email: "janedoe@gmail.com"},
+		{ID: duplicate, Email: "jane.doe+dating@googlemail.com"},
+		{ID: other, Email: "jane.doe@example.com"},
+	}
+
+	tests := []struct {
+		name          string
+		providerRules bool
+		want          []EmailConflict
+	}{
+		// The deleted account is older, but doesn't hold its email any more.
+		{
+			name:          "provider rules",
+			providerRules: true,
+			want:          []EmailConflict{{ID: duplicate, Email: "jane.doe+dating@googlemail.com", Canonical: "janedoe@gmail.com", KeptBy: oldest}},
+		},
+		{name: "case only"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := append([]userEmail(nil), users...)
+			if err := canonicalizeEmails(users, tt.providerRules); err != nil {
+				t.Fatal(err)
+			}
+			if got := emailConflicts(users); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("emailConflicts() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
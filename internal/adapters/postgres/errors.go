@@ -0,0 +1,62 @@
+package postgres
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+// SQLSTATE codes translated into domain errors.
+const (
+	// foreignKeyViolation is reported when a referenced row does not exist.
+	foreignKeyViolation = "23503"
+	// uniqueViolation is reported when a unique index rejects a row.
+	uniqueViolation = "23505"
+	// serializationFailure is reported when a transaction conflicts with a
+	// concurrent one and must be retried.
+	serializationFailure = "40001"
+	// deadlockDetected is reported for the transaction chosen to break a deadlock.
+	deadlockDetected = "40P01"
+)
+
+// constraintErrors are the domain errors of the constraints that requests can
+// violate. The names are the defaults Postgres gives the constraints in tables.up.sql.
+var constraintErrors = map[string]error{
+	"users_email_canonical_idx": domain.ErrAlreadyExists,
+	"user_roles_role_fkey":      domain.ErrUnknownRole,
+	"user_roles_user_id_fkey":   domain.ErrUserNotFound,
+	"sessions_user_id_fkey":     domain.ErrUserNotFound,
+	"consents_user_id_fkey":     domain.ErrUserNotFound,
+	"logins_user_id_fkey":       domain.ErrUserNotFound,
+}
+
+// translateError wraps err in op, replacing a Postgres error with its domain
+// error. Other Postgres errors are kept as they are, so they surface as
+// internal errors.
+func translateError(op string, err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	switch pgErr.Code {
+	case uniqueViolation, foreignKeyViolation:
+		if domainErr, ok := constraintErrors[pgErr.ConstraintName]; ok {
+			return fmt.Errorf("%s: %w", op, domainErr)
+		}
+	case serializationFailure, deadlockDetected:
+		return fmt.Errorf("%s: %w", op, domain.ErrConcurrentUpdate)
+	}
+	return fmt.Errorf("%s: %w", op, err)
+}
+
+// isRetryable reports whether the transaction that failed with err can be run again.
+func isRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == serializationFailure || pgErr.Code == deadlockDetected
+	}
+	return errors.Is(err, domain.ErrConcurrentUpdate)
+}
@@ -0,0 +1,33 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+// UpgradeGuest gives the guest the credentials of u, keeping their ID, and
+// bumps their token version.
+func (r *Repo) UpgradeGuest(ctx context.Context, u *domain.User) error {
+	return r.execForUser(ctx, "upgrade guest", upgradeGuestQuery,
+		u.ID, u.Email, u.EmailCanonical, u.Password, u.AgeAttestedAt, u.AgePolicyVersion)
+}
+
+// ExpireGuests soft-deletes the guests created before createdBefore with a
+// purge_after of now, so the next purge removes them.
+func (r *Repo) ExpireGuests(ctx context.Context, createdBefore, now time.Time) ([]uuid.UUID, error) {
+	rows, err := r.pool.GetTx(ctx).Query(ctx, expireGuestsQuery, createdBefore, now)
+	if err != nil {
+		return nil, fmt.Errorf("expire guests: %w", err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return nil, fmt.Errorf("map expired guests: %w", err)
+	}
+	return ids, nil
+}
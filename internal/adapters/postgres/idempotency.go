@@ -0,0 +1,49 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+func (r *Repo) GetIdempotencyRecord(ctx context.Context, operation, key string, now time.Time) (*domain.IdempotencyRecord, error) {
+	rows, err := r.pool.GetTx(ctx).Query(ctx, getIdempotencyRecordQuery, operation, key, now)
+	if err != nil {
+		return nil, fmt.Errorf("get idempotency record: %w", err)
+	}
+	record, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[domain.IdempotencyRecord])
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, domain.ErrIdempotencyKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("map idempotency record: %w", err)
+	}
+	return &record, nil
+}
+
+// SaveIdempotencyRecord returns ErrIdempotencyKeyReused if the key has a
+// record that has not expired.
+func (r *Repo) SaveIdempotencyRecord(ctx context.Context, rec *domain.IdempotencyRecord) error {
+	tag, err := r.pool.GetTx(ctx).Exec(ctx, saveIdempotencyRecordQuery,
+		rec.Operation, rec.Key, rec.RequestHash, rec.UserID, rec.CreatedAt, rec.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("save idempotency record: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrIdempotencyKeyReused
+	}
+	return nil
+}
+
+func (r *Repo) DeleteExpiredIdempotencyRecords(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := r.pool.GetTx(ctx).Exec(ctx, deleteExpiredIdempotencyRecordsQuery, before)
+	if err != nil {
+		return 0, fmt.Errorf("delete expired idempotency records: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,88 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+func (r *Repo) CreateInviteCode(ctx context.Context, c *domain.InviteCode) error {
+	_, err := r.pool.GetTx(ctx).Exec(ctx, createInviteCodeQuery, c.ID, c.CodeHash, c.MaxUses, c.CreatedBy, c.CreatedAt, c.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("create invite code: %w", err)
+	}
+	return nil
+}
+
+func (r *Repo) UseInviteCode(ctx context.Context, codeHash string, now time.Time) (uuid.UUID, error) {
+	var id uuid.UUID
+	err := r.pool.GetTx(ctx).QueryRow(ctx, useInviteCodeQuery, codeHash, now).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return uuid.UUID{}, domain.ErrInvalidInviteCode
+	}
+	if err != nil {
+		return uuid.UUID{}, fmt.Errorf("use invite code: %w", err)
+	}
+	return id, nil
+}
+
+// AddToWaitlist returns the entry of the email, which is e unless the email
+// was already on the waitlist.
+func (r *Repo) AddToWaitlist(ctx context.Context, e *domain.WaitlistEntry) (*domain.WaitlistEntry, error) {
+	conn := r.pool.GetTx(ctx)
+	if _, err := conn.Exec(ctx, addToWaitlistQuery, e.ID, e.Email, e.EmailCanonical, e.CreatedAt); err != nil {
+		return nil, fmt.Errorf("add to waitlist: %w", err)
+	}
+	rows, err := conn.Query(ctx, getWaitlistEntryQuery, e.EmailCanonical)
+	if err != nil {
+		return nil, fmt.Errorf("get waitlist entry: %w", err)
+	}
+	entry, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[domain.WaitlistEntry])
+	if err != nil {
+		return nil, fmt.Errorf("map waitlist entry: %w", err)
+	}
+	return &entry, nil
+}
+
+func (r *Repo) GetWaitlistEntry(ctx context.Context, canonical string) (*domain.WaitlistEntry, error) {
+	rows, err := r.pool.GetTx(ctx).Query(ctx, getWaitlistEntryQuery, canonical)
+	if err != nil {
+		return nil, fmt.Errorf("get waitlist entry: %w", err)
+	}
+	entry, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[domain.WaitlistEntry])
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, domain.ErrWaitlistEntryNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("map waitlist entry: %w", err)
+	}
+	return &entry, nil
+}
+
+// ListWaitlist locks the oldest entries not admitted yet, so it must run
+// inside a transaction.
+func (r *Repo) ListWaitlist(ctx context.Context, limit int) ([]domain.WaitlistEntry, error) {
+	rows, err := r.pool.GetTx(ctx).Query(ctx, listWaitlistQuery, limit)
+	if err != nil {
+		return nil, fmt.Errorf("list waitlist: %w", err)
+	}
+	entries, err := pgx.CollectRows(rows, pgx.RowToStructByName[domain.WaitlistEntry])
+	if err != nil {
+		return nil, fmt.Errorf("map waitlist entries: %w", err)
+	}
+	return entries, nil
+}
+
+func (r *Repo) AdmitWaitlistEntry(ctx context.Context, id, inviteCodeID uuid.UUID, at time.Time) error {
+	_, err := r.pool.GetTx(ctx).Exec(ctx, admitWaitlistEntryQuery, id, at, inviteCodeID)
+	if err != nil {
+		return fmt.Errorf("admit waitlist entry: %w", err)
+	}
+	return nil
+}
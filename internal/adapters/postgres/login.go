@@ -0,0 +1,43 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+func (r *Repo) AddLogin(ctx context.Context, l *domain.Login) error {
+	_, err := r.pool.GetTx(ctx).Exec(ctx, createLoginQuery,
+		l.ID, l.UserID, l.SessionID, l.DeviceFingerprint, l.IP, l.UserAgent, l.Country, l.City, l.NewDevice, l.CreatedAt,
+	)
+	if err != nil {
+		return translateError("add login", err)
+	}
+	return nil
+}
+
+func (r *Repo) GetLoginOrigins(ctx context.Context, userID uuid.UUID, fingerprint, country string) (domain.LoginOrigins, error) {
+	var o domain.LoginOrigins
+	err := r.pool.GetTx(ctx).QueryRow(ctx, getLoginOriginsQuery, userID, fingerprint, country).
+		Scan(&o.HasLogins, &o.KnownDevice, &o.KnownCountry)
+	if err != nil {
+		return domain.LoginOrigins{}, fmt.Errorf("get login origins: %w", err)
+	}
+	return o, nil
+}
+
+func (r *Repo) ListLogins(ctx context.Context, f domain.LoginFilter) ([]domain.Login, error) {
+	rows, err := r.pool.GetTx(ctx).Query(ctx, listLoginsQuery, f.UserID, f.BeforeSeq, f.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("list logins: %w", err)
+	}
+	logins, err := pgx.CollectRows(rows, pgx.RowToStructByName[domain.Login])
+	if err != nil {
+		return nil, fmt.Errorf("map logins: %w", err)
+	}
+	return logins, nil
+}
@@ -1,2 +1,20 @@
+DROP TABLE IF EXISTS auth.outbox;
+DROP TABLE IF EXISTS auth.audit_events;
+DROP FUNCTION IF EXISTS auth.reject_audit_event_change();
+DROP FUNCTION IF EXISTS auth.reject_audit_event_update();
+DROP TABLE IF EXISTS auth.rate_limits;
+DROP TABLE IF EXISTS auth.idempotency_keys;
+DROP TABLE IF EXISTS auth.waitlist;
+DROP TABLE IF EXISTS auth.invite_codes;
+DROP TABLE IF EXISTS auth.consents;
+DROP TABLE IF EXISTS auth.email_changes;
+DROP TABLE IF EXISTS auth.password_resets;
+DROP TABLE IF EXISTS auth.user_roles;
+DROP TABLE IF EXISTS auth.role_permissions;
+DROP TABLE IF EXISTS auth.roles;
+DROP TABLE IF EXISTS auth.service_clients;
+DROP TABLE IF EXISTS auth.logins;
+DROP TABLE IF EXISTS auth.sessions;
+DROP TABLE IF EXISTS auth.banned_identifiers;
 DROP TABLE IF EXISTS auth.users;
-DROP SCHEMA IF EXISTS auth;
\ No newline at end of file
+DROP SCHEMA IF EXISTS auth;
@@ -2,9 +2,316 @@ CREATE SCHEMA auth;
 
 CREATE TABLE auth.users
 (
-    id         uuid,
-    email      TEXT UNIQUE NOT NULL,
-    password   TEXT,
+    id          uuid,
+    -- email is the address as the user entered it, email_canonical identifies the account.
+    email       TEXT NOT NULL,
+    email_canonical TEXT NOT NULL,
+    password    TEXT,
 --     logged_in  BOOLEAN,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    deleted_at  TIMESTAMPTZ,
+    purge_after TIMESTAMPTZ,
+    disabled_at TIMESTAMPTZ,
+    password_reset_required BOOLEAN NOT NULL DEFAULT false,
+    token_version INT NOT NULL DEFAULT 0,
+    status            TEXT NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'suspended', 'banned')),
+    status_reason     TEXT NOT NULL DEFAULT '',
+    status_actor_id   uuid,
+    status_changed_at TIMESTAMPTZ,
+    status_until      TIMESTAMPTZ,
+    -- The age gate the user passed at sign-up or as a guest, the date of birth is not stored.
+    age_attested_at    TIMESTAMPTZ,
+    age_policy_version TEXT NOT NULL DEFAULT '',
+    -- email_verified_at is when a code or token sent to email came back.
+    email_verified_at  TIMESTAMPTZ,
+    -- Guests have an empty email and password until they sign up.
+    guest BOOLEAN NOT NULL DEFAULT false,
+    PRIMARY KEY (id)
+);
+
+-- Deleted users free their address at once, so it can sign up again during the grace period.
+CREATE UNIQUE INDEX users_email_canonical_idx ON auth.users (email_canonical) WHERE NOT guest AND deleted_at IS NULL;
+-- Admin searches page through the users in this order.
+CREATE INDEX users_email_canonical_id_idx ON auth.users (email_canonical, id);
+CREATE INDEX users_purge_after_idx ON auth.users (purge_after) WHERE purge_after IS NOT NULL;
+CREATE INDEX users_guest_created_at_idx ON auth.users (created_at) WHERE guest AND deleted_at IS NULL;
+
+-- Identifiers of banned accounts. There is no foreign key, so they outlive purged accounts.
+CREATE TABLE auth.banned_identifiers
+(
+    kind       TEXT        NOT NULL,
+    value      TEXT        NOT NULL,
+    user_id    uuid        NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at TIMESTAMPTZ,
+    PRIMARY KEY (kind, value)
+);
+
+CREATE INDEX banned_identifiers_user_id_idx ON auth.banned_identifiers (user_id);
+
+CREATE TABLE auth.sessions
+(
+    id                 uuid,
+    user_id            uuid        NOT NULL REFERENCES auth.users (id) ON DELETE CASCADE,
+    refresh_token_hash TEXT        NOT NULL,
+    ip                 TEXT        NOT NULL DEFAULT '',
+    user_agent         TEXT        NOT NULL DEFAULT '',
+    created_at         TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_used_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at         TIMESTAMPTZ NOT NULL,
+    revoked_at         TIMESTAMPTZ,
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX sessions_user_id_idx ON auth.sessions (user_id);
+
+-- logins is the login history users review. Rows go with the user when purged.
+CREATE TABLE auth.logins
+(
+    seq                BIGSERIAL,
+    id                 uuid        NOT NULL UNIQUE,
+    user_id            uuid        NOT NULL REFERENCES auth.users (id) ON DELETE CASCADE,
+    session_id         uuid        NOT NULL,
+    device_fingerprint TEXT        NOT NULL,
+    ip                 TEXT        NOT NULL DEFAULT '',
+    user_agent         TEXT        NOT NULL DEFAULT '',
+    country            TEXT        NOT NULL DEFAULT '',
+    city               TEXT        NOT NULL DEFAULT '',
+    new_device         BOOLEAN     NOT NULL DEFAULT false,
+    created_at         TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (seq)
+);
+
+CREATE INDEX logins_user_id_idx ON auth.logins (user_id, seq);
+CREATE INDEX logins_user_device_idx ON auth.logins (user_id, device_fingerprint);
+CREATE INDEX logins_user_country_idx ON auth.logins (user_id, country);
+
+-- service_clients are registered by operators, e.g.
+-- INSERT INTO auth.service_clients (id, name, secret_hash, scopes)
+-- VALUES ('feed', 'Feed service', encode(sha256('<secret>'), 'hex'), '{profile:read}');
+CREATE TABLE auth.service_clients
+(
+    id          TEXT,
+    name        TEXT        NOT NULL DEFAULT '',
+    secret_hash TEXT        NOT NULL,
+    scopes      TEXT[]      NOT NULL DEFAULT '{}',
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    disabled_at TIMESTAMPTZ,
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE auth.roles
+(
+    name        TEXT,
+    description TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (name)
+);
+
+CREATE TABLE auth.role_permissions
+(
+    role       TEXT NOT NULL REFERENCES auth.roles (name) ON DELETE CASCADE,
+    permission TEXT NOT NULL,
+    PRIMARY KEY (role, permission)
+);
+
+INSERT INTO auth.roles (name, description)
+VALUES ('guest', 'Visitor going through onboarding before signing up'),
+       ('user', 'Regular member'),
+       ('premium', 'Member with a paid subscription'),
+       ('moderator', 'Staff reviewing reported content'),
+       ('admin', 'Staff with access to the admin service');
+
+INSERT INTO auth.role_permissions (role, permission)
+VALUES ('guest', 'onboarding:read'),
+       ('guest', 'onboarding:write'),
+       ('user', 'profile:read'),
+       ('user', 'profile:write'),
+       ('user', 'matches:read'),
+       ('premium', 'likes:unlimited'),
+       ('premium', 'likes:see'),
+       ('premium', 'profile:boost'),
+       ('moderator', 'reports:read'),
+       ('moderator', 'reports:resolve'),
+       ('moderator', 'profile:moderate'),
+       ('admin', 'admin'),
+       ('admin', 'users:read'),
+       ('admin', 'users:write'),
+       ('admin', 'audit:read');
+
+CREATE TABLE auth.user_roles
+(
+    user_id uuid NOT NULL REFERENCES auth.users (id) ON DELETE CASCADE,
+    role    TEXT NOT NULL REFERENCES auth.roles (name),
+    PRIMARY KEY (user_id, role)
+);
+
+CREATE TABLE auth.password_resets
+(
+    token_hash TEXT,
+    user_id    uuid        NOT NULL REFERENCES auth.users (id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at    TIMESTAMPTZ,
+    PRIMARY KEY (token_hash)
+);
+
+CREATE TABLE auth.email_changes
+(
+    id                  uuid,
+    user_id             uuid        NOT NULL REFERENCES auth.users (id) ON DELETE CASCADE,
+    old_email           TEXT        NOT NULL,
+    new_email           TEXT        NOT NULL,
+    new_email_canonical TEXT        NOT NULL,
+    code_hash           TEXT        NOT NULL,
+    attempts            INT         NOT NULL DEFAULT 0,
+    created_at          TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at          TIMESTAMPTZ NOT NULL,
+    confirmed_at        TIMESTAMPTZ,
+    revert_token_hash   TEXT UNIQUE,
+    revert_expires_at   TIMESTAMPTZ,
+    reverted_at         TIMESTAMPTZ,
     PRIMARY KEY (id)
-);
\ No newline at end of file
+);
+
+-- At most one request of a user is pending.
+CREATE UNIQUE INDEX email_changes_pending_idx ON auth.email_changes (user_id) WHERE confirmed_at IS NULL;
+
+-- consents prove which versions of the terms and privacy policy a user accepted.
+CREATE TABLE auth.consents
+(
+    user_id     uuid        NOT NULL REFERENCES auth.users (id) ON DELETE CASCADE,
+    document    TEXT        NOT NULL,
+    version     TEXT        NOT NULL,
+    accepted_at TIMESTAMPTZ NOT NULL,
+    ip          TEXT        NOT NULL DEFAULT '',
+    PRIMARY KEY (user_id, document, version)
+);
+
+-- invite_codes let users sign up while registration is invite-only or waitlisted.
+-- created_by has no foreign key, so codes outlive the admin who created them.
+CREATE TABLE auth.invite_codes
+(
+    id         uuid,
+    code_hash  TEXT        NOT NULL UNIQUE,
+    max_uses   INT         NOT NULL CHECK (max_uses > 0),
+    uses       INT         NOT NULL DEFAULT 0 CHECK (uses <= max_uses),
+    created_by uuid,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at TIMESTAMPTZ,
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE auth.waitlist
+(
+    id              uuid,
+    email           TEXT        NOT NULL,
+    email_canonical TEXT        NOT NULL UNIQUE,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    admitted_at     TIMESTAMPTZ,
+    invite_code_id  uuid REFERENCES auth.invite_codes (id),
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX waitlist_pending_idx ON auth.waitlist (created_at) WHERE admitted_at IS NULL;
+
+-- idempotency_keys tie the keys of requests to the users they signed up, so
+-- retries are answered with a new session of the user. Expired records are deleted.
+CREATE TABLE auth.idempotency_keys
+(
+    operation    TEXT        NOT NULL,
+    key          TEXT        NOT NULL,
+    request_hash TEXT        NOT NULL,
+    user_id      uuid        NOT NULL REFERENCES auth.users (id) ON DELETE CASCADE,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at   TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (operation, key)
+);
+
+CREATE INDEX idempotency_keys_expires_at_idx ON auth.idempotency_keys (expires_at);
+
+-- rate_limits count the requests of a key, e.g. an action and a client IP,
+-- in its current window. Ended windows are purged.
+CREATE TABLE auth.rate_limits
+(
+    key          TEXT        NOT NULL,
+    window_start TIMESTAMPTZ NOT NULL,
+    count        INT         NOT NULL,
+    PRIMARY KEY (key)
+);
+
+CREATE INDEX rate_limits_window_start_idx ON auth.rate_limits (window_start);
+
+CREATE TABLE auth.audit_events
+(
+    seq        BIGSERIAL,
+    id         uuid        NOT NULL UNIQUE,
+    -- Every subject has its own hash chain, events about no subject share the nil one.
+    chain_id   uuid        NOT NULL,
+    actor_id   uuid,
+    subject_id uuid,
+    action     TEXT        NOT NULL,
+    outcome    TEXT        NOT NULL,
+    -- ip and user_agent are not hashed, so they can be redacted.
+    ip         TEXT        NOT NULL DEFAULT '',
+    user_agent TEXT        NOT NULL DEFAULT '',
+    details    JSONB       NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL,
+    prev_hash  TEXT        NOT NULL,
+    hash       TEXT        NOT NULL,
+    PRIMARY KEY (seq)
+);
+
+CREATE INDEX audit_events_chain_idx ON auth.audit_events (chain_id, seq);
+CREATE INDEX audit_events_subject_idx ON auth.audit_events (subject_id, seq);
+CREATE INDEX audit_events_actor_idx ON auth.audit_events (actor_id, seq);
+
+CREATE FUNCTION auth.reject_audit_event_change() RETURNS trigger AS
+$$
+BEGIN
+    RAISE EXCEPTION 'auth.audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only
+    BEFORE DELETE OR TRUNCATE
+    ON auth.audit_events
+    FOR EACH STATEMENT
+EXECUTE FUNCTION auth.reject_audit_event_change();
+
+-- The only update allowed is the redaction of the personal data.
+CREATE FUNCTION auth.reject_audit_event_update() RETURNS trigger AS
+$$
+BEGIN
+    IF (NEW.ip <> '' OR NEW.user_agent <> '')
+        OR (NEW.seq, NEW.id, NEW.chain_id, NEW.actor_id, NEW.subject_id, NEW.action, NEW.outcome,
+            NEW.details, NEW.created_at, NEW.prev_hash, NEW.hash)
+        IS DISTINCT FROM (OLD.seq, OLD.id, OLD.chain_id, OLD.actor_id, OLD.subject_id, OLD.action, OLD.outcome,
+            OLD.details, OLD.created_at, OLD.prev_hash, OLD.hash) THEN
+        RAISE EXCEPTION 'auth.audit_events is append-only';
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_redact_only
+    BEFORE UPDATE
+    ON auth.audit_events
+    FOR EACH ROW
+EXECUTE FUNCTION auth.reject_audit_event_update();
+
+CREATE TABLE auth.outbox
+(
+    id              uuid,
+    aggregate_id    uuid        NOT NULL,
+    event_type      TEXT        NOT NULL,
+    payload         BYTEA       NOT NULL,
+    attempts        INT         NOT NULL DEFAULT 0,
+    last_error      TEXT,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    published_at    TIMESTAMPTZ,
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX outbox_pending_idx ON auth.outbox (next_attempt_at) WHERE published_at IS NULL;
+CREATE INDEX outbox_unpublished_aggregate_idx ON auth.outbox (aggregate_id, created_at) WHERE published_at IS NULL;
@@ -0,0 +1,44 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+func (r *Repo) CreatePasswordReset(ctx context.Context, p *domain.PasswordReset) error {
+	_, err := r.pool.GetTx(ctx).Exec(ctx, createPasswordResetQuery, p.TokenHash, p.UserID, p.CreatedAt, p.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("create password reset: %w", err)
+	}
+	return nil
+}
+
+// GetPasswordReset locks the reset row, so it must run inside a transaction.
+func (r *Repo) GetPasswordReset(ctx context.Context, tokenHash string) (*domain.PasswordReset, error) {
+	rows, err := r.pool.GetTx(ctx).Query(ctx, getPasswordResetQuery, tokenHash)
+	if err != nil {
+		return nil, fmt.Errorf("get password reset: %w", err)
+	}
+	reset, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[domain.PasswordReset])
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, domain.ErrInvalidResetToken
+		}
+		return nil, fmt.Errorf("map password reset: %w", err)
+	}
+	return &reset, nil
+}
+
+func (r *Repo) UsePasswordReset(ctx context.Context, tokenHash string, usedAt time.Time) error {
+	_, err := r.pool.GetTx(ctx).Exec(ctx, usePasswordResetQuery, tokenHash, usedAt)
+	if err != nil {
+		return fmt.Errorf("use password reset: %w", err)
+	}
+	return nil
+}
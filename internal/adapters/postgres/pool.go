@@ -2,10 +2,13 @@ package postgres
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/soulmate-dating/auth/internal/domain"
 )
 
 type TxCtxKey struct{}
@@ -17,16 +20,23 @@ type Connection interface {
 	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
 }
 
+// TxStarter is a Connection that begins transactions with options, such as *pgxpool.Pool.
+type TxStarter interface {
+	Connection
+	BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error)
+}
+
 type ConnPool interface {
 	GetTx(ctx context.Context) Connection
 	RunInTx(ctx context.Context, f func(context.Context) error) error
+	RunInTxWithOptions(ctx context.Context, opts domain.TxOptions, f func(context.Context) error) error
 }
 
 type Pool struct {
-	pool Connection
+	pool TxStarter
 }
 
-func NewPool(pool Connection) *Pool {
+func NewPool(pool TxStarter) *Pool {
 	return &Pool{pool: pool}
 }
 
@@ -44,11 +54,33 @@ func (p *Pool) AcquireTx(ctx context.Context) pgx.Tx {
 }
 
 func (p *Pool) RunInTx(ctx context.Context, f func(context.Context) error) error {
+	return p.RunInTxWithOptions(ctx, domain.TxOptions{}, f)
+}
+
+// RunInTxWithOptions runs f in a transaction, running it again in a new one
+// when it fails with a serialization failure or a deadlock, at most
+// opts.Retries times. Nested in a transaction, f runs in it and the options
+// are ignored, as the outer transaction is retried instead.
+func (p *Pool) RunInTxWithOptions(ctx context.Context, opts domain.TxOptions, f func(context.Context) error) error {
 	if tx := p.AcquireTx(ctx); tx != nil {
 		return f(ctx)
 	}
+	for attempt := 0; ; attempt++ {
+		err := p.runInTx(ctx, opts, f)
+		if err == nil || !isRetryable(err) {
+			return err
+		}
+		if attempt >= opts.Retries {
+			if !errors.Is(err, domain.ErrConcurrentUpdate) {
+				err = fmt.Errorf("%w: %w", domain.ErrConcurrentUpdate, err)
+			}
+			return err
+		}
+	}
+}
 
-	tx, err := p.pool.Begin(ctx)
+func (p *Pool) runInTx(ctx context.Context, opts domain.TxOptions, f func(context.Context) error) error {
+	tx, err := p.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.TxIsoLevel(opts.Isolation)})
 	if err != nil {
 		return fmt.Errorf("begin transaction: %w", err)
 	}
@@ -0,0 +1,126 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+// fakeTx is a transaction that only commits or rolls back.
+type fakeTx struct {
+	pgx.Tx
+	commitErr error
+}
+
+func (tx *fakeTx) Commit(context.Context) error   { return tx.commitErr }
+func (tx *fakeTx) Rollback(context.Context) error { return nil }
+
+// fakeStarter begins fake transactions and records their options.
+type fakeStarter struct {
+	Connection
+	begun     []pgx.TxOptions
+	commitErr error
+}
+
+func (s *fakeStarter) BeginTx(_ context.Context, opts pgx.TxOptions) (pgx.Tx, error) {
+	s.begun = append(s.begun, opts)
+	return &fakeTx{commitErr: s.commitErr}, nil
+}
+
+func TestPool_RunInTxWithOptions(t *testing.T) {
+	conflict := &pgconn.PgError{Code: serializationFailure}
+	tests := []struct {
+		name      string
+		failures  int
+		commitErr error
+		fErr      error
+		wantErr   error
+		wantRuns  int
+	}{
+		{name: "succeeds", wantRuns: 1},
+		{name: "retries serialization failures", failures: 2, wantRuns: 3},
+		{name: "gives up after the retries", failures: 3, wantRuns: 3, wantErr: domain.ErrConcurrentUpdate},
+		{name: "retries failed commits", commitErr: conflict, wantRuns: 3, wantErr: domain.ErrConcurrentUpdate},
+		{name: "does not retry other errors", fErr: domain.ErrAlreadyExists, wantRuns: 1, wantErr: domain.ErrAlreadyExists},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			starter := &fakeStarter{commitErr: tt.commitErr}
+			pool := NewPool(starter)
+			runs := 0
+			opts := domain.TxOptions{Isolation: domain.Serializable, Retries: 2}
+			err := pool.RunInTxWithOptions(context.Background(), opts, func(ctx context.Context) error {
+				runs++
+				if pool.AcquireTx(ctx) == nil {
+					t.Error("f runs outside of a transaction")
+				}
+				if runs <= tt.failures {
+					return fmt.Errorf("create profile: %w", conflict)
+				}
+				return tt.fErr
+			})
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+			if runs != tt.wantRuns {
+				t.Errorf("ran f %d times, want %d", runs, tt.wantRuns)
+			}
+			for _, begun := range starter.begun {
+				if begun.IsoLevel != pgx.Serializable {
+					t.Errorf("began a transaction with isolation %q, want %q", begun.IsoLevel, pgx.Serializable)
+				}
+			}
+		})
+	}
+}
+
+func TestPool_RunInTxNested(t *testing.T) {
+	starter := &fakeStarter{}
+	pool := NewPool(starter)
+	runs := 0
+	err := pool.RunInTx(context.Background(), func(ctx context.Context) error {
+		return pool.RunInTxWithOptions(ctx, domain.TxOptions{Retries: 2}, func(context.Context) error {
+			runs++
+			return &pgconn.PgError{Code: deadlockDetected}
+		})
+	})
+	if !errors.Is(err, domain.ErrConcurrentUpdate) {
+		t.Errorf("got error %v, want %v", err, domain.ErrConcurrentUpdate)
+	}
+	// The nested call is retried by the outer transaction, which has no retries.
+	if runs != 1 || len(starter.begun) != 1 {
+		t.Errorf("ran f %d times in %d transactions, want 1 in 1", runs, len(starter.begun))
+	}
+}
+
+func TestTranslateError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"taken email", &pgconn.PgError{Code: uniqueViolation, ConstraintName: "users_email_canonical_idx"}, domain.ErrAlreadyExists},
+		{"unknown role", &pgconn.PgError{Code: foreignKeyViolation, ConstraintName: "user_roles_role_fkey"}, domain.ErrUnknownRole},
+		{"purged user", &pgconn.PgError{Code: foreignKeyViolation, ConstraintName: "sessions_user_id_fkey"}, domain.ErrUserNotFound},
+		{"serialization failure", &pgconn.PgError{Code: serializationFailure}, domain.ErrConcurrentUpdate},
+		{"deadlock", &pgconn.PgError{Code: deadlockDetected}, domain.ErrConcurrentUpdate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := translateError("op", tt.err); !errors.Is(got, tt.want) {
+				t.Errorf("translateError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+
+	other := &pgconn.PgError{Code: uniqueViolation, ConstraintName: "sessions_pkey"}
+	if got := translateError("op", other); !errors.Is(got, other) || errors.Is(got, domain.ErrAlreadyExists) {
+		t.Errorf("translateError(%v) = %v, want it kept as it is", other, got)
+	}
+}
@@ -1,10 +1,225 @@
 package postgres
 
 const (
-	getUserByEmailQuery = `SELECT * FROM auth.users WHERE email = $1`
-	createUserQuery     = `INSERT INTO auth.users (
-                      		id, email, password
-    						) VALUES ($1, $2, $3) RETURNING id`
+	userColumns = `id, email, email_canonical, password, created_at, deleted_at, purge_after,
+							disabled_at, password_reset_required, token_version,
+							status, status_reason, status_actor_id, status_changed_at, status_until,
+							age_attested_at, age_policy_version, guest, email_verified_at`
+	getUserByEmailQuery = `SELECT ` + userColumns + ` FROM auth.users WHERE email_canonical = $1 AND deleted_at IS NULL`
+	getUserByIDQuery    = `SELECT ` + userColumns + ` FROM auth.users WHERE id = $1 AND deleted_at IS NULL`
+	getAnyUserByIDQuery = `SELECT ` + userColumns + ` FROM auth.users WHERE id = $1`
+	searchUsersQuery    = `SELECT ` + userColumns + ` FROM auth.users
+							WHERE email_canonical LIKE $1 ESCAPE '\' AND (email_canonical, id) > ($2, $3)
+							ORDER BY email_canonical, id
+							LIMIT $4`
+	setUserDisabledQuery = `UPDATE auth.users SET disabled_at = $2 WHERE id = $1`
+	setUserStatusQuery   = `UPDATE auth.users SET status = $2, status_reason = $3, status_actor_id = $4,
+							status_changed_at = $5, status_until = $6
+							WHERE id = $1`
+	requirePasswordResetQuery = `UPDATE auth.users SET password_reset_required = true WHERE id = $1`
+	updatePasswordQuery       = `UPDATE auth.users SET password = $2, password_reset_required = false WHERE id = $1`
+	updateEmailQuery          = `UPDATE auth.users SET email = $2, email_canonical = $3, email_verified_at = now(),
+							token_version = token_version + 1
+							WHERE id = $1`
+	bumpTokenVersionQuery   = `UPDATE auth.users SET token_version = token_version + 1 WHERE id = $1`
+	getUserRolesQuery       = `SELECT role FROM auth.user_roles WHERE user_id = $1 ORDER BY role`
+	deleteUserRolesQuery    = `DELETE FROM auth.user_roles WHERE user_id = $1`
+	addUserRolesQuery       = `INSERT INTO auth.user_roles (user_id, role) SELECT $1, unnest($2::text[])`
+	getUserPermissionsQuery = `SELECT DISTINCT p.permission FROM auth.user_roles r
+		JOIN auth.role_permissions p ON p.role = r.role
+		WHERE r.user_id = $1 ORDER BY p.permission`
+
+	// A taken email returns no row instead of aborting the transaction, so concurrent
+	// sign-ups with the same email are told apart from other failures.
+	createUserQuery = `INSERT INTO auth.users (
+                      		id, email, email_canonical, password, age_attested_at, age_policy_version, guest
+    						) VALUES ($1, $2, $3, $4, $5, $6, $7)
+							ON CONFLICT (email_canonical) WHERE NOT guest AND deleted_at IS NULL DO NOTHING RETURNING id`
+	// Upgrading a guest invalidates the tokens issued to them, as they carry the guest claim.
+	upgradeGuestQuery = `UPDATE auth.users SET email = $2, email_canonical = $3, password = $4,
+							age_attested_at = $5, age_policy_version = $6, guest = false,
+							token_version = token_version + 1
+							WHERE id = $1 AND guest AND deleted_at IS NULL`
+	expireGuestsQuery = `UPDATE auth.users SET deleted_at = $2, purge_after = $2
+							WHERE guest AND deleted_at IS NULL AND created_at < $1 RETURNING id`
+	softDeleteUserQuery = `UPDATE auth.users SET deleted_at = $2, purge_after = $3
+							WHERE id = $1 AND deleted_at IS NULL`
+	// Published outbox messages of purged users are removed too, as their payloads carry personal data,
+	// and so are the waitlist entries of their emails unless another account holds the email now.
+	// Their audit events are kept for accountability, only the addresses and user agents are redacted.
+	purgeUsersQuery = `WITH purged AS (
+								DELETE FROM auth.users WHERE purge_after <= $1 RETURNING id, email_canonical
+							), purged_waitlist AS (
+								DELETE FROM auth.waitlist w
+								WHERE w.email_canonical IN (SELECT email_canonical FROM purged)
+								AND NOT EXISTS (
+									SELECT 1 FROM auth.users u
+									WHERE u.email_canonical = w.email_canonical AND NOT u.guest AND u.deleted_at IS NULL
+								)
+							), purged_events AS (
+								DELETE FROM auth.outbox
+								WHERE published_at IS NOT NULL AND aggregate_id IN (SELECT id FROM purged)
+							), redacted_audit AS (
+								UPDATE auth.audit_events SET ip = '', user_agent = ''
+								WHERE subject_id IN (SELECT id FROM purged) OR actor_id IN (SELECT id FROM purged)
+							)
+							SELECT count(*) FROM purged`
+
+	createPasswordResetQuery = `INSERT INTO auth.password_resets (
+                      		token_hash, user_id, created_at, expires_at
+    						) VALUES ($1, $2, $3, $4)`
+	getPasswordResetQuery = `SELECT token_hash, user_id, created_at, expires_at, used_at
+							FROM auth.password_resets WHERE token_hash = $1 FOR UPDATE`
+	usePasswordResetQuery = `UPDATE auth.password_resets SET used_at = $2 WHERE token_hash = $1`
+
+	// A user banned again extends the ban of an identifier they share with an earlier account.
+	addBannedIdentifierQuery = `INSERT INTO auth.banned_identifiers (
+                      		kind, value, user_id, created_at, expires_at
+    						) VALUES ($1, $2, $3, $4, $5)
+							ON CONFLICT (kind, value) DO UPDATE
+							SET user_id = excluded.user_id, created_at = excluded.created_at, expires_at = excluded.expires_at`
+	deleteBannedIdentifiersQuery = `DELETE FROM auth.banned_identifiers WHERE user_id = $1`
+	isIdentifierBannedQuery      = `SELECT EXISTS (
+								SELECT 1 FROM auth.banned_identifiers
+								WHERE kind = $1 AND value = $2 AND (expires_at IS NULL OR expires_at > $3)
+							)`
+	listBannedIdentifiersQuery = `SELECT kind, value, user_id, created_at, expires_at FROM auth.banned_identifiers
+							WHERE user_id = $1 ORDER BY kind, value`
+
+	emailChangeColumns = `id, user_id, old_email, new_email, new_email_canonical, code_hash, attempts,
+							created_at, expires_at, confirmed_at, revert_token_hash, revert_expires_at, reverted_at`
+	deletePendingEmailChangeQuery = `DELETE FROM auth.email_changes WHERE user_id = $1 AND confirmed_at IS NULL`
+	createEmailChangeQuery        = `INSERT INTO auth.email_changes (
+                      		id, user_id, old_email, new_email, new_email_canonical, code_hash, created_at, expires_at
+    						) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	getPendingEmailChangeQuery = `SELECT ` + emailChangeColumns + ` FROM auth.email_changes
+							WHERE user_id = $1 AND confirmed_at IS NULL FOR UPDATE`
+	getEmailChangeByRevertTokenQuery = `SELECT ` + emailChangeColumns + ` FROM auth.email_changes
+							WHERE revert_token_hash = $1 FOR UPDATE`
+	listEmailChangesQuery = `SELECT ` + emailChangeColumns + ` FROM auth.email_changes
+							WHERE user_id = $1 ORDER BY created_at DESC`
+	updateEmailChangeQuery = `UPDATE auth.email_changes SET attempts = $2, confirmed_at = $3,
+							revert_token_hash = $4, revert_expires_at = $5, reverted_at = $6
+							WHERE id = $1`
+
+	// Accepting a version again keeps the first acceptance as the proof.
+	addConsentQuery = `INSERT INTO auth.consents (user_id, document, version, accepted_at, ip)
+							VALUES ($1, $2, $3, $4, $5)
+							ON CONFLICT (user_id, document, version) DO NOTHING`
+	listConsentsQuery = `SELECT user_id, document, version, accepted_at, ip FROM auth.consents
+							WHERE user_id = $1
+							ORDER BY accepted_at, document`
+
+	createInviteCodeQuery = `INSERT INTO auth.invite_codes (
+                      		id, code_hash, max_uses, created_by, created_at, expires_at
+    						) VALUES ($1, $2, $3, $4, $5, $6)`
+	// The use is counted by the same statement that checks the limit, so
+	// concurrent sign-ups can't exceed it.
+	useInviteCodeQuery = `UPDATE auth.invite_codes SET uses = uses + 1
+							WHERE code_hash = $1 AND uses < max_uses AND (expires_at IS NULL OR expires_at > $2)
+							RETURNING id`
+	waitlistColumns    = `id, email, email_canonical, created_at, admitted_at, invite_code_id`
+	addToWaitlistQuery = `INSERT INTO auth.waitlist (id, email, email_canonical, created_at)
+							VALUES ($1, $2, $3, $4)
+							ON CONFLICT (email_canonical) DO NOTHING`
+	getWaitlistEntryQuery = `SELECT ` + waitlistColumns + ` FROM auth.waitlist WHERE email_canonical = $1`
+	// Admins admitting at the same time take different entries.
+	listWaitlistQuery = `SELECT ` + waitlistColumns + ` FROM auth.waitlist
+							WHERE admitted_at IS NULL
+							ORDER BY created_at, id
+							LIMIT $1
+							FOR UPDATE SKIP LOCKED`
+	admitWaitlistEntryQuery = `UPDATE auth.waitlist SET admitted_at = $2, invite_code_id = $3 WHERE id = $1`
+
+	getIdempotencyRecordQuery = `SELECT operation, key, request_hash, user_id, created_at, expires_at
+							FROM auth.idempotency_keys WHERE operation = $1 AND key = $2 AND expires_at > $3`
+	// An expired record is replaced, a current one is kept and no row is affected.
+	saveIdempotencyRecordQuery = `INSERT INTO auth.idempotency_keys (
+                      		operation, key, request_hash, user_id, created_at, expires_at
+    						) VALUES ($1, $2, $3, $4, $5, $6)
+							ON CONFLICT (operation, key) DO UPDATE
+							SET request_hash = excluded.request_hash, user_id = excluded.user_id,
+								created_at = excluded.created_at, expires_at = excluded.expires_at
+							WHERE idempotency_keys.expires_at <= excluded.created_at`
+	deleteExpiredIdempotencyRecordsQuery = `DELETE FROM auth.idempotency_keys WHERE expires_at <= $1`
+
+	// The count of an earlier window is restarted by the statement counting
+	// the request, so concurrent requests are all counted.
+	countRequestQuery = `INSERT INTO auth.rate_limits (key, window_start, count) VALUES ($1, $2, 1)
+							ON CONFLICT (key) DO UPDATE
+							SET count = CASE WHEN rate_limits.window_start = excluded.window_start
+								THEN rate_limits.count + 1 ELSE 1 END,
+								window_start = excluded.window_start
+							RETURNING count`
+	deleteRateLimitsQuery = `DELETE FROM auth.rate_limits WHERE window_start < $1`
+
+	// Writers to a chain take its advisory lock, so each event links to the one
+	// of its chain committed before it. Writers to other chains don't wait.
+	lockAuditChainQuery   = `SELECT pg_advisory_xact_lock(hashtext('auth.audit_events'), hashtext($1::text))`
+	lastAuditHashQuery    = `SELECT hash FROM auth.audit_events WHERE chain_id = $1 ORDER BY seq DESC LIMIT 1`
+	createAuditEventQuery = `INSERT INTO auth.audit_events (
+                      		id, chain_id, actor_id, subject_id, action, outcome, ip, user_agent, details, created_at, prev_hash, hash
+    						) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING seq`
+	auditEventColumns    = `seq, id, chain_id, actor_id, subject_id, action, outcome, ip, user_agent, details, created_at, prev_hash, hash`
+	listAuditEventsQuery = `SELECT ` + auditEventColumns + ` FROM auth.audit_events
+							WHERE ($1::uuid IS NULL OR subject_id = $1 OR actor_id = $1)
+							AND ($2::timestamptz IS NULL OR created_at >= $2)
+							AND ($3::timestamptz IS NULL OR created_at < $3)
+							AND ($4::bigint = 0 OR seq < $4)
+							ORDER BY seq DESC
+							LIMIT $5`
+	scanAuditEventsQuery = `SELECT ` + auditEventColumns + ` FROM auth.audit_events
+							WHERE seq > $1
+							ORDER BY seq
+							LIMIT $2`
+
+	sessionColumns     = `id, user_id, refresh_token_hash, ip, user_agent, created_at, last_used_at, expires_at, revoked_at`
+	createSessionQuery = `INSERT INTO auth.sessions (
+                      		id, user_id, refresh_token_hash, ip, user_agent, created_at, last_used_at, expires_at
+    						) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	getSessionQuery    = `SELECT ` + sessionColumns + ` FROM auth.sessions WHERE id = $1`
+	listSessionsQuery  = `SELECT ` + sessionColumns + ` FROM auth.sessions WHERE user_id = $1 ORDER BY created_at DESC`
+	rotateSessionQuery = `UPDATE auth.sessions
+							SET refresh_token_hash = $3, last_used_at = $4, expires_at = $5
+							WHERE id = $1 AND refresh_token_hash = $2 AND revoked_at IS NULL`
+	revokeSessionQuery      = `UPDATE auth.sessions SET revoked_at = now() WHERE id = $1 AND revoked_at IS NULL`
+	revokeUserSessionsQuery = `UPDATE auth.sessions SET revoked_at = now() WHERE user_id = $1 AND revoked_at IS NULL`
+
+	loginColumns     = `seq, id, user_id, session_id, device_fingerprint, ip, user_agent, country, city, new_device, created_at`
+	createLoginQuery = `INSERT INTO auth.logins (
+                      		id, user_id, session_id, device_fingerprint, ip, user_agent, country, city, new_device, created_at
+    						) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+	getLoginOriginsQuery = `SELECT EXISTS (SELECT 1 FROM auth.logins WHERE user_id = $1),
+							EXISTS (SELECT 1 FROM auth.logins WHERE user_id = $1 AND device_fingerprint = $2),
+							EXISTS (SELECT 1 FROM auth.logins WHERE user_id = $1 AND country = $3 AND country <> '')`
+	listLoginsQuery = `SELECT ` + loginColumns + ` FROM auth.logins
+							WHERE user_id = $1 AND ($2::bigint = 0 OR seq < $2)
+							ORDER BY seq DESC
+							LIMIT $3`
+
+	createOutboxMessageQuery = `INSERT INTO auth.outbox (
+                      		id, aggregate_id, event_type, payload, created_at
+    						) VALUES ($1, $2, $3, $4, $5)`
+	// A message is due only if no older message of its aggregate is unpublished,
+	// which keeps the order of the events of an aggregate.
+	claimOutboxMessagesQuery = `WITH claimed AS (
+								UPDATE auth.outbox SET next_attempt_at = $2
+								WHERE id IN (SELECT m.id FROM auth.outbox m
+									WHERE m.published_at IS NULL AND m.next_attempt_at <= now()
+										AND NOT EXISTS (SELECT 1 FROM auth.outbox p
+											WHERE p.aggregate_id = m.aggregate_id AND p.published_at IS NULL
+												AND (p.created_at, p.id) < (m.created_at, m.id))
+									ORDER BY m.created_at
+									LIMIT $1
+									FOR UPDATE SKIP LOCKED)
+								RETURNING id, aggregate_id, event_type, payload, attempts, created_at)
+							SELECT * FROM claimed ORDER BY created_at`
+	markOutboxMessagePublishedQuery = `UPDATE auth.outbox SET published_at = now() WHERE id = $1`
+	markOutboxMessageFailedQuery    = `UPDATE auth.outbox
+							SET attempts = attempts + 1, last_error = $2, next_attempt_at = $3
+							WHERE id = $1`
+
+	getServiceClientQuery = `SELECT id, name, secret_hash, scopes, created_at, disabled_at
+							FROM auth.service_clients WHERE id = $1`
 	//updateUserLoginStatusQuery = `UPDATE users SET logged_in = $2 WHERE id = $1 RETURNING *`
-	//updatePasswordQuery = `UPDATE users password = $2 WHERE id = $1 RETURNING *`
 )
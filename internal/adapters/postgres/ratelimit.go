@@ -0,0 +1,23 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+func (r *Repo) CountRequest(ctx context.Context, key string, windowStart time.Time) (int, error) {
+	var count int
+	if err := r.pool.GetTx(ctx).QueryRow(ctx, countRequestQuery, key, windowStart).Scan(&count); err != nil {
+		return 0, fmt.Errorf("count request: %w", err)
+	}
+	return count, nil
+}
+
+func (r *Repo) DeleteRateLimits(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := r.pool.GetTx(ctx).Exec(ctx, deleteRateLimitsQuery, before)
+	if err != nil {
+		return 0, fmt.Errorf("delete rate limits: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
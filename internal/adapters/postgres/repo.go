@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
@@ -11,47 +13,215 @@ import (
 	"github.com/soulmate-dating/auth/internal/domain"
 )
 
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
 type Repo struct {
-	pool       ConnPool
-	mapUsers   func(row pgx.CollectableRow) (domain.User, error)
-	mapUserIDs func(row pgx.CollectableRow) (domain.UserID, error)
+	pool        ConnPool
+	mapUsers    func(row pgx.CollectableRow) (domain.User, error)
+	mapUserIDs  func(row pgx.CollectableRow) (domain.UserID, error)
+	mapOutbox   func(row pgx.CollectableRow) (domain.OutboxMessage, error)
+	mapSessions func(row pgx.CollectableRow) (domain.Session, error)
+	mapClients  func(row pgx.CollectableRow) (domain.ServiceClient, error)
 }
 
 func NewRepo(pool ConnPool) *Repo {
 	return &Repo{
-		pool:       pool,
-		mapUsers:   pgx.RowToStructByName[domain.User],
-		mapUserIDs: pgx.RowToStructByName[domain.UserID],
+		pool:        pool,
+		mapUsers:    pgx.RowToStructByName[domain.User],
+		mapUserIDs:  pgx.RowToStructByName[domain.UserID],
+		mapOutbox:   pgx.RowToStructByName[domain.OutboxMessage],
+		mapSessions: pgx.RowToStructByName[domain.Session],
+		mapClients:  pgx.RowToStructByName[domain.ServiceClient],
 	}
 }
 
 func (r *Repo) CreateUser(ctx context.Context, p *domain.User) (uuid.UUID, error) {
 	var args []any
 	args = append(args,
-		p.ID, p.Email, p.Password,
+		p.ID, p.Email, p.EmailCanonical, p.Password, p.AgeAttestedAt, p.AgePolicyVersion, p.Guest,
 	)
 	rows, err := r.pool.GetTx(ctx).Query(ctx, createUserQuery, args...)
 	if err != nil {
-		return uuid.UUID{}, fmt.Errorf("create profile: %w", err)
+		return uuid.UUID{}, translateError("create profile", err)
 	}
+	// No row is returned when the email is taken, see createUserQuery.
 	userID, err := pgx.CollectOneRow(rows, r.mapUserIDs)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return uuid.UUID{}, fmt.Errorf("create profile: %w", domain.ErrAlreadyExists)
+	}
 	if err != nil {
-		return uuid.UUID{}, fmt.Errorf("map id: %w", err)
+		return uuid.UUID{}, translateError("map id", err)
 	}
 	return userID.ID, nil
 }
 
-func (r *Repo) GetUserByEmail(ctx context.Context, id string) (*domain.User, error) {
-	rows, err := r.pool.GetTx(ctx).Query(ctx, getUserByEmailQuery, id)
+func (r *Repo) GetUserByEmail(ctx context.Context, canonical string) (*domain.User, error) {
+	rows, err := r.pool.GetTx(ctx).Query(ctx, getUserByEmailQuery, canonical)
+	if err != nil {
+		return nil, fmt.Errorf("get user by email: %w", err)
+	}
+	return r.collectUser(rows)
+}
+
+func (r *Repo) GetUserByID(ctx context.Context, id uuid.UUID) (*domain.User, error) {
+	rows, err := r.pool.GetTx(ctx).Query(ctx, getUserByIDQuery, id)
 	if err != nil {
 		return nil, fmt.Errorf("get user by id: %w", err)
 	}
-	profile, err := pgx.CollectOneRow(rows, r.mapUsers)
+	return r.collectUser(rows)
+}
+
+func (r *Repo) collectUser(rows pgx.Rows) (*domain.User, error) {
+	user, err := pgx.CollectOneRow(rows, r.mapUsers)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, domain.ErrUserNotFound
 		}
 		return nil, fmt.Errorf("map user: %w", err)
 	}
-	return &profile, nil
+	return &user, nil
+}
+
+func (r *Repo) SoftDeleteUser(ctx context.Context, id uuid.UUID, deletedAt, purgeAfter time.Time) error {
+	tag, err := r.pool.GetTx(ctx).Exec(ctx, softDeleteUserQuery, id, deletedAt, purgeAfter)
+	if err != nil {
+		return fmt.Errorf("soft delete user: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrUserNotFound
+	}
+	return nil
+}
+
+func (r *Repo) PurgeUsers(ctx context.Context, before time.Time) (int64, error) {
+	var purged int64
+	err := r.pool.GetTx(ctx).QueryRow(ctx, purgeUsersQuery, before).Scan(&purged)
+	if err != nil {
+		return 0, fmt.Errorf("purge users: %w", err)
+	}
+	return purged, nil
+}
+
+func (r *Repo) AddOutboxMessage(ctx context.Context, m *domain.OutboxMessage) error {
+	_, err := r.pool.GetTx(ctx).Exec(ctx, createOutboxMessageQuery,
+		m.ID, m.AggregateID, m.EventType, m.Payload, m.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("create outbox message: %w", err)
+	}
+	return nil
+}
+
+func (r *Repo) ClaimOutboxMessages(ctx context.Context, limit int, claimedUntil time.Time) ([]domain.OutboxMessage, error) {
+	rows, err := r.pool.GetTx(ctx).Query(ctx, claimOutboxMessagesQuery, limit, claimedUntil)
+	if err != nil {
+		return nil, fmt.Errorf("claim outbox messages: %w", err)
+	}
+	messages, err := pgx.CollectRows(rows, r.mapOutbox)
+	if err != nil {
+		return nil, fmt.Errorf("map outbox messages: %w", err)
+	}
+	return messages, nil
+}
+
+func (r *Repo) MarkOutboxMessagePublished(ctx context.Context, id uuid.UUID) error {
+	_, err := r.pool.GetTx(ctx).Exec(ctx, markOutboxMessagePublishedQuery, id)
+	if err != nil {
+		return fmt.Errorf("mark outbox message published: %w", err)
+	}
+	return nil
+}
+
+func (r *Repo) MarkOutboxMessageFailed(ctx context.Context, id uuid.UUID, reason string, nextAttemptAt time.Time) error {
+	_, err := r.pool.GetTx(ctx).Exec(ctx, markOutboxMessageFailedQuery, id, reason, nextAttemptAt)
+	if err != nil {
+		return fmt.Errorf("mark outbox message failed: %w", err)
+	}
+	return nil
+}
+
+func (r *Repo) GetAnyUserByID(ctx context.Context, id uuid.UUID) (*domain.User, error) {
+	rows, err := r.pool.GetTx(ctx).Query(ctx, getAnyUserByIDQuery, id)
+	if err != nil {
+		return nil, fmt.Errorf("get user by id: %w", err)
+	}
+	return r.collectUser(rows)
+}
+
+func (r *Repo) SearchUsers(ctx context.Context, search domain.UserSearch) ([]domain.User, error) {
+	pattern := likeEscaper.Replace(search.EmailPrefix) + "%"
+	rows, err := r.pool.GetTx(ctx).Query(ctx, searchUsersQuery, pattern,
+		search.After.EmailCanonical, search.After.ID, search.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("search users: %w", err)
+	}
+	users, err := pgx.CollectRows(rows, r.mapUsers)
+	if err != nil {
+		return nil, fmt.Errorf("map users: %w", err)
+	}
+	return users, nil
+}
+
+func (r *Repo) SetUserDisabled(ctx context.Context, id uuid.UUID, disabledAt *time.Time) error {
+	return r.execForUser(ctx, "set user disabled", setUserDisabledQuery, id, disabledAt)
+}
+
+func (r *Repo) RequirePasswordReset(ctx context.Context, id uuid.UUID) error {
+	return r.execForUser(ctx, "require password reset", requirePasswordResetQuery, id)
+}
+
+func (r *Repo) BumpTokenVersion(ctx context.Context, id uuid.UUID) error {
+	return r.execForUser(ctx, "bump token version", bumpTokenVersionQuery, id)
+}
+
+func (r *Repo) UpdatePassword(ctx context.Context, id uuid.UUID, password string) error {
+	return r.execForUser(ctx, "update password", updatePasswordQuery, id, password)
+}
+
+func (r *Repo) GetUserRoles(ctx context.Context, id uuid.UUID) ([]string, error) {
+	rows, err := r.pool.GetTx(ctx).Query(ctx, getUserRolesQuery, id)
+	if err != nil {
+		return nil, fmt.Errorf("get user roles: %w", err)
+	}
+	roles, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("map roles: %w", err)
+	}
+	return roles, nil
+}
+
+// SetUserRoles replaces all roles of the user. It must run inside a transaction.
+func (r *Repo) SetUserRoles(ctx context.Context, id uuid.UUID, roles []string) error {
+	conn := r.pool.GetTx(ctx)
+	if _, err := conn.Exec(ctx, deleteUserRolesQuery, id); err != nil {
+		return fmt.Errorf("delete user roles: %w", err)
+	}
+	if _, err := conn.Exec(ctx, addUserRolesQuery, id, roles); err != nil {
+		return translateError("add user roles", err)
+	}
+	return nil
+}
+
+// GetUserPermissions returns the permissions granted by all roles of the user.
+func (r *Repo) GetUserPermissions(ctx context.Context, id uuid.UUID) ([]string, error) {
+	rows, err := r.pool.GetTx(ctx).Query(ctx, getUserPermissionsQuery, id)
+	if err != nil {
+		return nil, fmt.Errorf("get user permissions: %w", err)
+	}
+	permissions, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("map permissions: %w", err)
+	}
+	return permissions, nil
+}
+
+func (r *Repo) execForUser(ctx context.Context, op, query string, id uuid.UUID, args ...any) error {
+	tag, err := r.pool.GetTx(ctx).Exec(ctx, query, append([]any{id}, args...)...)
+	if err != nil {
+		return translateError(op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrUserNotFound
+	}
+	return nil
 }
@@ -0,0 +1,26 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+func (r *Repo) GetServiceClient(ctx context.Context, id string) (*domain.ServiceClient, error) {
+	rows, err := r.pool.GetTx(ctx).Query(ctx, getServiceClientQuery, id)
+	if err != nil {
+		return nil, fmt.Errorf("get service client: %w", err)
+	}
+	client, err := pgx.CollectOneRow(rows, r.mapClients)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, domain.ErrClientNotFound
+		}
+		return nil, fmt.Errorf("map service client: %w", err)
+	}
+	return &client, nil
+}
@@ -0,0 +1,79 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+func (r *Repo) CreateSession(ctx context.Context, s *domain.Session) error {
+	_, err := r.pool.GetTx(ctx).Exec(ctx, createSessionQuery,
+		s.ID, s.UserID, s.RefreshTokenHash, s.IP, s.UserAgent, s.CreatedAt, s.LastUsedAt, s.ExpiresAt,
+	)
+	if err != nil {
+		return translateError("create session", err)
+	}
+	return nil
+}
+
+func (r *Repo) GetSession(ctx context.Context, id uuid.UUID) (*domain.Session, error) {
+	rows, err := r.pool.GetTx(ctx).Query(ctx, getSessionQuery, id)
+	if err != nil {
+		return nil, fmt.Errorf("get session: %w", err)
+	}
+	session, err := pgx.CollectOneRow(rows, r.mapSessions)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, domain.ErrSessionNotFound
+		}
+		return nil, fmt.Errorf("map session: %w", err)
+	}
+	return &session, nil
+}
+
+func (r *Repo) ListUserSessions(ctx context.Context, userID uuid.UUID) ([]domain.Session, error) {
+	rows, err := r.pool.GetTx(ctx).Query(ctx, listSessionsQuery, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list sessions: %w", err)
+	}
+	sessions, err := pgx.CollectRows(rows, r.mapSessions)
+	if err != nil {
+		return nil, fmt.Errorf("map sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// RotateSession replaces the refresh token hash only if the session still holds
+// oldHash, so two concurrent refreshes with the same token cannot both succeed.
+func (r *Repo) RotateSession(ctx context.Context, id uuid.UUID, oldHash, newHash string, usedAt, expiresAt time.Time) error {
+	tag, err := r.pool.GetTx(ctx).Exec(ctx, rotateSessionQuery, id, oldHash, newHash, usedAt, expiresAt)
+	if err != nil {
+		return fmt.Errorf("rotate session: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrRefreshTokenReused
+	}
+	return nil
+}
+
+func (r *Repo) RevokeSession(ctx context.Context, id uuid.UUID) error {
+	_, err := r.pool.GetTx(ctx).Exec(ctx, revokeSessionQuery, id)
+	if err != nil {
+		return fmt.Errorf("revoke session: %w", err)
+	}
+	return nil
+}
+
+func (r *Repo) RevokeUserSessions(ctx context.Context, userID uuid.UUID) error {
+	_, err := r.pool.GetTx(ctx).Exec(ctx, revokeUserSessionsQuery, userID)
+	if err != nil {
+		return fmt.Errorf("revoke user sessions: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+func (r *Repo) SetUserStatus(ctx context.Context, id uuid.UUID, change domain.StatusChange) error {
+	return r.execForUser(ctx, "set user status", setUserStatusQuery, id,
+		change.Status, change.Reason, change.ActorID, change.At, change.Until)
+}
+
+func (r *Repo) AddBannedIdentifier(ctx context.Context, b *domain.BannedIdentifier) error {
+	_, err := r.pool.GetTx(ctx).Exec(ctx, addBannedIdentifierQuery, b.Kind, b.Value, b.UserID, b.CreatedAt, b.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("add banned identifier: %w", err)
+	}
+	return nil
+}
+
+func (r *Repo) DeleteBannedIdentifiers(ctx context.Context, userID uuid.UUID) error {
+	_, err := r.pool.GetTx(ctx).Exec(ctx, deleteBannedIdentifiersQuery, userID)
+	if err != nil {
+		return fmt.Errorf("delete banned identifiers: %w", err)
+	}
+	return nil
+}
+
+func (r *Repo) ListBannedIdentifiers(ctx context.Context, userID uuid.UUID) ([]domain.BannedIdentifier, error) {
+	rows, err := r.pool.GetTx(ctx).Query(ctx, listBannedIdentifiersQuery, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list banned identifiers: %w", err)
+	}
+	banned, err := pgx.CollectRows(rows, pgx.RowToStructByName[domain.BannedIdentifier])
+	if err != nil {
+		return nil, fmt.Errorf("map banned identifiers: %w", err)
+	}
+	return banned, nil
+}
+
+func (r *Repo) IsIdentifierBanned(ctx context.Context, kind, value string, now time.Time) (bool, error) {
+	var banned bool
+	err := r.pool.GetTx(ctx).QueryRow(ctx, isIdentifierBannedQuery, kind, value, now).Scan(&banned)
+	if err != nil {
+		return false, fmt.Errorf("check banned identifier: %w", err)
+	}
+	return banned, nil
+}
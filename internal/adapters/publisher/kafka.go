@@ -0,0 +1,45 @@
+package publisher
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+type Kafka struct {
+	writer *kafka.Writer
+}
+
+// NewKafka creates a publisher writing events to a single topic. Messages are
+// keyed by aggregate ID, so events of one user keep their order within a partition.
+func NewKafka(brokers []string, topic string) *Kafka {
+	return &Kafka{writer: &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+	}}
+}
+
+func (k *Kafka) Publish(ctx context.Context, m domain.OutboxMessage) error {
+	err := k.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(m.AggregateID.String()),
+		Value: m.Payload,
+		Headers: []kafka.Header{
+			{Key: headerMessageID, Value: []byte(m.ID.String())},
+			{Key: headerEventType, Value: []byte(m.EventType)},
+		},
+		Time: m.CreatedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("write kafka message: %w", err)
+	}
+	return nil
+}
+
+func (k *Kafka) Close() error {
+	return k.writer.Close()
+}
@@ -0,0 +1,46 @@
+package publisher
+
+import (
+	"context"
+	"sync"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+// Memory keeps published messages in memory. It is meant for tests and local runs.
+type Memory struct {
+	mu       sync.Mutex
+	messages []domain.OutboxMessage
+	err      error
+}
+
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+func (m *Memory) Publish(_ context.Context, msg domain.OutboxMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// FailWith makes subsequent publishes return err until it is reset with nil.
+func (m *Memory) FailWith(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.err = err
+}
+
+func (m *Memory) Messages() []domain.OutboxMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]domain.OutboxMessage(nil), m.messages...)
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
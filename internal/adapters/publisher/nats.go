@@ -0,0 +1,49 @@
+package publisher
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+type NATS struct {
+	conn          *nats.Conn
+	js            nats.JetStreamContext
+	subjectPrefix string
+}
+
+// NewNATS creates a publisher sending events to JetStream on
+// "<subjectPrefix>.<event type>". The stream covering these subjects must exist.
+func NewNATS(url, subjectPrefix string) (*NATS, error) {
+	conn, err := nats.Connect(url)
+	if err != nil {
+		return nil, fmt.Errorf("connect to nats: %w", err)
+	}
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("create jetstream context: %w", err)
+	}
+	return &NATS{conn: conn, js: js, subjectPrefix: subjectPrefix}, nil
+}
+
+func (n *NATS) Publish(ctx context.Context, m domain.OutboxMessage) error {
+	msg := nats.NewMsg(n.subjectPrefix + "." + m.EventType)
+	msg.Data = m.Payload
+	msg.Header.Set(headerMessageID, m.ID.String())
+	msg.Header.Set(headerEventType, m.EventType)
+	// The message ID lets JetStream drop duplicates when the relay retries.
+	_, err := n.js.PublishMsg(msg, nats.Context(ctx), nats.MsgId(m.ID.String()))
+	if err != nil {
+		return fmt.Errorf("publish nats message: %w", err)
+	}
+	return nil
+}
+
+func (n *NATS) Close() error {
+	n.conn.Close()
+	return nil
+}
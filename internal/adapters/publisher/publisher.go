@@ -0,0 +1,49 @@
+package publisher
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+const (
+	headerMessageID = "message-id"
+	headerEventType = "event-type"
+)
+
+const (
+	KindKafka  = "kafka"
+	KindNATS   = "nats"
+	KindMemory = "memory"
+)
+
+type Publisher interface {
+	Publish(ctx context.Context, m domain.OutboxMessage) error
+	Close() error
+}
+
+type Config struct {
+	Kind         string
+	KafkaBrokers []string
+	KafkaTopic   string
+	NATSURL      string
+	NATSSubject  string
+}
+
+// New creates the publisher selected by cfg.Kind.
+func New(cfg Config) (Publisher, error) {
+	switch cfg.Kind {
+	case KindKafka:
+		return NewKafka(cfg.KafkaBrokers, cfg.KafkaTopic), nil
+	case KindNATS:
+		p, err := NewNATS(cfg.NATSURL, cfg.NATSSubject)
+		if err != nil {
+			return nil, err
+		}
+		return p, nil
+	case KindMemory:
+		return NewMemory(), nil
+	}
+	return nil, fmt.Errorf("unknown publisher %q", cfg.Kind)
+}
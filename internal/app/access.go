@@ -0,0 +1,31 @@
+package app
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+// loadAccess fills in the roles and permissions of the user that are embedded
+// into access tokens. It is called whenever tokens are issued, so role changes
+// take effect on the next refresh.
+func (a *Application) loadAccess(ctx context.Context, user *domain.User) error {
+	roles, err := a.repository.GetUserRoles(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get user roles: %w", err)
+	}
+	permissions, err := a.repository.GetUserPermissions(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get user permissions: %w", err)
+	}
+	user.Roles, user.Permissions = roles, permissions
+	return nil
+}
+
+func requireScope(claims *domain.Claims, scope string) error {
+	if scope != "" && !claims.HasScope(scope) {
+		return fmt.Errorf("%w: %s", domain.ErrInsufficientScope, scope)
+	}
+	return nil
+}
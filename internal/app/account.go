@@ -0,0 +1,262 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+// DeleteAccount re-authenticates the user with their password and soft-deletes
+// the account. All sessions are revoked at once; the data itself is removed by
+// the purge job once the user's PurgeAfter has passed.
+func (a *Application) DeleteAccount(ctx context.Context, token, password string) (*domain.User, error) {
+	claims, err := a.authenticate(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	user, err := a.repository.GetUserByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user by id: %w", err)
+	}
+	if !a.checkPassword(password, user.Password) {
+		return nil, domain.ErrWrongPassword
+	}
+
+	now := time.Now().UTC()
+	purgeAfter := now.Add(a.deletionGracePeriod)
+	err = a.txManager.RunInTx(ctx, func(ctx context.Context) error {
+		if err := a.repository.SoftDeleteUser(ctx, user.ID, now, purgeAfter); err != nil {
+			return err
+		}
+		if err := a.sessions.RevokeUserSessions(ctx, user.ID); err != nil {
+			return err
+		}
+		if err := a.recordEvent(ctx, domain.UserDeleted{UserID: user.ID}); err != nil {
+			return err
+		}
+		return a.audit(ctx, domain.AuditEvent{
+			ActorID:   &user.ID,
+			SubjectID: &user.ID,
+			Action:    domain.AuditDeleteAccount,
+			Outcome:   domain.AuditOutcomeSuccess,
+			Details:   map[string]string{"purge_after": purgeAfter.Format(time.RFC3339)},
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete account: %w", err)
+	}
+	user.DeletedAt = &now
+	user.PurgeAfter = &purgeAfter
+	return user, nil
+}
+
+// ExportMyData collects everything stored about the authenticated user.
+func (a *Application) ExportMyData(ctx context.Context, token string) (*domain.UserDataExport, error) {
+	claims, err := a.authenticate(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	user, err := a.repository.GetUserByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user by id: %w", err)
+	}
+	sessions, err := a.sessions.ListUserSessions(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	logins, err := a.listAllLogins(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	consents, err := a.repository.ListConsents(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list consents: %w", err)
+	}
+	waitlist, err := a.repository.GetWaitlistEntry(ctx, user.EmailCanonical)
+	if err != nil && !errors.Is(err, domain.ErrWaitlistEntryNotFound) {
+		return nil, fmt.Errorf("failed to get waitlist entry: %w", err)
+	}
+	roles, err := a.repository.GetUserRoles(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user roles: %w", err)
+	}
+	changes, err := a.repository.ListEmailChanges(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list email changes: %w", err)
+	}
+	banned, err := a.repository.ListBannedIdentifiers(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list banned identifiers: %w", err)
+	}
+	events, err := a.listAccountAuditEvents(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	export := &domain.UserDataExport{
+		GeneratedAt: time.Now().UTC(),
+		Account: domain.AccountExport{
+			ID:               user.ID,
+			Email:            user.Email,
+			EmailVerifiedAt:  user.EmailVerifiedAt,
+			CreatedAt:        user.CreatedAt,
+			DeletedAt:        user.DeletedAt,
+			Status:           user.Status,
+			StatusReason:     user.StatusReason,
+			StatusChangedAt:  user.StatusChangedAt,
+			StatusUntil:      user.StatusUntil,
+			AgeAttestedAt:    user.AgeAttestedAt,
+			AgePolicyVersion: user.AgePolicyVersion,
+		},
+		Roles:             roles,
+		LoginHistory:      make([]domain.SessionExport, 0, len(sessions)),
+		Logins:            make([]domain.LoginExport, 0, len(logins)),
+		Consents:          make([]domain.ConsentExport, 0, len(consents)),
+		EmailChanges:      make([]domain.EmailChangeExport, 0, len(changes)),
+		BannedIdentifiers: make([]domain.BannedIdentifierExport, 0, len(banned)),
+		AuditEvents:       make([]domain.AuditEventExport, 0, len(events)),
+	}
+	for _, s := range sessions {
+		export.LoginHistory = append(export.LoginHistory, domain.SessionExport{
+			ID:         s.ID,
+			IP:         s.IP,
+			UserAgent:  s.UserAgent,
+			CreatedAt:  s.CreatedAt,
+			LastUsedAt: s.LastUsedAt,
+			ExpiresAt:  s.ExpiresAt,
+			RevokedAt:  s.RevokedAt,
+		})
+	}
+	for _, l := range logins {
+		export.Logins = append(export.Logins, domain.LoginExport{
+			SessionID: l.SessionID,
+			IP:        l.IP,
+			UserAgent: l.UserAgent,
+			Country:   l.Country,
+			City:      l.City,
+			NewDevice: l.NewDevice,
+			CreatedAt: l.CreatedAt,
+		})
+	}
+	if waitlist != nil {
+		export.Waitlist = &domain.WaitlistExport{
+			Email:      waitlist.Email,
+			JoinedAt:   waitlist.CreatedAt,
+			AdmittedAt: waitlist.AdmittedAt,
+		}
+	}
+	for _, c := range consents {
+		export.Consents = append(export.Consents, domain.ConsentExport{
+			Document:   c.Document,
+			Version:    c.Version,
+			AcceptedAt: c.AcceptedAt,
+			IP:         c.IP,
+		})
+	}
+	for _, c := range changes {
+		export.EmailChanges = append(export.EmailChanges, domain.EmailChangeExport{
+			OldEmail:        c.OldEmail,
+			NewEmail:        c.NewEmail,
+			CreatedAt:       c.CreatedAt,
+			ExpiresAt:       c.ExpiresAt,
+			ConfirmedAt:     c.ConfirmedAt,
+			RevertExpiresAt: c.RevertExpiresAt,
+			RevertedAt:      c.RevertedAt,
+		})
+	}
+	for _, b := range banned {
+		export.BannedIdentifiers = append(export.BannedIdentifiers, domain.BannedIdentifierExport{
+			Kind:      b.Kind,
+			Value:     b.Value,
+			CreatedAt: b.CreatedAt,
+			ExpiresAt: b.ExpiresAt,
+		})
+	}
+	for _, e := range events {
+		export.AuditEvents = append(export.AuditEvents, domain.AuditEventExport{
+			Action:    e.Action,
+			Outcome:   e.Outcome,
+			ByAdmin:   e.ActorID != nil && *e.ActorID != user.ID,
+			IP:        e.IP,
+			UserAgent: e.UserAgent,
+			Details:   e.Details,
+			CreatedAt: e.CreatedAt,
+		})
+	}
+	a.auditSuccess(ctx, user.ID, domain.AuditExportData)
+	return export, nil
+}
+
+// listAccountAuditEvents returns the audit events about the account, newest
+// first. Events the user caused as an admin are about other accounts.
+func (a *Application) listAccountAuditEvents(ctx context.Context, userID uuid.UUID) ([]domain.AuditEvent, error) {
+	var events []domain.AuditEvent
+	filter := domain.AuditFilter{UserID: &userID, Limit: maxAuditLimit}
+	for {
+		page, err := a.auditLog.ListAuditEvents(ctx, filter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list audit events: %w", err)
+		}
+		for _, e := range page {
+			if domain.AuditChainOf(e) == userID {
+				events = append(events, e)
+			}
+		}
+		if len(page) < filter.Limit {
+			return events, nil
+		}
+		filter.BeforeSeq = page[len(page)-1].Seq
+	}
+}
+
+// PurgeDeletedAccounts hard-deletes accounts whose grace period has ended.
+// Sessions and other per-user rows are removed by cascading foreign keys, and
+// the waitlist entry of their email unless another account holds it now.
+func (a *Application) PurgeDeletedAccounts(ctx context.Context) (int64, error) {
+	purged, err := a.repository.PurgeUsers(ctx, time.Now().UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge deleted accounts: %w", err)
+	}
+	return purged, nil
+}
+
+func (a *Application) purgeJob(interval time.Duration) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-ticker.C:
+			}
+			// Expired guests are soft-deleted to be purged right after.
+			if expired, err := a.PurgeExpiredGuests(ctx); err != nil {
+				slog.Error("guest purge failed", slog.Any("error", err))
+			} else if expired > 0 {
+				slog.Info("purged expired guests", slog.Int64("count", expired))
+			}
+			if purged, err := a.PurgeDeletedAccounts(ctx); err != nil {
+				slog.Error("account purge failed", slog.Any("error", err))
+			} else if purged > 0 {
+				slog.Info("purged deleted accounts", slog.Int64("count", purged))
+			}
+			if deleted, err := a.PurgeIdempotencyRecords(ctx); err != nil {
+				slog.Error("idempotency record purge failed", slog.Any("error", err))
+			} else if deleted > 0 {
+				slog.Info("purged expired idempotency records", slog.Int64("count", deleted))
+			}
+			if deleted, err := a.PurgeRateLimits(ctx); err != nil {
+				slog.Error("rate limit purge failed", slog.Any("error", err))
+			} else if deleted > 0 {
+				slog.Info("purged ended rate limit windows", slog.Int64("count", deleted))
+			}
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package app_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/soulmate-dating/auth/internal/app"
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+func TestApplication_DeleteAccount(t *testing.T) {
+	tests := []struct {
+		name     string
+		token    func(t *testing.T, env *testEnv, token *domain.Token) string
+		password string
+		wantErr  error
+	}{
+		{
+			name:     "valid",
+			token:    func(_ *testing.T, _ *testEnv, token *domain.Token) string { return token.AccessToken },
+			password: testPassword,
+		},
+		{
+			name:     "wrong password",
+			token:    func(_ *testing.T, _ *testEnv, token *domain.Token) string { return token.AccessToken },
+			password: "wrong-password",
+			wantErr:  domain.ErrWrongPassword,
+		},
+		{
+			name:     "service token",
+			token:    func(t *testing.T, env *testEnv, _ *domain.Token) string { return env.serviceToken(t) },
+			password: testPassword,
+			wantErr:  domain.ErrServiceToken,
+		},
+		{
+			name:     "invalid token",
+			token:    func(_ *testing.T, _ *testEnv, token *domain.Token) string { return token.RefreshToken },
+			password: testPassword,
+			wantErr:  domain.ErrInvalidToken,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			ctx := context.Background()
+			token := env.signUp(t, "user@example.com")
+
+			user, err := env.app.DeleteAccount(ctx, tt.token(t, env, token), tt.password)
+			checkErr(t, err, tt.wantErr)
+			if tt.wantErr != nil {
+				if _, err := env.repo.GetUserByID(ctx, token.Id); err != nil {
+					t.Errorf("user is gone after a failed deletion: %v", err)
+				}
+				return
+			}
+			if user.DeletedAt == nil || user.PurgeAfter == nil || !user.PurgeAfter.After(*user.DeletedAt) {
+				t.Errorf("deleted_at = %v, purge_after = %v", user.DeletedAt, user.PurgeAfter)
+			}
+			if _, err := env.repo.GetUserByID(ctx, token.Id); !errors.Is(err, domain.ErrUserNotFound) {
+				t.Errorf("deleted user is still found: %v", err)
+			}
+			if _, err := env.app.Refresh(ctx, token.RefreshToken); !errors.Is(err, domain.ErrSessionRevoked) {
+				t.Errorf("session survived the deletion: %v", err)
+			}
+			if _, err := env.app.Login(ctx, domain.LoginCredentials{Email: "user@example.com", Password: testPassword}); !errors.Is(err, domain.ErrUserNotFound) {
+				t.Errorf("deleted user can log in: %v", err)
+			}
+			var deleted bool
+			for _, m := range env.repo.OutboxMessages() {
+				deleted = deleted || m.AggregateID == token.Id && m.EventType == domain.EventUserDeleted
+			}
+			if !deleted {
+				t.Error("no UserDeleted event in the outbox")
+			}
+		})
+	}
+}
+
+func TestApplication_SignUpAfterDeleteAccount(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	deleted := env.signUp(t, "user@example.com")
+	if _, err := env.app.DeleteAccount(ctx, deleted.AccessToken, testPassword); err != nil {
+		t.Fatal(err)
+	}
+
+	// The address is free during the grace period, for a new account.
+	token := env.signUp(t, "User@example.com")
+	if token.Id == deleted.Id {
+		t.Error("the deleted account was signed into")
+	}
+	if _, err := env.app.Login(ctx, domain.LoginCredentials{Email: "user@example.com", Password: testPassword}); err != nil {
+		t.Errorf("login to the new account: %v", err)
+	}
+}
+
+func TestApplication_ExportMyData(t *testing.T) {
+	tests := []struct {
+		name         string
+		token        func(t *testing.T, env *testEnv, token *domain.Token) string
+		wantErr      error
+		wantSessions int
+	}{
+		{
+			name: "valid",
+			token: func(t *testing.T, env *testEnv, token *domain.Token) string {
+				if _, err := env.app.Login(context.Background(), domain.LoginCredentials{Email: "user@example.com", Password: testPassword}); err != nil {
+					t.Fatal(err)
+				}
+				return token.AccessToken
+			},
+			wantSessions: 2,
+		},
+		{
+			name:    "service token",
+			token:   func(t *testing.T, env *testEnv, _ *domain.Token) string { return env.serviceToken(t) },
+			wantErr: domain.ErrServiceToken,
+		},
+		{
+			name: "logged out",
+			token: func(t *testing.T, env *testEnv, token *domain.Token) string {
+				if _, err := env.app.Logout(context.Background(), token.AccessToken); err != nil {
+					t.Fatal(err)
+				}
+				return token.AccessToken
+			},
+			wantErr: domain.ErrSessionRevoked,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			token := env.signUp(t, "user@example.com")
+
+			export, err := env.app.ExportMyData(context.Background(), tt.token(t, env, token))
+			checkErr(t, err, tt.wantErr)
+			if tt.wantErr != nil {
+				return
+			}
+			if export.Account.ID != token.Id || export.Account.Email != "user@example.com" {
+				t.Errorf("account = %+v", export.Account)
+			}
+			if len(export.LoginHistory) != tt.wantSessions {
+				t.Errorf("got %d sessions, want %d", len(export.LoginHistory), tt.wantSessions)
+			}
+			// Every session was started by a sign-up or login.
+			if len(export.Logins) != tt.wantSessions {
+				t.Errorf("got %d logins, want %d", len(export.Logins), tt.wantSessions)
+			}
+		})
+	}
+}
+
+func TestApplication_ExportMyDataAccountHistory(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	adminID, adminToken := env.signUpAdmin(t)
+	token := env.signUp(t, "user@example.com")
+	_, err := env.app.RequestEmailChange(ctx, token.AccessToken, testPassword, "new@example.com")
+	checkErr(t, err, nil)
+	_, err = env.app.SuspendUser(ctx, adminID, token.Id, "spam", nil)
+	checkErr(t, err, nil)
+	_, err = env.app.ReinstateUser(ctx, adminID, token.Id, "appeal")
+	checkErr(t, err, nil)
+
+	export, err := env.app.ExportMyData(ctx, token.AccessToken)
+	checkErr(t, err, nil)
+	account := export.Account
+	if account.Status != domain.StatusActive || account.StatusReason != "appeal" || account.StatusChangedAt == nil {
+		t.Errorf("status = %s (%q) changed at %v, want the reinstatement", account.Status, account.StatusReason, account.StatusChangedAt)
+	}
+	if account.AgeAttestedAt == nil || account.AgePolicyVersion == "" {
+		t.Errorf("age attested at %v under %q, want the attestation of the sign-up", account.AgeAttestedAt, account.AgePolicyVersion)
+	}
+	if !slices.Equal(export.Roles, []string{domain.RoleUser}) {
+		t.Errorf("roles = %v, want %s", export.Roles, domain.RoleUser)
+	}
+	if len(export.EmailChanges) != 1 || export.EmailChanges[0].NewEmail != "new@example.com" || export.EmailChanges[0].ConfirmedAt != nil {
+		t.Errorf("email changes = %+v, want the pending one", export.EmailChanges)
+	}
+
+	var actions []string
+	for _, e := range export.AuditEvents {
+		if e.ByAdmin {
+			actions = append(actions, e.Action)
+		}
+	}
+	if want := []string{domain.AuditAdminReinstateUser, domain.AuditAdminSuspendUser}; !slices.Equal(actions, want) {
+		t.Errorf("admin actions = %v, want %v", actions, want)
+	}
+	// The admin's own export holds no events about other accounts.
+	adminExport, err := env.app.ExportMyData(ctx, adminToken)
+	checkErr(t, err, nil)
+	for _, e := range adminExport.AuditEvents {
+		if e.Action == domain.AuditAdminSuspendUser {
+			t.Errorf("admin export holds %s of another account", e.Action)
+		}
+	}
+}
+
+func TestApplication_PurgeDeletedAccounts(t *testing.T) {
+	tests := []struct {
+		name       string
+		purgeAfter time.Duration
+		// retaken signs up another account with the email after the deletion.
+		retaken      bool
+		wantPurged   int64
+		wantWaitlist bool
+	}{
+		{"grace period over", -time.Minute, false, 1, false},
+		{"within grace period", time.Hour, false, 0, true},
+		{"email taken again", -time.Minute, true, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			ctx := context.Background()
+			client := domain.ClientInfo{IP: "203.0.113.7", UserAgent: "Glimpse/1.0"}
+			deleted, err := env.app.SignUp(app.WithClientInfo(ctx, client), registration("deleted@example.com", testPassword))
+			if err != nil {
+				t.Fatal(err)
+			}
+			kept := env.signUp(t, "kept@example.com").Id
+			for _, email := range []string{"deleted@example.com", "kept@example.com"} {
+				_, err := env.repo.AddToWaitlist(ctx, &domain.WaitlistEntry{ID: uuid.New(), Email: email, EmailCanonical: email, CreatedAt: time.Now()})
+				checkErr(t, err, nil)
+			}
+			now := time.Now()
+			if err := env.repo.SoftDeleteUser(ctx, deleted.Id, now, now.Add(tt.purgeAfter)); err != nil {
+				t.Fatal(err)
+			}
+			if tt.retaken {
+				env.signUp(t, "deleted@example.com")
+			}
+
+			purged, err := env.app.PurgeDeletedAccounts(ctx)
+			checkErr(t, err, nil)
+			if purged != tt.wantPurged {
+				t.Errorf("purged %d, want %d", purged, tt.wantPurged)
+			}
+			if _, err := env.repo.GetAnyUserByID(ctx, deleted.Id); (err == nil) != (tt.wantPurged == 0) {
+				t.Errorf("GetAnyUserByID(deleted) = %v", err)
+			}
+			if _, err := env.repo.GetUserByID(ctx, kept); err != nil {
+				t.Errorf("active user was purged: %v", err)
+			}
+			if _, err := env.repo.GetWaitlistEntry(ctx, "deleted@example.com"); (err == nil) != tt.wantWaitlist {
+				t.Errorf("GetWaitlistEntry(deleted) = %v, want the entry kept: %t", err, tt.wantWaitlist)
+			}
+			if _, err := env.repo.GetWaitlistEntry(ctx, "kept@example.com"); err != nil {
+				t.Errorf("waitlist entry of the active user was purged: %v", err)
+			}
+
+			// The audit events outlive the user, but not where they came from.
+			events, err := env.repo.ListAuditEvents(ctx, domain.AuditFilter{UserID: &deleted.Id, Limit: 10})
+			checkErr(t, err, nil)
+			if len(events) == 0 {
+				t.Fatal("the audit events of the user are gone")
+			}
+			for _, e := range events {
+				if redacted := e.IP == "" && e.UserAgent == ""; redacted != (tt.wantPurged == 1) {
+					t.Errorf("%s event from %q %q, redacted = %t", e.Action, e.IP, e.UserAgent, redacted)
+				}
+			}
+			result, err := env.app.VerifyAuditLog(ctx, kept)
+			checkErr(t, err, nil)
+			if !result.Valid {
+				t.Errorf("redaction broke the audit log: %s", result.Reason)
+			}
+		})
+	}
+}
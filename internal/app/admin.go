@@ -0,0 +1,369 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+const (
+	defaultSearchLimit = 50
+	maxSearchLimit     = 100
+	resetTokenBytes    = 32
+)
+
+// Admin is used by support staff to manage members. Every call is recorded in
+// the audit log with the acting admin as the actor.
+type Admin interface {
+	AuthenticateAdmin(ctx context.Context, token string) (*domain.Claims, error)
+	GetUser(ctx context.Context, actor, id uuid.UUID) (*domain.User, error)
+	SearchUsers(ctx context.Context, actor uuid.UUID, search domain.UserSearch) (*domain.UserPage, error)
+	DisableUser(ctx context.Context, actor, id uuid.UUID, reason string) (*domain.User, error)
+	EnableUser(ctx context.Context, actor, id uuid.UUID, reason string) (*domain.User, error)
+	SuspendUser(ctx context.Context, actor, id uuid.UUID, reason string, until *time.Time) (*domain.User, error)
+	BanUser(ctx context.Context, actor, id uuid.UUID, reason string, until *time.Time) (*domain.User, error)
+	ReinstateUser(ctx context.Context, actor, id uuid.UUID, reason string) (*domain.User, error)
+	ForceLogout(ctx context.Context, actor, id uuid.UUID, reason string) (*domain.User, error)
+	ForcePasswordReset(ctx context.Context, actor, id uuid.UUID, reason string) (*domain.User, error)
+	SetRoles(ctx context.Context, actor, id uuid.UUID, roles []string) (*domain.User, error)
+	CreateInviteCodes(ctx context.Context, actor uuid.UUID, count, maxUses int, expiresAt *time.Time) ([]domain.InviteCode, error)
+	AdmitWaitlist(ctx context.Context, actor uuid.UUID, count int) ([]domain.WaitlistEntry, error)
+	ListAuditEvents(ctx context.Context, actor uuid.UUID, filter domain.AuditFilter) (*domain.AuditPage, error)
+	VerifyAuditLog(ctx context.Context, actor uuid.UUID) (*domain.AuditVerification, error)
+}
+
+// AuthenticateAdmin validates the token of a staff member. The admin scope is
+// checked against the current roles rather than the token, so revoking the
+// admin role takes effect immediately.
+func (a *Application) AuthenticateAdmin(ctx context.Context, token string) (*domain.Claims, error) {
+	claims, err := a.authenticate(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	permissions, err := a.repository.GetUserPermissions(ctx, claims.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user permissions: %w", err)
+	}
+	claims.Scope = strings.Join(permissions, " ")
+	if err := requireScope(claims, domain.ScopeAdmin); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (a *Application) GetUser(ctx context.Context, actor, id uuid.UUID) (*domain.User, error) {
+	var user *domain.User
+	err := a.txManager.RunInTx(ctx, func(ctx context.Context) (err error) {
+		user, err = a.userWithRoles(ctx, id)
+		if err != nil {
+			return err
+		}
+		return a.audit(ctx, domain.AuditEvent{
+			ActorID:   &actor,
+			SubjectID: &id,
+			Action:    domain.AuditAdminGetUser,
+			Outcome:   domain.AuditOutcomeSuccess,
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return user, nil
+}
+
+func (a *Application) SearchUsers(ctx context.Context, actor uuid.UUID, search domain.UserSearch) (*domain.UserPage, error) {
+	if search.Limit <= 0 {
+		search.Limit = defaultSearchLimit
+	}
+	search.Limit = min(search.Limit, maxSearchLimit)
+	// Canonical emails are lowercase.
+	search.EmailPrefix = strings.ToLower(search.EmailPrefix)
+	limit := search.Limit
+	// One extra row tells whether there is a next page.
+	search.Limit++
+
+	var users []domain.User
+	err := a.txManager.RunInTx(ctx, func(ctx context.Context) (err error) {
+		users, err = a.repository.SearchUsers(ctx, search)
+		if err != nil {
+			return err
+		}
+		return a.audit(ctx, domain.AuditEvent{
+			ActorID: &actor,
+			Action:  domain.AuditAdminSearchUsers,
+			Outcome: domain.AuditOutcomeSuccess,
+			Details: map[string]string{"email_prefix": search.EmailPrefix},
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search users: %w", err)
+	}
+
+	page := &domain.UserPage{Users: users}
+	if len(users) > limit {
+		page.Users = users[:limit]
+		last := page.Users[limit-1]
+		page.NextAfter = &domain.UserCursor{EmailCanonical: last.EmailCanonical, ID: last.ID}
+	}
+	return page, nil
+}
+
+func (a *Application) DisableUser(ctx context.Context, actor, id uuid.UUID, reason string) (*domain.User, error) {
+	now := time.Now().UTC()
+	return a.adminUpdate(ctx, actor, id, domain.AuditAdminDisableUser, map[string]string{"reason": reason},
+		func(ctx context.Context) error {
+			if err := a.repository.SetUserDisabled(ctx, id, &now); err != nil {
+				return err
+			}
+			return a.sessions.RevokeUserSessions(ctx, id)
+		},
+	)
+}
+
+func (a *Application) EnableUser(ctx context.Context, actor, id uuid.UUID, reason string) (*domain.User, error) {
+	return a.adminUpdate(ctx, actor, id, domain.AuditAdminEnableUser, map[string]string{"reason": reason},
+		func(ctx context.Context) error {
+			return a.repository.SetUserDisabled(ctx, id, nil)
+		},
+	)
+}
+
+// SuspendUser keeps the user from logging in and using their tokens until they
+// are reinstated or until passes. Sessions are kept, so a short suspension
+// does not log the user out everywhere.
+func (a *Application) SuspendUser(ctx context.Context, actor, id uuid.UUID, reason string, until *time.Time) (*domain.User, error) {
+	return a.setStatus(ctx, actor, id, domain.AuditAdminSuspendUser, domain.StatusChange{
+		Status: domain.StatusSuspended,
+		Reason: reason,
+		Until:  until,
+	}, nil)
+}
+
+// BanUser revokes all sessions of the user and keeps them from logging in
+// until they are reinstated or until passes. Their canonical email is banned
+// too, so it can't be used to sign up again, and so are the addresses they
+// signed in from, so no guests can be created there.
+func (a *Application) BanUser(ctx context.Context, actor, id uuid.UUID, reason string, until *time.Time) (*domain.User, error) {
+	change := domain.StatusChange{Status: domain.StatusBanned, Reason: reason, Until: until}
+	return a.setStatus(ctx, actor, id, domain.AuditAdminBanUser, change, func(ctx context.Context, user *domain.User, change domain.StatusChange) error {
+		identifiers, err := a.bannedIdentifiers(ctx, user)
+		if err != nil {
+			return err
+		}
+		for _, identifier := range identifiers {
+			err := a.repository.AddBannedIdentifier(ctx, &domain.BannedIdentifier{
+				Kind:      identifier.Kind,
+				Value:     identifier.Value,
+				UserID:    user.ID,
+				CreatedAt: change.At,
+				ExpiresAt: change.Until,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return a.sessions.RevokeUserSessions(ctx, id)
+	})
+}
+
+// bannedIdentifiers returns the email of the user, unless they are a guest,
+// and the addresses of their sessions.
+func (a *Application) bannedIdentifiers(ctx context.Context, user *domain.User) ([]domain.BannedIdentifier, error) {
+	var identifiers []domain.BannedIdentifier
+	if user.EmailCanonical != "" {
+		identifiers = append(identifiers, domain.BannedIdentifier{Kind: domain.IdentifierEmail, Value: user.EmailCanonical})
+	}
+	sessions, err := a.sessions.ListUserSessions(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	seen := map[string]bool{}
+	for _, s := range sessions {
+		if s.IP != "" && !seen[s.IP] {
+			seen[s.IP] = true
+			identifiers = append(identifiers, domain.BannedIdentifier{Kind: domain.IdentifierIP, Value: s.IP})
+		}
+	}
+	return identifiers, nil
+}
+
+// ReinstateUser lifts a suspension or ban along with the banned identifiers.
+func (a *Application) ReinstateUser(ctx context.Context, actor, id uuid.UUID, reason string) (*domain.User, error) {
+	change := domain.StatusChange{Status: domain.StatusActive, Reason: reason}
+	return a.setStatus(ctx, actor, id, domain.AuditAdminReinstateUser, change, func(ctx context.Context, _ *domain.User, _ domain.StatusChange) error {
+		return a.repository.DeleteBannedIdentifiers(ctx, id)
+	})
+}
+
+// setStatus applies the moderation decision, runs apply for its side effects
+// and tells other services about it.
+func (a *Application) setStatus(
+	ctx context.Context, actor, id uuid.UUID, action string, change domain.StatusChange,
+	apply func(ctx context.Context, user *domain.User, change domain.StatusChange) error,
+) (*domain.User, error) {
+	now := time.Now().UTC()
+	change.ActorID, change.At = &actor, now
+	details := map[string]string{"reason": change.Reason}
+	if change.Until != nil {
+		details["until"] = change.Until.UTC().Format(time.RFC3339)
+	}
+	return a.adminUpdate(ctx, actor, id, action, details, func(ctx context.Context) error {
+		if strings.TrimSpace(change.Reason) == "" {
+			return domain.ErrMissingReason
+		}
+		if change.Until != nil && !change.Until.After(now) {
+			return domain.ErrInvalidExpiry
+		}
+		// Deleted accounts can be banned too, so their email can't be reused.
+		user, err := a.repository.GetAnyUserByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := a.repository.SetUserStatus(ctx, id, change); err != nil {
+			return err
+		}
+		if apply != nil {
+			if err := apply(ctx, user, change); err != nil {
+				return err
+			}
+		}
+		return a.recordEvent(ctx, domain.UserStatusChanged{UserID: id, Status: change.Status, Until: change.Until})
+	})
+}
+
+func (a *Application) ForceLogout(ctx context.Context, actor, id uuid.UUID, reason string) (*domain.User, error) {
+	return a.adminUpdate(ctx, actor, id, domain.AuditAdminForceLogout, map[string]string{"reason": reason},
+		func(ctx context.Context) error {
+			if _, err := a.repository.GetAnyUserByID(ctx, id); err != nil {
+				return err
+			}
+			return a.sessions.RevokeUserSessions(ctx, id)
+		},
+	)
+}
+
+// ForcePasswordReset logs the user out everywhere and blocks password logins
+// until the password is changed with a one-time token. The token is sent to
+// the user only, the admin never sees it.
+func (a *Application) ForcePasswordReset(ctx context.Context, actor, id uuid.UUID, reason string) (*domain.User, error) {
+	reset, err := a.newPasswordReset(id)
+	if err != nil {
+		return nil, err
+	}
+	user, err := a.adminUpdate(ctx, actor, id, domain.AuditAdminForcePasswordReset, map[string]string{"reason": reason},
+		func(ctx context.Context) error {
+			if err := a.repository.RequirePasswordReset(ctx, id); err != nil {
+				return err
+			}
+			if err := a.sessions.RevokeUserSessions(ctx, id); err != nil {
+				return err
+			}
+			return a.repository.CreatePasswordReset(ctx, reset)
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	// A failed delivery can be retried with a new reset.
+	err = a.notifier.SendSecret(ctx, domain.SecretMessage{
+		Kind:      domain.SecretPasswordReset,
+		UserID:    user.ID,
+		Email:     user.Email,
+		Secret:    reset.Token,
+		ExpiresAt: reset.ExpiresAt,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to send password reset token: %w", err)
+	}
+	return user, nil
+}
+
+// SetRoles replaces the roles of the user. Access tokens carrying the previous
+// roles are outdated and must be refreshed.
+func (a *Application) SetRoles(ctx context.Context, actor, id uuid.UUID, roles []string) (*domain.User, error) {
+	roles = normalizeRoles(roles)
+	return a.adminUpdate(ctx, actor, id, domain.AuditAdminSetRoles, map[string]string{"roles": strings.Join(roles, ",")},
+		func(ctx context.Context) error {
+			if _, err := a.repository.GetAnyUserByID(ctx, id); err != nil {
+				return err
+			}
+			if err := a.repository.SetUserRoles(ctx, id, roles); err != nil {
+				return err
+			}
+			return a.repository.BumpTokenVersion(ctx, id)
+		},
+	)
+}
+
+// adminUpdate applies an admin change and its audit record in one transaction
+// and returns the resulting state of the user. A failed change is audited as well.
+func (a *Application) adminUpdate(
+	ctx context.Context, actor, id uuid.UUID, action string, details map[string]string,
+	update func(ctx context.Context) error,
+) (*domain.User, error) {
+	event := domain.AuditEvent{
+		ActorID:   &actor,
+		SubjectID: &id,
+		Action:    action,
+		Outcome:   domain.AuditOutcomeSuccess,
+		Details:   details,
+	}
+	var user *domain.User
+	err := a.txManager.RunInTx(ctx, func(ctx context.Context) (err error) {
+		if err := update(ctx); err != nil {
+			return err
+		}
+		if err := a.audit(ctx, event); err != nil {
+			return err
+		}
+		user, err = a.userWithRoles(ctx, id)
+		return err
+	})
+	if err != nil {
+		event.Outcome = domain.AuditOutcomeFailure
+		a.auditFailure(ctx, event, err)
+		return nil, fmt.Errorf("failed to %s: %w", strings.TrimPrefix(action, "admin."), err)
+	}
+	return user, nil
+}
+
+func (a *Application) userWithRoles(ctx context.Context, id uuid.UUID) (*domain.User, error) {
+	user, err := a.repository.GetAnyUserByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	user.Roles, err = a.repository.GetUserRoles(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func normalizeRoles(roles []string) []string {
+	seen := make(map[string]struct{}, len(roles))
+	normalized := make([]string, 0, len(roles))
+	for _, r := range roles {
+		r = strings.ToLower(strings.TrimSpace(r))
+		if _, ok := seen[r]; ok || r == "" {
+			continue
+		}
+		seen[r] = struct{}{}
+		normalized = append(normalized, r)
+	}
+	return normalized
+}
+
+func newResetToken() (string, error) {
+	b := make([]byte, resetTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate reset token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,449 @@
+package app_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+func TestApplication_AuthenticateAdmin(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   func(t *testing.T, env *testEnv) string
+		wantErr error
+	}{
+		{
+			name: "admin",
+			token: func(t *testing.T, env *testEnv) string {
+				_, token := env.signUpAdmin(t)
+				return token
+			},
+		},
+		{
+			name:    "regular user",
+			token:   func(t *testing.T, env *testEnv) string { return env.signUp(t, "user@example.com").AccessToken },
+			wantErr: domain.ErrInsufficientScope,
+		},
+		{
+			name: "admin role revoked after login",
+			token: func(t *testing.T, env *testEnv) string {
+				id, token := env.signUpAdmin(t)
+				if err := env.repo.SetUserRoles(context.Background(), id, []string{domain.RoleUser}); err != nil {
+					t.Fatal(err)
+				}
+				return token
+			},
+			wantErr: domain.ErrInsufficientScope,
+		},
+		{
+			name:    "service token",
+			token:   func(t *testing.T, env *testEnv) string { return env.serviceToken(t) },
+			wantErr: domain.ErrServiceToken,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			claims, err := env.app.AuthenticateAdmin(context.Background(), tt.token(t, env))
+			checkErr(t, err, tt.wantErr)
+			if tt.wantErr == nil && !claims.HasScope(domain.ScopeAdmin) {
+				t.Errorf("claims lack the admin scope: %q", claims.Scope)
+			}
+		})
+	}
+}
+
+func TestApplication_GetUser(t *testing.T) {
+	env := newTestEnv(t)
+	adminID, _ := env.signUpAdmin(t)
+	userID := env.signUp(t, "user@example.com").Id
+
+	tests := []struct {
+		name    string
+		id      uuid.UUID
+		wantErr error
+	}{
+		{"existing", userID, nil},
+		{"unknown", uuid.New(), domain.ErrUserNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := env.app.GetUser(context.Background(), adminID, tt.id)
+			checkErr(t, err, tt.wantErr)
+			if tt.wantErr != nil {
+				return
+			}
+			if user.ID != tt.id || !slices.Equal(user.Roles, []string{domain.RoleUser}) {
+				t.Errorf("user = %s %v", user.ID, user.Roles)
+			}
+		})
+	}
+	if actions := env.auditActions(t, adminID); !slices.Contains(actions, domain.AuditAdminGetUser+":success") {
+		t.Errorf("audit = %v, want the lookup", actions)
+	}
+}
+
+func TestApplication_SearchUsers(t *testing.T) {
+	env := newTestEnv(t)
+	adminID, _ := env.signUpAdmin(t)
+	ids := map[string]uuid.UUID{}
+	for _, email := range []string{"anna@example.com", "Anton@example.com", "antonia@example.com", "bob@example.com"} {
+		ids[email] = env.signUp(t, email).Id
+	}
+
+	tests := []struct {
+		name       string
+		search     domain.UserSearch
+		wantEmails []string
+		wantNext   *domain.UserCursor
+	}{
+		{
+			name:       "prefix",
+			search:     domain.UserSearch{EmailPrefix: "an"},
+			wantEmails: []string{"anna@example.com", "Anton@example.com", "antonia@example.com"},
+		},
+		{
+			name:       "prefix matches the canonical email",
+			search:     domain.UserSearch{EmailPrefix: "ANTON"},
+			wantEmails: []string{"Anton@example.com", "antonia@example.com"},
+		},
+		{
+			name:       "first page",
+			search:     domain.UserSearch{EmailPrefix: "an", Limit: 2},
+			wantEmails: []string{"anna@example.com", "Anton@example.com"},
+			wantNext:   &domain.UserCursor{EmailCanonical: "anton@example.com", ID: ids["Anton@example.com"]},
+		},
+		{
+			name: "next page",
+			search: domain.UserSearch{
+				EmailPrefix: "an",
+				After:       domain.UserCursor{EmailCanonical: "anton@example.com", ID: ids["Anton@example.com"]},
+				Limit:       2,
+			},
+			wantEmails: []string{"antonia@example.com"},
+		},
+		{
+			name:   "no match",
+			search: domain.UserSearch{EmailPrefix: "zed"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := env.app.SearchUsers(context.Background(), adminID, tt.search)
+			checkErr(t, err, nil)
+			var emails []string
+			for _, u := range page.Users {
+				emails = append(emails, u.Email)
+			}
+			if !slices.Equal(emails, tt.wantEmails) || !reflect.DeepEqual(page.NextAfter, tt.wantNext) {
+				t.Errorf("got %v next %+v, want %v next %+v", emails, page.NextAfter, tt.wantEmails, tt.wantNext)
+			}
+		})
+	}
+}
+
+func TestApplication_AdminUserActions(t *testing.T) {
+	tests := []struct {
+		name   string
+		action func(env *testEnv, actor, id uuid.UUID) error
+		// check verifies the state of the user afterwards, given their original token.
+		check      func(t *testing.T, env *testEnv, token *domain.Token)
+		wantAction string
+	}{
+		{
+			name: "disable",
+			action: func(env *testEnv, actor, id uuid.UUID) error {
+				_, err := env.app.DisableUser(context.Background(), actor, id, "scam")
+				return err
+			},
+			check: func(t *testing.T, env *testEnv, token *domain.Token) {
+				expectRevoked(t, env, token)
+				_, err := env.app.Login(context.Background(), domain.LoginCredentials{Email: "user@example.com", Password: testPassword})
+				checkErr(t, err, domain.ErrUserDisabled)
+			},
+			wantAction: domain.AuditAdminDisableUser,
+		},
+		{
+			name: "enable",
+			action: func(env *testEnv, actor, id uuid.UUID) error {
+				if _, err := env.app.DisableUser(context.Background(), actor, id, "scam"); err != nil {
+					return err
+				}
+				_, err := env.app.EnableUser(context.Background(), actor, id, "appeal")
+				return err
+			},
+			check: func(t *testing.T, env *testEnv, token *domain.Token) {
+				_, err := env.app.Login(context.Background(), domain.LoginCredentials{Email: "user@example.com", Password: testPassword})
+				checkErr(t, err, nil)
+			},
+			wantAction: domain.AuditAdminEnableUser,
+		},
+		{
+			name: "suspend",
+			action: func(env *testEnv, actor, id uuid.UUID) error {
+				_, err := env.app.SuspendUser(context.Background(), actor, id, "harassment", nil)
+				return err
+			},
+			check: func(t *testing.T, env *testEnv, token *domain.Token) {
+				_, err := env.app.Validate(context.Background(), token.AccessToken, "")
+				checkErr(t, err, domain.ErrAccountSuspended)
+				_, err = env.app.Refresh(context.Background(), token.RefreshToken)
+				checkErr(t, err, domain.ErrAccountSuspended)
+				_, err = env.app.Login(context.Background(), domain.LoginCredentials{Email: "user@example.com", Password: testPassword})
+				checkErr(t, err, domain.ErrAccountSuspended)
+			},
+			wantAction: domain.AuditAdminSuspendUser,
+		},
+		{
+			name: "ban",
+			action: func(env *testEnv, actor, id uuid.UUID) error {
+				user, err := env.app.BanUser(context.Background(), actor, id, "romance scam", nil)
+				if err == nil && (user.StatusAt(time.Now()) != domain.StatusBanned || *user.StatusActorID != actor) {
+					return errors.New("user not banned by the actor")
+				}
+				return err
+			},
+			check: func(t *testing.T, env *testEnv, token *domain.Token) {
+				expectRevoked(t, env, token)
+				_, err := env.app.Login(context.Background(), domain.LoginCredentials{Email: "user@example.com", Password: testPassword})
+				checkErr(t, err, domain.ErrAccountBanned)
+			},
+			wantAction: domain.AuditAdminBanUser,
+		},
+		{
+			name: "reinstate",
+			action: func(env *testEnv, actor, id uuid.UUID) error {
+				if _, err := env.app.BanUser(context.Background(), actor, id, "romance scam", nil); err != nil {
+					return err
+				}
+				_, err := env.app.ReinstateUser(context.Background(), actor, id, "appeal")
+				return err
+			},
+			check: func(t *testing.T, env *testEnv, token *domain.Token) {
+				_, err := env.app.Login(context.Background(), domain.LoginCredentials{Email: "user@example.com", Password: testPassword})
+				checkErr(t, err, nil)
+			},
+			wantAction: domain.AuditAdminReinstateUser,
+		},
+		{
+			name: "force logout",
+			action: func(env *testEnv, actor, id uuid.UUID) error {
+				_, err := env.app.ForceLogout(context.Background(), actor, id, "stolen phone")
+				return err
+			},
+			check: func(t *testing.T, env *testEnv, token *domain.Token) {
+				expectRevoked(t, env, token)
+			},
+			wantAction: domain.AuditAdminForceLogout,
+		},
+		{
+			name: "force password reset",
+			action: func(env *testEnv, actor, id uuid.UUID) error {
+				user, err := env.app.ForcePasswordReset(context.Background(), actor, id, "leaked password")
+				if err == nil && !user.PasswordResetRequired {
+					return errors.New("password reset not required")
+				}
+				return err
+			},
+			check: func(t *testing.T, env *testEnv, token *domain.Token) {
+				expectRevoked(t, env, token)
+				// The token goes to the user, not back to the admin.
+				if sent := env.alerts.secretsSent(domain.SecretPasswordReset); len(sent) != 1 || sent[0].UserID != token.Id {
+					t.Errorf("reset tokens sent = %+v, want one to the user", sent)
+				}
+				_, err := env.app.Login(context.Background(), domain.LoginCredentials{Email: "user@example.com", Password: testPassword})
+				checkErr(t, err, domain.ErrPasswordResetNeeded)
+			},
+			wantAction: domain.AuditAdminForcePasswordReset,
+		},
+		{
+			name: "set roles",
+			action: func(env *testEnv, actor, id uuid.UUID) error {
+				user, err := env.app.SetRoles(context.Background(), actor, id, []string{" Premium", "user", "premium"})
+				if err == nil && !slices.Equal(user.Roles, []string{domain.RolePremium, domain.RoleUser}) {
+					return errors.New("unexpected roles " + user.Email)
+				}
+				return err
+			},
+			check: func(t *testing.T, env *testEnv, token *domain.Token) {
+				// The old token must not keep the previous roles.
+				_, err := env.app.Validate(context.Background(), token.AccessToken, "")
+				checkErr(t, err, domain.ErrTokenOutdated)
+				refreshed, err := env.app.Refresh(context.Background(), token.RefreshToken)
+				checkErr(t, err, nil)
+				_, err = env.app.Validate(context.Background(), refreshed.AccessToken, "likes:unlimited")
+				checkErr(t, err, nil)
+			},
+			wantAction: domain.AuditAdminSetRoles,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			adminID, _ := env.signUpAdmin(t)
+			token := env.signUp(t, "user@example.com")
+
+			checkErr(t, tt.action(env, adminID, token.Id), nil)
+			tt.check(t, env, token)
+			if actions := env.auditActions(t, token.Id); !slices.Contains(actions, tt.wantAction+":success") {
+				t.Errorf("audit = %v, want %s", actions, tt.wantAction)
+			}
+		})
+	}
+}
+
+func TestApplication_AdminUserActionsFailures(t *testing.T) {
+	tests := []struct {
+		name    string
+		action  func(env *testEnv, actor, id uuid.UUID) error
+		unknown bool
+		wantErr error
+	}{
+		{
+			name: "disable unknown user",
+			action: func(env *testEnv, actor, id uuid.UUID) error {
+				_, err := env.app.DisableUser(context.Background(), actor, id, "")
+				return err
+			},
+			unknown: true,
+			wantErr: domain.ErrUserNotFound,
+		},
+		{
+			name: "enable unknown user",
+			action: func(env *testEnv, actor, id uuid.UUID) error {
+				_, err := env.app.EnableUser(context.Background(), actor, id, "")
+				return err
+			},
+			unknown: true,
+			wantErr: domain.ErrUserNotFound,
+		},
+		{
+			name: "force logout of unknown user",
+			action: func(env *testEnv, actor, id uuid.UUID) error {
+				_, err := env.app.ForceLogout(context.Background(), actor, id, "")
+				return err
+			},
+			unknown: true,
+			wantErr: domain.ErrUserNotFound,
+		},
+		{
+			name: "force password reset of unknown user",
+			action: func(env *testEnv, actor, id uuid.UUID) error {
+				_, err := env.app.ForcePasswordReset(context.Background(), actor, id, "")
+				return err
+			},
+			unknown: true,
+			wantErr: domain.ErrUserNotFound,
+		},
+		{
+			name: "ban unknown user",
+			action: func(env *testEnv, actor, id uuid.UUID) error {
+				_, err := env.app.BanUser(context.Background(), actor, id, "scam", nil)
+				return err
+			},
+			unknown: true,
+			wantErr: domain.ErrUserNotFound,
+		},
+		{
+			name: "ban without reason",
+			action: func(env *testEnv, actor, id uuid.UUID) error {
+				_, err := env.app.BanUser(context.Background(), actor, id, " ", nil)
+				return err
+			},
+			wantErr: domain.ErrMissingReason,
+		},
+		{
+			name: "suspend until the past",
+			action: func(env *testEnv, actor, id uuid.UUID) error {
+				_, err := env.app.SuspendUser(context.Background(), actor, id, "spam", ptr(time.Now().Add(-time.Hour)))
+				return err
+			},
+			wantErr: domain.ErrInvalidExpiry,
+		},
+		{
+			name: "set unknown role",
+			action: func(env *testEnv, actor, id uuid.UUID) error {
+				_, err := env.app.SetRoles(context.Background(), actor, id, []string{"superuser"})
+				return err
+			},
+			wantErr: domain.ErrUnknownRole,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			adminID, _ := env.signUpAdmin(t)
+			id := env.signUp(t, "user@example.com").Id
+			if tt.unknown {
+				id = uuid.New()
+			}
+
+			checkErr(t, tt.action(env, adminID, id), tt.wantErr)
+			actions := env.auditActions(t, id)
+			if len(actions) == 0 || !strings.HasSuffix(actions[0], ":"+domain.AuditOutcomeFailure) {
+				t.Errorf("audit = %v, want the failure recorded last", actions)
+			}
+		})
+	}
+}
+
+func expectRevoked(t *testing.T, env *testEnv, token *domain.Token) {
+	t.Helper()
+	_, err := env.app.Validate(context.Background(), token.AccessToken, "")
+	checkErr(t, err, domain.ErrSessionRevoked)
+}
+
+func TestApplication_BanEvasion(t *testing.T) {
+	tests := []struct {
+		name string
+		// banFor limits the ban if set.
+		banFor    time.Duration
+		reinstate bool
+		email     string
+		wantErr   error
+	}{
+		{name: "alias of a banned email", email: "Scam.Mer+new@googlemail.com", wantErr: domain.ErrIdentifierBanned},
+		{name: "other email", email: "someone@gmail.com"},
+		{name: "reinstated", reinstate: true, email: "scammer+new@gmail.com"},
+		{name: "expired ban", banFor: 200 * time.Millisecond, email: "scammer+new@gmail.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			ctx := context.Background()
+			adminID, _ := env.signUpAdmin(t)
+			token := env.signUp(t, "scammer@gmail.com")
+			// The deadline follows the slow sign-ups, so the ban is still
+			// running when it is created.
+			var until *time.Time
+			if tt.banFor > 0 {
+				until = ptr(time.Now().Add(tt.banFor))
+			}
+			_, err := env.app.BanUser(ctx, adminID, token.Id, "romance scam", until)
+			checkErr(t, err, nil)
+			if tt.reinstate {
+				_, err := env.app.ReinstateUser(ctx, adminID, token.Id, "appeal")
+				checkErr(t, err, nil)
+			}
+			// Purging the account does not lift the ban of the email.
+			now := time.Now()
+			checkErr(t, env.repo.SoftDeleteUser(ctx, token.Id, now, now), nil)
+			_, err = env.repo.PurgeUsers(ctx, now)
+			checkErr(t, err, nil)
+			if until != nil {
+				time.Sleep(time.Until(*until))
+			}
+
+			_, err = env.app.SignUp(ctx, registration(tt.email, testPassword))
+			checkErr(t, err, tt.wantErr)
+		})
+	}
+}
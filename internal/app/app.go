@@ -2,115 +2,494 @@ package app
 
 import (
 	"context"
+	"crypto/rsa"
+	"errors"
 	"fmt"
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/soulmate-dating/auth/internal/adapters/geoip"
 	"github.com/soulmate-dating/auth/internal/adapters/jwt"
+	"github.com/soulmate-dating/auth/internal/adapters/metrics"
+	"github.com/soulmate-dating/auth/internal/adapters/notifier"
 	"github.com/soulmate-dating/auth/internal/adapters/postgres"
+	"github.com/soulmate-dating/auth/internal/adapters/publisher"
 	"github.com/soulmate-dating/auth/internal/config"
 	"github.com/soulmate-dating/auth/internal/domain"
 	"github.com/soulmate-dating/auth/internal/hash"
-	"log"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
-const jwtTag = "jwt"
+const (
+	jwtTag = "jwt"
+	// countryTag accepts ISO 3166-1 alpha-2 codes.
+	countryTag = "required,iso3166_1_alpha2"
+	// maxValidateBatch limits the number of tokens checked by one ValidateMany call.
+	maxValidateBatch = 100
+)
 
 type App interface {
-	SignUp(ctx context.Context, credentials domain.LoginCredentials) (*domain.Token, error)
+	SignUp(ctx context.Context, registration domain.Registration) (*domain.Token, error)
+	CreateGuest(ctx context.Context, registration domain.GuestRegistration) (*domain.Token, error)
 	Login(ctx context.Context, credentials domain.LoginCredentials) (*domain.Token, error)
 	Refresh(ctx context.Context, token string) (*domain.Token, error)
 	Logout(ctx context.Context, token string) (string, error)
-	Validate(ctx context.Context, token string) (string, error)
+	Validate(ctx context.Context, token, scope string) (*domain.Claims, error)
+	ValidateMany(ctx context.Context, tokens []string, scope string) ([]ValidationResult, error)
+	IssueServiceToken(ctx context.Context, credentials domain.ClientCredentials) (*domain.ServiceToken, error)
+	VerificationKeys() jwt.JWKS
+	DeleteAccount(ctx context.Context, token, password string) (*domain.User, error)
+	ExportMyData(ctx context.Context, token string) (*domain.UserDataExport, error)
+	ListLoginHistory(ctx context.Context, token string, filter domain.LoginFilter) (*domain.LoginPage, error)
+	ResetPassword(ctx context.Context, resetToken, password string) (string, error)
+	RequestEmailChange(ctx context.Context, token, password, newEmail string) (*domain.EmailChange, error)
+	ConfirmEmailChange(ctx context.Context, token, code string) (*domain.User, error)
+	RevertEmailChange(ctx context.Context, revertToken string) (*domain.PasswordReset, error)
+	JoinWaitlist(ctx context.Context, email string) error
+	AcceptTerms(ctx context.Context, token string, accepted []domain.DocumentVersion) ([]domain.DocumentVersion, error)
 }
 
 type Repository interface {
 	CreateUser(ctx context.Context, p *domain.User) (uuid.UUID, error)
-	GetUserByEmail(ctx context.Context, email string) (*domain.User, error)
+	// UpgradeGuest sets the credentials of a guest and bumps their TokenVersion.
+	UpgradeGuest(ctx context.Context, u *domain.User) error
+	// GetUserByEmail looks up an active user by the canonical form of their email.
+	GetUserByEmail(ctx context.Context, canonical string) (*domain.User, error)
+	GetUserByID(ctx context.Context, id uuid.UUID) (*domain.User, error)
+	SoftDeleteUser(ctx context.Context, id uuid.UUID, deletedAt, purgeAfter time.Time) error
+	PurgeUsers(ctx context.Context, before time.Time) (int64, error)
+	// ExpireGuests soft-deletes the guests created before createdBefore, to be
+	// purged at once, and returns their IDs.
+	ExpireGuests(ctx context.Context, createdBefore, now time.Time) ([]uuid.UUID, error)
+	GetAnyUserByID(ctx context.Context, id uuid.UUID) (*domain.User, error)
+	SearchUsers(ctx context.Context, search domain.UserSearch) ([]domain.User, error)
+	SetUserDisabled(ctx context.Context, id uuid.UUID, disabledAt *time.Time) error
+	RequirePasswordReset(ctx context.Context, id uuid.UUID) error
+	UpdatePassword(ctx context.Context, id uuid.UUID, password string) error
+	GetUserRoles(ctx context.Context, id uuid.UUID) ([]string, error)
+	SetUserRoles(ctx context.Context, id uuid.UUID, roles []string) error
+	// BumpTokenVersion outdates the access tokens issued to the user.
+	BumpTokenVersion(ctx context.Context, id uuid.UUID) error
+	GetUserPermissions(ctx context.Context, id uuid.UUID) ([]string, error)
+	CreatePasswordReset(ctx context.Context, p *domain.PasswordReset) error
+	GetPasswordReset(ctx context.Context, tokenHash string) (*domain.PasswordReset, error)
+	UsePasswordReset(ctx context.Context, tokenHash string, usedAt time.Time) error
+	// UpdateEmail changes the email of the user to a verified one and bumps
+	// their TokenVersion. Addresses are only set once a code or token sent
+	// there came back.
+	UpdateEmail(ctx context.Context, id uuid.UUID, email, canonical string) error
+	// CreateEmailChange replaces the pending email change of the user.
+	CreateEmailChange(ctx context.Context, c *domain.EmailChange) error
+	GetPendingEmailChange(ctx context.Context, userID uuid.UUID) (*domain.EmailChange, error)
+	GetEmailChangeByRevertToken(ctx context.Context, tokenHash string) (*domain.EmailChange, error)
+	UpdateEmailChange(ctx context.Context, c *domain.EmailChange) error
+	// ListEmailChanges returns the email changes of the user, newest first.
+	ListEmailChanges(ctx context.Context, userID uuid.UUID) ([]domain.EmailChange, error)
+	SetUserStatus(ctx context.Context, id uuid.UUID, change domain.StatusChange) error
+	// AddBannedIdentifier replaces an earlier ban of the same identifier.
+	AddBannedIdentifier(ctx context.Context, b *domain.BannedIdentifier) error
+	DeleteBannedIdentifiers(ctx context.Context, userID uuid.UUID) error
+	ListBannedIdentifiers(ctx context.Context, userID uuid.UUID) ([]domain.BannedIdentifier, error)
+	IsIdentifierBanned(ctx context.Context, kind, value string, now time.Time) (bool, error)
+	// AddConsents keeps the first acceptance of a version.
+	AddConsents(ctx context.Context, consents []domain.Consent) error
+	ListConsents(ctx context.Context, userID uuid.UUID) ([]domain.Consent, error)
+	CreateInviteCode(ctx context.Context, c *domain.InviteCode) error
+	// UseInviteCode counts a use of the code and returns its ID, or
+	// ErrInvalidInviteCode if it is used up or expired.
+	UseInviteCode(ctx context.Context, codeHash string, now time.Time) (uuid.UUID, error)
+	// AddToWaitlist returns the existing entry of an email already on the waitlist.
+	AddToWaitlist(ctx context.Context, e *domain.WaitlistEntry) (*domain.WaitlistEntry, error)
+	// GetWaitlistEntry returns ErrWaitlistEntryNotFound unless the canonical
+	// email is on the waitlist.
+	GetWaitlistEntry(ctx context.Context, canonical string) (*domain.WaitlistEntry, error)
+	// ListWaitlist returns the oldest entries not admitted yet.
+	ListWaitlist(ctx context.Context, limit int) ([]domain.WaitlistEntry, error)
+	AdmitWaitlistEntry(ctx context.Context, id, inviteCodeID uuid.UUID, at time.Time) error
+	// GetIdempotencyRecord returns ErrIdempotencyKeyNotFound unless the key
+	// has a record that has not expired at now.
+	GetIdempotencyRecord(ctx context.Context, operation, key string, now time.Time) (*domain.IdempotencyRecord, error)
+	// SaveIdempotencyRecord returns ErrIdempotencyKeyReused if the key has a
+	// record that has not expired.
+	SaveIdempotencyRecord(ctx context.Context, rec *domain.IdempotencyRecord) error
+	DeleteExpiredIdempotencyRecords(ctx context.Context, before time.Time) (int64, error)
+	// CountRequest counts a request of key in the window starting at
+	// windowStart and returns the requests of key in that window so far.
+	// Counts of earlier windows are discarded.
+	CountRequest(ctx context.Context, key string, windowStart time.Time) (int, error)
+	DeleteRateLimits(ctx context.Context, before time.Time) (int64, error)
 }
 
 type TransactionManager interface {
 	RunInTx(ctx context.Context, f func(ctx context.Context) error) error
+	// RunInTxWithOptions runs f again when its transaction conflicts with a
+	// concurrent one, so f must have no effects outside the transaction.
+	RunInTxWithOptions(ctx context.Context, opts domain.TxOptions, f func(ctx context.Context) error) error
 }
 
 type Application struct {
-	validate   *validator.Validate
-	repository Repository
-	jwtWrapper jwt.Wrapper
-	txManager  TransactionManager
+	validate            *validator.Validate
+	repository          Repository
+	sessions            SessionRepository
+	clients             ServiceClientRepository
+	outbox              OutboxRepository
+	auditLog            AuditRepository
+	logins              LoginHistoryRepository
+	geo                 GeoLocator
+	notifier            Notifier
+	jwtWrapper          *jwt.Wrapper
+	txManager           TransactionManager
+	metrics             Metrics
+	deletionGracePeriod time.Duration
+	passwordResetTTL    time.Duration
+	emailChangeCodeTTL  time.Duration
+	emailRevertTTL      time.Duration
+	emailProviderRules  bool
+	agePolicy           domain.AgePolicy
+	consentPolicy       domain.ConsentPolicy
+	registrationMode    domain.RegistrationMode
+	waitlistInviteTTL   time.Duration
+	idempotencyKeyTTL   time.Duration
+	rateLimits          atomic.Pointer[rateLimits]
+	guestTTL            time.Duration
+	alerts              chan domain.NewDeviceLogin
+	jobs                []func(ctx context.Context) error
+	// closers release the adapters New opened, once the servers have stopped.
+	closers []func() error
+}
+
+// Jobs returns the background jobs that must run alongside the servers.
+func (a *Application) Jobs() []func(ctx context.Context) error {
+	return a.jobs
+}
+
+// Close releases the adapters opened by New, such as the GeoIP database. It
+// must be called after the servers and jobs stopped using the Application.
+func (a *Application) Close() error {
+	var errs []error
+	for _, closer := range a.closers {
+		errs = append(errs, closer())
+	}
+	return errors.Join(errs...)
+}
+
+// Reload applies the reloadable settings of cfg: token lifetimes and rate
+// limits. Tokens issued before keep their lifetimes, and requests counted
+// before count towards the new limits.
+func (a *Application) Reload(cfg config.Config) {
+	a.rateLimits.Store(newRateLimits(cfg.Account))
+	a.jwtWrapper.SetExpirations(jwt.Expirations{
+		Access:       cfg.JWT.AccessExpirationHours,
+		Refresh:      cfg.JWT.RefreshExpirationHours,
+		Service:      cfg.JWT.ServiceExpiration,
+		GuestAccess:  cfg.JWT.GuestAccessExpiration,
+		GuestRefresh: cfg.JWT.GuestRefreshExpiration,
+	})
+}
+
+// Validate checks the access token of a user or a service client and, if scope
+// is not empty, that the token grants it.
+func (a *Application) Validate(ctx context.Context, token, scope string) (*domain.Claims, error) {
+	claims, err := a.validateAccessToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireScope(claims, scope); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// VerificationKeys returns the public keys other services verify access tokens with.
+func (a *Application) VerificationKeys() jwt.JWKS {
+	return a.jwtWrapper.JWKS()
+}
+
+// ValidationResult is the outcome of validating one token of a batch.
+// Exactly one of Claims and Err is set.
+type ValidationResult struct {
+	Claims *domain.Claims
+	Err    error
+}
+
+// ValidateMany validates every token like Validate does. An invalid token
+// does not fail the batch; its error is reported in the matching result.
+func (a *Application) ValidateMany(ctx context.Context, tokens []string, scope string) ([]ValidationResult, error) {
+	if len(tokens) > maxValidateBatch {
+		return nil, fmt.Errorf("%w: at most %d tokens are allowed", domain.ErrBatchTooLarge, maxValidateBatch)
+	}
+	results := make([]ValidationResult, len(tokens))
+	for i, token := range tokens {
+		claims, err := a.Validate(ctx, token, scope)
+		results[i] = ValidationResult{Claims: claims, Err: err}
+	}
+	return results, nil
+}
+
+// authenticate validates the access token of a user calling an account operation.
+func (a *Application) authenticate(ctx context.Context, token string) (*domain.Claims, error) {
+	claims, err := a.validateAccessToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if claims.IsService() {
+		return nil, domain.ErrServiceToken
+	}
+	return claims, nil
 }
 
-func (a *Application) Validate(_ context.Context, token string) (string, error) {
+// validateAccessToken checks the token and that the session or service client
+// it was issued to is still active. User tokens must also be of the current
+// TokenVersion, so that no claims outlive a change of the account, and the
+// account must not be suspended or banned.
+func (a *Application) validateAccessToken(ctx context.Context, token string) (*domain.Claims, error) {
 	err := a.validate.Var(token, jwtTag)
 	if err != nil {
-		return "", fmt.Errorf("invalid token: %w", err)
+		return nil, fmt.Errorf("invalid token: %w", err)
 	}
 	claims, err := a.jwtWrapper.ValidateAccessToken(token)
 	if err != nil {
-		return "", err
+		a.metrics.TokenValidationFailed(tokenFailureReason(err))
+		return nil, err
+	}
+	if claims.IsService() {
+		if _, err := a.activeServiceClient(ctx, claims.ClientID); err != nil {
+			if errors.Is(err, domain.ErrInvalidClient) {
+				a.metrics.TokenValidationFailed(TokenFailureRevoked)
+			}
+			return nil, err
+		}
+		return claims, nil
+	}
+	if _, err := a.activeSession(ctx, claims.SessionId); err != nil {
+		if errors.Is(err, domain.ErrSessionRevoked) {
+			a.metrics.TokenValidationFailed(TokenFailureRevoked)
+		}
+		return nil, err
+	}
+	user, err := a.repository.GetUserByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user by id: %w", err)
 	}
-	return claims.Id.String(), nil
+	if user.TokenVersion != claims.Version {
+		a.metrics.TokenValidationFailed(TokenFailureRevoked)
+		return nil, domain.ErrTokenOutdated
+	}
+	if err := user.CheckStatus(time.Now()); err != nil {
+		a.metrics.TokenValidationFailed(TokenFailureRevoked)
+		return nil, err
+	}
+	return claims, nil
 }
 
-func (a *Application) Logout(_ context.Context, token string) (string, error) {
-	claims, err := a.jwtWrapper.ValidateAccessToken(token)
+func (a *Application) Logout(ctx context.Context, token string) (string, error) {
+	claims, err := a.authenticate(ctx, token)
 	if err != nil {
 		return "", fmt.Errorf("invalid token: %w", err)
 	}
-	return claims.Id.String(), nil
+	if err := a.sessions.RevokeSession(ctx, claims.SessionId); err != nil {
+		return "", fmt.Errorf("failed to logout: %w", err)
+	}
+	a.auditSuccess(ctx, claims.UserID, domain.AuditLogout)
+	return claims.UserID.String(), nil
 }
 
-func (a *Application) SignUp(ctx context.Context, credentials domain.LoginCredentials) (token *domain.Token, err error) {
-	err = a.validate.Struct(credentials)
+// SignUp creates a user who passes the age gate and starts their session. A
+// guest signing up with their access token becomes that user instead.
+// Retried with the idempotency key of the first call, it starts another
+// session of the same user.
+func (a *Application) SignUp(ctx context.Context, registration domain.Registration) (*domain.Token, error) {
+	// The password is checked on replay instead of being hashed with the request.
+	request := registration
+	request.Password = ""
+	idempotent, err := newIdempotentRequest(ctx, domain.IdempotencyOperationSignUp, request)
 	if err != nil {
-		return nil, fmt.Errorf("invalid email or password: %w", err)
+		return nil, err
 	}
-	var user *domain.User
-	err = a.txManager.RunInTx(ctx, func(ctx context.Context) error {
-		user, err = a.signup(ctx, credentials)
-		return err
+	if idempotent == nil {
+		return a.signUp(ctx, registration, nil)
+	}
+	token, err := a.replaySignUp(ctx, idempotent, registration.Password)
+	if !errors.Is(err, domain.ErrIdempotencyKeyNotFound) {
+		return token, err
+	}
+	token, err = a.signUp(ctx, registration, idempotent)
+	if errors.Is(err, domain.ErrAlreadyExists) || errors.Is(err, domain.ErrIdempotencyKeyReused) {
+		// A concurrent call with the key may have signed up first.
+		if replayed, rerr := a.replaySignUp(ctx, idempotent, registration.Password); !errors.Is(rerr, domain.ErrIdempotencyKeyNotFound) {
+			return replayed, rerr
+		}
+	}
+	return token, err
+}
+
+// signUpTxOptions keep the read committed isolation the audit hash chain relies
+// on, and retry the sign-ups that deadlock with concurrent ones over the same
+// invite code or guest.
+var signUpTxOptions = domain.TxOptions{Isolation: domain.ReadCommitted, Retries: 2}
+
+func (a *Application) signUp(
+	ctx context.Context, registration domain.Registration, idempotent *idempotentRequest,
+) (token *domain.Token, err error) {
+	email, err := a.checkCredentials(&registration.LoginCredentials)
+	if err != nil {
+		return nil, err
+	}
+	var guestID uuid.UUID
+	if registration.GuestToken != "" {
+		if guestID, err = a.authenticateGuest(ctx, registration.GuestToken); err != nil {
+			return nil, err
+		}
+	}
+	attestedAt, err := a.checkAge(ctx, registration.DateOfBirth, registration.Country)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.consentPolicy.Check(registration.Accepted); err != nil {
+		return nil, err
+	}
+	err = a.txManager.RunInTxWithOptions(ctx, signUpTxOptions, func(ctx context.Context) error {
+		// The use of the code is rolled back if the sign-up fails.
+		details, err := a.useInviteCode(ctx, registration.InviteCode)
+		if err != nil {
+			return err
+		}
+		user, err := a.signup(ctx, email, registration.Password, attestedAt, guestID)
+		if err != nil {
+			return err
+		}
+		if guestID != uuid.Nil {
+			if details == nil {
+				details = map[string]string{}
+			}
+			details["upgraded_guest"] = "true"
+		}
+		if err := a.repository.AddConsents(ctx, newConsents(ctx, user.ID, a.consentPolicy)); err != nil {
+			return err
+		}
+		// The sign-up sets the baseline of new device alerts, so none is sent for it.
+		token, _, err = a.startSession(ctx, user)
+		if err != nil {
+			return err
+		}
+		if idempotent != nil {
+			if err := a.remember(ctx, idempotent, user.ID); err != nil {
+				return err
+			}
+		}
+		return a.audit(ctx, domain.AuditEvent{
+			ActorID:   &user.ID,
+			SubjectID: &user.ID,
+			Action:    domain.AuditSignUp,
+			Outcome:   domain.AuditOutcomeSuccess,
+			Details:   details,
+		})
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to signup: %w", err)
 	}
-	return a.generateTokenForUser(user)
+	a.metrics.SignUp()
+	return token, nil
 }
 
-func (a *Application) signup(ctx context.Context, credentials domain.LoginCredentials) (*domain.User, error) {
-	_, err := a.repository.GetUserByEmail(ctx, credentials.Email)
-	if err == nil {
-		return nil, domain.ErrAlreadyExists
+// signup creates the user, or upgrades the guest with guestID unless it is uuid.Nil.
+func (a *Application) signup(
+	ctx context.Context, email domain.Email, password string, ageAttestedAt time.Time, guestID uuid.UUID,
+) (*domain.User, error) {
+	if err := a.checkEmailNotBanned(ctx, email); err != nil {
+		return nil, err
 	}
-
+	// A taken email is reported by CreateUser or UpgradeGuest rather than checked
+	// beforehand, as a concurrent sign-up could take it in between.
 	user := &domain.User{
-		ID:       domain.NewUUID(),
-		Email:    credentials.Email,
-		Password: hash.HashPassword(credentials.Password),
+		ID:               domain.NewUUID(),
+		Email:            email.Display,
+		EmailCanonical:   email.Canonical,
+		Password:         a.hashPassword(password),
+		AgeAttestedAt:    &ageAttestedAt,
+		AgePolicyVersion: a.agePolicy.Version,
 	}
 
-	id, err := a.repository.CreateUser(ctx, user)
+	var err error
+	if guestID != uuid.Nil {
+		user.ID = guestID
+		if user, err = a.upgradeGuest(ctx, user); err != nil {
+			return nil, err
+		}
+	} else {
+		id, err := a.repository.CreateUser(ctx, user)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create user: %w", err)
+		}
+		user.ID = id
+	}
+	err = a.repository.SetUserRoles(ctx, user.ID, []string{domain.RoleUser})
+	if err != nil {
+		return nil, fmt.Errorf("failed to grant default role: %w", err)
+	}
+	err = a.recordEvent(ctx, domain.UserCreated{UserID: user.ID, Email: user.Email})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create user: %w", err)
+		return nil, err
 	}
-	user.ID = id
 	return user, nil
 }
 
 func (a *Application) Login(ctx context.Context, credentials domain.LoginCredentials) (*domain.Token, error) {
-	err := a.validate.Struct(credentials)
+	email, err := a.checkCredentials(&credentials)
 	if err != nil {
-		return nil, fmt.Errorf("invalid email or password: %w", err)
+		return nil, err
 	}
-	user, err := a.repository.GetUserByEmail(ctx, credentials.Email)
+	user, err := a.repository.GetUserByEmail(ctx, email.Canonical)
 	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			a.metrics.LoginFailed(LoginFailureUnknownUser)
+			a.auditFailure(ctx, domain.AuditEvent{Action: domain.AuditLogin}, err)
+		}
 		return nil, fmt.Errorf("failed to get user by email: %w", err)
 	}
 
-	match := hash.CheckPasswordHash(credentials.Password, user.Password)
+	match := a.checkPassword(credentials.Password, user.Password)
 	if !match {
+		a.metrics.LoginFailed(LoginFailureWrongPassword)
+		a.auditFailure(ctx, domain.AuditEvent{SubjectID: &user.ID, Action: domain.AuditLogin}, domain.ErrWrongPassword)
 		return nil, domain.ErrWrongPassword
 	}
+	if err := checkUserAccess(user); err != nil {
+		a.metrics.LoginFailed(LoginFailureLocked)
+		a.auditFailure(ctx, domain.AuditEvent{SubjectID: &user.ID, Action: domain.AuditLogin}, err)
+		return nil, err
+	}
 
-	return a.generateTokenForUser(user)
+	var token *domain.Token
+	var alert *domain.NewDeviceLogin
+	err = a.txManager.RunInTx(ctx, func(ctx context.Context) error {
+		var login *domain.Login
+		if token, login, err = a.startSession(ctx, user); err != nil {
+			return err
+		}
+		if !login.NewDevice {
+			return nil
+		}
+		e := newDeviceLogin(user, login)
+		alert = &e
+		return a.recordEvent(ctx, e)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if alert != nil {
+		a.notifyNewDeviceLogin(ctx, *alert)
+	}
+	if token.PendingConsents, err = a.pendingConsents(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	a.metrics.LoginSucceeded()
+	a.auditSuccess(ctx, user.ID, domain.AuditLogin)
+	return token, nil
 }
 
 func (a *Application) Refresh(ctx context.Context, token string) (*domain.Token, error) {
@@ -120,22 +499,84 @@ func (a *Application) Refresh(ctx context.Context, token string) (*domain.Token,
 	}
 	claims, err := a.jwtWrapper.ValidateRefreshToken(token)
 	if err != nil {
+		a.metrics.TokenValidationFailed(tokenFailureReason(err))
 		return nil, err
 	}
-	user, err := a.repository.GetUserByEmail(ctx, claims.Email)
+	session, err := a.activeSession(ctx, claims.SessionId)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user by email: %w", err)
+		if errors.Is(err, domain.ErrSessionRevoked) {
+			a.metrics.TokenValidationFailed(TokenFailureRevoked)
+		}
+		return nil, err
+	}
+	presentedHash := hash.HashToken(token)
+	if presentedHash != session.RefreshTokenHash {
+		return nil, a.refreshTokenReused(ctx, session)
+	}
+	user, err := a.repository.GetUserByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user by id: %w", err)
+	}
+	if err := checkUserAccess(user); err != nil {
+		return nil, err
+	}
+
+	newToken, err := a.rotateSession(ctx, session, user, presentedHash)
+	if err != nil {
+		return nil, err
+	}
+	// Guests accept the documents when they sign up.
+	if !user.Guest {
+		if newToken.PendingConsents, err = a.pendingConsents(ctx, user.ID); err != nil {
+			return nil, err
+		}
+	}
+	a.auditSuccess(ctx, user.ID, domain.AuditRefresh)
+	return newToken, nil
+}
+
+// checkAge validates the declared country and checks someone born on
+// dateOfBirth is old enough to sign up there, returning the time of the
+// attestation. As the country is declared by the client, the minimum age is
+// the one of the jurisdiction the client's address is located in if that is
+// stricter.
+func (a *Application) checkAge(ctx context.Context, dateOfBirth time.Time, country string) (time.Time, error) {
+	country = strings.ToUpper(strings.TrimSpace(country))
+	if err := a.validate.Var(country, countryTag); err != nil {
+		return time.Time{}, fmt.Errorf("invalid country: %w", err)
 	}
+	location, err := a.geo.Locate(ClientInfoFromContext(ctx).IP)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to locate sign-up", slog.Any("error", err))
+	}
+	jurisdiction := a.agePolicy.Jurisdiction(country, location.Country)
+	now := time.Now().UTC()
+	if err := a.agePolicy.Check(dateOfBirth, jurisdiction, now); err != nil {
+		return time.Time{}, err
+	}
+	return now, nil
+}
 
-	return a.generateTokenForUser(user)
+// checkCredentials normalizes the email of the credentials and validates them.
+// Users are looked up by the returned canonical form.
+func (a *Application) checkCredentials(credentials *domain.LoginCredentials) (domain.Email, error) {
+	email, err := domain.NormalizeEmail(credentials.Email, a.emailProviderRules)
+	if err != nil {
+		return domain.Email{}, fmt.Errorf("invalid email or password: %w", err)
+	}
+	credentials.Email = email.Display
+	if err := a.validate.Struct(credentials); err != nil {
+		return domain.Email{}, fmt.Errorf("invalid email or password: %w", err)
+	}
+	return email, nil
 }
 
-func (a *Application) generateTokenForUser(user *domain.User) (*domain.Token, error) {
-	accessToken, err := a.jwtWrapper.GenerateAccessToken(user)
+func (a *Application) generateTokenForUser(user *domain.User, sessionID uuid.UUID) (*domain.Token, error) {
+	accessToken, err := a.jwtWrapper.GenerateAccessToken(user, sessionID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate access token: %w", err)
 	}
-	refreshToken, err := a.jwtWrapper.GenerateRefreshToken(user)
+	refreshToken, err := a.jwtWrapper.GenerateRefreshToken(user, sessionID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
 	}
@@ -143,7 +584,79 @@ func (a *Application) generateTokenForUser(user *domain.User) (*domain.Token, er
 	return &domain.Token{Id: user.ID, AccessToken: accessToken, RefreshToken: refreshToken}, nil
 }
 
-func New(ctx context.Context, cfg config.Config) App {
+// Dependencies are the adapters an Application works with.
+type Dependencies struct {
+	Repository Repository
+	Sessions   SessionRepository
+	Clients    ServiceClientRepository
+	Outbox     OutboxRepository
+	AuditLog   AuditRepository
+	Logins     LoginHistoryRepository
+	TxManager  TransactionManager
+	JWT        *jwt.Wrapper
+	// Metrics defaults to discarding everything.
+	Metrics Metrics
+	// Geo defaults to locating no address, and Notifier to sending no alerts.
+	Geo      GeoLocator
+	Notifier Notifier
+}
+
+// NewWithDependencies builds an Application on the given adapters, e.g. the
+// in-memory ones in tests. Unlike New it starts no event relay. Alerts are
+// only sent while its Jobs run.
+func NewWithDependencies(deps Dependencies, cfg config.Account) *Application {
+	if deps.Metrics == nil {
+		deps.Metrics = noopMetrics{}
+	}
+	if deps.Geo == nil {
+		deps.Geo = noopLocator{}
+	}
+	if deps.Notifier == nil {
+		deps.Notifier = noopNotifier{}
+	}
+	// The config was validated when it was loaded.
+	minimumAges, _ := cfg.MinimumAgesByCountry()
+	a := &Application{
+		repository:          deps.Repository,
+		sessions:            deps.Sessions,
+		clients:             deps.Clients,
+		outbox:              deps.Outbox,
+		auditLog:            deps.AuditLog,
+		logins:              deps.Logins,
+		geo:                 deps.Geo,
+		notifier:            deps.Notifier,
+		jwtWrapper:          deps.JWT,
+		txManager:           deps.TxManager,
+		validate:            validator.New(),
+		metrics:             deps.Metrics,
+		deletionGracePeriod: cfg.DeletionGracePeriod,
+		passwordResetTTL:    cfg.PasswordResetTTL,
+		emailChangeCodeTTL:  cfg.EmailChangeCodeTTL,
+		emailRevertTTL:      cfg.EmailChangeRevertTTL,
+		emailProviderRules:  cfg.EmailProviderRules,
+		agePolicy: domain.AgePolicy{
+			Version:    cfg.AgePolicyVersion,
+			MinimumAge: cfg.MinimumAge,
+			ByCountry:  minimumAges,
+		},
+		consentPolicy: domain.ConsentPolicy{
+			{Document: domain.DocumentTerms, Version: cfg.TermsVersion},
+			{Document: domain.DocumentPrivacyPolicy, Version: cfg.PrivacyPolicyVersion},
+		},
+		registrationMode:  domain.RegistrationMode(cfg.RegistrationMode),
+		waitlistInviteTTL: cfg.WaitlistInviteTTL,
+		idempotencyKeyTTL: cfg.IdempotencyKeyTTL,
+		guestTTL:          cfg.GuestTTL,
+		alerts:            make(chan domain.NewDeviceLogin, alertQueueSize),
+	}
+	a.rateLimits.Store(newRateLimits(cfg))
+	a.jobs = append(a.jobs, a.purgeJob(cfg.PurgeInterval), a.alertJob)
+	return a
+}
+
+// New connects to Postgres and builds the Application on it, exiting if the
+// configured adapters can't be set up.
+func New(ctx context.Context, cfg config.Config) *Application {
 	conn, err := postgres.Connect(ctx, postgres.Config{
 		Host:              cfg.Postgres.Host,
 		Port:              cfg.Postgres.Port,
@@ -154,16 +667,102 @@ func New(ctx context.Context, cfg config.Config) App {
 		ConnectionTimeout: cfg.Postgres.ConnectionTimeout,
 	})
 	if err != nil {
-		log.Fatalf("failed to connect to db: %v", err)
+		slog.Error("failed to connect to db", slog.Any("error", err))
+		os.Exit(1)
+	}
+	var accessKey *rsa.PrivateKey
+	if cfg.JWT.AccessKeyFile != "" {
+		pem, err := os.ReadFile(cfg.JWT.AccessKeyFile)
+		if err == nil {
+			accessKey, err = jwt.ParseAccessKey(pem)
+		}
+		if err != nil {
+			slog.Error("failed to load access key", slog.Any("error", err))
+			os.Exit(1)
+		}
 	}
-	wrapper := jwt.NewWrapper(
-		cfg.JWT.SecretKey,
-		cfg.JWT.RefreshSecretKey,
-		cfg.JWT.Issuer,
-		cfg.JWT.AccessExpirationHours,
-		cfg.JWT.RefreshExpirationHours,
-	)
+	var previousKeys []*rsa.PublicKey
+	for _, file := range cfg.JWT.PreviousAccessKeyFiles {
+		pem, err := os.ReadFile(file)
+		var key *rsa.PublicKey
+		if err == nil {
+			key, err = jwt.ParseVerificationKey(pem)
+		}
+		if err != nil {
+			slog.Error("failed to load previous access key", slog.String("file", file), slog.Any("error", err))
+			os.Exit(1)
+		}
+		previousKeys = append(previousKeys, key)
+	}
+	wrapper := jwt.NewWrapper(jwt.Config{
+		Issuer:                      cfg.JWT.Issuer,
+		Audience:                    cfg.JWT.Audience,
+		SecretKey:                   cfg.JWT.SecretKey,
+		RefreshSecretKey:            cfg.JWT.RefreshSecretKey,
+		AccessTokenExpiration:       cfg.JWT.AccessExpirationHours,
+		RefreshTokenExpiration:      cfg.JWT.RefreshExpirationHours,
+		ServiceTokenExpiration:      cfg.JWT.ServiceExpiration,
+		GuestAccessTokenExpiration:  cfg.JWT.GuestAccessExpiration,
+		GuestRefreshTokenExpiration: cfg.JWT.GuestRefreshExpiration,
+		Leeway:                      cfg.JWT.Leeway,
+		AccessKey:                   accessKey,
+		PreviousAccessKeys:          previousKeys,
+	})
+	var geo GeoLocator
+	var closers []func() error
+	if cfg.GeoIP.DatabaseFile != "" {
+		reader, err := geoip.Open(cfg.GeoIP.DatabaseFile)
+		if err != nil {
+			slog.Error("failed to open geoip database", slog.Any("error", err))
+			os.Exit(1)
+		}
+		geo = reader
+		closers = append(closers, reader.Close)
+	}
+	var alerts Notifier = notifier.Log{}
+	if cfg.Notifier.WebhookURL != "" {
+		alerts = notifier.NewWebhook(cfg.Notifier.WebhookURL, cfg.Notifier.Timeout)
+	}
+	prometheus.MustRegister(metrics.NewPoolCollector(conn))
 	pool := postgres.NewPool(conn)
 	repo := postgres.NewRepo(pool)
-	return &Application{repository: repo, jwtWrapper: *wrapper, txManager: pool, validate: validator.New()}
+	a := NewWithDependencies(Dependencies{
+		Repository: repo,
+		Sessions:   repo,
+		Clients:    repo,
+		Outbox:     repo,
+		AuditLog:   repo,
+		Logins:     repo,
+		TxManager:  pool,
+		JWT:        wrapper,
+		Metrics:    metrics.NewPrometheus(prometheus.DefaultRegisterer),
+		Geo:        geo,
+		Notifier:   alerts,
+	}, cfg.Account)
+	a.closers = closers
+	if cfg.Outbox.Publisher != "" {
+		pub, err := publisher.New(publisher.Config{
+			Kind:         cfg.Outbox.Publisher,
+			KafkaBrokers: cfg.Outbox.KafkaBrokers,
+			KafkaTopic:   cfg.Outbox.KafkaTopic,
+			NATSURL:      cfg.Outbox.NATSURL,
+			NATSSubject:  cfg.Outbox.NATSSubject,
+		})
+		if err != nil {
+			slog.Error("failed to create event publisher", slog.Any("error", err))
+			os.Exit(1)
+		}
+		relay := NewRelay(repo, pool, pub, RelayConfig{
+			PollInterval: cfg.Outbox.PollInterval,
+			BatchSize:    cfg.Outbox.BatchSize,
+			RetryBackoff: cfg.Outbox.RetryBackoff,
+			MaxBackoff:   cfg.Outbox.MaxBackoff,
+			ClaimTimeout: cfg.Outbox.ClaimTimeout,
+		})
+		a.jobs = append(a.jobs, func(ctx context.Context) error {
+			defer pub.Close()
+			return relay.Run(ctx)
+		})
+	}
+	return a
 }
@@ -0,0 +1,905 @@
+package app_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/soulmate-dating/auth/internal/adapters/jwt"
+	"github.com/soulmate-dating/auth/internal/adapters/memory"
+	"github.com/soulmate-dating/auth/internal/app"
+	"github.com/soulmate-dating/auth/internal/config"
+	"github.com/soulmate-dating/auth/internal/domain"
+	"github.com/soulmate-dating/auth/internal/hash"
+)
+
+const (
+	testPassword     = "correct-horse-battery"
+	testClientID     = "feed"
+	testClientSecret = "feed-client-secret"
+)
+
+// recorder is the Metrics of the tests, counting every call by name and reason.
+type recorder struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (r *recorder) inc(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.counts == nil {
+		r.counts = map[string]int{}
+	}
+	r.counts[name]++
+}
+
+func (r *recorder) count(name string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.counts[name]
+}
+
+func (r *recorder) SignUp()                              { r.inc("sign_up") }
+func (r *recorder) LoginSucceeded()                      { r.inc("login") }
+func (r *recorder) LoginFailed(reason string)            { r.inc("login_failed:" + reason) }
+func (r *recorder) RefreshReuseDetected()                { r.inc("refresh_reuse") }
+func (r *recorder) TokenValidationFailed(reason string)  { r.inc("token_failed:" + reason) }
+func (r *recorder) ObservePasswordHashing(time.Duration) { r.inc("password_hashing") }
+
+// geoTable is the GeoLocator of the tests, locating only the IPs it lists.
+type geoTable map[string]domain.GeoLocation
+
+func (g geoTable) Locate(ip string) (domain.GeoLocation, error) { return g[ip], nil }
+
+// alertRecorder is the Notifier of the tests, keeping every alert and secret
+// sent.
+type alertRecorder struct {
+	mu      sync.Mutex
+	alerts  []domain.NewDeviceLogin
+	secrets []domain.SecretMessage
+}
+
+func (r *alertRecorder) NotifyNewDeviceLogin(_ context.Context, e domain.NewDeviceLogin) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.alerts = append(r.alerts, e)
+	return nil
+}
+
+func (r *alertRecorder) sent() []domain.NewDeviceLogin {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.alerts)
+}
+
+func (r *alertRecorder) SendSecret(_ context.Context, m domain.SecretMessage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.secrets = append(r.secrets, m)
+	return nil
+}
+
+// secretsSent returns the secrets of the kind sent so far, oldest first.
+func (r *alertRecorder) secretsSent(kind string) []domain.SecretMessage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var secrets []domain.SecretMessage
+	for _, m := range r.secrets {
+		if m.Kind == kind {
+			secrets = append(secrets, m)
+		}
+	}
+	return secrets
+}
+
+// lastSecret returns the last secret of the kind sent to email.
+func (r *alertRecorder) lastSecret(t *testing.T, kind, email string) string {
+	t.Helper()
+	var secret string
+	for _, m := range r.secretsSent(kind) {
+		if m.Email == email {
+			secret = m.Secret
+		}
+	}
+	if secret == "" {
+		t.Fatalf("no %s sent to %s", kind, email)
+	}
+	return secret
+}
+
+// waitSent returns the alerts sent once there are at least n of them, as they
+// are sent in the background, or when a second has passed.
+func (r *alertRecorder) waitSent(n int) []domain.NewDeviceLogin {
+	deadline := time.Now().Add(time.Second)
+	for {
+		alerts := r.sent()
+		if len(alerts) >= n || time.Now().After(deadline) {
+			return alerts
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+type testEnv struct {
+	app     *app.Application
+	repo    *memory.Repo
+	jwt     *jwt.Wrapper
+	metrics *recorder
+	geo     geoTable
+	alerts  *alertRecorder
+	cfg     config.Account
+	// jobs is the context the jobs of the application run in until the test ends.
+	jobs context.Context
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	repo := memory.NewRepo()
+	repo.AddServiceClient(domain.ServiceClient{
+		ID:         testClientID,
+		Name:       "Feed service",
+		SecretHash: hash.HashToken(testClientSecret),
+		Scopes:     []string{"profile:read", "matches:read"},
+	})
+	wrapper := jwt.NewWrapper(jwt.Config{
+		Issuer:                      "auth-test",
+		Audience:                    "api-test",
+		SecretKey:                   "access-secret-for-tests-only-0123456789",
+		RefreshSecretKey:            "refresh-secret-for-tests-only-0123456789",
+		AccessTokenExpiration:       time.Hour,
+		RefreshTokenExpiration:      24 * time.Hour,
+		ServiceTokenExpiration:      15 * time.Minute,
+		GuestAccessTokenExpiration:  10 * time.Minute,
+		GuestRefreshTokenExpiration: 2 * time.Hour,
+	})
+	jobs, stop := context.WithCancel(context.Background())
+	t.Cleanup(stop)
+	env := &testEnv{repo: repo, jwt: wrapper, metrics: &recorder{}, geo: geoTable{}, alerts: &alertRecorder{}, jobs: jobs}
+	env.reconfigure(config.Account{
+		DeletionGracePeriod:  30 * 24 * time.Hour,
+		PurgeInterval:        time.Hour,
+		PasswordResetTTL:     time.Hour,
+		EmailChangeCodeTTL:   time.Hour,
+		EmailChangeRevertTTL: 24 * time.Hour,
+		EmailProviderRules:   true,
+		MinimumAge:           18,
+		MinimumAges:          []string{"KR:19"},
+		AgePolicyVersion:     "test-1",
+		TermsVersion:         "terms-1",
+		PrivacyPolicyVersion: "privacy-1",
+		RegistrationMode:     "open",
+		WaitlistInviteTTL:    time.Hour,
+		IdempotencyKeyTTL:    time.Hour,
+		RateLimitWindow:      time.Hour,
+		WaitlistRateLimit:    10,
+		GuestRateLimit:       10,
+		GuestTTL:             24 * time.Hour,
+	})
+	return env
+}
+
+// reconfigure replaces the application with one configured by cfg on the
+// same adapters, e.g. to publish new terms, and starts its jobs.
+func (e *testEnv) reconfigure(cfg config.Account) {
+	e.app = app.NewWithDependencies(app.Dependencies{
+		Repository: e.repo,
+		Sessions:   e.repo,
+		Clients:    e.repo,
+		Outbox:     e.repo,
+		AuditLog:   e.repo,
+		Logins:     e.repo,
+		TxManager:  e.repo,
+		JWT:        e.jwt,
+		Metrics:    e.metrics,
+		Geo:        e.geo,
+		Notifier:   e.alerts,
+	}, cfg)
+	e.cfg = cfg
+	for _, job := range e.app.Jobs() {
+		go func(job func(context.Context) error) { _ = job(e.jobs) }(job)
+	}
+}
+
+func (e *testEnv) signUp(t *testing.T, email string) *domain.Token {
+	t.Helper()
+	token, err := e.app.SignUp(context.Background(), registration(email, testPassword))
+	if err != nil {
+		t.Fatalf("SignUp(%s): %v", email, err)
+	}
+	return token
+}
+
+// registration returns the registration of an adult living in Germany who
+// accepts the terms and privacy policy of newTestEnv.
+func registration(email, password string) domain.Registration {
+	return domain.Registration{
+		LoginCredentials: domain.LoginCredentials{Email: email, Password: password},
+		DateOfBirth:      time.Date(1990, time.May, 17, 0, 0, 0, 0, time.UTC),
+		Country:          "DE",
+		Accepted: []domain.DocumentVersion{
+			{Document: domain.DocumentTerms, Version: "terms-1"},
+			{Document: domain.DocumentPrivacyPolicy, Version: "privacy-1"},
+		},
+	}
+}
+
+// bornYearsAgo returns a registration of someone turning years old on the
+// day after days.
+func bornYearsAgo(years, days int, country string) domain.Registration {
+	r := registration("young@example.com", testPassword)
+	r.DateOfBirth = time.Now().UTC().AddDate(-years, 0, days)
+	r.Country = country
+	return r
+}
+
+// signUpAdmin creates a user with the admin role and returns its ID and access token.
+func (e *testEnv) signUpAdmin(t *testing.T) (uuid.UUID, string) {
+	t.Helper()
+	ctx := context.Background()
+	id := e.signUp(t, "admin@example.com").Id
+	if err := e.repo.SetUserRoles(ctx, id, []string{domain.RoleUser, domain.RoleAdmin}); err != nil {
+		t.Fatal(err)
+	}
+	token, err := e.app.Login(ctx, domain.LoginCredentials{Email: "admin@example.com", Password: testPassword})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id, token.AccessToken
+}
+
+func (e *testEnv) serviceToken(t *testing.T) string {
+	t.Helper()
+	token, err := e.app.IssueServiceToken(context.Background(), domain.ClientCredentials{
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token.AccessToken
+}
+
+func (e *testEnv) auditActions(t *testing.T, userID uuid.UUID) []string {
+	t.Helper()
+	events, err := e.repo.ListAuditEvents(context.Background(), domain.AuditFilter{UserID: &userID, Limit: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	actions := make([]string, 0, len(events))
+	for _, ev := range events {
+		actions = append(actions, ev.Action+":"+ev.Outcome)
+	}
+	return actions
+}
+
+func checkErr(t *testing.T, err, want error) {
+	t.Helper()
+	switch {
+	case want == nil && err != nil:
+		t.Fatalf("unexpected error: %v", err)
+	case want != nil && !errors.Is(err, want):
+		t.Fatalf("got error %v, want %v", err, want)
+	}
+}
+
+// errAny matches any error in the tables, for invalid input rejected by the validator.
+var errAny = errors.New("any error")
+
+func checkErrAny(t *testing.T, err, want error) {
+	t.Helper()
+	if want == errAny {
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		return
+	}
+	checkErr(t, err, want)
+}
+
+func TestApplication_SignUpJurisdiction(t *testing.T) {
+	tests := []struct {
+		name     string
+		declared string
+		located  string
+		years    int
+		wantErr  error
+	}{
+		{name: "located where declared", declared: "DE", located: "DE", years: 18},
+		{name: "located in a stricter country", declared: "DE", located: "KR", years: 18, wantErr: domain.ErrUnderage},
+		{name: "declared a stricter country", declared: "KR", located: "DE", years: 18, wantErr: domain.ErrUnderage},
+		// The strictest minimum age applies when the country is not verified.
+		{name: "not located", declared: "DE", years: 18, wantErr: domain.ErrUnderage},
+		{name: "not located and of the strictest age", declared: "DE", years: 19},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			if tt.located != "" {
+				env.geo["198.51.100.7"] = domain.GeoLocation{Country: tt.located}
+			}
+			ctx := app.WithClientInfo(context.Background(), domain.ClientInfo{IP: "198.51.100.7"})
+
+			_, err := env.app.SignUp(ctx, bornYearsAgo(tt.years, 0, tt.declared))
+			checkErr(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestApplication_SignUp(t *testing.T) {
+	noBirthDate := registration("new@example.com", testPassword)
+	noBirthDate.DateOfBirth = time.Time{}
+	tests := []struct {
+		name         string
+		registration domain.Registration
+		wantErr      error
+	}{
+		{"valid", registration("new@example.com", testPassword), nil},
+		{"display case kept", registration("New.User@example.com", testPassword), nil},
+		{"existing email", registration("taken@example.com", testPassword), domain.ErrAlreadyExists},
+		{"existing email in another case", registration("Taken@EXAMPLE.com", testPassword), domain.ErrAlreadyExists},
+		{"invalid email", registration("not-an-email", testPassword), errAny},
+		{"short password", registration("short@example.com", "short"), errAny},
+		{"missing password", registration("none@example.com", ""), errAny},
+		{"eighteenth birthday", bornYearsAgo(18, 0, "DE"), nil},
+		{"day before eighteenth birthday", bornYearsAgo(18, 1, "DE"), domain.ErrUnderage},
+		{"lowercase country", bornYearsAgo(18, 0, "de"), nil},
+		{"country with higher minimum age", bornYearsAgo(18, 0, "KR"), domain.ErrUnderage},
+		{"country minimum age reached", bornYearsAgo(19, 0, "KR"), nil},
+		{"missing date of birth", noBirthDate, domain.ErrInvalidDateOfBirth},
+		{"born in the future", bornYearsAgo(0, 2, "DE"), domain.ErrInvalidDateOfBirth},
+		{"unknown country", bornYearsAgo(30, 0, "XX"), errAny},
+		{"missing country", bornYearsAgo(30, 0, ""), errAny},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			env.signUp(t, "taken@example.com")
+			env.geo["198.51.100.7"] = domain.GeoLocation{Country: strings.ToUpper(tt.registration.Country)}
+			ctx := app.WithClientInfo(context.Background(), domain.ClientInfo{IP: "198.51.100.7"})
+
+			token, err := env.app.SignUp(ctx, tt.registration)
+			checkErrAny(t, err, tt.wantErr)
+			if tt.wantErr != nil {
+				if got := env.metrics.count("sign_up"); got != 1 {
+					t.Errorf("sign_up metric = %d, want only the setup's", got)
+				}
+				return
+			}
+
+			claims, err := env.app.Validate(context.Background(), token.AccessToken, "")
+			if err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			if claims.UserID != token.Id || claims.Email != tt.registration.Email {
+				t.Errorf("claims = %s %s, want %s %s", claims.UserID, claims.Email, token.Id, tt.registration.Email)
+			}
+			if !claims.AgeVerified {
+				t.Error("claims lack the age gate")
+			}
+			if claims.EmailVerified {
+				t.Error("the email is verified before any mail came back")
+			}
+			user, err := env.repo.GetUserByID(context.Background(), token.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.AgeAttestedAt == nil || user.AgePolicyVersion != "test-1" {
+				t.Errorf("age attestation = %v of %q, want one of test-1", user.AgeAttestedAt, user.AgePolicyVersion)
+			}
+			if !slices.Contains(claims.Roles, domain.RoleUser) {
+				t.Errorf("roles = %v, want the default role", claims.Roles)
+			}
+			if got := env.metrics.count("sign_up"); got != 2 {
+				t.Errorf("sign_up metric = %d, want 2", got)
+			}
+			var created bool
+			for _, m := range env.repo.OutboxMessages() {
+				created = created || m.AggregateID == token.Id && m.EventType == domain.EventUserCreated
+			}
+			if !created {
+				t.Error("no UserCreated event in the outbox")
+			}
+			if actions := env.auditActions(t, token.Id); !slices.Contains(actions, domain.AuditSignUp+":success") {
+				t.Errorf("audit = %v, want a successful sign-up", actions)
+			}
+		})
+	}
+}
+
+func TestApplication_SignUpRollsBackOnFailure(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	// A sign-up that fails inside the transaction must leave neither a user nor an event behind.
+	err := env.repo.RunInTx(ctx, func(ctx context.Context) error {
+		if _, err := env.app.SignUp(ctx, registration("gone@example.com", testPassword)); err != nil {
+			return err
+		}
+		return errors.New("abort")
+	})
+	if err == nil {
+		t.Fatal("expected the transaction to fail")
+	}
+	if _, err := env.repo.GetUserByEmail(ctx, "gone@example.com"); !errors.Is(err, domain.ErrUserNotFound) {
+		t.Errorf("user survived the rollback: %v", err)
+	}
+	if n := len(env.repo.OutboxMessages()); n != 0 {
+		t.Errorf("%d outbox messages survived the rollback", n)
+	}
+}
+
+func TestApplication_SignUpConcurrently(t *testing.T) {
+	env := newTestEnv(t)
+	const signUps = 8
+	// The emails differ in case only, so they are the same canonical email.
+	emails := []string{"racer@example.com", "Racer@Example.com"}
+	errs := make([]error, signUps)
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = env.app.SignUp(context.Background(), registration(emails[i%len(emails)], testPassword))
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, err := range errs {
+		if err == nil {
+			succeeded++
+			continue
+		}
+		checkErr(t, err, domain.ErrAlreadyExists)
+	}
+	if succeeded != 1 {
+		t.Errorf("%d sign-ups succeeded, want 1", succeeded)
+	}
+	if n := len(env.repo.OutboxMessages()); n != 1 {
+		t.Errorf("recorded %d outbox messages, want 1", n)
+	}
+}
+
+func TestApplication_Login(t *testing.T) {
+	tests := []struct {
+		name        string
+		prepare     func(t *testing.T, env *testEnv, id uuid.UUID)
+		credentials domain.LoginCredentials
+		wantErr     error
+		wantMetric  string
+	}{
+		{
+			name:        "valid",
+			credentials: domain.LoginCredentials{Email: "user@example.com", Password: testPassword},
+			wantMetric:  "login",
+		},
+		{
+			name:        "email in another case",
+			credentials: domain.LoginCredentials{Email: " User@EXAMPLE.com ", Password: testPassword},
+			wantMetric:  "login",
+		},
+		{
+			name:        "unknown user",
+			credentials: domain.LoginCredentials{Email: "nobody@example.com", Password: testPassword},
+			wantErr:     domain.ErrUserNotFound,
+			wantMetric:  "login_failed:" + app.LoginFailureUnknownUser,
+		},
+		{
+			name:        "wrong password",
+			credentials: domain.LoginCredentials{Email: "user@example.com", Password: "wrong-password"},
+			wantErr:     domain.ErrWrongPassword,
+			wantMetric:  "login_failed:" + app.LoginFailureWrongPassword,
+		},
+		{
+			name: "disabled user",
+			prepare: func(t *testing.T, env *testEnv, id uuid.UUID) {
+				now := time.Now()
+				if err := env.repo.SetUserDisabled(context.Background(), id, &now); err != nil {
+					t.Fatal(err)
+				}
+			},
+			credentials: domain.LoginCredentials{Email: "user@example.com", Password: testPassword},
+			wantErr:     domain.ErrUserDisabled,
+			wantMetric:  "login_failed:" + app.LoginFailureLocked,
+		},
+		{
+			name: "password reset required",
+			prepare: func(t *testing.T, env *testEnv, id uuid.UUID) {
+				if err := env.repo.RequirePasswordReset(context.Background(), id); err != nil {
+					t.Fatal(err)
+				}
+			},
+			credentials: domain.LoginCredentials{Email: "user@example.com", Password: testPassword},
+			wantErr:     domain.ErrPasswordResetNeeded,
+			wantMetric:  "login_failed:" + app.LoginFailureLocked,
+		},
+		{
+			name:        "invalid email",
+			credentials: domain.LoginCredentials{Email: "user", Password: testPassword},
+			wantErr:     errAny,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			id := env.signUp(t, "user@example.com").Id
+			if tt.prepare != nil {
+				tt.prepare(t, env, id)
+			}
+
+			token, err := env.app.Login(context.Background(), tt.credentials)
+			checkErrAny(t, err, tt.wantErr)
+			if tt.wantMetric != "" && env.metrics.count(tt.wantMetric) != 1 {
+				t.Errorf("metric %s not recorded", tt.wantMetric)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if token.Id != id {
+				t.Errorf("token for %s, want %s", token.Id, id)
+			}
+			if _, err := env.app.Validate(context.Background(), token.AccessToken, ""); err != nil {
+				t.Errorf("Validate: %v", err)
+			}
+		})
+	}
+}
+
+func TestApplication_Refresh(t *testing.T) {
+	tests := []struct {
+		name       string
+		token      func(t *testing.T, env *testEnv, token *domain.Token) string
+		wantErr    error
+		wantMetric string
+	}{
+		{
+			name:  "valid",
+			token: func(_ *testing.T, _ *testEnv, token *domain.Token) string { return token.RefreshToken },
+		},
+		{
+			name: "reused refresh token",
+			token: func(t *testing.T, env *testEnv, token *domain.Token) string {
+				if _, err := env.app.Refresh(context.Background(), token.RefreshToken); err != nil {
+					t.Fatal(err)
+				}
+				return token.RefreshToken
+			},
+			wantErr:    domain.ErrRefreshTokenReused,
+			wantMetric: "refresh_reuse",
+		},
+		{
+			name:       "access token",
+			token:      func(_ *testing.T, _ *testEnv, token *domain.Token) string { return token.AccessToken },
+			wantErr:    domain.ErrInvalidToken,
+			wantMetric: "token_failed:" + app.TokenFailureBadSignature,
+		},
+		{
+			name: "expired",
+			token: func(t *testing.T, env *testEnv, token *domain.Token) string {
+				return expiredRefreshToken(t, env, token)
+			},
+			wantErr:    domain.ErrExpiredToken,
+			wantMetric: "token_failed:" + app.TokenFailureExpired,
+		},
+		{
+			name: "logged out",
+			token: func(t *testing.T, env *testEnv, token *domain.Token) string {
+				if _, err := env.app.Logout(context.Background(), token.AccessToken); err != nil {
+					t.Fatal(err)
+				}
+				return token.RefreshToken
+			},
+			wantErr:    domain.ErrSessionRevoked,
+			wantMetric: "token_failed:" + app.TokenFailureRevoked,
+		},
+		{
+			name: "disabled user",
+			token: func(t *testing.T, env *testEnv, token *domain.Token) string {
+				now := time.Now()
+				if err := env.repo.SetUserDisabled(context.Background(), token.Id, &now); err != nil {
+					t.Fatal(err)
+				}
+				return token.RefreshToken
+			},
+			wantErr: domain.ErrUserDisabled,
+		},
+		{
+			name:    "malformed",
+			token:   func(_ *testing.T, _ *testEnv, _ *domain.Token) string { return "not.a.jwt" },
+			wantErr: errAny,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			token := env.signUp(t, "user@example.com")
+
+			refreshed, err := env.app.Refresh(context.Background(), tt.token(t, env, token))
+			checkErrAny(t, err, tt.wantErr)
+			if tt.wantMetric != "" && env.metrics.count(tt.wantMetric) != 1 {
+				t.Errorf("metric %s not recorded", tt.wantMetric)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if refreshed.RefreshToken == token.RefreshToken {
+				t.Error("refresh token was not rotated")
+			}
+			if _, err := env.app.Refresh(context.Background(), refreshed.RefreshToken); err != nil {
+				t.Errorf("rotated refresh token rejected: %v", err)
+			}
+		})
+	}
+}
+
+func TestApplication_RefreshReuseRevokesSession(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	token := env.signUp(t, "user@example.com")
+	refreshed, err := env.app.Refresh(ctx, token.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.app.Refresh(ctx, token.RefreshToken); !errors.Is(err, domain.ErrRefreshTokenReused) {
+		t.Fatalf("reuse: got %v", err)
+	}
+	if _, err := env.app.Refresh(ctx, refreshed.RefreshToken); !errors.Is(err, domain.ErrSessionRevoked) {
+		t.Errorf("session survived the reuse: %v", err)
+	}
+}
+
+// expiredRefreshToken logs in again while refresh tokens expire immediately.
+func expiredRefreshToken(t *testing.T, env *testEnv, token *domain.Token) string {
+	t.Helper()
+	e := env.jwt.Expirations()
+	env.jwt.SetExpirations(jwt.Expirations{Access: e.Access, Refresh: -time.Minute, Service: e.Service})
+	defer env.jwt.SetExpirations(e)
+	claims, err := env.app.Validate(context.Background(), token.AccessToken, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := env.app.Login(context.Background(), domain.LoginCredentials{Email: claims.Email, Password: testPassword})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return expired.RefreshToken
+}
+
+func TestApplication_Logout(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   func(t *testing.T, env *testEnv, token *domain.Token) string
+		wantErr error
+	}{
+		{
+			name:  "valid",
+			token: func(_ *testing.T, _ *testEnv, token *domain.Token) string { return token.AccessToken },
+		},
+		{
+			name: "already logged out",
+			token: func(t *testing.T, env *testEnv, token *domain.Token) string {
+				if _, err := env.app.Logout(context.Background(), token.AccessToken); err != nil {
+					t.Fatal(err)
+				}
+				return token.AccessToken
+			},
+			wantErr: domain.ErrSessionRevoked,
+		},
+		{
+			name:    "refresh token",
+			token:   func(_ *testing.T, _ *testEnv, token *domain.Token) string { return token.RefreshToken },
+			wantErr: domain.ErrInvalidToken,
+		},
+		{
+			name:    "service token",
+			token:   func(t *testing.T, env *testEnv, _ *domain.Token) string { return env.serviceToken(t) },
+			wantErr: domain.ErrServiceToken,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			token := env.signUp(t, "user@example.com")
+
+			id, err := env.app.Logout(context.Background(), tt.token(t, env, token))
+			checkErr(t, err, tt.wantErr)
+			if tt.wantErr != nil {
+				return
+			}
+			if id != token.Id.String() {
+				t.Errorf("logged out %s, want %s", id, token.Id)
+			}
+			if _, err := env.app.Validate(context.Background(), token.AccessToken, ""); !errors.Is(err, domain.ErrSessionRevoked) {
+				t.Errorf("access token still valid after logout: %v", err)
+			}
+		})
+	}
+}
+
+func TestApplication_Validate(t *testing.T) {
+	tests := []struct {
+		name       string
+		token      func(t *testing.T, env *testEnv, token *domain.Token) string
+		scope      string
+		wantErr    error
+		wantMetric string
+	}{
+		{
+			name:  "valid",
+			token: func(_ *testing.T, _ *testEnv, token *domain.Token) string { return token.AccessToken },
+		},
+		{
+			name:  "granted scope",
+			token: func(_ *testing.T, _ *testEnv, token *domain.Token) string { return token.AccessToken },
+			scope: "profile:read",
+		},
+		{
+			name:    "missing scope",
+			token:   func(_ *testing.T, _ *testEnv, token *domain.Token) string { return token.AccessToken },
+			scope:   domain.ScopeAdmin,
+			wantErr: domain.ErrInsufficientScope,
+		},
+		{
+			name:  "service token",
+			token: func(t *testing.T, env *testEnv, _ *domain.Token) string { return env.serviceToken(t) },
+			scope: "matches:read",
+		},
+		{
+			name:       "refresh token",
+			token:      func(_ *testing.T, _ *testEnv, token *domain.Token) string { return token.RefreshToken },
+			wantErr:    domain.ErrInvalidSignature,
+			wantMetric: "token_failed:" + app.TokenFailureBadSignature,
+		},
+		{
+			name: "expired",
+			token: func(t *testing.T, env *testEnv, _ *domain.Token) string {
+				e := env.jwt.Expirations()
+				env.jwt.SetExpirations(jwt.Expirations{Access: -time.Minute, Refresh: e.Refresh, Service: e.Service})
+				defer env.jwt.SetExpirations(e)
+				token, err := env.app.Login(context.Background(), domain.LoginCredentials{Email: "user@example.com", Password: testPassword})
+				if err != nil {
+					t.Fatal(err)
+				}
+				return token.AccessToken
+			},
+			wantErr:    domain.ErrExpiredToken,
+			wantMetric: "token_failed:" + app.TokenFailureExpired,
+		},
+		{
+			name: "revoked session",
+			token: func(t *testing.T, env *testEnv, token *domain.Token) string {
+				if err := env.repo.RevokeUserSessions(context.Background(), token.Id); err != nil {
+					t.Fatal(err)
+				}
+				return token.AccessToken
+			},
+			wantErr:    domain.ErrSessionRevoked,
+			wantMetric: "token_failed:" + app.TokenFailureRevoked,
+		},
+		{
+			name: "tampered",
+			token: func(_ *testing.T, _ *testEnv, token *domain.Token) string {
+				parts := strings.Split(token.AccessToken, ".")
+				return parts[0] + "." + parts[1] + ".AAAA" + parts[2][4:]
+			},
+			wantErr: domain.ErrInvalidToken,
+		},
+		{
+			name:    "empty",
+			token:   func(_ *testing.T, _ *testEnv, _ *domain.Token) string { return "" },
+			wantErr: errAny,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			token := env.signUp(t, "user@example.com")
+
+			claims, err := env.app.Validate(context.Background(), tt.token(t, env, token), tt.scope)
+			checkErrAny(t, err, tt.wantErr)
+			if tt.wantMetric != "" && env.metrics.count(tt.wantMetric) != 1 {
+				t.Errorf("metric %s not recorded", tt.wantMetric)
+			}
+			if tt.wantErr == nil && tt.scope != "" && !claims.HasScope(tt.scope) {
+				t.Errorf("claims lack scope %s", tt.scope)
+			}
+		})
+	}
+}
+
+func TestApplication_ValidateMany(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	token := env.signUp(t, "user@example.com")
+
+	tests := []struct {
+		name     string
+		tokens   []string
+		wantErr  error
+		wantErrs []error
+	}{
+		{"empty", nil, nil, nil},
+		{
+			name:     "mixed",
+			tokens:   []string{token.AccessToken, token.RefreshToken, env.serviceToken(t)},
+			wantErrs: []error{nil, domain.ErrInvalidToken, nil},
+		},
+		{
+			name:    "too large",
+			tokens:  make([]string, 101),
+			wantErr: domain.ErrBatchTooLarge,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := env.app.ValidateMany(ctx, tt.tokens, "")
+			checkErr(t, err, tt.wantErr)
+			if len(results) != len(tt.wantErrs) {
+				t.Fatalf("got %d results, want %d", len(results), len(tt.wantErrs))
+			}
+			for i, r := range results {
+				checkErr(t, r.Err, tt.wantErrs[i])
+				if (r.Claims == nil) == (r.Err == nil) {
+					t.Errorf("result %d: exactly one of claims and error must be set", i)
+				}
+			}
+		})
+	}
+}
+
+func TestApplication_VerificationKeys(t *testing.T) {
+	env := newTestEnv(t)
+	// Tokens signed with the shared secret must not be published.
+	if keys := env.app.VerificationKeys(); len(keys.Keys) != 0 {
+		t.Errorf("got %d keys without an access key", len(keys.Keys))
+	}
+}
+
+func TestApplication_Reload(t *testing.T) {
+	env := newTestEnv(t)
+	env.withRegistrationMode(domain.RegistrationWaitlist)
+	ctx := context.Background()
+	checkErr(t, env.app.JoinWaitlist(ctx, "first@example.com"), nil)
+	checkErr(t, env.app.JoinWaitlist(ctx, "second@example.com"), nil)
+	account := env.cfg
+	account.WaitlistRateLimit = 2
+	env.app.Reload(config.Config{
+		JWT: config.JWT{
+			AccessExpirationHours:  time.Minute,
+			RefreshExpirationHours: 2 * time.Minute,
+			ServiceExpiration:      3 * time.Minute,
+			GuestAccessExpiration:  4 * time.Minute,
+			GuestRefreshExpiration: 5 * time.Minute,
+		},
+		Account: account,
+	})
+
+	// The requests before the reload count towards the new limit.
+	checkErr(t, env.app.JoinWaitlist(ctx, "third@example.com"), domain.ErrRateLimited)
+
+	want := jwt.Expirations{
+		Access:       time.Minute,
+		Refresh:      2 * time.Minute,
+		Service:      3 * time.Minute,
+		GuestAccess:  4 * time.Minute,
+		GuestRefresh: 5 * time.Minute,
+	}
+	if got := env.jwt.Expirations(); got != want {
+		t.Fatalf("expirations = %+v, want %+v", got, want)
+	}
+	service, err := env.app.IssueServiceToken(context.Background(), domain.ClientCredentials{
+		ClientID: testClientID, ClientSecret: testClientSecret,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if service.ExpiresIn != want.Service {
+		t.Errorf("service token expires in %s, want %s", service.ExpiresIn, want.Service)
+	}
+}
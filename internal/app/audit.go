@@ -0,0 +1,146 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 500
+	auditVerifyBatch  = 1000
+)
+
+type AuditRepository interface {
+	AddAuditEvent(ctx context.Context, e *domain.AuditEvent) error
+	ListAuditEvents(ctx context.Context, filter domain.AuditFilter) ([]domain.AuditEvent, error)
+	ScanAuditEvents(ctx context.Context, afterSeq int64, limit int) ([]domain.AuditEvent, error)
+}
+
+// audit appends the event to the audit log, annotating it with the caller's
+// address. Inside RunInTx the record is committed together with the change.
+func (a *Application) audit(ctx context.Context, e domain.AuditEvent) error {
+	client := ClientInfoFromContext(ctx)
+	e.ID = domain.NewUUID()
+	e.IP = client.IP
+	e.UserAgent = client.UserAgent
+	e.CreatedAt = time.Now().UTC()
+	e.ChainID = domain.AuditChainOf(e)
+	if e.Details == nil {
+		e.Details = map[string]string{}
+	}
+	if err := a.auditLog.AddAuditEvent(ctx, &e); err != nil {
+		return fmt.Errorf("failed to write audit event: %w", err)
+	}
+	return nil
+}
+
+// auditBestEffort records an event outside of a business transaction. An
+// unavailable audit log must not lock users out, so errors are only logged.
+func (a *Application) auditBestEffort(ctx context.Context, e domain.AuditEvent) {
+	if err := a.audit(ctx, e); err != nil {
+		slog.ErrorContext(ctx, "audit event lost", slog.String("action", e.Action), slog.Any("error", err))
+	}
+}
+
+func (a *Application) auditSuccess(ctx context.Context, userID uuid.UUID, action string) {
+	a.auditBestEffort(ctx, domain.AuditEvent{
+		ActorID:   &userID,
+		SubjectID: &userID,
+		Action:    action,
+		Outcome:   domain.AuditOutcomeSuccess,
+	})
+}
+
+func (a *Application) auditFailure(ctx context.Context, e domain.AuditEvent, cause error) {
+	e.Outcome = domain.AuditOutcomeFailure
+	if e.Details == nil {
+		e.Details = map[string]string{}
+	}
+	e.Details["reason"] = cause.Error()
+	a.auditBestEffort(ctx, e)
+}
+
+func (a *Application) ListAuditEvents(ctx context.Context, actor uuid.UUID, filter domain.AuditFilter) (*domain.AuditPage, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultAuditLimit
+	}
+	filter.Limit = min(filter.Limit, maxAuditLimit)
+	limit := filter.Limit
+	filter.Limit++
+
+	details := map[string]string{}
+	if filter.UserID != nil {
+		details["user_id"] = filter.UserID.String()
+	}
+	var events []domain.AuditEvent
+	err := a.txManager.RunInTx(ctx, func(ctx context.Context) (err error) {
+		events, err = a.auditLog.ListAuditEvents(ctx, filter)
+		if err != nil {
+			return err
+		}
+		return a.audit(ctx, domain.AuditEvent{
+			ActorID:   &actor,
+			SubjectID: filter.UserID,
+			Action:    domain.AuditAdminListAuditEvents,
+			Outcome:   domain.AuditOutcomeSuccess,
+			Details:   details,
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", err)
+	}
+
+	page := &domain.AuditPage{Events: events}
+	if len(events) > limit {
+		page.Events = events[:limit]
+		page.NextBefore = page.Events[limit-1].Seq
+	}
+	return page, nil
+}
+
+// VerifyAuditLog walks the whole audit log and checks its hash chains.
+func (a *Application) VerifyAuditLog(ctx context.Context, actor uuid.UUID) (*domain.AuditVerification, error) {
+	result := &domain.AuditVerification{Valid: true}
+	heads := make(map[uuid.UUID]string)
+	var afterSeq int64
+	for {
+		events, err := a.auditLog.ScanAuditEvents(ctx, afterSeq, auditVerifyBatch)
+		if err != nil {
+			return nil, fmt.Errorf("failed to verify audit log: %w", err)
+		}
+		if len(events) == 0 {
+			break
+		}
+		brokenAt, err := domain.VerifyAuditChain(heads, events)
+		if err != nil {
+			result.Valid = false
+			result.BrokenAtSeq = brokenAt
+			result.Reason = err.Error()
+			break
+		}
+		result.Checked += int64(len(events))
+		afterSeq = events[len(events)-1].Seq
+	}
+
+	outcome := domain.AuditOutcomeSuccess
+	if !result.Valid {
+		outcome = domain.AuditOutcomeFailure
+	}
+	err := a.audit(ctx, domain.AuditEvent{
+		ActorID: &actor,
+		Action:  domain.AuditAdminVerifyAuditLog,
+		Outcome: outcome,
+		Details: map[string]string{"checked": fmt.Sprint(result.Checked)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,136 @@
+package app_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+	"github.com/soulmate-dating/auth/internal/hash"
+)
+
+func TestApplication_ListAuditEvents(t *testing.T) {
+	ctx := context.Background()
+	start := time.Now().Add(-time.Second)
+	userID := domain.NewUUID()
+
+	tests := []struct {
+		name        string
+		filter      domain.AuditFilter
+		wantActions []string
+		wantNext    bool
+	}{
+		{
+			name:        "by user",
+			filter:      domain.AuditFilter{UserID: &userID},
+			wantActions: []string{domain.AuditLogin, domain.AuditLogin, domain.AuditLogin},
+		},
+		{
+			name:        "paginated",
+			filter:      domain.AuditFilter{UserID: &userID, Limit: 2},
+			wantActions: []string{domain.AuditLogin, domain.AuditLogin},
+			wantNext:    true,
+		},
+		{
+			name:   "in the future",
+			filter: domain.AuditFilter{UserID: &userID, From: time.Now().Add(time.Hour)},
+		},
+		{
+			name:        "time range",
+			filter:      domain.AuditFilter{UserID: &userID, From: start, To: start.Add(time.Hour)},
+			wantActions: []string{domain.AuditLogin, domain.AuditLogin, domain.AuditLogin},
+		},
+		{
+			name:   "unknown user",
+			filter: domain.AuditFilter{UserID: ptr(uuid.New())},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			adminID, _ := env.signUpAdmin(t)
+			// The user ID is fixed for the filters, so the user is created directly.
+			err := env.repo.RunInTx(ctx, func(ctx context.Context) error {
+				if _, err := env.repo.CreateUser(ctx, &domain.User{ID: userID, Email: "user@example.com", EmailCanonical: "user@example.com", Password: hash.HashPassword(testPassword)}); err != nil {
+					return err
+				}
+				return env.repo.SetUserRoles(ctx, userID, []string{domain.RoleUser})
+			})
+			checkErr(t, err, nil)
+			for i := 0; i < 3; i++ {
+				if _, err := env.app.Login(ctx, domain.LoginCredentials{Email: "user@example.com", Password: testPassword}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			page, err := env.app.ListAuditEvents(ctx, adminID, tt.filter)
+			checkErr(t, err, nil)
+			var actions []string
+			for _, e := range page.Events {
+				actions = append(actions, e.Action)
+			}
+			if len(actions) != len(tt.wantActions) {
+				t.Fatalf("got %v, want %v", actions, tt.wantActions)
+			}
+			for i := range actions {
+				if actions[i] != tt.wantActions[i] {
+					t.Fatalf("got %v, want %v", actions, tt.wantActions)
+				}
+			}
+			if (page.NextBefore != 0) != tt.wantNext {
+				t.Errorf("next before = %d", page.NextBefore)
+			}
+		})
+	}
+}
+
+func TestApplication_VerifyAuditLog(t *testing.T) {
+	tests := []struct {
+		name       string
+		tamper     func(e *domain.AuditEvent)
+		wantBroken int64
+	}{
+		{name: "intact"},
+		{
+			name:       "altered outcome",
+			tamper:     func(e *domain.AuditEvent) { e.Outcome = domain.AuditOutcomeFailure },
+			wantBroken: 2,
+		},
+		{
+			// The next event of the admin no longer links to it.
+			name:       "rehashed event",
+			tamper:     func(e *domain.AuditEvent) { e.Action = "auth.nothing"; e.Hash = e.ComputeHash() },
+			wantBroken: 4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			adminID, _ := env.signUpAdmin(t)
+			env.signUp(t, "user@example.com")
+			if _, err := env.app.Login(context.Background(), domain.LoginCredentials{Email: "admin@example.com", Password: testPassword}); err != nil {
+				t.Fatal(err)
+			}
+			if tt.tamper != nil {
+				if err := env.repo.TamperAuditEvent(2, tt.tamper); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			result, err := env.app.VerifyAuditLog(context.Background(), adminID)
+			checkErr(t, err, nil)
+			if result.Valid != (tt.wantBroken == 0) || result.BrokenAtSeq != tt.wantBroken {
+				t.Errorf("result = %+v, want broken at %d", result, tt.wantBroken)
+			}
+			if tt.wantBroken == 0 && result.Checked == 0 {
+				t.Error("no events were checked")
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
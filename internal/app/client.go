@@ -0,0 +1,20 @@
+package app
+
+import (
+	"context"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+type clientInfoKey struct{}
+
+// WithClientInfo attaches the caller's IP and user agent to the context so that
+// sessions and audit records can be annotated with them.
+func WithClientInfo(ctx context.Context, info domain.ClientInfo) context.Context {
+	return context.WithValue(ctx, clientInfoKey{}, info)
+}
+
+func ClientInfoFromContext(ctx context.Context) domain.ClientInfo {
+	info, _ := ctx.Value(clientInfoKey{}).(domain.ClientInfo)
+	return info
+}
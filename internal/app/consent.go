@@ -0,0 +1,76 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+// AcceptTerms records that the user accepted the given current document
+// versions, e.g. when Login reported them pending, and returns the versions
+// still pending.
+func (a *Application) AcceptTerms(ctx context.Context, token string, accepted []domain.DocumentVersion) ([]domain.DocumentVersion, error) {
+	claims, err := a.authenticate(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.consentPolicy.Current(accepted); err != nil {
+		return nil, err
+	}
+
+	var pending []domain.DocumentVersion
+	err = a.txManager.RunInTx(ctx, func(ctx context.Context) error {
+		if err := a.repository.AddConsents(ctx, newConsents(ctx, claims.UserID, accepted)); err != nil {
+			return err
+		}
+		if pending, err = a.pendingConsents(ctx, claims.UserID); err != nil {
+			return err
+		}
+		details := make(map[string]string, len(accepted))
+		for _, v := range accepted {
+			details[v.Document] = v.Version
+		}
+		return a.audit(ctx, domain.AuditEvent{
+			ActorID:   &claims.UserID,
+			SubjectID: &claims.UserID,
+			Action:    domain.AuditAcceptTerms,
+			Outcome:   domain.AuditOutcomeSuccess,
+			Details:   details,
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to accept terms: %w", err)
+	}
+	return pending, nil
+}
+
+// pendingConsents returns the current document versions the user has not
+// accepted yet.
+func (a *Application) pendingConsents(ctx context.Context, userID uuid.UUID) ([]domain.DocumentVersion, error) {
+	consents, err := a.repository.ListConsents(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list consents: %w", err)
+	}
+	return a.consentPolicy.Pending(consents), nil
+}
+
+// newConsents records the acceptance of versions by the caller.
+func newConsents(ctx context.Context, userID uuid.UUID, versions []domain.DocumentVersion) []domain.Consent {
+	now := time.Now().UTC()
+	ip := ClientInfoFromContext(ctx).IP
+	consents := make([]domain.Consent, 0, len(versions))
+	for _, v := range versions {
+		consents = append(consents, domain.Consent{
+			UserID:     userID,
+			Document:   v.Document,
+			Version:    v.Version,
+			AcceptedAt: now,
+			IP:         ip,
+		})
+	}
+	return consents
+}
@@ -0,0 +1,95 @@
+package app_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/soulmate-dating/auth/internal/app"
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+func TestApplication_SignUpRequiresConsent(t *testing.T) {
+	outdated := registration("user@example.com", testPassword)
+	outdated.Accepted = []domain.DocumentVersion{
+		{Document: domain.DocumentTerms, Version: "terms-0"},
+		{Document: domain.DocumentPrivacyPolicy, Version: "privacy-1"},
+	}
+	missing := registration("user@example.com", testPassword)
+	missing.Accepted = missing.Accepted[:1]
+	tests := []struct {
+		name         string
+		registration domain.Registration
+		wantErr      error
+	}{
+		{"current versions", registration("user@example.com", testPassword), nil},
+		{"outdated terms", outdated, domain.ErrConsentRequired},
+		{"missing privacy policy", missing, domain.ErrConsentRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			ctx := app.WithClientInfo(context.Background(), domain.ClientInfo{IP: "203.0.113.7"})
+
+			token, err := env.app.SignUp(ctx, tt.registration)
+			checkErr(t, err, tt.wantErr)
+			if tt.wantErr != nil {
+				return
+			}
+			if len(token.PendingConsents) != 0 {
+				t.Errorf("pending consents = %v, want none", token.PendingConsents)
+			}
+			consents, err := env.repo.ListConsents(ctx, token.Id)
+			checkErr(t, err, nil)
+			if len(consents) != 2 || consents[0].IP != "203.0.113.7" || consents[0].AcceptedAt.IsZero() {
+				t.Errorf("consents = %+v, want both documents accepted from the client", consents)
+			}
+		})
+	}
+}
+
+func TestApplication_AcceptTerms(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	token := env.signUp(t, "user@example.com")
+
+	// Publishing new terms prompts the user at the next login or refresh.
+	cfg := env.cfg
+	cfg.TermsVersion = "terms-2"
+	env.reconfigure(cfg)
+	newTerms := domain.DocumentVersion{Document: domain.DocumentTerms, Version: "terms-2"}
+	login, err := env.app.Login(ctx, domain.LoginCredentials{Email: "user@example.com", Password: testPassword})
+	checkErr(t, err, nil)
+	if !slices.Equal(login.PendingConsents, []domain.DocumentVersion{newTerms}) {
+		t.Fatalf("pending consents = %v, want %v", login.PendingConsents, newTerms)
+	}
+	refreshed, err := env.app.Refresh(ctx, token.RefreshToken)
+	checkErr(t, err, nil)
+	if !slices.Equal(refreshed.PendingConsents, []domain.DocumentVersion{newTerms}) {
+		t.Fatalf("pending consents = %v, want %v", refreshed.PendingConsents, newTerms)
+	}
+
+	_, err = env.app.AcceptTerms(ctx, login.AccessToken, []domain.DocumentVersion{{Document: domain.DocumentTerms, Version: "terms-1"}})
+	checkErr(t, err, domain.ErrUnknownDocumentVersion)
+	_, err = env.app.AcceptTerms(ctx, env.serviceToken(t), []domain.DocumentVersion{newTerms})
+	checkErr(t, err, domain.ErrServiceToken)
+	pending, err := env.app.AcceptTerms(ctx, login.AccessToken, []domain.DocumentVersion{newTerms})
+	checkErr(t, err, nil)
+	if len(pending) != 0 {
+		t.Errorf("pending consents = %v, want none", pending)
+	}
+
+	login, err = env.app.Login(ctx, domain.LoginCredentials{Email: "user@example.com", Password: testPassword})
+	checkErr(t, err, nil)
+	if len(login.PendingConsents) != 0 {
+		t.Errorf("pending consents = %v after accepting, want none", login.PendingConsents)
+	}
+	export, err := env.app.ExportMyData(ctx, login.AccessToken)
+	checkErr(t, err, nil)
+	if len(export.Consents) != 3 {
+		t.Errorf("exported %d consents, want the 2 of the sign-up and the new terms", len(export.Consents))
+	}
+	if actions := env.auditActions(t, token.Id); !slices.Contains(actions, domain.AuditAcceptTerms+":success") {
+		t.Errorf("audit = %v, want an accepted consent", actions)
+	}
+}
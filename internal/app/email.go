@@ -0,0 +1,289 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"time"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+	"github.com/soulmate-dating/auth/internal/hash"
+)
+
+const (
+	emailTag = "required,email"
+	// maxEmailCodeAttempts bounds guessing of the six-digit code.
+	maxEmailCodeAttempts = 5
+)
+
+// RequestEmailChange re-authenticates the user with their password and issues
+// a code confirming newEmail, which the notification service sends to it.
+// A new request replaces a pending one.
+func (a *Application) RequestEmailChange(ctx context.Context, token, password, newEmail string) (*domain.EmailChange, error) {
+	claims, err := a.authenticate(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	email, err := domain.NormalizeEmail(newEmail, a.emailProviderRules)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.validate.Var(email.Display, emailTag); err != nil {
+		return nil, fmt.Errorf("invalid email: %w", err)
+	}
+	user, err := a.repository.GetUserByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user by id: %w", err)
+	}
+	if !a.checkPassword(password, user.Password) {
+		return nil, domain.ErrWrongPassword
+	}
+	if err := a.checkEmailAvailable(ctx, user, email); err != nil {
+		return nil, err
+	}
+
+	code, err := newEmailCode()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	change := &domain.EmailChange{
+		ID:                domain.NewUUID(),
+		UserID:            user.ID,
+		OldEmail:          user.Email,
+		NewEmail:          email.Display,
+		NewEmailCanonical: email.Canonical,
+		CodeHash:          hash.HashToken(code),
+		CreatedAt:         now,
+		ExpiresAt:         now.Add(a.emailChangeCodeTTL),
+	}
+	err = a.txManager.RunInTx(ctx, func(ctx context.Context) error {
+		if err := a.repository.CreateEmailChange(ctx, change); err != nil {
+			return err
+		}
+		err := a.recordEvent(ctx, domain.EmailChangeRequested{
+			UserID:    user.ID,
+			NewEmail:  change.NewEmail,
+			ExpiresAt: change.ExpiresAt,
+		})
+		if err != nil {
+			return err
+		}
+		return a.audit(ctx, domain.AuditEvent{
+			ActorID:   &user.ID,
+			SubjectID: &user.ID,
+			Action:    domain.AuditRequestEmailChange,
+			Outcome:   domain.AuditOutcomeSuccess,
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to request email change: %w", err)
+	}
+	// A failed delivery can be retried with a new request.
+	err = a.notifier.SendSecret(ctx, domain.SecretMessage{
+		Kind:      domain.SecretEmailChangeCode,
+		UserID:    user.ID,
+		Email:     change.NewEmail,
+		Secret:    code,
+		ExpiresAt: change.ExpiresAt,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to send email change code: %w", err)
+	}
+	return change, nil
+}
+
+// ConfirmEmailChange changes the email of the user to the one the code was sent
+// to, which the code verifies. The previous address is sent a token reverting the change. The token
+// version of the user is bumped, so access tokens carrying the old email,
+// including the presented one, must be refreshed.
+func (a *Application) ConfirmEmailChange(ctx context.Context, token, code string) (*domain.User, error) {
+	claims, err := a.authenticate(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	revertToken, err := newResetToken()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		change    *domain.EmailChange
+		wrongCode bool
+	)
+	err = a.txManager.RunInTx(ctx, func(ctx context.Context) error {
+		now := time.Now().UTC()
+		pending, err := a.repository.GetPendingEmailChange(ctx, claims.UserID)
+		if err != nil {
+			return err
+		}
+		change = pending
+		if change.Attempts >= maxEmailCodeAttempts || !now.Before(change.ExpiresAt) {
+			return domain.ErrInvalidEmailCode
+		}
+		if subtle.ConstantTimeCompare([]byte(hash.HashToken(code)), []byte(change.CodeHash)) != 1 {
+			// The attempt must be committed, so the error is returned after the transaction.
+			wrongCode = true
+			change.Attempts++
+			return a.repository.UpdateEmailChange(ctx, change)
+		}
+
+		revertHash := hash.HashToken(revertToken)
+		revertExpiresAt := now.Add(a.emailRevertTTL)
+		change.ConfirmedAt = &now
+		change.RevertTokenHash, change.RevertExpiresAt = &revertHash, &revertExpiresAt
+		if err := a.repository.UpdateEmailChange(ctx, change); err != nil {
+			return err
+		}
+		if err := a.repository.UpdateEmail(ctx, change.UserID, change.NewEmail, change.NewEmailCanonical); err != nil {
+			return err
+		}
+		err = a.recordEvent(ctx, domain.UserEmailChanged{
+			UserID:          change.UserID,
+			OldEmail:        change.OldEmail,
+			NewEmail:        change.NewEmail,
+			RevertExpiresAt: revertExpiresAt,
+		})
+		if err != nil {
+			return err
+		}
+		// The code proves the user receives mail at the new address.
+		if err := a.recordEvent(ctx, domain.UserEmailVerified{UserID: change.UserID, Email: change.NewEmail}); err != nil {
+			return err
+		}
+		return a.audit(ctx, domain.AuditEvent{
+			ActorID:   &change.UserID,
+			SubjectID: &change.UserID,
+			Action:    domain.AuditConfirmEmailChange,
+			Outcome:   domain.AuditOutcomeSuccess,
+		})
+	})
+	if err == nil && wrongCode {
+		err = domain.ErrInvalidEmailCode
+	}
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidEmailCode) {
+			a.auditFailure(ctx, domain.AuditEvent{
+				ActorID:   &claims.UserID,
+				SubjectID: &claims.UserID,
+				Action:    domain.AuditConfirmEmailChange,
+			}, err)
+		}
+		return nil, fmt.Errorf("failed to confirm email change: %w", err)
+	}
+	// The change is made, so a failed delivery only costs the old address
+	// the chance to revert it.
+	err = a.notifier.SendSecret(ctx, domain.SecretMessage{
+		Kind:      domain.SecretEmailChangeRevert,
+		UserID:    change.UserID,
+		Email:     change.OldEmail,
+		Secret:    revertToken,
+		ExpiresAt: *change.RevertExpiresAt,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to send email change revert token",
+			slog.String("user_id", change.UserID.String()), slog.Any("error", err))
+	}
+	return a.repository.GetUserByID(ctx, claims.UserID)
+}
+
+// RevertEmailChange restores the email the change replaced. As whoever changed
+// it may know the password, all sessions are revoked and the returned
+// reset token must be used to set a new password before the next login.
+func (a *Application) RevertEmailChange(ctx context.Context, revertToken string) (*domain.PasswordReset, error) {
+	var reset *domain.PasswordReset
+	err := a.txManager.RunInTx(ctx, func(ctx context.Context) error {
+		now := time.Now().UTC()
+		change, err := a.repository.GetEmailChangeByRevertToken(ctx, hash.HashToken(revertToken))
+		if err != nil {
+			return err
+		}
+		if change.RevertedAt != nil || change.RevertExpiresAt == nil || !now.Before(*change.RevertExpiresAt) {
+			return domain.ErrInvalidRevertToken
+		}
+		email, err := domain.NormalizeEmail(change.OldEmail, a.emailProviderRules)
+		if err != nil {
+			return err
+		}
+		if err := a.repository.UpdateEmail(ctx, change.UserID, email.Display, email.Canonical); err != nil {
+			return err
+		}
+		change.RevertedAt = &now
+		if err := a.repository.UpdateEmailChange(ctx, change); err != nil {
+			return err
+		}
+
+		if reset, err = a.newPasswordReset(change.UserID); err != nil {
+			return err
+		}
+		if err := a.repository.RequirePasswordReset(ctx, change.UserID); err != nil {
+			return err
+		}
+		if err := a.sessions.RevokeUserSessions(ctx, change.UserID); err != nil {
+			return err
+		}
+		if err := a.repository.CreatePasswordReset(ctx, reset); err != nil {
+			return err
+		}
+		err = a.recordEvent(ctx, domain.UserEmailChanged{
+			UserID:   change.UserID,
+			OldEmail: change.NewEmail,
+			NewEmail: email.Display,
+		})
+		if err != nil {
+			return err
+		}
+		return a.audit(ctx, domain.AuditEvent{
+			SubjectID: &change.UserID,
+			Action:    domain.AuditRevertEmailChange,
+			Outcome:   domain.AuditOutcomeSuccess,
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to revert email change: %w", err)
+	}
+	return reset, nil
+}
+
+// checkEmailAvailable rejects an email that identifies another account or
+// belonged to a banned one.
+func (a *Application) checkEmailAvailable(ctx context.Context, user *domain.User, email domain.Email) error {
+	if err := a.checkEmailNotBanned(ctx, email); err != nil {
+		return err
+	}
+	owner, err := a.repository.GetUserByEmail(ctx, email.Canonical)
+	switch {
+	case errors.Is(err, domain.ErrUserNotFound):
+		return nil
+	case err != nil:
+		return fmt.Errorf("failed to get user by email: %w", err)
+	case owner.ID != user.ID:
+		return domain.ErrAlreadyExists
+	}
+	return nil
+}
+
+// checkEmailNotBanned keeps banned members from coming back under an alias of
+// their email.
+func (a *Application) checkEmailNotBanned(ctx context.Context, email domain.Email) error {
+	banned, err := a.repository.IsIdentifierBanned(ctx, domain.IdentifierEmail, email.Canonical, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to check banned email: %w", err)
+	}
+	if banned {
+		return domain.ErrIdentifierBanned
+	}
+	return nil
+}
+
+func newEmailCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", fmt.Errorf("failed to generate email code: %w", err)
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
@@ -0,0 +1,238 @@
+package app_test
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/soulmate-dating/auth/internal/adapters/events"
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+// secretsInOutbox fails the test if any of the secrets is part of a message
+// in the outbox.
+func (e *testEnv) secretsInOutbox(t *testing.T, secrets ...string) {
+	t.Helper()
+	for _, m := range e.repo.OutboxMessages() {
+		for _, secret := range secrets {
+			if bytes.Contains(m.Payload, []byte(secret)) {
+				t.Errorf("%s message in the outbox contains the secret %q", m.EventType, secret)
+			}
+		}
+	}
+}
+
+func TestApplication_EmailChange(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	token := env.signUp(t, "old@example.com")
+
+	change, err := env.app.RequestEmailChange(ctx, token.AccessToken, testPassword, " New@Example.COM")
+	checkErr(t, err, nil)
+	code := env.alerts.lastSecret(t, domain.SecretEmailChangeCode, "New@example.com")
+	if change.NewEmail != "New@example.com" || len(code) != 6 {
+		t.Fatalf("change = %s with code %q", change.NewEmail, code)
+	}
+	user, err := env.app.ConfirmEmailChange(ctx, token.AccessToken, code)
+	checkErr(t, err, nil)
+	if user.Email != "New@example.com" {
+		t.Errorf("email = %s, want the new one", user.Email)
+	}
+	var verified []string
+	for _, m := range env.repo.OutboxMessages() {
+		if m.EventType != domain.EventUserEmailVerified {
+			continue
+		}
+		var envelope events.Envelope
+		if err := proto.Unmarshal(m.Payload, &envelope); err != nil {
+			t.Fatal(err)
+		}
+		verified = append(verified, envelope.GetUserEmailVerified().GetEmail())
+	}
+	if !slices.Equal(verified, []string{"New@example.com"}) {
+		t.Errorf("verified emails in the outbox = %v, want the new one", verified)
+	}
+
+	// Tokens carrying the old email are outdated, but the session survives.
+	_, err = env.app.Validate(ctx, token.AccessToken, "")
+	checkErr(t, err, domain.ErrTokenOutdated)
+	refreshed, err := env.app.Refresh(ctx, token.RefreshToken)
+	checkErr(t, err, nil)
+	claims, err := env.app.Validate(ctx, refreshed.AccessToken, "")
+	checkErr(t, err, nil)
+	if claims.Email != "New@example.com" || !claims.EmailVerified {
+		t.Errorf("claims email = %s, verified = %t, want the new one verified", claims.Email, claims.EmailVerified)
+	}
+	_, err = env.app.Login(ctx, domain.LoginCredentials{Email: "old@example.com", Password: testPassword})
+	checkErr(t, err, domain.ErrUserNotFound)
+	_, err = env.app.Login(ctx, domain.LoginCredentials{Email: "new@example.com", Password: testPassword})
+	checkErr(t, err, nil)
+
+	// The old address reverts the change and locks out whoever made it.
+	revert := env.alerts.lastSecret(t, domain.SecretEmailChangeRevert, "old@example.com")
+	env.secretsInOutbox(t, code, revert)
+	reset, err := env.app.RevertEmailChange(ctx, revert)
+	checkErr(t, err, nil)
+	if reset.UserID != token.Id || reset.Token == "" {
+		t.Fatalf("reset = %+v, want a token for the user", reset)
+	}
+	_, err = env.app.Refresh(ctx, refreshed.RefreshToken)
+	checkErr(t, err, domain.ErrSessionRevoked)
+	_, err = env.app.Login(ctx, domain.LoginCredentials{Email: "old@example.com", Password: testPassword})
+	checkErr(t, err, domain.ErrPasswordResetNeeded)
+	_, err = env.app.RevertEmailChange(ctx, revert)
+	checkErr(t, err, domain.ErrInvalidRevertToken)
+
+	_, err = env.app.ResetPassword(ctx, reset.Token, "a-brand-new-password")
+	checkErr(t, err, nil)
+	_, err = env.app.Login(ctx, domain.LoginCredentials{Email: "old@example.com", Password: "a-brand-new-password"})
+	checkErr(t, err, nil)
+
+	want := []string{
+		domain.AuditSignUp + ":" + domain.AuditOutcomeSuccess,
+		domain.AuditRequestEmailChange + ":" + domain.AuditOutcomeSuccess,
+		domain.AuditConfirmEmailChange + ":" + domain.AuditOutcomeSuccess,
+		domain.AuditRevertEmailChange + ":" + domain.AuditOutcomeSuccess,
+	}
+	got := env.auditActions(t, token.Id)
+	for _, action := range want {
+		if !slices.Contains(got, action) {
+			t.Errorf("audit log %v lacks %s", got, action)
+		}
+	}
+}
+
+func TestApplication_RequestEmailChange(t *testing.T) {
+	tests := []struct {
+		name     string
+		token    func(t *testing.T, env *testEnv, user *domain.Token) string
+		password string
+		email    string
+		wantErr  error
+	}{
+		{name: "valid", password: testPassword, email: "new@example.com"},
+		{name: "same mailbox in another case", password: testPassword, email: "User@example.com"},
+		{name: "wrong password", password: "wrong-password", email: "new@example.com", wantErr: domain.ErrWrongPassword},
+		{name: "taken email", password: testPassword, email: "taken@gmail.com", wantErr: domain.ErrAlreadyExists},
+		{name: "taken alias", password: testPassword, email: "Ta.ken+x@GoogleMail.com", wantErr: domain.ErrAlreadyExists},
+		{name: "invalid email", password: testPassword, email: "not-an-email", wantErr: errAny},
+		{
+			name:     "service token",
+			token:    func(t *testing.T, env *testEnv, _ *domain.Token) string { return env.serviceToken(t) },
+			password: testPassword,
+			email:    "new@example.com",
+			wantErr:  domain.ErrServiceToken,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			env.signUp(t, "taken@gmail.com")
+			user := env.signUp(t, "user@example.com")
+			token := user.AccessToken
+			if tt.token != nil {
+				token = tt.token(t, env, user)
+			}
+
+			_, err := env.app.RequestEmailChange(context.Background(), token, tt.password, tt.email)
+			checkErrAny(t, err, tt.wantErr)
+			requested := 0
+			for _, m := range env.repo.OutboxMessages() {
+				if m.EventType == domain.EventEmailChangeRequested {
+					requested++
+				}
+			}
+			wantRequested := 1
+			if tt.wantErr != nil {
+				wantRequested = 0
+			}
+			if requested != wantRequested {
+				t.Errorf("%d email change requests in the outbox, want %d", requested, wantRequested)
+			}
+			if sent := len(env.alerts.secretsSent(domain.SecretEmailChangeCode)); sent != wantRequested {
+				t.Errorf("%d email change codes sent, want %d", sent, wantRequested)
+			}
+		})
+	}
+}
+
+func TestApplication_ConfirmEmailChange(t *testing.T) {
+	tests := []struct {
+		name      string
+		code      func(t *testing.T, env *testEnv, token, code string) string
+		wantErr   error
+		wantEmail string
+	}{
+		{
+			name:      "valid",
+			code:      func(_ *testing.T, _ *testEnv, _, code string) string { return code },
+			wantEmail: "new@example.com",
+		},
+		{
+			name: "wrong code",
+			code: func(_ *testing.T, _ *testEnv, _, code string) string {
+				return wrongCode(code)
+			},
+			wantErr:   domain.ErrInvalidEmailCode,
+			wantEmail: "user@example.com",
+		},
+		{
+			name: "too many attempts",
+			code: func(t *testing.T, env *testEnv, token, code string) string {
+				for i := 0; i < 5; i++ {
+					_, err := env.app.ConfirmEmailChange(context.Background(), token, wrongCode(code))
+					checkErr(t, err, domain.ErrInvalidEmailCode)
+				}
+				return code
+			},
+			wantErr:   domain.ErrInvalidEmailCode,
+			wantEmail: "user@example.com",
+		},
+		{
+			name: "replaced request",
+			code: func(t *testing.T, env *testEnv, token, code string) string {
+				_, err := env.app.RequestEmailChange(context.Background(), token, testPassword, "other@example.com")
+				checkErr(t, err, nil)
+				return code
+			},
+			wantErr:   domain.ErrInvalidEmailCode,
+			wantEmail: "user@example.com",
+		},
+		{
+			name: "already confirmed",
+			code: func(t *testing.T, env *testEnv, token, code string) string {
+				_, err := env.app.ConfirmEmailChange(context.Background(), token, code)
+				checkErr(t, err, nil)
+				return code
+			},
+			wantErr:   domain.ErrTokenOutdated,
+			wantEmail: "new@example.com",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			ctx := context.Background()
+			token := env.signUp(t, "user@example.com").AccessToken
+			_, err := env.app.RequestEmailChange(ctx, token, testPassword, "new@example.com")
+			checkErr(t, err, nil)
+			code := env.alerts.lastSecret(t, domain.SecretEmailChangeCode, "new@example.com")
+
+			_, err = env.app.ConfirmEmailChange(ctx, token, tt.code(t, env, token, code))
+			checkErr(t, err, tt.wantErr)
+			if _, err := env.repo.GetUserByEmail(ctx, tt.wantEmail); err != nil {
+				t.Errorf("no user with %s: %v", tt.wantEmail, err)
+			}
+		})
+	}
+}
+
+func wrongCode(code string) string {
+	if code == "000000" {
+		return "000001"
+	}
+	return "000000"
+}
@@ -0,0 +1,131 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+// CreateGuest creates a user without credentials and starts their session,
+// letting them go through onboarding before signing up. Signing up with the
+// guest's access token keeps their ID, so data other services stored for the
+// guest stays attached. Guests are only created while registration is open
+// and must pass the age gate; PurgeExpiredGuests removes the ones who don't
+// sign up.
+func (a *Application) CreateGuest(ctx context.Context, registration domain.GuestRegistration) (token *domain.Token, err error) {
+	if a.registrationMode != domain.RegistrationOpen {
+		return nil, domain.ErrInviteRequired
+	}
+	if err := a.checkRateLimit(ctx, rateLimitCreateGuest); err != nil {
+		return nil, err
+	}
+	if err := a.checkClientNotBanned(ctx); err != nil {
+		return nil, err
+	}
+	attestedAt, err := a.checkAge(ctx, registration.DateOfBirth, registration.Country)
+	if err != nil {
+		return nil, err
+	}
+	err = a.txManager.RunInTx(ctx, func(ctx context.Context) error {
+		user := &domain.User{
+			ID:               domain.NewUUID(),
+			Guest:            true,
+			AgeAttestedAt:    &attestedAt,
+			AgePolicyVersion: a.agePolicy.Version,
+		}
+		if _, err := a.repository.CreateUser(ctx, user); err != nil {
+			return err
+		}
+		if err := a.repository.SetUserRoles(ctx, user.ID, []string{domain.RoleGuest}); err != nil {
+			return fmt.Errorf("failed to grant guest role: %w", err)
+		}
+		if token, _, err = a.startSession(ctx, user); err != nil {
+			return err
+		}
+		return a.audit(ctx, domain.AuditEvent{
+			ActorID:   &user.ID,
+			SubjectID: &user.ID,
+			Action:    domain.AuditCreateGuest,
+			Outcome:   domain.AuditOutcomeSuccess,
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create guest: %w", err)
+	}
+	return token, nil
+}
+
+// checkClientNotBanned refuses clients whose IP a banned account signed in from.
+func (a *Application) checkClientNotBanned(ctx context.Context) error {
+	ip := ClientInfoFromContext(ctx).IP
+	if ip == "" {
+		return nil
+	}
+	banned, err := a.repository.IsIdentifierBanned(ctx, domain.IdentifierIP, ip, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to check banned ip: %w", err)
+	}
+	if banned {
+		return domain.ErrIdentifierBanned
+	}
+	return nil
+}
+
+// PurgeExpiredGuests deletes the guests who didn't sign up within guestTTL.
+// Other services are told as for deleted accounts, so they drop what the
+// guests stored during onboarding.
+func (a *Application) PurgeExpiredGuests(ctx context.Context) (int64, error) {
+	var expired []uuid.UUID
+	err := a.txManager.RunInTx(ctx, func(ctx context.Context) (err error) {
+		now := time.Now().UTC()
+		if expired, err = a.repository.ExpireGuests(ctx, now.Add(-a.guestTTL), now); err != nil {
+			return err
+		}
+		for _, id := range expired {
+			if err := a.sessions.RevokeUserSessions(ctx, id); err != nil {
+				return err
+			}
+			if err := a.recordEvent(ctx, domain.UserDeleted{UserID: id}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge expired guests: %w", err)
+	}
+	return int64(len(expired)), nil
+}
+
+// authenticateGuest returns the ID of the guest the access token was issued to.
+func (a *Application) authenticateGuest(ctx context.Context, token string) (uuid.UUID, error) {
+	claims, err := a.authenticate(ctx, token)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if !claims.Guest {
+		return uuid.Nil, domain.ErrNotGuest
+	}
+	return claims.UserID, nil
+}
+
+// upgradeGuest gives the guest the credentials of user and returns the
+// upgraded user. The sessions of the guest are revoked, as their refresh
+// tokens would issue guest claims.
+func (a *Application) upgradeGuest(ctx context.Context, user *domain.User) (*domain.User, error) {
+	if err := a.repository.UpgradeGuest(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to upgrade guest: %w", err)
+	}
+	if err := a.sessions.RevokeUserSessions(ctx, user.ID); err != nil {
+		return nil, fmt.Errorf("failed to revoke guest sessions: %w", err)
+	}
+	upgraded, err := a.repository.GetUserByID(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user by id: %w", err)
+	}
+	return upgraded, nil
+}
@@ -0,0 +1,250 @@
+package app_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/soulmate-dating/auth/internal/app"
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+// guestRegistration returns the attestation of a guest old enough everywhere.
+func guestRegistration() domain.GuestRegistration {
+	return domain.GuestRegistration{DateOfBirth: time.Date(1990, time.May, 17, 0, 0, 0, 0, time.UTC), Country: "DE"}
+}
+
+func TestApplication_CreateGuest(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	token, err := env.app.CreateGuest(ctx, guestRegistration())
+	checkErr(t, err, nil)
+
+	claims, err := env.app.Validate(ctx, token.AccessToken, "onboarding:write")
+	checkErr(t, err, nil)
+	if !claims.Guest || claims.UserID != token.Id || !claims.AgeVerified {
+		t.Errorf("claims = %+v, want those of a guest who passed the age gate", claims)
+	}
+	if lifetime := time.Duration(claims.ExpiresAt-claims.IssuedAt) * time.Second; lifetime != 10*time.Minute {
+		t.Errorf("access token lives %s, want the guest expiration", lifetime)
+	}
+	if !slices.Equal(claims.Roles, []string{domain.RoleGuest}) {
+		t.Errorf("roles = %v, want only %s", claims.Roles, domain.RoleGuest)
+	}
+	for _, scope := range []string{"profile:read", "profile:write", "matches:read"} {
+		_, err = env.app.Validate(ctx, token.AccessToken, scope)
+		checkErr(t, err, domain.ErrInsufficientScope)
+	}
+
+	sessions, err := env.repo.ListUserSessions(ctx, token.Id)
+	checkErr(t, err, nil)
+	if len(sessions) != 1 || sessions[0].ExpiresAt.Sub(sessions[0].CreatedAt) != 2*time.Hour {
+		t.Errorf("sessions = %+v, want one lasting the guest refresh expiration", sessions)
+	}
+	refreshed, err := env.app.Refresh(ctx, token.RefreshToken)
+	checkErr(t, err, nil)
+	if len(refreshed.PendingConsents) != 0 {
+		t.Errorf("guest is asked to accept %v", refreshed.PendingConsents)
+	}
+	if actions := env.auditActions(t, token.Id); actions[len(actions)-1] != domain.AuditCreateGuest+":"+domain.AuditOutcomeSuccess {
+		t.Errorf("audit actions = %v, want the guest creation first", actions)
+	}
+}
+
+func TestApplication_CreateGuestFails(t *testing.T) {
+	bannedIP := domain.ClientInfo{IP: "203.0.113.7", UserAgent: "Glimpse/1.0"}
+	tests := []struct {
+		name         string
+		registration domain.GuestRegistration
+		// setup runs before the guest is created from bannedIP.
+		setup   func(t *testing.T, env *testEnv)
+		wantErr error
+	}{
+		{
+			name:         "registration gated",
+			registration: guestRegistration(),
+			setup:        func(_ *testing.T, env *testEnv) { env.withRegistrationMode(domain.RegistrationInviteOnly) },
+			wantErr:      domain.ErrInviteRequired,
+		},
+		{
+			name:         "underage",
+			registration: domain.GuestRegistration{DateOfBirth: time.Now().UTC().AddDate(-17, 0, 0), Country: "DE"},
+			wantErr:      domain.ErrUnderage,
+		},
+		{
+			name:         "invalid country",
+			registration: domain.GuestRegistration{DateOfBirth: time.Date(1990, time.May, 17, 0, 0, 0, 0, time.UTC), Country: "Germany"},
+			wantErr:      errAny,
+		},
+		{
+			name:         "address of a banned account",
+			registration: guestRegistration(),
+			setup: func(t *testing.T, env *testEnv) {
+				adminID, _ := env.signUpAdmin(t)
+				banned := env.signUpFrom(t, bannedIP)
+				_, err := env.app.BanUser(context.Background(), adminID, banned.Id, "romance scam", nil)
+				checkErr(t, err, nil)
+			},
+			wantErr: domain.ErrIdentifierBanned,
+		},
+		{
+			name:         "rate limited",
+			registration: guestRegistration(),
+			setup: func(t *testing.T, env *testEnv) {
+				ctx := app.WithClientInfo(context.Background(), bannedIP)
+				for i := 0; i < env.cfg.GuestRateLimit; i++ {
+					_, err := env.app.CreateGuest(ctx, guestRegistration())
+					checkErr(t, err, nil)
+				}
+			},
+			wantErr: domain.ErrRateLimited,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			if tt.setup != nil {
+				tt.setup(t, env)
+			}
+			_, err := env.app.CreateGuest(app.WithClientInfo(context.Background(), bannedIP), tt.registration)
+			checkErrAny(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestApplication_PurgeExpiredGuests(t *testing.T) {
+	tests := []struct {
+		name       string
+		ttl        time.Duration
+		wantPurged int64
+	}{
+		{"within ttl", time.Hour, 0},
+		// A negative TTL expires the guests created until now.
+		{"ttl over", -time.Minute, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			ctx := context.Background()
+			guest, err := env.app.CreateGuest(ctx, guestRegistration())
+			checkErr(t, err, nil)
+			upgraded, err := env.app.CreateGuest(ctx, guestRegistration())
+			checkErr(t, err, nil)
+			r := registration("upgraded@example.com", testPassword)
+			r.GuestToken = upgraded.AccessToken
+			_, err = env.app.SignUp(ctx, r)
+			checkErr(t, err, nil)
+			cfg := env.cfg
+			cfg.GuestTTL = tt.ttl
+			env.reconfigure(cfg)
+
+			expired, err := env.app.PurgeExpiredGuests(ctx)
+			checkErr(t, err, nil)
+			if expired != tt.wantPurged {
+				t.Errorf("expired %d guests, want %d", expired, tt.wantPurged)
+			}
+			_, err = env.app.PurgeDeletedAccounts(ctx)
+			checkErr(t, err, nil)
+			if _, err := env.repo.GetAnyUserByID(ctx, guest.Id); (err == nil) != (tt.wantPurged == 0) {
+				t.Errorf("GetAnyUserByID(guest) = %v", err)
+			}
+			if _, err := env.repo.GetUserByID(ctx, upgraded.Id); err != nil {
+				t.Errorf("upgraded guest was purged: %v", err)
+			}
+			var deleted bool
+			for _, m := range env.repo.OutboxMessages() {
+				deleted = deleted || m.AggregateID == guest.Id && m.EventType == domain.EventUserDeleted
+			}
+			if deleted != (tt.wantPurged > 0) {
+				t.Errorf("UserDeleted event in the outbox: %t, want %t", deleted, tt.wantPurged > 0)
+			}
+		})
+	}
+}
+
+func TestApplication_SignUpUpgradesGuest(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	guest, err := env.app.CreateGuest(ctx, guestRegistration())
+	checkErr(t, err, nil)
+
+	r := registration("guest@example.com", testPassword)
+	r.GuestToken = guest.AccessToken
+	token, err := env.app.SignUp(ctx, r)
+	checkErr(t, err, nil)
+	if token.Id != guest.Id {
+		t.Fatalf("signed up as %s, want the guest %s", token.Id, guest.Id)
+	}
+	claims, err := env.app.Validate(ctx, token.AccessToken, "matches:read")
+	checkErr(t, err, nil)
+	if claims.Guest || claims.Email != "guest@example.com" || !claims.AgeVerified {
+		t.Errorf("claims = %+v, want those of a verified user", claims)
+	}
+	_, err = env.app.Validate(ctx, guest.AccessToken, "")
+	checkErr(t, err, domain.ErrSessionRevoked)
+	_, err = env.app.Refresh(ctx, guest.RefreshToken)
+	checkErr(t, err, domain.ErrSessionRevoked)
+	_, err = env.app.Login(ctx, domain.LoginCredentials{Email: "guest@example.com", Password: testPassword})
+	checkErr(t, err, nil)
+
+	events, err := env.repo.ListAuditEvents(ctx, domain.AuditFilter{UserID: &guest.Id, Limit: 100})
+	checkErr(t, err, nil)
+	i := slices.IndexFunc(events, func(e domain.AuditEvent) bool { return e.Action == domain.AuditSignUp })
+	if i < 0 || events[i].Details["upgraded_guest"] != "true" {
+		t.Errorf("audit events = %+v, want the sign-up of an upgraded guest", events)
+	}
+}
+
+func TestApplication_SignUpWithGuestTokenFails(t *testing.T) {
+	tests := []struct {
+		name    string
+		email   string
+		token   func(t *testing.T, env *testEnv, guest *domain.Token) string
+		wantErr error
+	}{
+		{
+			name:  "token of a user",
+			email: "new@example.com",
+			token: func(t *testing.T, env *testEnv, _ *domain.Token) string {
+				return env.signUp(t, "user@example.com").AccessToken
+			},
+			wantErr: domain.ErrNotGuest,
+		},
+		{
+			name:    "refresh token",
+			email:   "new@example.com",
+			token:   func(_ *testing.T, _ *testEnv, guest *domain.Token) string { return guest.RefreshToken },
+			wantErr: domain.ErrInvalidToken,
+		},
+		{
+			name:  "email taken",
+			email: "user@example.com",
+			token: func(t *testing.T, env *testEnv, guest *domain.Token) string {
+				env.signUp(t, "user@example.com")
+				return guest.AccessToken
+			},
+			wantErr: domain.ErrAlreadyExists,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			ctx := context.Background()
+			guest, err := env.app.CreateGuest(ctx, guestRegistration())
+			checkErr(t, err, nil)
+
+			r := registration(tt.email, testPassword)
+			r.GuestToken = tt.token(t, env, guest)
+			_, err = env.app.SignUp(ctx, r)
+			checkErr(t, err, tt.wantErr)
+
+			// The guest is left as it was.
+			claims, err := env.app.Validate(ctx, guest.AccessToken, "")
+			checkErr(t, err, nil)
+			if !claims.Guest {
+				t.Error("guest lost the guest claim")
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+	"github.com/soulmate-dating/auth/internal/hash"
+)
+
+// maxIdempotencyKeyLength fits UUIDs and other random keys clients generate.
+const maxIdempotencyKeyLength = 128
+
+type idempotencyKeyKey struct{}
+
+// WithIdempotencyKey attaches the idempotency key the client sent with the
+// request to the context. Operations supporting it return the response of
+// the first request with the key to retries.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyKey{}, key)
+}
+
+func idempotencyKeyFromContext(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKeyKey{}).(string)
+	return key
+}
+
+// idempotentRequest is a request made with an idempotency key.
+type idempotentRequest struct {
+	operation string
+	key       string
+	hash      string
+}
+
+// newIdempotentRequest returns nil if the context has no idempotency key.
+// The hash of the request is taken from its JSON encoding.
+func newIdempotentRequest(ctx context.Context, operation string, request any) (*idempotentRequest, error) {
+	key := idempotencyKeyFromContext(ctx)
+	if key == "" {
+		return nil, nil
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		return nil, fmt.Errorf("%w: at most %d bytes are allowed", domain.ErrInvalidIdempotencyKey, maxIdempotencyKeyLength)
+	}
+	b, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash request: %w", err)
+	}
+	return &idempotentRequest{operation: operation, key: key, hash: hash.HashToken(string(b))}, nil
+}
+
+// replay returns the user an earlier request with the same key signed up.
+// It returns ErrIdempotencyKeyNotFound if there was none and
+// ErrIdempotencyKeyReused if the earlier request differs.
+func (a *Application) replay(ctx context.Context, r *idempotentRequest) (uuid.UUID, error) {
+	rec, err := a.repository.GetIdempotencyRecord(ctx, r.operation, r.key, time.Now().UTC())
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if rec.RequestHash != r.hash {
+		return uuid.Nil, domain.ErrIdempotencyKeyReused
+	}
+	return rec.UserID, nil
+}
+
+// remember ties the request to the user for retries. It must run in the
+// transaction of the request, so that the record is stored only if it
+// succeeds, and fails it if a concurrent request with the key won.
+func (a *Application) remember(ctx context.Context, r *idempotentRequest, userID uuid.UUID) error {
+	now := time.Now().UTC()
+	return a.repository.SaveIdempotencyRecord(ctx, &domain.IdempotencyRecord{
+		Operation:   r.operation,
+		Key:         r.key,
+		RequestHash: r.hash,
+		UserID:      userID,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(a.idempotencyKeyTTL),
+	})
+}
+
+// replaySignUp starts a new session of the user an earlier sign-up with the
+// key created, as their tokens are not stored. As the password is left out of
+// the request hash, it is checked against the user.
+func (a *Application) replaySignUp(ctx context.Context, r *idempotentRequest, password string) (*domain.Token, error) {
+	id, err := a.replay(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	user, err := a.repository.GetUserByID(ctx, id)
+	if err != nil && !errors.Is(err, domain.ErrUserNotFound) {
+		return nil, fmt.Errorf("failed to get user by id: %w", err)
+	}
+	if err != nil || !a.checkPassword(password, user.Password) {
+		return nil, domain.ErrIdempotencyKeyReused
+	}
+	if err := checkUserAccess(user); err != nil {
+		return nil, err
+	}
+	var token *domain.Token
+	err = a.txManager.RunInTx(ctx, func(ctx context.Context) (err error) {
+		token, _, err = a.startSession(ctx, user)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	a.auditSuccess(ctx, user.ID, domain.AuditLogin)
+	return token, nil
+}
+
+// PurgeIdempotencyRecords deletes the responses whose keys have expired.
+func (a *Application) PurgeIdempotencyRecords(ctx context.Context) (int64, error) {
+	deleted, err := a.repository.DeleteExpiredIdempotencyRecords(ctx, time.Now().UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge idempotency records: %w", err)
+	}
+	return deleted, nil
+}
@@ -0,0 +1,139 @@
+package app_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/soulmate-dating/auth/internal/app"
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+func TestApplication_SignUpIdempotency(t *testing.T) {
+	const key = "3f1e2d4c-5b6a-4978-8695-a4b3c2d1e0f9"
+	tests := []struct {
+		name     string
+		key      string
+		retry    func(r *domain.Registration)
+		wantErr  error
+		wantSame bool
+	}{
+		{name: "retry", key: key, wantSame: true},
+		{name: "retry with another email", key: key, retry: func(r *domain.Registration) { r.Email = "other@example.com" }, wantErr: domain.ErrIdempotencyKeyReused},
+		{name: "retry with another password", key: key, retry: func(r *domain.Registration) { r.Password = "another-password" }, wantErr: domain.ErrIdempotencyKeyReused},
+		{name: "retry without key", wantErr: domain.ErrAlreadyExists},
+		{name: "key too long", key: strings.Repeat("k", 129), wantErr: domain.ErrInvalidIdempotencyKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			ctx := app.WithIdempotencyKey(context.Background(), tt.key)
+			r := registration("user@example.com", testPassword)
+			first, err := env.app.SignUp(ctx, r)
+			if tt.wantErr == domain.ErrInvalidIdempotencyKey {
+				checkErr(t, err, tt.wantErr)
+				return
+			}
+			checkErr(t, err, nil)
+
+			if tt.retry != nil {
+				tt.retry(&r)
+			}
+			retried, err := env.app.SignUp(ctx, r)
+			checkErr(t, err, tt.wantErr)
+			if tt.wantSame {
+				// The retry signs in the same user with a session of its own.
+				if retried.Id != first.Id || retried.RefreshToken == first.RefreshToken {
+					t.Errorf("retry returned %+v, want new tokens of %s", retried, first.Id)
+				}
+				for _, token := range []*domain.Token{first, retried} {
+					_, err := env.app.Refresh(ctx, token.RefreshToken)
+					checkErr(t, err, nil)
+				}
+			}
+			if got := env.metrics.count("sign_up"); got != 1 {
+				t.Errorf("counted %d sign-ups, want 1", got)
+			}
+		})
+	}
+}
+
+func TestApplication_SignUpIdempotencyConcurrently(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := app.WithIdempotencyKey(context.Background(), "key")
+	tokens := make([]*domain.Token, 8)
+	errs := make([]error, len(tokens))
+	var wg sync.WaitGroup
+	for i := range tokens {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tokens[i], errs[i] = env.app.SignUp(ctx, registration("user@example.com", testPassword))
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		checkErr(t, err, nil)
+		if tokens[i].Id != tokens[0].Id {
+			t.Errorf("call %d signed up %s, want %s", i, tokens[i].Id, tokens[0].Id)
+		}
+	}
+	if got := env.metrics.count("sign_up"); got != 1 {
+		t.Errorf("counted %d sign-ups, want 1", got)
+	}
+}
+
+func TestApplication_SignUpIdempotencyStoresNoTokens(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := app.WithIdempotencyKey(context.Background(), "key")
+	token, err := env.app.SignUp(ctx, registration("user@example.com", testPassword))
+	checkErr(t, err, nil)
+
+	rec, err := env.repo.GetIdempotencyRecord(ctx, domain.IdempotencyOperationSignUp, "key", time.Now())
+	checkErr(t, err, nil)
+	if rec.UserID != token.Id {
+		t.Errorf("record of user %s, want %s", rec.UserID, token.Id)
+	}
+
+	// A retry after the user was banned starts no session.
+	adminID, _ := env.signUpAdmin(t)
+	_, err = env.app.BanUser(context.Background(), adminID, token.Id, "romance scam", nil)
+	checkErr(t, err, nil)
+	_, err = env.app.SignUp(ctx, registration("user@example.com", testPassword))
+	checkErr(t, err, domain.ErrAccountBanned)
+}
+
+func TestApplication_SignUpIdempotencyFailuresAreNotStored(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := app.WithIdempotencyKey(context.Background(), "key")
+	_, err := env.app.SignUp(ctx, bornYearsAgo(17, 0, "DE"))
+	checkErr(t, err, domain.ErrUnderage)
+
+	_, err = env.app.SignUp(ctx, registration("young@example.com", testPassword))
+	checkErr(t, err, nil)
+}
+
+func TestApplication_SignUpIdempotencyKeyExpires(t *testing.T) {
+	env := newTestEnv(t)
+	cfg := env.cfg
+	cfg.IdempotencyKeyTTL = 50 * time.Millisecond
+	env.reconfigure(cfg)
+	ctx := app.WithIdempotencyKey(context.Background(), "key")
+	_, err := env.app.SignUp(ctx, registration("user@example.com", testPassword))
+	checkErr(t, err, nil)
+	time.Sleep(cfg.IdempotencyKeyTTL)
+
+	_, err = env.app.SignUp(ctx, registration("user@example.com", testPassword))
+	checkErr(t, err, domain.ErrAlreadyExists)
+	deleted, err := env.app.PurgeIdempotencyRecords(context.Background())
+	checkErr(t, err, nil)
+	if deleted != 1 {
+		t.Errorf("purged %d records, want 1", deleted)
+	}
+	// The key can be used again once it expired.
+	_, err = env.app.SignUp(ctx, registration("other@example.com", testPassword))
+	checkErr(t, err, nil)
+}
@@ -0,0 +1,236 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+	"github.com/soulmate-dating/auth/internal/hash"
+)
+
+const (
+	// maxInviteBatch limits the codes created or waitlist entries admitted by one call.
+	maxInviteBatch  = 100
+	inviteCodeBytes = 10
+)
+
+// useInviteCode counts a use of the invite code unless registration is open,
+// returning the audit details of the sign-up. It must run in the sign-up
+// transaction, so that a failed sign-up gives the use back.
+func (a *Application) useInviteCode(ctx context.Context, code string) (map[string]string, error) {
+	if a.registrationMode == domain.RegistrationOpen {
+		return nil, nil
+	}
+	code = normalizeInviteCode(code)
+	if code == "" {
+		return nil, domain.ErrInviteRequired
+	}
+	id, err := a.repository.UseInviteCode(ctx, hash.HashToken(code), time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"invite_code_id": id.String()}, nil
+}
+
+// JoinWaitlist puts the email on the waitlist unless it is already there.
+// Emails of accounts and banned ones are left out silently, so that the
+// response tells nothing about an address and callers are rate-limited.
+func (a *Application) JoinWaitlist(ctx context.Context, address string) error {
+	if a.registrationMode != domain.RegistrationWaitlist {
+		return domain.ErrWaitlistClosed
+	}
+	email, err := domain.NormalizeEmail(address, a.emailProviderRules)
+	if err != nil {
+		return err
+	}
+	if err := a.validate.Var(email.Display, emailTag); err != nil {
+		return fmt.Errorf("invalid email: %w", err)
+	}
+	if err := a.checkRateLimit(ctx, rateLimitJoinWaitlist); err != nil {
+		return err
+	}
+	if err := a.checkEmailNotBanned(ctx, email); err != nil {
+		if errors.Is(err, domain.ErrIdentifierBanned) {
+			return nil
+		}
+		return err
+	}
+	if _, err := a.repository.GetUserByEmail(ctx, email.Canonical); err == nil {
+		return nil
+	} else if !errors.Is(err, domain.ErrUserNotFound) {
+		return fmt.Errorf("failed to get user by email: %w", err)
+	}
+	_, err = a.repository.AddToWaitlist(ctx, &domain.WaitlistEntry{
+		ID:             domain.NewUUID(),
+		Email:          email.Display,
+		EmailCanonical: email.Canonical,
+		CreatedAt:      time.Now().UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to join waitlist: %w", err)
+	}
+	return nil
+}
+
+// CreateInviteCodes creates count codes, each letting maxUses users sign up
+// until expiresAt, if set. The codes are only returned here.
+func (a *Application) CreateInviteCodes(
+	ctx context.Context, actor uuid.UUID, count, maxUses int, expiresAt *time.Time,
+) ([]domain.InviteCode, error) {
+	count, maxUses = max(count, 1), max(maxUses, 1)
+	details := map[string]string{"count": fmt.Sprint(count), "max_uses": fmt.Sprint(maxUses)}
+	if expiresAt != nil {
+		details["expires_at"] = expiresAt.UTC().Format(time.RFC3339)
+	}
+	event := domain.AuditEvent{
+		ActorID: &actor,
+		Action:  domain.AuditAdminCreateInviteCodes,
+		Outcome: domain.AuditOutcomeSuccess,
+		Details: details,
+	}
+
+	var codes []domain.InviteCode
+	err := a.txManager.RunInTx(ctx, func(ctx context.Context) error {
+		if count > maxInviteBatch {
+			return domain.ErrBatchTooLarge
+		}
+		if expiresAt != nil && !expiresAt.After(time.Now()) {
+			return domain.ErrInvalidExpiry
+		}
+		for i := 0; i < count; i++ {
+			code, err := a.createInviteCode(ctx, &actor, maxUses, expiresAt)
+			if err != nil {
+				return err
+			}
+			codes = append(codes, *code)
+		}
+		return a.audit(ctx, event)
+	})
+	if err != nil {
+		a.auditFailure(ctx, event, err)
+		return nil, fmt.Errorf("failed to create invite codes: %w", err)
+	}
+	return codes, nil
+}
+
+// AdmitWaitlist admits the count oldest waitlist entries. Each is sent a
+// single-use invite code valid for the waitlist invite TTL.
+func (a *Application) AdmitWaitlist(ctx context.Context, actor uuid.UUID, count int) ([]domain.WaitlistEntry, error) {
+	count = max(count, 1)
+	event := domain.AuditEvent{
+		ActorID: &actor,
+		Action:  domain.AuditAdminAdmitWaitlist,
+		Outcome: domain.AuditOutcomeSuccess,
+		Details: map[string]string{"count": fmt.Sprint(count)},
+	}
+
+	var (
+		entries []domain.WaitlistEntry
+		invites []domain.SecretMessage
+	)
+	err := a.txManager.RunInTx(ctx, func(ctx context.Context) (err error) {
+		invites = nil
+		if count > maxInviteBatch {
+			return domain.ErrBatchTooLarge
+		}
+		if entries, err = a.repository.ListWaitlist(ctx, count); err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		expiresAt := now.Add(a.waitlistInviteTTL)
+		for i := range entries {
+			code, err := a.createInviteCode(ctx, &actor, 1, &expiresAt)
+			if err != nil {
+				return err
+			}
+			if err := a.repository.AdmitWaitlistEntry(ctx, entries[i].ID, code.ID, now); err != nil {
+				return err
+			}
+			entries[i].AdmittedAt, entries[i].InviteCodeID = &now, &code.ID
+			err = a.recordEvent(ctx, domain.WaitlistAdmitted{
+				EntryID:   entries[i].ID,
+				Email:     entries[i].Email,
+				ExpiresAt: expiresAt,
+			})
+			if err != nil {
+				return err
+			}
+			invites = append(invites, domain.SecretMessage{
+				Kind:      domain.SecretWaitlistInvite,
+				EntryID:   entries[i].ID,
+				Email:     entries[i].Email,
+				Secret:    code.Code,
+				ExpiresAt: expiresAt,
+			})
+		}
+		event.Details["admitted"] = fmt.Sprint(len(entries))
+		return a.audit(ctx, event)
+	})
+	if err != nil {
+		a.auditFailure(ctx, event, err)
+		return nil, fmt.Errorf("failed to admit waitlist: %w", err)
+	}
+	// The entries are admitted, so an admin has to create a code for those
+	// whose invite was not delivered.
+	for _, m := range invites {
+		if err := a.notifier.SendSecret(ctx, m); err != nil {
+			slog.ErrorContext(ctx, "failed to send waitlist invite",
+				slog.String("entry_id", m.EntryID.String()), slog.Any("error", err))
+		}
+	}
+	return entries, nil
+}
+
+func (a *Application) createInviteCode(
+	ctx context.Context, createdBy *uuid.UUID, maxUses int, expiresAt *time.Time,
+) (*domain.InviteCode, error) {
+	code, err := newInviteCode()
+	if err != nil {
+		return nil, err
+	}
+	invite := &domain.InviteCode{
+		ID:        domain.NewUUID(),
+		CodeHash:  hash.HashToken(normalizeInviteCode(code)),
+		MaxUses:   maxUses,
+		CreatedBy: createdBy,
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: expiresAt,
+		Code:      code,
+	}
+	if err := a.repository.CreateInviteCode(ctx, invite); err != nil {
+		return nil, err
+	}
+	return invite, nil
+}
+
+// newInviteCode returns a code meant to be typed in, e.g. ABCD-EFGH-IJKL-MNOP.
+func newInviteCode() (string, error) {
+	b := make([]byte, inviteCodeBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate invite code: %w", err)
+	}
+	code := base32.StdEncoding.EncodeToString(b)
+	groups := make([]string, 0, len(code)/4)
+	for i := 0; i < len(code); i += 4 {
+		groups = append(groups, code[i:i+4])
+	}
+	return strings.Join(groups, "-"), nil
+}
+
+// normalizeInviteCode ignores the case and separators of a typed code.
+func normalizeInviteCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(strings.TrimSpace(code)))
+}
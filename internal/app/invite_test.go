@@ -0,0 +1,212 @@
+package app_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/soulmate-dating/auth/internal/app"
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+// withRegistrationMode switches the registration mode after the admin signed up.
+func (e *testEnv) withRegistrationMode(mode domain.RegistrationMode) {
+	cfg := e.cfg
+	cfg.RegistrationMode = string(mode)
+	e.reconfigure(cfg)
+}
+
+// admittedCodes returns the invite codes sent to admitted waitlist entries by email.
+func (e *testEnv) admittedCodes(t *testing.T) map[string]string {
+	t.Helper()
+	codes := map[string]string{}
+	for _, m := range e.alerts.secretsSent(domain.SecretWaitlistInvite) {
+		codes[m.Email] = m.Secret
+	}
+	return codes
+}
+
+func TestApplication_InviteOnlySignUp(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    func(t *testing.T, env *testEnv, code string) string
+		wantErr error
+	}{
+		{name: "valid", code: func(_ *testing.T, _ *testEnv, code string) string { return code }},
+		{
+			name: "typed in lowercase without dashes",
+			code: func(_ *testing.T, _ *testEnv, code string) string {
+				return strings.ToLower(strings.ReplaceAll(code, "-", ""))
+			},
+		},
+		{name: "missing", code: func(*testing.T, *testEnv, string) string { return "" }, wantErr: domain.ErrInviteRequired},
+		{name: "unknown", code: func(*testing.T, *testEnv, string) string { return "AAAA-BBBB" }, wantErr: domain.ErrInvalidInviteCode},
+		{
+			name: "used up",
+			code: func(t *testing.T, env *testEnv, code string) string {
+				for _, email := range []string{"first@example.com", "second@example.com"} {
+					r := registration(email, testPassword)
+					r.InviteCode = code
+					_, err := env.app.SignUp(context.Background(), r)
+					checkErr(t, err, nil)
+				}
+				return code
+			},
+			wantErr: domain.ErrInvalidInviteCode,
+		},
+		{
+			name: "not used by a failed sign-up",
+			code: func(t *testing.T, env *testEnv, code string) string {
+				for i := 0; i < 2; i++ {
+					r := registration("admin@example.com", testPassword)
+					r.InviteCode = code
+					_, err := env.app.SignUp(context.Background(), r)
+					checkErr(t, err, domain.ErrAlreadyExists)
+				}
+				return code
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			ctx := context.Background()
+			adminID, _ := env.signUpAdmin(t)
+			env.withRegistrationMode(domain.RegistrationInviteOnly)
+			codes, err := env.app.CreateInviteCodes(ctx, adminID, 1, 2, nil)
+			checkErr(t, err, nil)
+
+			r := registration("user@example.com", testPassword)
+			r.InviteCode = tt.code(t, env, codes[0].Code)
+			_, err = env.app.SignUp(ctx, r)
+			checkErr(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestApplication_CreateInviteCodes(t *testing.T) {
+	// Expiry itself is covered by TestApplication_InviteCodeExpires.
+	past, future := time.Now().Add(-time.Minute), time.Now().Add(time.Hour)
+	tests := []struct {
+		name      string
+		count     int
+		expiresAt *time.Time
+		wantCodes int
+		wantErr   error
+	}{
+		{name: "default count", wantCodes: 1},
+		{name: "batch", count: 100, expiresAt: &future, wantCodes: 100},
+		{name: "batch too large", count: 101, wantErr: domain.ErrBatchTooLarge},
+		{name: "expired", count: 1, expiresAt: &past, wantErr: domain.ErrInvalidExpiry},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			adminID, _ := env.signUpAdmin(t)
+			codes, err := env.app.CreateInviteCodes(context.Background(), adminID, tt.count, 1, tt.expiresAt)
+			checkErr(t, err, tt.wantErr)
+			if len(codes) != tt.wantCodes {
+				t.Errorf("got %d codes, want %d", len(codes), tt.wantCodes)
+			}
+			want := domain.AuditAdminCreateInviteCodes + ":" + domain.AuditOutcomeSuccess
+			if tt.wantErr != nil {
+				want = domain.AuditAdminCreateInviteCodes + ":" + domain.AuditOutcomeFailure
+			}
+			if actions := env.auditActions(t, adminID); actions[0] != want {
+				t.Errorf("latest audit action = %s, want %s", actions[0], want)
+			}
+		})
+	}
+}
+
+func TestApplication_InviteCodeExpires(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	adminID, _ := env.signUpAdmin(t)
+	env.withRegistrationMode(domain.RegistrationInviteOnly)
+	expiresAt := time.Now().Add(50 * time.Millisecond)
+	codes, err := env.app.CreateInviteCodes(ctx, adminID, 1, 10, &expiresAt)
+	checkErr(t, err, nil)
+	time.Sleep(time.Until(expiresAt))
+
+	r := registration("user@example.com", testPassword)
+	r.InviteCode = codes[0].Code
+	_, err = env.app.SignUp(ctx, r)
+	checkErr(t, err, domain.ErrInvalidInviteCode)
+}
+
+func TestApplication_Waitlist(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	adminID, _ := env.signUpAdmin(t)
+	checkErr(t, env.app.JoinWaitlist(ctx, "first@example.com"), domain.ErrWaitlistClosed)
+
+	env.withRegistrationMode(domain.RegistrationWaitlist)
+	checkErr(t, env.app.JoinWaitlist(ctx, "first@example.com"), nil)
+	checkErr(t, env.app.JoinWaitlist(ctx, "second@gmail.com"), nil)
+	checkErr(t, env.app.JoinWaitlist(ctx, "Sec.ond+dating@gmail.com"), nil)
+	checkErrAny(t, env.app.JoinWaitlist(ctx, "not-an-email"), errAny)
+	// Registered emails get the same response, but are not put on the waitlist.
+	checkErr(t, env.app.JoinWaitlist(ctx, "admin@example.com"), nil)
+	if _, err := env.repo.GetWaitlistEntry(ctx, "admin@example.com"); !errors.Is(err, domain.ErrWaitlistEntryNotFound) {
+		t.Errorf("GetWaitlistEntry(admin) = %v, want ErrWaitlistEntryNotFound", err)
+	}
+	_, err := env.app.SignUp(ctx, registration("first@example.com", testPassword))
+	checkErr(t, err, domain.ErrInviteRequired)
+
+	// The oldest entry is admitted first.
+	admitted, err := env.app.AdmitWaitlist(ctx, adminID, 1)
+	checkErr(t, err, nil)
+	if len(admitted) != 1 || admitted[0].Email != "first@example.com" || admitted[0].AdmittedAt == nil {
+		t.Fatalf("admitted %+v, want the first entry", admitted)
+	}
+	code := env.admittedCodes(t)["first@example.com"]
+	r := registration("first@example.com", testPassword)
+	r.InviteCode = code
+	_, err = env.app.SignUp(ctx, r)
+	checkErr(t, err, nil)
+	r = registration("second@gmail.com", testPassword)
+	r.InviteCode = code
+	_, err = env.app.SignUp(ctx, r)
+	checkErr(t, err, domain.ErrInvalidInviteCode)
+
+	admitted, err = env.app.AdmitWaitlist(ctx, adminID, 10)
+	checkErr(t, err, nil)
+	if len(admitted) != 1 || admitted[0].Email != "second@gmail.com" {
+		t.Fatalf("admitted %+v, want only the second entry", admitted)
+	}
+	r.InviteCode = env.admittedCodes(t)["second@gmail.com"]
+	token, err := env.app.SignUp(ctx, r)
+	checkErr(t, err, nil)
+	env.secretsInOutbox(t, code, r.InviteCode)
+
+	// The entry is part of the data of the account.
+	export, err := env.app.ExportMyData(ctx, token.AccessToken)
+	checkErr(t, err, nil)
+	if export.Waitlist == nil || export.Waitlist.Email != "second@gmail.com" || export.Waitlist.AdmittedAt == nil {
+		t.Errorf("exported waitlist entry %+v, want the admitted second entry", export.Waitlist)
+	}
+}
+
+func TestApplication_JoinWaitlistRateLimit(t *testing.T) {
+	env := newTestEnv(t)
+	env.signUp(t, "member@example.com")
+	cfg := env.cfg
+	cfg.RegistrationMode = string(domain.RegistrationWaitlist)
+	cfg.WaitlistRateLimit = 2
+	env.reconfigure(cfg)
+	client := app.WithClientInfo(context.Background(), domain.ClientInfo{IP: "203.0.113.7"})
+	other := app.WithClientInfo(context.Background(), domain.ClientInfo{IP: "203.0.113.8"})
+
+	// Registered emails count like any other, so they can't be probed either.
+	checkErr(t, env.app.JoinWaitlist(client, "first@example.com"), nil)
+	checkErr(t, env.app.JoinWaitlist(client, "member@example.com"), nil)
+	checkErr(t, env.app.JoinWaitlist(client, "third@example.com"), domain.ErrRateLimited)
+	checkErr(t, env.app.JoinWaitlist(other, "third@example.com"), nil)
+
+	if deleted, err := env.app.PurgeRateLimits(context.Background()); err != nil || deleted != 0 {
+		t.Errorf("PurgeRateLimits() = %d, %v, want the current window kept", deleted, err)
+	}
+}
@@ -0,0 +1,171 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/google/uuid"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+	"github.com/soulmate-dating/auth/internal/hash"
+)
+
+const (
+	defaultLoginHistoryLimit = 50
+	maxLoginHistoryLimit     = 200
+	// alertQueueSize bounds the alerts waiting for the notifier.
+	alertQueueSize = 256
+)
+
+type LoginHistoryRepository interface {
+	AddLogin(ctx context.Context, l *domain.Login) error
+	// GetLoginOrigins compares the device and country of a login with the
+	// earlier logins of the user.
+	GetLoginOrigins(ctx context.Context, userID uuid.UUID, fingerprint, country string) (domain.LoginOrigins, error)
+	// ListLogins returns the logins of the user, newest first.
+	ListLogins(ctx context.Context, filter domain.LoginFilter) ([]domain.Login, error)
+}
+
+// GeoLocator resolves the coarse location of an IP address.
+type GeoLocator interface {
+	Locate(ip string) (domain.GeoLocation, error)
+}
+
+// Notifier alerts users of activity on their account they may not expect, and
+// delivers the codes and tokens that must not go through the outbox.
+type Notifier interface {
+	NotifyNewDeviceLogin(ctx context.Context, e domain.NewDeviceLogin) error
+	SendSecret(ctx context.Context, m domain.SecretMessage) error
+}
+
+type noopLocator struct{}
+
+func (noopLocator) Locate(string) (domain.GeoLocation, error) { return domain.GeoLocation{}, nil }
+
+type noopNotifier struct{}
+
+func (noopNotifier) NotifyNewDeviceLogin(context.Context, domain.NewDeviceLogin) error { return nil }
+func (noopNotifier) SendSecret(context.Context, domain.SecretMessage) error            { return nil }
+
+// recordLogin adds the session to the login history of the user, flagging it
+// if it comes from a device or country not seen in their earlier logins.
+func (a *Application) recordLogin(ctx context.Context, session *domain.Session) (*domain.Login, error) {
+	client := ClientInfoFromContext(ctx)
+	login := &domain.Login{
+		ID:                domain.NewUUID(),
+		UserID:            session.UserID,
+		SessionID:         session.ID,
+		DeviceFingerprint: deviceFingerprint(client),
+		IP:                session.IP,
+		UserAgent:         session.UserAgent,
+		CreatedAt:         session.CreatedAt,
+	}
+	// An unknown location must not lock users out, it only weakens the check.
+	location, err := a.geo.Locate(client.IP)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to locate login", slog.Any("error", err))
+	}
+	login.Country, login.City = location.Country, location.City
+
+	origins, err := a.logins.GetLoginOrigins(ctx, login.UserID, login.DeviceFingerprint, login.Country)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check login origins: %w", err)
+	}
+	login.NewDevice = origins.Unfamiliar(login.Country)
+	if err := a.logins.AddLogin(ctx, login); err != nil {
+		return nil, fmt.Errorf("failed to record login: %w", err)
+	}
+	return login, nil
+}
+
+// deviceFingerprint identifies the device by the ID the app sent, falling
+// back to the user agent for clients that send none.
+func deviceFingerprint(client domain.ClientInfo) string {
+	if client.DeviceID != "" {
+		return hash.HashToken("device:" + client.DeviceID)
+	}
+	return hash.HashToken("user-agent:" + client.UserAgent)
+}
+
+// notifyNewDeviceLogin queues the alert once the login is committed, so that
+// a slow notifier doesn't hold up logins. The NewDeviceLogin event is the
+// durable record, so alerts that don't fit in the queue are only logged.
+func (a *Application) notifyNewDeviceLogin(ctx context.Context, alert domain.NewDeviceLogin) {
+	select {
+	case a.alerts <- alert:
+	default:
+		slog.ErrorContext(ctx, "new device login alert dropped, queue is full")
+	}
+}
+
+// alertJob sends the queued alerts until ctx is done. Failures are only
+// logged, as in notifyNewDeviceLogin.
+func (a *Application) alertJob(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case alert := <-a.alerts:
+			if err := a.notifier.NotifyNewDeviceLogin(ctx, alert); err != nil {
+				slog.ErrorContext(ctx, "new device login alert lost",
+					slog.String("user_id", alert.UserID.String()), slog.Any("error", err))
+			}
+		}
+	}
+}
+
+func newDeviceLogin(user *domain.User, login *domain.Login) domain.NewDeviceLogin {
+	return domain.NewDeviceLogin{
+		UserID:    user.ID,
+		Email:     user.Email,
+		IP:        login.IP,
+		UserAgent: login.UserAgent,
+		Country:   login.Country,
+		City:      login.City,
+		At:        login.CreatedAt,
+	}
+}
+
+// ListLoginHistory returns a page of the logins of the token owner, newest first.
+func (a *Application) ListLoginHistory(ctx context.Context, token string, filter domain.LoginFilter) (*domain.LoginPage, error) {
+	claims, err := a.authenticate(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	filter.UserID = claims.UserID
+	if filter.Limit <= 0 {
+		filter.Limit = defaultLoginHistoryLimit
+	}
+	filter.Limit = min(filter.Limit, maxLoginHistoryLimit)
+	limit := filter.Limit
+	filter.Limit++
+
+	logins, err := a.logins.ListLogins(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list logins: %w", err)
+	}
+	page := &domain.LoginPage{Logins: logins}
+	if len(logins) > limit {
+		page.Logins = logins[:limit]
+		page.NextBefore = page.Logins[limit-1].Seq
+	}
+	return page, nil
+}
+
+// listAllLogins returns the whole login history of the user, newest first.
+func (a *Application) listAllLogins(ctx context.Context, userID uuid.UUID) ([]domain.Login, error) {
+	var logins []domain.Login
+	filter := domain.LoginFilter{UserID: userID, Limit: maxLoginHistoryLimit}
+	for {
+		page, err := a.logins.ListLogins(ctx, filter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list logins: %w", err)
+		}
+		logins = append(logins, page...)
+		if len(page) < filter.Limit {
+			return logins, nil
+		}
+		filter.BeforeSeq = page[len(page)-1].Seq
+	}
+}
@@ -0,0 +1,201 @@
+package app_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/soulmate-dating/auth/internal/adapters/events"
+	"github.com/soulmate-dating/auth/internal/app"
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+var (
+	phone  = domain.ClientInfo{IP: "198.51.100.1", UserAgent: "Glimpse/2.1 (iPhone)", DeviceID: "phone"}
+	tablet = domain.ClientInfo{IP: "198.51.100.1", UserAgent: "Glimpse/2.1 (iPad)", DeviceID: "tablet"}
+	// abroad is the phone on a network of another country.
+	abroad = domain.ClientInfo{IP: "192.0.2.1", UserAgent: phone.UserAgent, DeviceID: "phone"}
+	// unlocated is the phone on a network missing from the geo database.
+	unlocated = domain.ClientInfo{IP: "203.0.113.9", UserAgent: phone.UserAgent, DeviceID: "phone"}
+)
+
+func TestApplication_LoginAlertsOfNewDevices(t *testing.T) {
+	tests := []struct {
+		name      string
+		logins    []domain.ClientInfo
+		wantAlert bool
+	}{
+		{name: "known device", logins: []domain.ClientInfo{phone}},
+		{name: "new device", logins: []domain.ClientInfo{tablet}, wantAlert: true},
+		{name: "new country", logins: []domain.ClientInfo{abroad}, wantAlert: true},
+		{name: "unknown country", logins: []domain.ClientInfo{unlocated}},
+		{name: "device seen in an earlier login", logins: []domain.ClientInfo{tablet, tablet}, wantAlert: true},
+		{name: "user agent without device id", logins: []domain.ClientInfo{{IP: phone.IP, UserAgent: "curl/8.4"}}, wantAlert: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			env.geo[phone.IP] = domain.GeoLocation{Country: "DE", City: "Berlin"}
+			env.geo[abroad.IP] = domain.GeoLocation{Country: "BR", City: "São Paulo"}
+			user := env.signUpFrom(t, phone)
+
+			for _, client := range tt.logins {
+				ctx := app.WithClientInfo(context.Background(), client)
+				if _, err := env.app.Login(ctx, domain.LoginCredentials{Email: "user@example.com", Password: testPassword}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			wantAlerts := 0
+			if tt.wantAlert {
+				wantAlerts = 1
+			}
+			alerts := env.alerts.waitSent(wantAlerts)
+			if len(alerts) != wantAlerts {
+				t.Fatalf("sent %d alerts, want %d", len(alerts), wantAlerts)
+			}
+			if got := env.newDeviceLoginEvents(t); len(got) != wantAlerts {
+				t.Fatalf("recorded %d new device login events, want %d", len(got), wantAlerts)
+			}
+			if tt.wantAlert {
+				login := tt.logins[0]
+				want := env.geo[login.IP]
+				if a := alerts[0]; a.UserID != user.Id || a.Email != "user@example.com" || a.IP != login.IP ||
+					a.UserAgent != login.UserAgent || a.Country != want.Country || a.City != want.City {
+					t.Errorf("alert = %+v, want one for %+v in %+v", a, login, want)
+				}
+			}
+		})
+	}
+}
+
+// blockingNotifier holds every alert until release is closed.
+type blockingNotifier struct {
+	release chan struct{}
+}
+
+func (n blockingNotifier) NotifyNewDeviceLogin(ctx context.Context, _ domain.NewDeviceLogin) error {
+	select {
+	case <-n.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (blockingNotifier) SendSecret(context.Context, domain.SecretMessage) error { return nil }
+
+func TestApplication_LoginDoesNotWaitForAlerts(t *testing.T) {
+	env := newTestEnv(t)
+	env.signUpFrom(t, phone)
+	notifier := blockingNotifier{release: make(chan struct{})}
+	defer close(notifier.release)
+	a := app.NewWithDependencies(app.Dependencies{
+		Repository: env.repo,
+		Sessions:   env.repo,
+		Clients:    env.repo,
+		Outbox:     env.repo,
+		AuditLog:   env.repo,
+		Logins:     env.repo,
+		TxManager:  env.repo,
+		JWT:        env.jwt,
+		Geo:        env.geo,
+		Notifier:   notifier,
+	}, env.cfg)
+	for _, job := range a.Jobs() {
+		go func(job func(context.Context) error) { _ = job(env.jobs) }(job)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		ctx := app.WithClientInfo(context.Background(), tablet)
+		_, err := a.Login(ctx, domain.LoginCredentials{Email: "user@example.com", Password: testPassword})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		checkErr(t, err, nil)
+	case <-time.After(time.Second):
+		t.Fatal("login waited for the new device alert")
+	}
+	if got := env.newDeviceLoginEvents(t); len(got) != 1 {
+		t.Errorf("recorded %d new device login events, want 1", len(got))
+	}
+}
+
+func TestApplication_ListLoginHistory(t *testing.T) {
+	env := newTestEnv(t)
+	env.geo[phone.IP] = domain.GeoLocation{Country: "DE", City: "Berlin"}
+	user := env.signUpFrom(t, phone)
+	var token *domain.Token
+	for _, client := range []domain.ClientInfo{tablet, phone, abroad} {
+		var err error
+		ctx := app.WithClientInfo(context.Background(), client)
+		token, err = env.app.Login(ctx, domain.LoginCredentials{Email: "user@example.com", Password: testPassword})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var logins []domain.Login
+	filter := domain.LoginFilter{Limit: 3}
+	for {
+		page, err := env.app.ListLoginHistory(context.Background(), token.AccessToken, filter)
+		checkErr(t, err, nil)
+		logins = append(logins, page.Logins...)
+		if page.NextBefore == 0 {
+			break
+		}
+		filter.BeforeSeq = page.NextBefore
+	}
+
+	// The sign-up is the oldest login and sets the baseline.
+	want := []struct {
+		client    domain.ClientInfo
+		newDevice bool
+	}{{abroad, false}, {phone, false}, {tablet, true}, {phone, false}}
+	if len(logins) != len(want) {
+		t.Fatalf("got %d logins, want %d", len(logins), len(want))
+	}
+	for i, w := range want {
+		l := logins[i]
+		if l.UserID != user.Id || l.IP != w.client.IP || l.UserAgent != w.client.UserAgent || l.NewDevice != w.newDevice {
+			t.Errorf("login %d = %+v, want one from %+v with new device %t", i, l, w.client, w.newDevice)
+		}
+	}
+	if logins[3].Country != "DE" || logins[3].City != "Berlin" {
+		t.Errorf("sign-up located in %q, %q, want DE, Berlin", logins[3].Country, logins[3].City)
+	}
+
+	_, err := env.app.ListLoginHistory(context.Background(), "not-a-token", domain.LoginFilter{})
+	checkErrAny(t, err, errAny)
+}
+
+// signUpFrom signs up user@example.com from the client.
+func (e *testEnv) signUpFrom(t *testing.T, client domain.ClientInfo) *domain.Token {
+	t.Helper()
+	ctx := app.WithClientInfo(context.Background(), client)
+	token, err := e.app.SignUp(ctx, registration("user@example.com", testPassword))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func (e *testEnv) newDeviceLoginEvents(t *testing.T) []*events.NewDeviceLogin {
+	t.Helper()
+	var logins []*events.NewDeviceLogin
+	for _, m := range e.repo.OutboxMessages() {
+		if m.EventType != domain.EventNewDeviceLogin {
+			continue
+		}
+		var envelope events.Envelope
+		if err := proto.Unmarshal(m.Payload, &envelope); err != nil {
+			t.Fatal(err)
+		}
+		logins = append(logins, envelope.GetNewDeviceLogin())
+	}
+	return logins
+}
@@ -0,0 +1,61 @@
+package app
+
+import (
+	"errors"
+	"time"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+	"github.com/soulmate-dating/auth/internal/hash"
+)
+
+const (
+	LoginFailureWrongPassword = "wrong_password"
+	LoginFailureUnknownUser   = "unknown_user"
+	LoginFailureLocked        = "locked"
+
+	TokenFailureExpired      = "expired"
+	TokenFailureBadSignature = "bad_signature"
+	TokenFailureRevoked      = "revoked"
+	TokenFailureMalformed    = "malformed"
+)
+
+// Metrics records business-level events of the auth flows.
+type Metrics interface {
+	SignUp()
+	LoginSucceeded()
+	LoginFailed(reason string)
+	RefreshReuseDetected()
+	TokenValidationFailed(reason string)
+	ObservePasswordHashing(d time.Duration)
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) SignUp()                              {}
+func (noopMetrics) LoginSucceeded()                      {}
+func (noopMetrics) LoginFailed(string)                   {}
+func (noopMetrics) RefreshReuseDetected()                {}
+func (noopMetrics) TokenValidationFailed(string)         {}
+func (noopMetrics) ObservePasswordHashing(time.Duration) {}
+
+func tokenFailureReason(err error) string {
+	switch {
+	case errors.Is(err, domain.ErrExpiredToken):
+		return TokenFailureExpired
+	case errors.Is(err, domain.ErrInvalidSignature):
+		return TokenFailureBadSignature
+	}
+	return TokenFailureMalformed
+}
+
+func (a *Application) hashPassword(password string) string {
+	start := time.Now()
+	defer func() { a.metrics.ObservePasswordHashing(time.Since(start)) }()
+	return hash.HashPassword(password)
+}
+
+func (a *Application) checkPassword(password, hashed string) bool {
+	start := time.Now()
+	defer func() { a.metrics.ObservePasswordHashing(time.Since(start)) }()
+	return hash.CheckPasswordHash(password, hashed)
+}
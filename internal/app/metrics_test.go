@@ -0,0 +1,75 @@
+package app_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/soulmate-dating/auth/internal/adapters/metrics"
+	"github.com/soulmate-dating/auth/internal/app"
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+func TestApplication_PrometheusMetrics(t *testing.T) {
+	env := newTestEnv(t)
+	reg := prometheus.NewRegistry()
+	env.app = app.NewWithDependencies(app.Dependencies{
+		Repository: env.repo,
+		Sessions:   env.repo,
+		Clients:    env.repo,
+		Outbox:     env.repo,
+		AuditLog:   env.repo,
+		Logins:     env.repo,
+		TxManager:  env.repo,
+		JWT:        env.jwt,
+		Metrics:    metrics.NewPrometheus(reg),
+		Geo:        env.geo,
+		Notifier:   env.alerts,
+	}, env.cfg)
+	ctx := context.Background()
+
+	token := env.signUp(t, "user@example.com")
+	if _, err := env.app.Login(ctx, domain.LoginCredentials{Email: "user@example.com", Password: testPassword}); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = env.app.Login(ctx, domain.LoginCredentials{Email: "user@example.com", Password: "wrong-password"})
+	_, _ = env.app.Login(ctx, domain.LoginCredentials{Email: "nobody@example.com", Password: testPassword})
+	if _, err := env.app.Refresh(ctx, token.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = env.app.Refresh(ctx, token.RefreshToken)
+	// The reuse revoked the session the first access token belongs to.
+	_, _ = env.app.Validate(ctx, token.AccessToken, "")
+
+	want := `
+# HELP auth_signups_total Number of successful sign-ups.
+# TYPE auth_signups_total counter
+auth_signups_total 1
+# HELP auth_login_successes_total Number of successful logins.
+# TYPE auth_login_successes_total counter
+auth_login_successes_total 1
+# HELP auth_login_failures_total Number of failed logins by reason.
+# TYPE auth_login_failures_total counter
+auth_login_failures_total{reason="unknown_user"} 1
+auth_login_failures_total{reason="wrong_password"} 1
+# HELP auth_refresh_reuse_detections_total Number of refresh tokens presented after they had already been rotated.
+# TYPE auth_refresh_reuse_detections_total counter
+auth_refresh_reuse_detections_total 1
+# HELP auth_token_validation_failures_total Number of rejected tokens by reason.
+# TYPE auth_token_validation_failures_total counter
+auth_token_validation_failures_total{reason="revoked"} 1
+`
+	names := []string{
+		"auth_signups_total",
+		"auth_login_successes_total",
+		"auth_login_failures_total",
+		"auth_refresh_reuse_detections_total",
+		"auth_token_validation_failures_total",
+	}
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want), names...); err != nil {
+		t.Error(err)
+	}
+}
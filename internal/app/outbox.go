@@ -0,0 +1,141 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/soulmate-dating/auth/internal/adapters/events"
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+type OutboxRepository interface {
+	AddOutboxMessage(ctx context.Context, m *domain.OutboxMessage) error
+	// ClaimOutboxMessages returns up to limit due messages, oldest first, and
+	// postpones them until claimedUntil so that no other relay picks them up
+	// meanwhile. Only the oldest unpublished message of an aggregate is due.
+	ClaimOutboxMessages(ctx context.Context, limit int, claimedUntil time.Time) ([]domain.OutboxMessage, error)
+	MarkOutboxMessagePublished(ctx context.Context, id uuid.UUID) error
+	MarkOutboxMessageFailed(ctx context.Context, id uuid.UUID, reason string, nextAttemptAt time.Time) error
+}
+
+type Publisher interface {
+	Publish(ctx context.Context, m domain.OutboxMessage) error
+}
+
+// recordEvent stores the event in the outbox. It must be called inside RunInTx
+// so that the event is committed together with the domain change.
+func (a *Application) recordEvent(ctx context.Context, event domain.Event) error {
+	msg := &domain.OutboxMessage{
+		ID:          domain.NewUUID(),
+		AggregateID: event.AggregateID(),
+		EventType:   event.EventType(),
+		CreatedAt:   time.Now().UTC(),
+	}
+	payload, err := events.Marshal(msg.ID, msg.CreatedAt, event)
+	if err != nil {
+		return fmt.Errorf("encode %s event: %w", msg.EventType, err)
+	}
+	msg.Payload = payload
+	if err := a.outbox.AddOutboxMessage(ctx, msg); err != nil {
+		return fmt.Errorf("record %s event: %w", msg.EventType, err)
+	}
+	return nil
+}
+
+type RelayConfig struct {
+	PollInterval time.Duration
+	BatchSize    int
+	RetryBackoff time.Duration
+	MaxBackoff   time.Duration
+	ClaimTimeout time.Duration
+}
+
+// Relay moves messages from the outbox to the publisher. A message is marked as
+// published only after the publisher acknowledged it, so delivery is at least once.
+// Messages are claimed in a short transaction and published outside of it, so
+// no rows stay locked while the broker is slow; a claim expires after
+// ClaimTimeout if the relay dies before reporting the outcome. Several service
+// replicas can relay concurrently. The messages of an aggregate are published
+// in order: a later one is not claimed before the earlier ones were published,
+// so a failure holds back the rest of its aggregate until the retry succeeds.
+type Relay struct {
+	outbox    OutboxRepository
+	txManager TransactionManager
+	publisher Publisher
+	cfg       RelayConfig
+}
+
+func NewRelay(outbox OutboxRepository, txManager TransactionManager, publisher Publisher, cfg RelayConfig) *Relay {
+	return &Relay{outbox: outbox, txManager: txManager, publisher: publisher, cfg: cfg}
+}
+
+func (r *Relay) Run(ctx context.Context) error {
+	slog.Info("starting outbox relay", slog.Duration("poll_interval", r.cfg.PollInterval))
+	defer slog.Info("stop outbox relay")
+
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		for {
+			n, err := r.RelayBatch(ctx)
+			if err != nil {
+				slog.Error("failed to relay outbox messages", slog.Any("error", err))
+			}
+			if err != nil || n == 0 {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayBatch publishes up to BatchSize pending messages and returns how many were handled.
+func (r *Relay) RelayBatch(ctx context.Context) (int, error) {
+	var messages []domain.OutboxMessage
+	err := r.txManager.RunInTx(ctx, func(ctx context.Context) error {
+		var err error
+		messages, err = r.outbox.ClaimOutboxMessages(ctx, r.cfg.BatchSize, time.Now().Add(r.cfg.ClaimTimeout))
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	for i, m := range messages {
+		if err := r.relay(ctx, m); err != nil {
+			return i, err
+		}
+	}
+	return len(messages), nil
+}
+
+func (r *Relay) relay(ctx context.Context, m domain.OutboxMessage) error {
+	if err := r.publisher.Publish(ctx, m); err != nil {
+		slog.Warn("failed to publish outbox message",
+			slog.String("message_id", m.ID.String()),
+			slog.String("event_type", m.EventType),
+			slog.Int("attempts", m.Attempts+1),
+			slog.Any("error", err),
+		)
+		return r.outbox.MarkOutboxMessageFailed(ctx, m.ID, err.Error(), time.Now().Add(r.backoff(m.Attempts)))
+	}
+	return r.outbox.MarkOutboxMessagePublished(ctx, m.ID)
+}
+
+func (r *Relay) backoff(attempts int) time.Duration {
+	d := r.cfg.RetryBackoff
+	for i := 0; i < attempts && d < r.cfg.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > r.cfg.MaxBackoff {
+		return r.cfg.MaxBackoff
+	}
+	return d
+}
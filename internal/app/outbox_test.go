@@ -0,0 +1,107 @@
+package app_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/soulmate-dating/auth/internal/adapters/publisher"
+	"github.com/soulmate-dating/auth/internal/app"
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+func TestRelay_RelayBatch(t *testing.T) {
+	tests := []struct {
+		name          string
+		publishErr    error
+		wantPublished int
+		wantPending   int
+	}{
+		{"published", nil, 2, 0},
+		{"publisher down", errors.New("broker unavailable"), 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			ctx := context.Background()
+			env.signUp(t, "anna@example.com")
+			env.signUp(t, "bob@example.com")
+			pub := publisher.NewMemory()
+			pub.FailWith(tt.publishErr)
+			relay := app.NewRelay(env.repo, env.repo, pub, app.RelayConfig{
+				PollInterval: time.Second,
+				BatchSize:    10,
+				RetryBackoff: time.Hour,
+				MaxBackoff:   time.Hour,
+				ClaimTimeout: time.Minute,
+			})
+
+			handled, err := relay.RelayBatch(ctx)
+			checkErr(t, err, nil)
+			if handled != 2 {
+				t.Errorf("handled %d messages, want 2", handled)
+			}
+			if got := len(pub.Messages()); got != tt.wantPublished {
+				t.Errorf("published %d messages, want %d", got, tt.wantPublished)
+			}
+			// Published messages are done and failed ones wait for their backoff.
+			pending, err := env.repo.ClaimOutboxMessages(ctx, 10, time.Now())
+			checkErr(t, err, nil)
+			if len(pending) != tt.wantPending {
+				t.Errorf("%d messages pending, want %d", len(pending), tt.wantPending)
+			}
+			for _, m := range pub.Messages() {
+				if m.EventType != domain.EventUserCreated {
+					t.Errorf("published %s", m.EventType)
+				}
+			}
+		})
+	}
+}
+
+func TestRelay_KeepsOrderOfAggregate(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+	token := env.signUp(t, "anna@example.com")
+	if _, err := env.app.RequestEmailChange(ctx, token.AccessToken, testPassword, "new@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	pub := publisher.NewMemory()
+	relay := app.NewRelay(env.repo, env.repo, pub, app.RelayConfig{
+		PollInterval: time.Second,
+		BatchSize:    10,
+		RetryBackoff: time.Millisecond,
+		MaxBackoff:   time.Millisecond,
+		ClaimTimeout: time.Minute,
+	})
+
+	// The failed message holds back the later one of the same user.
+	pub.FailWith(errors.New("broker unavailable"))
+	handled, err := relay.RelayBatch(ctx)
+	checkErr(t, err, nil)
+	if handled != 1 {
+		t.Errorf("handled %d messages, want only the first one", handled)
+	}
+	pub.FailWith(nil)
+	handled, err = relay.RelayBatch(ctx)
+	checkErr(t, err, nil)
+	if handled != 0 {
+		t.Errorf("handled %d messages while the first one backs off", handled)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		_, err = relay.RelayBatch(ctx)
+		checkErr(t, err, nil)
+	}
+	var published []string
+	for _, m := range pub.Messages() {
+		published = append(published, m.EventType)
+	}
+	want := []string{domain.EventUserCreated, domain.EventEmailChangeRequested}
+	if !slices.Equal(published, want) {
+		t.Errorf("published %v, want %v", published, want)
+	}
+}
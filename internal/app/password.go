@@ -0,0 +1,86 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+	"github.com/soulmate-dating/auth/internal/hash"
+)
+
+const passwordTag = "required,min=8"
+
+// ResetPassword sets a new password using a one-time reset token and ends all
+// existing sessions of the user.
+func (a *Application) ResetPassword(ctx context.Context, resetToken, password string) (string, error) {
+	err := a.validate.Var(password, passwordTag)
+	if err != nil {
+		return "", fmt.Errorf("invalid password: %w", err)
+	}
+	hashed := a.hashPassword(password)
+
+	var reset *domain.PasswordReset
+	err = a.txManager.RunInTx(ctx, func(ctx context.Context) (err error) {
+		now := time.Now().UTC()
+		reset, err = a.repository.GetPasswordReset(ctx, hash.HashToken(resetToken))
+		if err != nil {
+			return err
+		}
+		if reset.UsedAt != nil || !now.Before(reset.ExpiresAt) {
+			return domain.ErrInvalidResetToken
+		}
+		if err := a.repository.UpdatePassword(ctx, reset.UserID, hashed); err != nil {
+			return err
+		}
+		if err := a.repository.UsePasswordReset(ctx, reset.TokenHash, now); err != nil {
+			return err
+		}
+		if err := a.sessions.RevokeUserSessions(ctx, reset.UserID); err != nil {
+			return err
+		}
+		return a.audit(ctx, domain.AuditEvent{
+			ActorID:   &reset.UserID,
+			SubjectID: &reset.UserID,
+			Action:    domain.AuditPasswordReset,
+			Outcome:   domain.AuditOutcomeSuccess,
+		})
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to reset password: %w", err)
+	}
+	return reset.UserID.String(), nil
+}
+
+// newPasswordReset issues a reset token for the user, which is valid once
+// stored with CreatePasswordReset.
+func (a *Application) newPasswordReset(userID uuid.UUID) (*domain.PasswordReset, error) {
+	token, err := newResetToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	return &domain.PasswordReset{
+		TokenHash: hash.HashToken(token),
+		UserID:    userID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(a.passwordResetTTL),
+		Token:     token,
+	}, nil
+}
+
+// checkUserAccess rejects users who may not hold sessions.
+func checkUserAccess(user *domain.User) error {
+	if user.DisabledAt != nil {
+		return domain.ErrUserDisabled
+	}
+	if err := user.CheckStatus(time.Now()); err != nil {
+		return err
+	}
+	if user.PasswordResetRequired {
+		return domain.ErrPasswordResetNeeded
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package app_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+	"github.com/soulmate-dating/auth/internal/hash"
+)
+
+func TestApplication_ResetPassword(t *testing.T) {
+	const newPassword = "a-brand-new-password"
+	tests := []struct {
+		name     string
+		token    func(t *testing.T, env *testEnv, reset *domain.PasswordReset) string
+		password string
+		wantErr  error
+	}{
+		{
+			name:     "valid",
+			token:    func(_ *testing.T, _ *testEnv, reset *domain.PasswordReset) string { return reset.Token },
+			password: newPassword,
+		},
+		{
+			name:     "unknown token",
+			token:    func(_ *testing.T, _ *testEnv, _ *domain.PasswordReset) string { return "unknown" },
+			password: newPassword,
+			wantErr:  domain.ErrInvalidResetToken,
+		},
+		{
+			name: "used token",
+			token: func(t *testing.T, env *testEnv, reset *domain.PasswordReset) string {
+				if _, err := env.app.ResetPassword(context.Background(), reset.Token, newPassword); err != nil {
+					t.Fatal(err)
+				}
+				return reset.Token
+			},
+			password: newPassword,
+			wantErr:  domain.ErrInvalidResetToken,
+		},
+		{
+			name: "expired token",
+			token: func(t *testing.T, env *testEnv, reset *domain.PasswordReset) string {
+				expired := &domain.PasswordReset{
+					TokenHash: hash.HashToken("expired"),
+					UserID:    reset.UserID,
+					CreatedAt: time.Now().Add(-2 * time.Hour),
+					ExpiresAt: time.Now().Add(-time.Hour),
+				}
+				if err := env.repo.CreatePasswordReset(context.Background(), expired); err != nil {
+					t.Fatal(err)
+				}
+				return "expired"
+			},
+			password: newPassword,
+			wantErr:  domain.ErrInvalidResetToken,
+		},
+		{
+			name:     "short password",
+			token:    func(_ *testing.T, _ *testEnv, reset *domain.PasswordReset) string { return reset.Token },
+			password: "short",
+			wantErr:  errAny,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			ctx := context.Background()
+			adminID, _ := env.signUpAdmin(t)
+			token := env.signUp(t, "user@example.com")
+			if _, err := env.app.ForcePasswordReset(ctx, adminID, token.Id, "compromised"); err != nil {
+				t.Fatal(err)
+			}
+			reset := &domain.PasswordReset{
+				UserID: token.Id,
+				Token:  env.alerts.lastSecret(t, domain.SecretPasswordReset, "user@example.com"),
+			}
+
+			id, err := env.app.ResetPassword(ctx, tt.token(t, env, reset), tt.password)
+			checkErrAny(t, err, tt.wantErr)
+			if tt.wantErr != nil {
+				return
+			}
+			if id != token.Id.String() {
+				t.Errorf("reset password of %s, want %s", id, token.Id)
+			}
+			if _, err := env.app.Login(ctx, domain.LoginCredentials{Email: "user@example.com", Password: newPassword}); err != nil {
+				t.Errorf("login with the new password: %v", err)
+			}
+			if _, err := env.app.Login(ctx, domain.LoginCredentials{Email: "user@example.com", Password: testPassword}); !errors.Is(err, domain.ErrWrongPassword) {
+				t.Errorf("login with the old password: %v", err)
+			}
+			userID, _ := uuid.Parse(id)
+			if actions := env.auditActions(t, userID); !slices.Contains(actions, domain.AuditPasswordReset+":success") {
+				t.Errorf("audit = %v, want a successful password reset", actions)
+			}
+		})
+	}
+}
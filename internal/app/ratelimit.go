@@ -0,0 +1,58 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/soulmate-dating/auth/internal/config"
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+const (
+	rateLimitJoinWaitlist = "join_waitlist"
+	rateLimitCreateGuest  = "create_guest"
+)
+
+// rateLimits are the limits of the rate-limited actions per window. They are
+// replaced as a whole when the config is reloaded.
+type rateLimits struct {
+	window time.Duration
+	limits map[string]int
+}
+
+func newRateLimits(cfg config.Account) *rateLimits {
+	return &rateLimits{
+		window: cfg.RateLimitWindow,
+		limits: map[string]int{
+			rateLimitJoinWaitlist: cfg.WaitlistRateLimit,
+			rateLimitCreateGuest:  cfg.GuestRateLimit,
+		},
+	}
+}
+
+// checkRateLimit counts a request of action by the client IP and returns
+// ErrRateLimited once it made more than the limit of action in the current
+// window. Clients without a known IP share one count.
+func (a *Application) checkRateLimit(ctx context.Context, action string) error {
+	limits := a.rateLimits.Load()
+	key := action + ":" + ClientInfoFromContext(ctx).IP
+	windowStart := time.Now().UTC().Truncate(limits.window)
+	count, err := a.repository.CountRequest(ctx, key, windowStart)
+	if err != nil {
+		return fmt.Errorf("failed to count request: %w", err)
+	}
+	if count > limits.limits[action] {
+		return domain.ErrRateLimited
+	}
+	return nil
+}
+
+// PurgeRateLimits deletes the counts of windows that have ended.
+func (a *Application) PurgeRateLimits(ctx context.Context) (int64, error) {
+	deleted, err := a.repository.DeleteRateLimits(ctx, time.Now().UTC().Add(-a.rateLimits.Load().window))
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge rate limits: %w", err)
+	}
+	return deleted, nil
+}
@@ -0,0 +1,92 @@
+package app
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+	"github.com/soulmate-dating/auth/internal/hash"
+)
+
+type ServiceClientRepository interface {
+	GetServiceClient(ctx context.Context, id string) (*domain.ServiceClient, error)
+}
+
+// IssueServiceToken implements the OAuth2 client_credentials grant: a registered
+// service client exchanges its secret for a short-lived access token limited
+// to the requested subset of its scopes.
+func (a *Application) IssueServiceToken(ctx context.Context, credentials domain.ClientCredentials) (*domain.ServiceToken, error) {
+	if err := a.validate.Struct(credentials); err != nil {
+		return nil, fmt.Errorf("%w: %w", domain.ErrInvalidClient, err)
+	}
+	event := domain.AuditEvent{
+		Action:  domain.AuditIssueServiceToken,
+		Details: map[string]string{"client_id": credentials.ClientID},
+	}
+	client, err := a.activeServiceClient(ctx, credentials.ClientID)
+	if err == nil && !secretMatches(credentials.ClientSecret, client.SecretHash) {
+		err = domain.ErrInvalidClient
+	}
+	if err != nil {
+		a.auditFailure(ctx, event, err)
+		return nil, err
+	}
+	scopes, err := grantScopes(client, credentials.Scopes)
+	if err != nil {
+		a.auditFailure(ctx, event, err)
+		return nil, err
+	}
+	token, err := a.jwtWrapper.GenerateServiceToken(client, scopes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate service token: %w", err)
+	}
+	event.Outcome = domain.AuditOutcomeSuccess
+	event.Details["scope"] = strings.Join(scopes, " ")
+	a.auditBestEffort(ctx, event)
+	return &domain.ServiceToken{
+		AccessToken: token,
+		ExpiresIn:   a.jwtWrapper.Expirations().Service,
+		Scopes:      scopes,
+	}, nil
+}
+
+// activeServiceClient returns the client unless it is unknown or disabled,
+// both of which are reported as ErrInvalidClient.
+func (a *Application) activeServiceClient(ctx context.Context, id string) (*domain.ServiceClient, error) {
+	client, err := a.clients.GetServiceClient(ctx, id)
+	if err != nil {
+		if errors.Is(err, domain.ErrClientNotFound) {
+			return nil, fmt.Errorf("%w: %w", domain.ErrInvalidClient, err)
+		}
+		return nil, fmt.Errorf("failed to get service client: %w", err)
+	}
+	if client.DisabledAt != nil {
+		return nil, fmt.Errorf("%w: client is disabled", domain.ErrInvalidClient)
+	}
+	return client, nil
+}
+
+func secretMatches(secret, secretHash string) bool {
+	return subtle.ConstantTimeCompare([]byte(hash.HashToken(secret)), []byte(secretHash)) == 1
+}
+
+// grantScopes returns the requested scopes, or all scopes of the client if none
+// were requested. Requesting a scope the client is not registered for fails.
+func grantScopes(client *domain.ServiceClient, requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		return client.Scopes, nil
+	}
+	allowed := make(map[string]struct{}, len(client.Scopes))
+	for _, s := range client.Scopes {
+		allowed[s] = struct{}{}
+	}
+	for _, s := range requested {
+		if _, ok := allowed[s]; !ok {
+			return nil, fmt.Errorf("%w: %s", domain.ErrInvalidScope, s)
+		}
+	}
+	return requested, nil
+}
@@ -0,0 +1,82 @@
+package app_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+	"github.com/soulmate-dating/auth/internal/hash"
+)
+
+func TestApplication_IssueServiceToken(t *testing.T) {
+	tests := []struct {
+		name        string
+		credentials domain.ClientCredentials
+		wantErr     error
+		wantScopes  []string
+	}{
+		{
+			name:        "all scopes",
+			credentials: domain.ClientCredentials{ClientID: testClientID, ClientSecret: testClientSecret},
+			wantScopes:  []string{"profile:read", "matches:read"},
+		},
+		{
+			name:        "requested scope",
+			credentials: domain.ClientCredentials{ClientID: testClientID, ClientSecret: testClientSecret, Scopes: []string{"matches:read"}},
+			wantScopes:  []string{"matches:read"},
+		},
+		{
+			name:        "scope not granted",
+			credentials: domain.ClientCredentials{ClientID: testClientID, ClientSecret: testClientSecret, Scopes: []string{domain.ScopeAdmin}},
+			wantErr:     domain.ErrInvalidScope,
+		},
+		{
+			name:        "wrong secret",
+			credentials: domain.ClientCredentials{ClientID: testClientID, ClientSecret: "guess"},
+			wantErr:     domain.ErrInvalidClient,
+		},
+		{
+			name:        "missing secret",
+			credentials: domain.ClientCredentials{ClientID: testClientID},
+			wantErr:     domain.ErrInvalidClient,
+		},
+		{
+			name:        "unknown client",
+			credentials: domain.ClientCredentials{ClientID: "unknown", ClientSecret: testClientSecret},
+			wantErr:     domain.ErrInvalidClient,
+		},
+		{
+			name:        "disabled client",
+			credentials: domain.ClientCredentials{ClientID: "disabled", ClientSecret: testClientSecret},
+			wantErr:     domain.ErrInvalidClient,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			disabledAt := time.Now()
+			env.repo.AddServiceClient(domain.ServiceClient{
+				ID:         "disabled",
+				SecretHash: hash.HashToken(testClientSecret),
+				Scopes:     []string{"profile:read"},
+				DisabledAt: &disabledAt,
+			})
+
+			token, err := env.app.IssueServiceToken(context.Background(), tt.credentials)
+			checkErr(t, err, tt.wantErr)
+			if tt.wantErr != nil {
+				return
+			}
+			if !slices.Equal(token.Scopes, tt.wantScopes) || token.ExpiresIn != 15*time.Minute {
+				t.Errorf("token = %v for %s", token.Scopes, token.ExpiresIn)
+			}
+			claims, err := env.app.Validate(context.Background(), token.AccessToken, tt.wantScopes[0])
+			checkErr(t, err, nil)
+			if !claims.IsService() || claims.Subject != testClientID {
+				t.Errorf("claims = %+v", claims)
+			}
+		})
+	}
+}
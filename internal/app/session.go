@@ -0,0 +1,111 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/soulmate-dating/auth/internal/domain"
+	"github.com/soulmate-dating/auth/internal/hash"
+)
+
+// SessionRepository stores a session per login. Deleting an account must end
+// its access at once and the data export must list where the user logged in
+// from, which stateless tokens can't provide: every user token is bound to a
+// session that Validate checks, so revoked tokens are refused before they expire.
+type SessionRepository interface {
+	CreateSession(ctx context.Context, s *domain.Session) error
+	GetSession(ctx context.Context, id uuid.UUID) (*domain.Session, error)
+	ListUserSessions(ctx context.Context, userID uuid.UUID) ([]domain.Session, error)
+	RotateSession(ctx context.Context, id uuid.UUID, oldHash, newHash string, usedAt, expiresAt time.Time) error
+	RevokeSession(ctx context.Context, id uuid.UUID) error
+	RevokeUserSessions(ctx context.Context, userID uuid.UUID) error
+}
+
+// startSession creates a session for the user, issues the token pair bound to
+// it and records the login in the history of the user.
+func (a *Application) startSession(ctx context.Context, user *domain.User) (*domain.Token, *domain.Login, error) {
+	now := time.Now().UTC()
+	client := ClientInfoFromContext(ctx)
+	session := &domain.Session{
+		ID:         domain.NewUUID(),
+		UserID:     user.ID,
+		IP:         client.IP,
+		UserAgent:  client.UserAgent,
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(a.jwtWrapper.Expirations().RefreshFor(user)),
+	}
+	if err := a.loadAccess(ctx, user); err != nil {
+		return nil, nil, err
+	}
+	token, err := a.generateTokenForUser(user, session.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	session.RefreshTokenHash = hash.HashToken(token.RefreshToken)
+	if err := a.sessions.CreateSession(ctx, session); err != nil {
+		return nil, nil, fmt.Errorf("failed to create session: %w", err)
+	}
+	login, err := a.recordLogin(ctx, session)
+	if err != nil {
+		return nil, nil, err
+	}
+	return token, login, nil
+}
+
+// activeSession returns the session if it exists and has neither expired nor been revoked.
+func (a *Application) activeSession(ctx context.Context, id uuid.UUID) (*domain.Session, error) {
+	session, err := a.sessions.GetSession(ctx, id)
+	if err != nil {
+		if errors.Is(err, domain.ErrSessionNotFound) {
+			return nil, fmt.Errorf("%w: %w", domain.ErrSessionRevoked, err)
+		}
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+	if !session.Active(time.Now()) {
+		return nil, domain.ErrSessionRevoked
+	}
+	return session, nil
+}
+
+// rotateSession issues a new token pair for the session, invalidating the
+// presented refresh token.
+func (a *Application) rotateSession(ctx context.Context, session *domain.Session, user *domain.User, presentedHash string) (*domain.Token, error) {
+	if err := a.loadAccess(ctx, user); err != nil {
+		return nil, err
+	}
+	token, err := a.generateTokenForUser(user, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	err = a.sessions.RotateSession(ctx, session.ID, presentedHash, hash.HashToken(token.RefreshToken),
+		now, now.Add(a.jwtWrapper.Expirations().RefreshFor(user)))
+	if err != nil {
+		if errors.Is(err, domain.ErrRefreshTokenReused) {
+			return nil, a.refreshTokenReused(ctx, session)
+		}
+		return nil, fmt.Errorf("failed to rotate session: %w", err)
+	}
+	return token, nil
+}
+
+// refreshTokenReused revokes a session whose already rotated refresh token was
+// presented again: either the token leaked or the legitimate client lost a race,
+// and in both cases the session can no longer be trusted.
+func (a *Application) refreshTokenReused(ctx context.Context, session *domain.Session) error {
+	a.metrics.RefreshReuseDetected()
+	a.auditFailure(ctx, domain.AuditEvent{
+		SubjectID: &session.UserID,
+		Action:    domain.AuditRefresh,
+		Details:   map[string]string{"session_id": session.ID.String()},
+	}, domain.ErrRefreshTokenReused)
+	if err := a.sessions.RevokeSession(ctx, session.ID); err != nil {
+		return fmt.Errorf("failed to revoke reused session: %w", err)
+	}
+	return domain.ErrRefreshTokenReused
+}
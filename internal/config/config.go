@@ -2,7 +2,9 @@ package config
 
 import (
 	"fmt"
-	"github.com/caarlos0/env/v6"
+	"net/netip"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -10,7 +12,7 @@ type Postgres struct {
 	Host              string        `env:"POSTGRES_HOST,required" example:"localhost"`
 	Port              int           `env:"POSTGRES_PORT" envDefault:"5432"`
 	User              string        `env:"POSTGRES_USER,required" example:"glimpse"`
-	Password          string        `env:"POSTGRES_PASSWORD,required" example:"password"`
+	Password          string        `env:"POSTGRES_PASSWORD,required" secret:"true" example:"password"`
 	Database          string        `env:"POSTGRES_DB,required" example:"glimpse"`
 	SSLMode           string        `env:"POSTGRES_SSL_MODE" envDefault:"disable"`
 	ConnectionTimeout time.Duration `env:"POSTGRES_CONNECTION_TIMEOUT" envDefault:"60s"`
@@ -19,32 +21,189 @@ type Postgres struct {
 type API struct {
 	Network string `env:"API_NETWORK" envDefault:"tcp"`
 	Address string `env:"API_ADDRESS,required" example:"localhost:8080"`
+	TLS     TLS    `envPrefix:"API_"`
+	// TrustedProxies are the CIDRs of the gateways whose X-Forwarded-For and
+	// X-Real-IP headers are honoured, by the HTTP endpoints as well. Other
+	// callers are located by their connection.
+	TrustedProxies []string `env:"API_TRUSTED_PROXIES" envSeparator:"," example:"10.0.0.0/8"`
+}
+
+// TLS configures a listener. It serves plaintext if no certificate is set and
+// requires client certificates issued by ClientCAFile if that is set.
+type TLS struct {
+	CertFile       string        `env:"TLS_CERT_FILE"`
+	KeyFile        string        `env:"TLS_KEY_FILE"`
+	ClientCAFile   string        `env:"TLS_CLIENT_CA_FILE"`
+	ReloadInterval time.Duration `env:"TLS_RELOAD_INTERVAL" envDefault:"1m"`
+}
+
+func (t TLS) Enabled() bool {
+	return t.CertFile != ""
 }
 
 type JWT struct {
-	SecretKey              string        `env:"JWT_ACCESS_SECRET,required"`
-	RefreshSecretKey       string        `env:"JWT_REFRESH_SECRET,required"`
+	SecretKey              string        `env:"JWT_ACCESS_SECRET,required" secret:"true"`
+	RefreshSecretKey       string        `env:"JWT_REFRESH_SECRET,required" secret:"true"`
 	Issuer                 string        `env:"JWT_ISSUER,required"`
+	Audience               string        `env:"JWT_AUDIENCE,required"`
+	Leeway                 time.Duration `env:"JWT_LEEWAY" envDefault:"30s"`
 	AccessExpirationHours  time.Duration `env:"JWT_ACCESS_EXPIRATION" envDefault:"24h"`
 	RefreshExpirationHours time.Duration `env:"JWT_REFRESH_EXPIRATION" envDefault:"720h"`
+	ServiceExpiration      time.Duration `env:"JWT_SERVICE_EXPIRATION" envDefault:"15m"`
+	// Guests get shorter lived tokens, as they can't log in again once these expire.
+	GuestAccessExpiration  time.Duration `env:"JWT_GUEST_ACCESS_EXPIRATION" envDefault:"1h"`
+	GuestRefreshExpiration time.Duration `env:"JWT_GUEST_REFRESH_EXPIRATION" envDefault:"72h"`
+	// AccessKeyFile is a PEM encoded RSA private key. If set, access tokens are
+	// signed with it and its public key is published for local verification.
+	AccessKeyFile string `env:"JWT_ACCESS_KEY_FILE"`
+	// PreviousAccessKeyFiles are PEM encoded RSA keys that AccessKeyFile
+	// replaced. Tokens they signed are still accepted and they are published
+	// along with it, so keep them for JWT_ACCESS_EXPIRATION after a rotation.
+	PreviousAccessKeyFiles []string `env:"JWT_PREVIOUS_ACCESS_KEY_FILES" envSeparator:","`
 }
 
+// AdminAPI is the listener of the admin service. It is disabled when no address is set
+// and must only be reachable from the internal network.
+type AdminAPI struct {
+	Network        string   `env:"ADMIN_API_NETWORK" envDefault:"tcp"`
+	Address        string   `env:"ADMIN_API_ADDRESS" example:"localhost:8082"`
+	TLS            TLS      `envPrefix:"ADMIN_API_"`
+	TrustedProxies []string `env:"ADMIN_API_TRUSTED_PROXIES" envSeparator:"," example:"10.0.0.0/8"`
+}
+
+// Metrics is the listener of the Prometheus metrics. It also serves the
+// endpoints of HTTP unless that has an address of its own.
 type Metrics struct {
 	Address string `env:"METRICS_ADDRESS,required" example:":8080"`
+	TLS     TLS    `envPrefix:"METRICS_"`
+}
+
+// HTTP is the listener of the OAuth token endpoint and the JWKS, which are
+// called by clients without a certificate. Set it to require client
+// certificates for the metrics.
+type HTTP struct {
+	Address string `env:"HTTP_ADDRESS" example:":8083"`
+	TLS     TLS    `envPrefix:"HTTP_"`
+}
+
+type Outbox struct {
+	Publisher    string        `env:"OUTBOX_PUBLISHER" example:"kafka"`
+	PollInterval time.Duration `env:"OUTBOX_POLL_INTERVAL" envDefault:"1s"`
+	BatchSize    int           `env:"OUTBOX_BATCH_SIZE" envDefault:"100"`
+	RetryBackoff time.Duration `env:"OUTBOX_RETRY_BACKOFF" envDefault:"1s"`
+	MaxBackoff   time.Duration `env:"OUTBOX_MAX_BACKOFF" envDefault:"5m"`
+	ClaimTimeout time.Duration `env:"OUTBOX_CLAIM_TIMEOUT" envDefault:"1m"`
+	KafkaBrokers []string      `env:"KAFKA_BROKERS" envSeparator:"," example:"kafka:9092"`
+	KafkaTopic   string        `env:"KAFKA_TOPIC" envDefault:"auth.user-events"`
+	NATSURL      string        `env:"NATS_URL" example:"nats://nats:4222"`
+	NATSSubject  string        `env:"NATS_SUBJECT_PREFIX" envDefault:"auth.events"`
+}
+
+// GeoIP locates the logins in the history of users. Logins are recorded
+// without a location if no database is set.
+type GeoIP struct {
+	// DatabaseFile is a MaxMind mmdb file such as GeoLite2-City, read on startup.
+	DatabaseFile string `env:"GEOIP_DATABASE_FILE" example:"/usr/share/GeoIP/GeoLite2-City.mmdb"`
+}
+
+// Notifier sends security alerts, such as logins from new devices, and the
+// codes and tokens confirming account changes to users. Without a webhook,
+// alerts are only logged and codes and tokens can't be delivered.
+type Notifier struct {
+	WebhookURL string        `env:"NOTIFIER_WEBHOOK_URL" example:"http://notifications:8080/alerts"`
+	Timeout    time.Duration `env:"NOTIFIER_TIMEOUT" envDefault:"5s"`
+}
+
+type Account struct {
+	DeletionGracePeriod time.Duration `env:"ACCOUNT_DELETION_GRACE_PERIOD" envDefault:"720h"`
+	PurgeInterval       time.Duration `env:"ACCOUNT_PURGE_INTERVAL" envDefault:"1h"`
+	PasswordResetTTL    time.Duration `env:"PASSWORD_RESET_TTL" envDefault:"72h"`
+	// EmailChangeCodeTTL limits how long the code sent to a new address is valid.
+	EmailChangeCodeTTL time.Duration `env:"EMAIL_CHANGE_CODE_TTL" envDefault:"15m"`
+	// EmailChangeRevertTTL limits how long the previous address can revert a change.
+	EmailChangeRevertTTL time.Duration `env:"EMAIL_CHANGE_REVERT_TTL" envDefault:"168h"`
+	// EmailProviderRules canonicalizes addresses of providers like Gmail that
+	// ignore dots or tags. Changing it requires rerunning the email migration.
+	EmailProviderRules bool `env:"EMAIL_PROVIDER_RULES" envDefault:"true"`
+	// MinimumAge is required to sign up unless MinimumAges sets another one
+	// for the country of the user. That is the stricter of the country the
+	// user declared and the one GeoIP locates them in, or the strictest of
+	// MinimumAges if they can't be located.
+	MinimumAge  int      `env:"MINIMUM_AGE" envDefault:"18"`
+	MinimumAges []string `env:"MINIMUM_AGES" envSeparator:"," example:"KR:19,US:18"`
+	// AgePolicyVersion is stored with the attestation of users passing the
+	// age gate. Change it along with the minimum ages.
+	AgePolicyVersion string `env:"AGE_POLICY_VERSION" envDefault:"1"`
+	// TermsVersion and PrivacyPolicyVersion are the versions users must
+	// accept. Publishing a new one prompts every user at the next login.
+	TermsVersion         string `env:"TERMS_VERSION" envDefault:"1"`
+	PrivacyPolicyVersion string `env:"PRIVACY_POLICY_VERSION" envDefault:"1"`
+	// RegistrationMode is open, invite_only or waitlist.
+	RegistrationMode string `env:"REGISTRATION_MODE" envDefault:"open"`
+	// WaitlistInviteTTL limits how long the code sent to an admitted waitlist entry is valid.
+	WaitlistInviteTTL time.Duration `env:"WAITLIST_INVITE_TTL" envDefault:"336h"`
+	// RateLimitWindow is the window in which the requests of a client IP are
+	// counted towards the rate limits, such as WaitlistRateLimit.
+	RateLimitWindow time.Duration `env:"RATE_LIMIT_WINDOW" envDefault:"1h"`
+	// WaitlistRateLimit limits the JoinWaitlist calls of a client IP per RateLimitWindow.
+	WaitlistRateLimit int `env:"WAITLIST_RATE_LIMIT" envDefault:"10"`
+	// GuestRateLimit limits the CreateGuest calls of a client IP per RateLimitWindow.
+	GuestRateLimit int `env:"GUEST_RATE_LIMIT" envDefault:"10"`
+	// GuestTTL is how long a guest can go without signing up before the purge
+	// job removes them.
+	GuestTTL time.Duration `env:"GUEST_TTL" envDefault:"168h"`
+	// IdempotencyKeyTTL limits how long a retried SignUp signs in the user
+	// the first call created instead of failing.
+	IdempotencyKeyTTL time.Duration `env:"IDEMPOTENCY_KEY_TTL" envDefault:"24h"`
+}
+
+// MinimumAgesByCountry parses MinimumAges, keyed by uppercase country codes.
+func (a Account) MinimumAgesByCountry() (map[string]int, error) {
+	ages := make(map[string]int, len(a.MinimumAges))
+	for _, entry := range a.MinimumAges {
+		country, age, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		n, err := strconv.Atoi(age)
+		if !ok || len(country) != 2 || err != nil || n <= 0 {
+			return nil, fmt.Errorf("MINIMUM_AGES entry %q must be a country code and a positive age, e.g. KR:19", entry)
+		}
+		ages[strings.ToUpper(country)] = n
+	}
+	return ages, nil
+}
+
+// ParseTrustedProxies parses the CIDRs of trusted proxies set by the variable name.
+// A single address is a prefix of its full length.
+func ParseTrustedProxies(name string, cidrs []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(cidr)
+			if addrErr != nil {
+				return nil, fmt.Errorf("%s entry %q must be a CIDR or an IP address", name, cidr)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+type Log struct {
+	Level string `env:"LOG_LEVEL" envDefault:"info" example:"debug"`
 }
 
 type Config struct {
 	Postgres Postgres
 	API      API
+	AdminAPI AdminAPI
 	JWT      JWT
 	Metrics  Metrics
-}
-
-func Load() (Config, error) {
-	var cfg Config
-	err := env.Parse(&cfg)
-	if err != nil {
-		return Config{}, fmt.Errorf("parsing config: %w", err)
-	}
-	return cfg, nil
+	HTTP     HTTP
+	Log      Log
+	Outbox   Outbox
+	GeoIP    GeoIP
+	Notifier Notifier
+	Account  Account
 }
@@ -0,0 +1,207 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/caarlos0/env/v6"
+	"gopkg.in/yaml.v3"
+)
+
+// fileSuffix marks a variable holding the path of a file with the value of a
+// secret, as mounted by Docker and Kubernetes secrets.
+const fileSuffix = "_FILE"
+
+// Load reads the config from the environment and, if path is not empty, from
+// a YAML or TOML file. Environment variables take precedence over the file.
+//
+// Keys of the file are the variable names split at the sections, e.g.
+//
+//	jwt:
+//	  access_expiration: 24h
+//	api:
+//	  tls:
+//	    cert_file: /etc/auth/tls.crt
+//
+// sets JWT_ACCESS_EXPIRATION and API_TLS_CERT_FILE. Secrets can be given as
+// <NAME>_FILE instead, either in the environment or in the file.
+func Load(path string) (Config, error) {
+	vars := knownVars()
+	environment := map[string]string{}
+	if path != "" {
+		values, err := readFile(path)
+		if err != nil {
+			return Config{}, err
+		}
+		for name := range values {
+			if _, ok := vars[name]; !ok {
+				return Config{}, fmt.Errorf("config file %s: unknown setting %s", path, fileKey(name))
+			}
+		}
+		environment = values
+	}
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		// A secret set in the environment overrides the file whichever
+		// variant of it either uses.
+		if other, ok := secretVariant(name, vars); ok {
+			if _, set := os.LookupEnv(other); !set {
+				delete(environment, other)
+			}
+		}
+		environment[name] = value
+	}
+	if err := readSecretFiles(environment, vars); err != nil {
+		return Config{}, err
+	}
+
+	var cfg Config
+	if err := env.Parse(&cfg, env.Options{Environment: environment}); err != nil {
+		return Config{}, fmt.Errorf("parsing config: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return Config{}, fmt.Errorf("invalid config:\n%w", err)
+	}
+	return cfg, nil
+}
+
+// readSecretFiles sets every secret whose <NAME>_FILE variable is set to the
+// content of that file.
+func readSecretFiles(environment map[string]string, vars map[string]bool) error {
+	var errs []error
+	for name, secret := range vars {
+		if !secret {
+			continue
+		}
+		path, ok := environment[name+fileSuffix]
+		if !ok || path == "" {
+			continue
+		}
+		if environment[name] != "" {
+			errs = append(errs, fmt.Errorf("%s and %s%s are mutually exclusive", name, name, fileSuffix))
+			continue
+		}
+		value, err := os.ReadFile(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s%s: %w", name, fileSuffix, err))
+			continue
+		}
+		environment[name] = strings.TrimRight(string(value), "\r\n")
+	}
+	return errors.Join(errs...)
+}
+
+// secretVariant returns NAME_FILE for the secret NAME and the other way round.
+func secretVariant(name string, vars map[string]bool) (string, bool) {
+	if vars[name] {
+		return name + fileSuffix, true
+	}
+	if secret, ok := strings.CutSuffix(name, fileSuffix); ok && vars[secret] {
+		return secret, true
+	}
+	return "", false
+}
+
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config file: %w", err)
+	}
+	var tree map[string]any
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &tree)
+	case ".toml":
+		err = toml.Unmarshal(data, &tree)
+	default:
+		return nil, fmt.Errorf("config file %s: unsupported format %q, use .yaml or .toml", path, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse config file %s: %w", path, err)
+	}
+	values := map[string]string{}
+	if err := flatten(values, "", tree); err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+	return values, nil
+}
+
+// flatten turns nested sections into variable names, joining keys with "_".
+func flatten(values map[string]string, prefix string, tree map[string]any) error {
+	for key, value := range tree {
+		name := strings.ToUpper(prefix + key)
+		switch v := value.(type) {
+		case map[string]any:
+			if err := flatten(values, name+"_", v); err != nil {
+				return err
+			}
+		case []any:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				s, err := scalar(item)
+				if err != nil {
+					return fmt.Errorf("%s: %w", fileKey(name), err)
+				}
+				items = append(items, s)
+			}
+			values[name] = strings.Join(items, ",")
+		default:
+			s, err := scalar(v)
+			if err != nil {
+				return fmt.Errorf("%s: %w", fileKey(name), err)
+			}
+			values[name] = s
+		}
+	}
+	return nil
+}
+
+func scalar(value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int, int64, uint64, float64:
+		return fmt.Sprint(v), nil
+	case nil:
+		return "", nil
+	}
+	return "", fmt.Errorf("unsupported value of type %T", value)
+}
+
+func fileKey(name string) string {
+	return strings.ToLower(name)
+}
+
+// knownVars returns the names of all variables of Config, telling whether
+// they hold a secret that may be read from a file.
+func knownVars() map[string]bool {
+	vars := map[string]bool{}
+	collectVars(vars, reflect.TypeOf(Config{}), "")
+	for name, secret := range vars {
+		if secret {
+			vars[name+fileSuffix] = false
+		}
+	}
+	return vars
+}
+
+func collectVars(vars map[string]bool, t reflect.Type, prefix string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if name, _, _ := strings.Cut(field.Tag.Get("env"), ","); name != "" {
+			vars[prefix+name] = field.Tag.Get("secret") == "true"
+			continue
+		}
+		if field.Type.Kind() == reflect.Struct {
+			collectVars(vars, field.Type, prefix+field.Tag.Get("envPrefix"))
+		}
+	}
+}
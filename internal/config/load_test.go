@@ -0,0 +1,336 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	accessSecret  = strings.Repeat("a", minSecretLength)
+	refreshSecret = strings.Repeat("r", minSecretLength)
+)
+
+// setRequired sets the required variables other than the JWT secrets.
+func setRequired(t *testing.T) {
+	t.Helper()
+	for name, value := range map[string]string{
+		"POSTGRES_HOST":     "localhost",
+		"POSTGRES_USER":     "glimpse",
+		"POSTGRES_PASSWORD": "password",
+		"POSTGRES_DB":       "glimpse",
+		"API_ADDRESS":       "localhost:8081",
+		"METRICS_ADDRESS":   ":8080",
+		"JWT_ISSUER":        "glimpse",
+		"JWT_AUDIENCE":      "glimpse",
+	} {
+		t.Setenv(name, value)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name string
+		// file is the content of the config file named config<ext>, in which
+		// $DIR is replaced by the directory of the secret files.
+		file    string
+		ext     string
+		env     map[string]string
+		secrets map[string]string
+		check   func(t *testing.T, cfg Config)
+		wantErr string
+	}{
+		{
+			name: "environment",
+			env:  map[string]string{"JWT_ACCESS_SECRET": accessSecret, "JWT_REFRESH_SECRET": refreshSecret},
+			check: func(t *testing.T, cfg Config) {
+				if cfg.JWT.SecretKey != accessSecret || cfg.JWT.RefreshSecretKey != refreshSecret {
+					t.Errorf("secrets = %q, %q", cfg.JWT.SecretKey, cfg.JWT.RefreshSecretKey)
+				}
+				if cfg.JWT.Leeway != 30*time.Second || cfg.Account.RegistrationMode != "open" {
+					t.Errorf("defaults not applied: leeway %s, registration mode %q", cfg.JWT.Leeway, cfg.Account.RegistrationMode)
+				}
+			},
+		},
+		{
+			name: "yaml file",
+			file: "jwt:\n  access_secret: " + accessSecret + "\n  refresh_secret: " + refreshSecret + "\n  leeway: 1m\n" +
+				"api:\n  tls:\n    reload_interval: 5m\nminimum_ages: [KR:19, US:18]\nemail:\n  provider_rules: false\n",
+			ext: ".yaml",
+			check: func(t *testing.T, cfg Config) {
+				if cfg.JWT.SecretKey != accessSecret || cfg.JWT.Leeway != time.Minute {
+					t.Errorf("jwt = %q, %s", cfg.JWT.SecretKey, cfg.JWT.Leeway)
+				}
+				if cfg.API.TLS.ReloadInterval != 5*time.Minute {
+					t.Errorf("API_TLS_RELOAD_INTERVAL = %s, want 5m", cfg.API.TLS.ReloadInterval)
+				}
+				if strings.Join(cfg.Account.MinimumAges, ",") != "KR:19,US:18" || cfg.Account.EmailProviderRules {
+					t.Errorf("account = %v, %t", cfg.Account.MinimumAges, cfg.Account.EmailProviderRules)
+				}
+			},
+		},
+		{
+			name: "toml file",
+			file: "[jwt]\naccess_secret = \"" + accessSecret + "\"\nrefresh_secret = \"" + refreshSecret + "\"\nleeway = \"1m\"\n",
+			ext:  ".toml",
+			check: func(t *testing.T, cfg Config) {
+				if cfg.JWT.Leeway != time.Minute {
+					t.Errorf("JWT_LEEWAY = %s, want 1m", cfg.JWT.Leeway)
+				}
+			},
+		},
+		{
+			name: "environment overrides file",
+			file: "jwt:\n  access_secret: " + accessSecret + "\n  refresh_secret: " + refreshSecret + "\n  leeway: 1m\n",
+			ext:  ".yml",
+			env:  map[string]string{"JWT_LEEWAY": "2m", "JWT_ACCESS_SECRET": strings.Repeat("e", minSecretLength)},
+			check: func(t *testing.T, cfg Config) {
+				if cfg.JWT.Leeway != 2*time.Minute || cfg.JWT.SecretKey != strings.Repeat("e", minSecretLength) {
+					t.Errorf("jwt = %q, %s", cfg.JWT.SecretKey, cfg.JWT.Leeway)
+				}
+			},
+		},
+		{
+			name:    "secret files in environment",
+			env:     map[string]string{"JWT_ACCESS_SECRET_FILE": "$DIR/access", "JWT_REFRESH_SECRET_FILE": "$DIR/refresh"},
+			secrets: map[string]string{"access": accessSecret + "\n", "refresh": refreshSecret},
+			check: func(t *testing.T, cfg Config) {
+				if cfg.JWT.SecretKey != accessSecret || cfg.JWT.RefreshSecretKey != refreshSecret {
+					t.Errorf("secrets = %q, %q", cfg.JWT.SecretKey, cfg.JWT.RefreshSecretKey)
+				}
+			},
+		},
+		{
+			name:    "secret files in file",
+			file:    "jwt:\n  access_secret_file: $DIR/access\n  refresh_secret_file: $DIR/refresh\n",
+			ext:     ".yaml",
+			secrets: map[string]string{"access": accessSecret, "refresh": refreshSecret},
+			check: func(t *testing.T, cfg Config) {
+				if cfg.JWT.SecretKey != accessSecret || cfg.JWT.RefreshSecretKey != refreshSecret {
+					t.Errorf("secrets = %q, %q", cfg.JWT.SecretKey, cfg.JWT.RefreshSecretKey)
+				}
+			},
+		},
+		{
+			name:    "secret in environment overrides secret file in file",
+			file:    "jwt:\n  access_secret_file: $DIR/access\n  refresh_secret: " + refreshSecret + "\n",
+			ext:     ".yaml",
+			env:     map[string]string{"JWT_ACCESS_SECRET": strings.Repeat("e", minSecretLength)},
+			secrets: map[string]string{"access": accessSecret},
+			check: func(t *testing.T, cfg Config) {
+				if cfg.JWT.SecretKey != strings.Repeat("e", minSecretLength) {
+					t.Errorf("JWT_ACCESS_SECRET = %q, want the one of the environment", cfg.JWT.SecretKey)
+				}
+			},
+		},
+		{
+			name:    "secret file in environment overrides secret in file",
+			file:    "jwt:\n  access_secret: " + strings.Repeat("f", minSecretLength) + "\n  refresh_secret: " + refreshSecret + "\n",
+			ext:     ".yaml",
+			env:     map[string]string{"JWT_ACCESS_SECRET_FILE": "$DIR/access"},
+			secrets: map[string]string{"access": accessSecret},
+			check: func(t *testing.T, cfg Config) {
+				if cfg.JWT.SecretKey != accessSecret {
+					t.Errorf("JWT_ACCESS_SECRET = %q, want the one of the secret file", cfg.JWT.SecretKey)
+				}
+			},
+		},
+		{
+			name:    "secret and secret file",
+			env:     map[string]string{"JWT_ACCESS_SECRET": accessSecret, "JWT_ACCESS_SECRET_FILE": "$DIR/access", "JWT_REFRESH_SECRET": refreshSecret},
+			secrets: map[string]string{"access": accessSecret},
+			wantErr: "JWT_ACCESS_SECRET and JWT_ACCESS_SECRET_FILE are mutually exclusive",
+		},
+		{
+			name:    "missing secret file",
+			env:     map[string]string{"JWT_ACCESS_SECRET_FILE": "$DIR/missing", "JWT_REFRESH_SECRET": refreshSecret},
+			wantErr: "JWT_ACCESS_SECRET_FILE",
+		},
+		{
+			name:    "secret file of a setting that is not secret",
+			env:     map[string]string{"JWT_ACCESS_SECRET": accessSecret, "JWT_REFRESH_SECRET": refreshSecret},
+			file:    "jwt:\n  issuer_file: $DIR/issuer\n",
+			ext:     ".yaml",
+			wantErr: "unknown setting jwt_issuer_file",
+		},
+		{
+			name:    "unknown setting",
+			file:    "jwt:\n  unknown: 1\n",
+			ext:     ".yaml",
+			wantErr: "unknown setting jwt_unknown",
+		},
+		{
+			name:    "unsupported format",
+			file:    "{}",
+			ext:     ".json",
+			wantErr: `unsupported format ".json"`,
+		},
+		{
+			name:    "missing required",
+			env:     map[string]string{"JWT_ACCESS_SECRET": accessSecret},
+			wantErr: "JWT_REFRESH_SECRET",
+		},
+		{
+			name:    "invalid",
+			env:     map[string]string{"JWT_ACCESS_SECRET": "short", "JWT_REFRESH_SECRET": refreshSecret, "LOG_LEVEL": "loud"},
+			wantErr: "invalid config",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setRequired(t)
+			dir := t.TempDir()
+			expand := func(s string) string { return strings.ReplaceAll(s, "$DIR", dir) }
+			for name, value := range tt.secrets {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(value), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for name, value := range tt.env {
+				t.Setenv(name, expand(value))
+			}
+			path := ""
+			if tt.file != "" {
+				path = filepath.Join(dir, "config"+tt.ext)
+				if err := os.WriteFile(path, []byte(expand(tt.file)), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			cfg, err := Load(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			tt.check(t, cfg)
+		})
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		change   func(c *Config)
+		wantErrs []string
+	}{
+		{name: "valid", change: func(*Config) {}},
+		{
+			name:     "short secrets",
+			change:   func(c *Config) { c.JWT.SecretKey, c.JWT.RefreshSecretKey = "short", "short" },
+			wantErrs: []string{"JWT_ACCESS_SECRET must be at least 32", "JWT_REFRESH_SECRET must be at least 32", "must differ"},
+		},
+		{
+			name:     "previous keys without a key",
+			change:   func(c *Config) { c.JWT.PreviousAccessKeyFiles = []string{"old.pem"} },
+			wantErrs: []string{"JWT_PREVIOUS_ACCESS_KEY_FILES requires JWT_ACCESS_KEY_FILE"},
+		},
+		{
+			name:     "negative durations",
+			change:   func(c *Config) { c.JWT.Leeway, c.Outbox.ClaimTimeout, c.Account.IdempotencyKeyTTL = -1, 0, 0 },
+			wantErrs: []string{"JWT_LEEWAY must not be negative", "OUTBOX_CLAIM_TIMEOUT must be positive", "IDEMPOTENCY_KEY_TTL must be positive"},
+		},
+		{
+			name:     "tls key without certificate",
+			change:   func(c *Config) { c.API.TLS.KeyFile = "tls.key" },
+			wantErrs: []string{"API_TLS_CERT_FILE and API_TLS_KEY_FILE must be set together"},
+		},
+		{
+			name:     "client ca without certificate",
+			change:   func(c *Config) { c.AdminAPI.TLS.ClientCAFile = "ca.crt" },
+			wantErrs: []string{"ADMIN_API_TLS_CLIENT_CA_FILE requires ADMIN_API_TLS_CERT_FILE"},
+		},
+		{
+			name: "client certificates for metrics and the token endpoint",
+			change: func(c *Config) {
+				c.Metrics.TLS = TLS{CertFile: "tls.crt", KeyFile: "tls.key", ClientCAFile: "ca.crt", ReloadInterval: time.Minute}
+			},
+			wantErrs: []string{"METRICS_TLS_CLIENT_CA_FILE requires HTTP_ADDRESS"},
+		},
+		{
+			name: "client certificates for metrics only",
+			change: func(c *Config) {
+				c.Metrics.TLS = TLS{CertFile: "tls.crt", KeyFile: "tls.key", ClientCAFile: "ca.crt", ReloadInterval: time.Minute}
+				c.HTTP.Address = ":8083"
+			},
+		},
+		{
+			name: "client certificates for the token endpoint",
+			change: func(c *Config) {
+				c.HTTP = HTTP{Address: ":8083", TLS: TLS{CertFile: "tls.crt", KeyFile: "tls.key", ClientCAFile: "ca.crt", ReloadInterval: time.Minute}}
+			},
+			wantErrs: []string{"HTTP_TLS_CLIENT_CA_FILE is not supported"},
+		},
+		{
+			name:     "invalid trusted proxy",
+			change:   func(c *Config) { c.API.TrustedProxies = []string{"10.0.0.0/8", "gateway"} },
+			wantErrs: []string{`API_TRUSTED_PROXIES entry "gateway"`},
+		},
+		{
+			name:     "publisher without brokers",
+			change:   func(c *Config) { c.Outbox.Publisher = "kafka" },
+			wantErrs: []string{"KAFKA_BROKERS is required"},
+		},
+		{
+			name:     "unknown publisher",
+			change:   func(c *Config) { c.Outbox.Publisher = "carrier-pigeon" },
+			wantErrs: []string{"OUTBOX_PUBLISHER must be one of"},
+		},
+		{
+			name:     "webhook without scheme",
+			change:   func(c *Config) { c.Notifier.WebhookURL = "notifications:8080/alerts" },
+			wantErrs: []string{"NOTIFIER_WEBHOOK_URL must be an http or https URL"},
+		},
+		{
+			name: "age policy",
+			change: func(c *Config) {
+				c.Account.MinimumAges = []string{"KR19"}
+				c.Account.RegistrationMode = "closed"
+			},
+			wantErrs: []string{`MINIMUM_AGES entry "KR19"`, "REGISTRATION_MODE must be one of"},
+		},
+		{
+			name:     "log level",
+			change:   func(c *Config) { c.Log.Level = "loud" },
+			wantErrs: []string{"LOG_LEVEL must be one of"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setRequired(t)
+			t.Setenv("JWT_ACCESS_SECRET", accessSecret)
+			t.Setenv("JWT_REFRESH_SECRET", refreshSecret)
+			cfg, err := Load("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.change(&cfg)
+
+			err = cfg.Validate()
+			if len(tt.wantErrs) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Validate() = nil, want %q", tt.wantErrs)
+			}
+			// Every problem is reported, one per line.
+			for _, want := range tt.wantErrs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Validate() error = %v, want %q", err, want)
+				}
+			}
+			if lines := strings.Count(err.Error(), "\n") + 1; lines != len(tt.wantErrs) {
+				t.Errorf("Validate() reported %d problems, want %d:\n%v", lines, len(tt.wantErrs), err)
+			}
+		})
+	}
+}
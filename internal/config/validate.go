@@ -0,0 +1,185 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// minSecretLength is the shortest HMAC secret accepted, matching the 256-bit output of HS256.
+const minSecretLength = 32
+
+// Validate checks the settings env tags can't express and reports every
+// problem at once, named by its variable.
+func (c Config) Validate() error {
+	return errors.Join(
+		c.JWT.validate(),
+		c.API.TLS.validate("API_"),
+		validateTrustedProxies("API_TRUSTED_PROXIES", c.API.TrustedProxies),
+		c.AdminAPI.TLS.validate("ADMIN_API_"),
+		validateTrustedProxies("ADMIN_API_TRUSTED_PROXIES", c.AdminAPI.TrustedProxies),
+		c.Metrics.TLS.validate("METRICS_"),
+		c.validateHTTP(),
+		c.Outbox.validate(),
+		c.Notifier.validate(),
+		c.Account.validate(),
+		c.Log.validate(),
+	)
+}
+
+func (c JWT) validate() error {
+	var errs []error
+	if len(c.SecretKey) < minSecretLength {
+		errs = append(errs, fmt.Errorf("JWT_ACCESS_SECRET must be at least %d bytes long", minSecretLength))
+	}
+	if len(c.RefreshSecretKey) < minSecretLength {
+		errs = append(errs, fmt.Errorf("JWT_REFRESH_SECRET must be at least %d bytes long", minSecretLength))
+	}
+	if c.SecretKey == c.RefreshSecretKey {
+		errs = append(errs, errors.New("JWT_ACCESS_SECRET and JWT_REFRESH_SECRET must differ"))
+	}
+	if len(c.PreviousAccessKeyFiles) > 0 && c.AccessKeyFile == "" {
+		errs = append(errs, errors.New("JWT_PREVIOUS_ACCESS_KEY_FILES requires JWT_ACCESS_KEY_FILE"))
+	}
+	if c.Leeway < 0 {
+		errs = append(errs, errors.New("JWT_LEEWAY must not be negative"))
+	}
+	errs = append(errs,
+		positive("JWT_ACCESS_EXPIRATION", c.AccessExpirationHours),
+		positive("JWT_REFRESH_EXPIRATION", c.RefreshExpirationHours),
+		positive("JWT_SERVICE_EXPIRATION", c.ServiceExpiration),
+		positive("JWT_GUEST_ACCESS_EXPIRATION", c.GuestAccessExpiration),
+		positive("JWT_GUEST_REFRESH_EXPIRATION", c.GuestRefreshExpiration),
+	)
+	return errors.Join(errs...)
+}
+
+// validateHTTP keeps the token endpoint and the JWKS reachable without a
+// client certificate, which the metrics listener serves them with otherwise.
+func (c Config) validateHTTP() error {
+	switch {
+	case c.HTTP.TLS.ClientCAFile != "":
+		return errors.New("HTTP_TLS_CLIENT_CA_FILE is not supported, the token endpoint and the JWKS are public")
+	case c.HTTP.TLS.Enabled() && c.HTTP.Address == "":
+		return errors.New("HTTP_TLS_CERT_FILE requires HTTP_ADDRESS")
+	case c.Metrics.TLS.ClientCAFile != "" && c.HTTP.Address == "":
+		return errors.New("METRICS_TLS_CLIENT_CA_FILE requires HTTP_ADDRESS to serve the token endpoint and the JWKS without client certificates")
+	}
+	return c.HTTP.TLS.validate("HTTP_")
+}
+
+func (t TLS) validate(prefix string) error {
+	switch {
+	case (t.CertFile == "") != (t.KeyFile == ""):
+		return fmt.Errorf("%[1]sTLS_CERT_FILE and %[1]sTLS_KEY_FILE must be set together", prefix)
+	case t.ClientCAFile != "" && t.CertFile == "":
+		return fmt.Errorf("%[1]sTLS_CLIENT_CA_FILE requires %[1]sTLS_CERT_FILE", prefix)
+	case t.Enabled() && t.ReloadInterval <= 0:
+		return fmt.Errorf("%sTLS_RELOAD_INTERVAL must be positive", prefix)
+	}
+	return nil
+}
+
+func validateTrustedProxies(name string, cidrs []string) error {
+	_, err := ParseTrustedProxies(name, cidrs)
+	return err
+}
+
+func (o Outbox) validate() error {
+	var errs []error
+	switch o.Publisher {
+	case "", "memory":
+	case "kafka":
+		if len(o.KafkaBrokers) == 0 {
+			errs = append(errs, errors.New("KAFKA_BROKERS is required for the kafka publisher"))
+		}
+	case "nats":
+		if o.NATSURL == "" {
+			errs = append(errs, errors.New("NATS_URL is required for the nats publisher"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("OUTBOX_PUBLISHER must be one of kafka, nats, memory, got %q", o.Publisher))
+	}
+	if o.BatchSize <= 0 {
+		errs = append(errs, errors.New("OUTBOX_BATCH_SIZE must be positive"))
+	}
+	errs = append(errs,
+		positive("OUTBOX_POLL_INTERVAL", o.PollInterval),
+		positive("OUTBOX_RETRY_BACKOFF", o.RetryBackoff),
+		positive("OUTBOX_MAX_BACKOFF", o.MaxBackoff),
+		positive("OUTBOX_CLAIM_TIMEOUT", o.ClaimTimeout),
+	)
+	return errors.Join(errs...)
+}
+
+func (n Notifier) validate() error {
+	if n.WebhookURL != "" {
+		if u, err := url.Parse(n.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("NOTIFIER_WEBHOOK_URL must be an http or https URL, got %q", n.WebhookURL)
+		}
+	}
+	return positive("NOTIFIER_TIMEOUT", n.Timeout)
+}
+
+func (a Account) validate() error {
+	return errors.Join(
+		positive("ACCOUNT_DELETION_GRACE_PERIOD", a.DeletionGracePeriod),
+		positive("ACCOUNT_PURGE_INTERVAL", a.PurgeInterval),
+		positive("PASSWORD_RESET_TTL", a.PasswordResetTTL),
+		positive("EMAIL_CHANGE_CODE_TTL", a.EmailChangeCodeTTL),
+		positive("EMAIL_CHANGE_REVERT_TTL", a.EmailChangeRevertTTL),
+		a.validateAgePolicy(),
+		notEmpty("TERMS_VERSION", a.TermsVersion),
+		notEmpty("PRIVACY_POLICY_VERSION", a.PrivacyPolicyVersion),
+		oneOf("REGISTRATION_MODE", a.RegistrationMode, "open", "invite_only", "waitlist"),
+		positive("WAITLIST_INVITE_TTL", a.WaitlistInviteTTL),
+		positive("IDEMPOTENCY_KEY_TTL", a.IdempotencyKeyTTL),
+		positive("RATE_LIMIT_WINDOW", a.RateLimitWindow),
+		positive("WAITLIST_RATE_LIMIT", a.WaitlistRateLimit),
+		positive("GUEST_RATE_LIMIT", a.GuestRateLimit),
+		positive("GUEST_TTL", a.GuestTTL),
+	)
+}
+
+func (a Account) validateAgePolicy() error {
+	if a.MinimumAge <= 0 {
+		return errors.New("MINIMUM_AGE must be positive")
+	}
+	if err := notEmpty("AGE_POLICY_VERSION", a.AgePolicyVersion); err != nil {
+		return err
+	}
+	_, err := a.MinimumAgesByCountry()
+	return err
+}
+
+func (l Log) validate() error {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(strings.TrimSpace(l.Level))); err != nil {
+		return fmt.Errorf("LOG_LEVEL must be one of debug, info, warn, error, got %q", l.Level)
+	}
+	return nil
+}
+
+func oneOf(name, v string, allowed ...string) error {
+	if !slices.Contains(allowed, v) {
+		return fmt.Errorf("%s must be one of %s, got %q", name, strings.Join(allowed, ", "), v)
+	}
+	return nil
+}
+
+func notEmpty(name, v string) error {
+	if strings.TrimSpace(v) == "" {
+		return fmt.Errorf("%s must be set", name)
+	}
+	return nil
+}
+
+func positive[T ~int | ~int64](name string, v T) error {
+	if v <= 0 {
+		return fmt.Errorf("%s must be positive", name)
+	}
+	return nil
+}
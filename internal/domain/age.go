@@ -0,0 +1,77 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+)
+
+// maxAge bounds plausible dates of birth.
+const maxAge = 120
+
+// AgePolicy is the minimum age required to sign up. Version identifies the
+// policy a user attested to and must change whenever the ages do.
+type AgePolicy struct {
+	Version    string
+	MinimumAge int
+	// ByCountry overrides MinimumAge in the countries it holds.
+	ByCountry map[string]int
+}
+
+// MinimumAgeIn returns the minimum age in country.
+func (p AgePolicy) MinimumAgeIn(country string) int {
+	if age, ok := p.ByCountry[country]; ok {
+		return age
+	}
+	return p.MinimumAge
+}
+
+// Jurisdiction returns the country whose minimum age applies to a user who
+// declared to live in declared and whose address was located in located.
+// The declared country is not verified, so it can only make the minimum age
+// stricter. If the address could not be located, the strictest country applies.
+func (p AgePolicy) Jurisdiction(declared, located string) string {
+	if located == "" {
+		return p.strictestCountry(declared)
+	}
+	if p.MinimumAgeIn(declared) > p.MinimumAgeIn(located) {
+		return declared
+	}
+	return located
+}
+
+// strictestCountry returns the country with the highest minimum age,
+// preferring fallback among those that share it.
+func (p AgePolicy) strictestCountry(fallback string) string {
+	strictest := fallback
+	for country, age := range p.ByCountry {
+		current := p.MinimumAgeIn(strictest)
+		if age > current || age == current && strictest != fallback && country < strictest {
+			strictest = country
+		}
+	}
+	return strictest
+}
+
+// Check returns ErrUnderage if a user born on dateOfBirth is younger than the
+// minimum age in country at now.
+func (p AgePolicy) Check(dateOfBirth time.Time, country string, now time.Time) error {
+	age := AgeAt(dateOfBirth, now)
+	if dateOfBirth.IsZero() || dateOfBirth.After(now) || age > maxAge {
+		return ErrInvalidDateOfBirth
+	}
+	if minimum := p.MinimumAgeIn(country); age < minimum {
+		return fmt.Errorf("%w of %d in %s", ErrUnderage, minimum, country)
+	}
+	return nil
+}
+
+// AgeAt returns the age in full years of someone born on dateOfBirth at now.
+// Both are compared as calendar dates, so one born on February 29 comes of
+// age on March 1 in common years.
+func AgeAt(dateOfBirth, now time.Time) int {
+	age := now.Year() - dateOfBirth.Year()
+	if now.Month() < dateOfBirth.Month() || now.Month() == dateOfBirth.Month() && now.Day() < dateOfBirth.Day() {
+		age--
+	}
+	return age
+}
@@ -0,0 +1,66 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAgePolicy_Check(t *testing.T) {
+	policy := AgePolicy{Version: "1", MinimumAge: 18, ByCountry: map[string]int{"KR": 19}}
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		dateOfBirth time.Time
+		country     string
+		now         time.Time
+		wantErr     error
+	}{
+		{name: "adult", dateOfBirth: date(1990, 5, 17), country: "DE", now: now},
+		{name: "birthday", dateOfBirth: date(2006, 5, 1), country: "DE", now: now},
+		{name: "day before birthday", dateOfBirth: date(2006, 5, 2), country: "DE", now: now, wantErr: ErrUnderage},
+		{name: "country minimum", dateOfBirth: date(2006, 5, 1), country: "KR", now: now, wantErr: ErrUnderage},
+		{name: "leap day in common year", dateOfBirth: date(2004, 2, 29), country: "DE", now: date(2022, 2, 28), wantErr: ErrUnderage},
+		{name: "day after leap day in common year", dateOfBirth: date(2004, 2, 29), country: "DE", now: date(2022, 3, 1)},
+		{name: "missing", country: "DE", now: now, wantErr: ErrInvalidDateOfBirth},
+		{name: "future", dateOfBirth: date(2025, 1, 1), country: "DE", now: now, wantErr: ErrInvalidDateOfBirth},
+		{name: "implausible", dateOfBirth: date(1850, 1, 1), country: "DE", now: now, wantErr: ErrInvalidDateOfBirth},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := policy.Check(tt.dateOfBirth, tt.country, tt.now); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Check() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAgePolicy_Jurisdiction(t *testing.T) {
+	policy := AgePolicy{Version: "1", MinimumAge: 18, ByCountry: map[string]int{"KR": 19, "JP": 19, "US": 18, "DE": 16}}
+	tests := []struct {
+		name     string
+		declared string
+		located  string
+		want     string
+	}{
+		{name: "located where declared", declared: "FR", located: "FR", want: "FR"},
+		{name: "located in a stricter country", declared: "FR", located: "KR", want: "KR"},
+		{name: "declared a stricter country", declared: "KR", located: "FR", want: "KR"},
+		{name: "declared a laxer country", declared: "DE", located: "FR", want: "FR"},
+		{name: "not located", declared: "DE", want: "JP"},
+		{name: "not located in the strictest country", declared: "KR", want: "KR"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.Jurisdiction(tt.declared, tt.located); got != tt.want {
+				t.Errorf("Jurisdiction(%q, %q) = %q, want %q", tt.declared, tt.located, got, tt.want)
+			}
+		})
+	}
+	if got := (AgePolicy{MinimumAge: 18}).Jurisdiction("FR", ""); got != "FR" {
+		t.Errorf("Jurisdiction without country ages = %q, want the declared country", got)
+	}
+}
@@ -0,0 +1,137 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	AuditSignUp        = "auth.sign_up"
+	AuditLogin         = "auth.login"
+	AuditRefresh       = "auth.refresh"
+	AuditLogout        = "auth.logout"
+	AuditPasswordReset = "auth.password_reset"
+	AuditDeleteAccount = "auth.delete_account"
+	AuditExportData    = "auth.export_data"
+	AuditAcceptTerms   = "auth.accept_terms"
+	AuditCreateGuest   = "auth.create_guest"
+
+	AuditRequestEmailChange = "auth.request_email_change"
+	AuditConfirmEmailChange = "auth.confirm_email_change"
+	AuditRevertEmailChange  = "auth.revert_email_change"
+
+	AuditIssueServiceToken = "auth.issue_service_token"
+
+	AuditAdminGetUser            = "admin.get_user"
+	AuditAdminSearchUsers        = "admin.search_users"
+	AuditAdminDisableUser        = "admin.disable_user"
+	AuditAdminEnableUser         = "admin.enable_user"
+	AuditAdminSuspendUser        = "admin.suspend_user"
+	AuditAdminBanUser            = "admin.ban_user"
+	AuditAdminReinstateUser      = "admin.reinstate_user"
+	AuditAdminForceLogout        = "admin.force_logout"
+	AuditAdminForcePasswordReset = "admin.force_password_reset"
+	AuditAdminSetRoles           = "admin.set_roles"
+	AuditAdminCreateInviteCodes  = "admin.create_invite_codes"
+	AuditAdminAdmitWaitlist      = "admin.admit_waitlist"
+	AuditAdminListAuditEvents    = "admin.list_audit_events"
+	AuditAdminVerifyAuditLog     = "admin.verify_audit_log"
+)
+
+const (
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeFailure = "failure"
+)
+
+// AuditEvent records who did what to which account and from where. The events
+// of an account form a hash chain, identified by ChainID: every event stores the
+// hash of its predecessor in PrevHash, so altering or removing a row breaks the
+// chain from that point on. IP and UserAgent are personal data kept out of the
+// hash, so they can be redacted without breaking the chain.
+type AuditEvent struct {
+	Seq       int64             `db:"seq"`
+	ID        uuid.UUID         `db:"id"`
+	ChainID   uuid.UUID         `db:"chain_id"`
+	ActorID   *uuid.UUID        `db:"actor_id"`
+	SubjectID *uuid.UUID        `db:"subject_id"`
+	Action    string            `db:"action"`
+	Outcome   string            `db:"outcome"`
+	IP        string            `db:"ip"`
+	UserAgent string            `db:"user_agent"`
+	Details   map[string]string `db:"details"`
+	CreatedAt time.Time         `db:"created_at"`
+	PrevHash  string            `db:"prev_hash"`
+	Hash      string            `db:"hash"`
+}
+
+// AuditChainOf returns the chain an event belongs to: the one of its subject,
+// else of its actor. Events about no account share the nil chain.
+func AuditChainOf(e AuditEvent) uuid.UUID {
+	switch {
+	case e.SubjectID != nil:
+		return *e.SubjectID
+	case e.ActorID != nil:
+		return *e.ActorID
+	}
+	return uuid.Nil
+}
+
+// ComputeHash returns the hex-encoded SHA-256 of the event content and PrevHash.
+// CreatedAt is taken with microsecond precision, as stored by Postgres.
+func (e *AuditEvent) ComputeHash() string {
+	payload, _ := json.Marshal(struct {
+		PrevHash  string            `json:"prev_hash"`
+		ID        uuid.UUID         `json:"id"`
+		ChainID   uuid.UUID         `json:"chain_id"`
+		ActorID   *uuid.UUID        `json:"actor_id"`
+		SubjectID *uuid.UUID        `json:"subject_id"`
+		Action    string            `json:"action"`
+		Outcome   string            `json:"outcome"`
+		Details   map[string]string `json:"details"`
+		CreatedAt int64             `json:"created_at"`
+	}{e.PrevHash, e.ID, e.ChainID, e.ActorID, e.SubjectID, e.Action, e.Outcome, e.Details, e.CreatedAt.UnixMicro()})
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyAuditChain checks events in ascending Seq order. heads holds the hash
+// of the last event checked of every chain and is updated as events are
+// checked, so it carries over to the next batch. It returns the Seq of the
+// first event that breaks its chain.
+func VerifyAuditChain(heads map[uuid.UUID]string, events []AuditEvent) (int64, error) {
+	for _, e := range events {
+		if e.PrevHash != heads[e.ChainID] {
+			return e.Seq, fmt.Errorf("%w: event %d does not link to its predecessor", ErrAuditChainBroken, e.Seq)
+		}
+		if e.ComputeHash() != e.Hash {
+			return e.Seq, fmt.Errorf("%w: event %d content does not match its hash", ErrAuditChainBroken, e.Seq)
+		}
+		heads[e.ChainID] = e.Hash
+	}
+	return 0, nil
+}
+
+type AuditFilter struct {
+	UserID    *uuid.UUID
+	From      time.Time
+	To        time.Time
+	BeforeSeq int64
+	Limit     int
+}
+
+type AuditPage struct {
+	Events     []AuditEvent
+	NextBefore int64
+}
+
+type AuditVerification struct {
+	Checked     int64
+	Valid       bool
+	BrokenAtSeq int64
+	Reason      string
+}
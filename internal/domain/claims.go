@@ -1,12 +1,55 @@
 package domain
 
 import (
+	"strings"
+
 	"github.com/golang-jwt/jwt"
 	"github.com/google/uuid"
 )
 
+const (
+	TokenUseAccess  = "access"
+	TokenUseRefresh = "refresh"
+)
+
 type Claims struct {
 	jwt.StandardClaims
-	Id    uuid.UUID
-	Email string
+	// UserID is parsed from the sub claim when the token is validated.
+	UserID    uuid.UUID `json:"-"`
+	Email     string    `json:"email"`
+	SessionId uuid.UUID `json:"sid"`
+	Roles     []string  `json:"roles,omitempty"`
+	// ClientID is set instead of UserID in tokens issued to service clients;
+	// the sub claim holds the same value.
+	ClientID string `json:"client_id,omitempty"`
+	// TokenUse tells access and refresh tokens apart, see TokenUseAccess and TokenUseRefresh.
+	TokenUse string `json:"token_use"`
+	// Scope holds the space-separated permissions granted by Roles.
+	Scope string `json:"scope,omitempty"`
+	// Version is the TokenVersion of the user the token was issued to.
+	Version int `json:"ver,omitempty"`
+	// AgeVerified tells the user passed the age gate at sign-up.
+	AgeVerified bool `json:"age_verified,omitempty"`
+	// EmailVerified tells the user proved to receive mail at Email.
+	EmailVerified bool `json:"email_verified,omitempty"`
+	// Guest tells the token was issued to a guest, who has not signed up yet.
+	Guest bool `json:"guest,omitempty"`
+}
+
+// IsService reports whether the token was issued to a service client rather than a user.
+func (c *Claims) IsService() bool {
+	return c.ClientID != ""
+}
+
+func (c *Claims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+func (c *Claims) HasScope(scope string) bool {
+	for _, s := range c.Scopes() {
+		if s == scope {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,68 @@
+package domain
+
+import (
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Documents users must accept to use the service.
+const (
+	DocumentTerms         = "terms"
+	DocumentPrivacyPolicy = "privacy_policy"
+)
+
+// DocumentVersion is a published version of a document.
+type DocumentVersion struct {
+	Document string
+	Version  string
+}
+
+// Consent proves that a user accepted a version of a document.
+type Consent struct {
+	UserID     uuid.UUID `db:"user_id"`
+	Document   string    `db:"document"`
+	Version    string    `db:"version"`
+	AcceptedAt time.Time `db:"accepted_at"`
+	IP         string    `db:"ip"`
+}
+
+// ConsentPolicy holds the current versions of the documents users must accept.
+type ConsentPolicy []DocumentVersion
+
+// Check returns ErrConsentRequired unless accepted holds every current version.
+func (p ConsentPolicy) Check(accepted []DocumentVersion) error {
+	for _, current := range p {
+		if !slices.Contains(accepted, current) {
+			return ErrConsentRequired
+		}
+	}
+	return nil
+}
+
+// Current returns ErrUnknownDocumentVersion unless every version in accepted
+// is current, as an outdated version can't be accepted anymore.
+func (p ConsentPolicy) Current(accepted []DocumentVersion) error {
+	for _, v := range accepted {
+		if !slices.Contains(p, v) {
+			return ErrUnknownDocumentVersion
+		}
+	}
+	return nil
+}
+
+// Pending returns the current versions the user has not accepted yet.
+func (p ConsentPolicy) Pending(consents []Consent) []DocumentVersion {
+	var pending []DocumentVersion
+	for _, current := range p {
+		accepted := false
+		for _, c := range consents {
+			accepted = accepted || c.Document == current.Document && c.Version == current.Version
+		}
+		if !accepted {
+			pending = append(pending, current)
+		}
+	}
+	return pending
+}
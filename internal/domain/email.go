@@ -0,0 +1,68 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Email is an address in the form the user entered it and in its canonical
+// form, which identifies the account: two addresses reaching the same mailbox
+// share the canonical form.
+type Email struct {
+	Display   string
+	Canonical string
+}
+
+// emailProvider describes how a mail provider routes addresses to mailboxes.
+type emailProvider struct {
+	// domain is the domain the provider's aliases are canonicalized to.
+	domain string
+	// ignoreDots is set if dots in the local part are not significant.
+	ignoreDots bool
+	// subaddress separates the mailbox from a tag that is ignored on delivery.
+	subaddress string
+}
+
+var emailProviders = map[string]emailProvider{
+	"gmail.com":      {domain: "gmail.com", ignoreDots: true, subaddress: "+"},
+	"googlemail.com": {domain: "gmail.com", ignoreDots: true, subaddress: "+"},
+	"outlook.com":    {domain: "outlook.com", subaddress: "+"},
+	"hotmail.com":    {domain: "hotmail.com", subaddress: "+"},
+	"live.com":       {domain: "live.com", subaddress: "+"},
+	"icloud.com":     {domain: "icloud.com", subaddress: "+"},
+	"me.com":         {domain: "icloud.com", subaddress: "+"},
+	"proton.me":      {domain: "proton.me", subaddress: "+"},
+	"protonmail.com": {domain: "proton.me", subaddress: "+"},
+	"fastmail.com":   {domain: "fastmail.com", subaddress: "+"},
+	"yahoo.com":      {domain: "yahoo.com", subaddress: "-"},
+}
+
+// NormalizeEmail trims the address, converts it to Unicode NFC and lowercases
+// the domain for display. The canonical form lowercases the local part too and,
+// with providerRules, applies the rules of well-known providers, so that
+// "John.Doe+dating@GoogleMail.com" is the same account as "johndoe@gmail.com".
+func NormalizeEmail(address string, providerRules bool) (Email, error) {
+	address = norm.NFC.String(strings.TrimSpace(address))
+	at := strings.LastIndexByte(address, '@')
+	if at <= 0 || at == len(address)-1 {
+		return Email{}, fmt.Errorf("%w: %q", ErrInvalidEmail, address)
+	}
+	local, domain := address[:at], strings.ToLower(address[at+1:])
+
+	canonicalLocal := strings.ToLower(local)
+	if provider, ok := emailProviders[domain]; ok && providerRules {
+		if i := strings.Index(canonicalLocal, provider.subaddress); i > 0 {
+			canonicalLocal = canonicalLocal[:i]
+		}
+		if provider.ignoreDots {
+			canonicalLocal = strings.ReplaceAll(canonicalLocal, ".", "")
+		}
+		domain = provider.domain
+	}
+	return Email{
+		Display:   local + "@" + strings.ToLower(address[at+1:]),
+		Canonical: canonicalLocal + "@" + domain,
+	}, nil
+}
@@ -0,0 +1,81 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		name          string
+		address       string
+		providerRules bool
+		want          Email
+		wantErr       error
+	}{
+		{
+			name:    "plain",
+			address: "bob@example.com",
+			want:    Email{Display: "bob@example.com", Canonical: "bob@example.com"},
+		},
+		{
+			name:    "case and whitespace",
+			address: "  Bob@Example.COM\n",
+			want:    Email{Display: "Bob@example.com", Canonical: "bob@example.com"},
+		},
+		{
+			name:    "unicode NFC",
+			address: "Jose\u0301@example.com",
+			want:    Email{Display: "Jos\u00e9@example.com", Canonical: "jos\u00e9@example.com"},
+		},
+		{
+			name:          "gmail dots, tag and alias domain",
+			address:       "John.Doe+dating@GoogleMail.com",
+			providerRules: true,
+			want:          Email{Display: "John.Doe+dating@googlemail.com", Canonical: "johndoe@gmail.com"},
+		},
+		{
+			name:    "gmail without provider rules",
+			address: "John.Doe+dating@gmail.com",
+			want:    Email{Display: "John.Doe+dating@gmail.com", Canonical: "john.doe+dating@gmail.com"},
+		},
+		{
+			name:          "outlook keeps dots",
+			address:       "john.doe+x@outlook.com",
+			providerRules: true,
+			want:          Email{Display: "john.doe+x@outlook.com", Canonical: "john.doe@outlook.com"},
+		},
+		{
+			name:          "yahoo subaddress",
+			address:       "jane-news@yahoo.com",
+			providerRules: true,
+			want:          Email{Display: "jane-news@yahoo.com", Canonical: "jane@yahoo.com"},
+		},
+		{
+			name:          "tag only is kept",
+			address:       "+tag@gmail.com",
+			providerRules: true,
+			want:          Email{Display: "+tag@gmail.com", Canonical: "+tag@gmail.com"},
+		},
+		{
+			name:          "unknown provider keeps tag",
+			address:       "bob+x@example.com",
+			providerRules: true,
+			want:          Email{Display: "bob+x@example.com", Canonical: "bob+x@example.com"},
+		},
+		{name: "missing domain", address: "bob@", wantErr: ErrInvalidEmail},
+		{name: "missing local part", address: "@example.com", wantErr: ErrInvalidEmail},
+		{name: "no at sign", address: "bob", wantErr: ErrInvalidEmail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeEmail(tt.address, tt.providerRules)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("NormalizeEmail(%q) = %+v, want %+v", tt.address, got, tt.want)
+			}
+		})
+	}
+}
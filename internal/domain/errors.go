@@ -5,10 +5,48 @@ import (
 )
 
 var (
-	ErrUserNotFound        = errors.New("user not found")
-	ErrAlreadyExists       = errors.New("user with email already exists")
-	ErrWrongPassword       = errors.New("passwords do not match")
-	ErrFailedToParseClaims = errors.New("failed to parse jwt claims")
-	ErrInvalidToken        = errors.New("invalid token")
-	ErrExpiredToken        = errors.New("token has expired")
+	ErrUserNotFound           = errors.New("user not found")
+	ErrAlreadyExists          = errors.New("user with email already exists")
+	ErrInvalidEmail           = errors.New("invalid email address")
+	ErrWrongPassword          = errors.New("passwords do not match")
+	ErrFailedToParseClaims    = errors.New("failed to parse jwt claims")
+	ErrInvalidToken           = errors.New("invalid token")
+	ErrExpiredToken           = errors.New("token has expired")
+	ErrInvalidSignature       = errors.New("token signature is invalid")
+	ErrSessionNotFound        = errors.New("session not found")
+	ErrSessionRevoked         = errors.New("session has been revoked")
+	ErrRefreshTokenReused     = errors.New("refresh token has already been used")
+	ErrUserDisabled           = errors.New("user is disabled")
+	ErrAccountSuspended       = errors.New("account is suspended")
+	ErrAccountBanned          = errors.New("account is banned")
+	ErrIdentifierBanned       = errors.New("identifier belongs to a banned account")
+	ErrUnderage               = errors.New("user is under the minimum age")
+	ErrInvalidDateOfBirth     = errors.New("invalid date of birth")
+	ErrConsentRequired        = errors.New("acceptance of the current terms is required")
+	ErrUnknownDocumentVersion = errors.New("document version is not current")
+	ErrInviteRequired         = errors.New("an invite code is required to sign up")
+	ErrInvalidInviteCode      = errors.New("invite code is invalid, used up or expired")
+	ErrWaitlistClosed         = errors.New("the waitlist is not open")
+	ErrWaitlistEntryNotFound  = errors.New("email is not on the waitlist")
+	ErrRateLimited            = errors.New("too many requests, retry later")
+	ErrNotGuest               = errors.New("token is not of a guest")
+	ErrIdempotencyKeyNotFound = errors.New("idempotency key not found")
+	ErrInvalidIdempotencyKey  = errors.New("invalid idempotency key")
+	ErrIdempotencyKeyReused   = errors.New("idempotency key was used for another request")
+	ErrMissingReason          = errors.New("a reason is required")
+	ErrInvalidExpiry          = errors.New("expiry must be in the future")
+	ErrPasswordResetNeeded    = errors.New("password reset is required")
+	ErrInvalidResetToken      = errors.New("password reset token is invalid or expired")
+	ErrInvalidEmailCode       = errors.New("email change code is invalid or expired")
+	ErrInvalidRevertToken     = errors.New("email change revert token is invalid or expired")
+	ErrTokenOutdated          = errors.New("token was issued before the account changed")
+	ErrAuditChainBroken       = errors.New("audit log hash chain is broken")
+	ErrInsufficientScope      = errors.New("token does not grant the required scope")
+	ErrUnknownRole            = errors.New("unknown role")
+	ErrBatchTooLarge          = errors.New("batch is too large")
+	ErrClientNotFound         = errors.New("service client not found")
+	ErrInvalidClient          = errors.New("invalid client credentials")
+	ErrInvalidScope           = errors.New("requested scope is not granted to the client")
+	ErrServiceToken           = errors.New("service tokens are not accepted for this operation")
+	ErrConcurrentUpdate       = errors.New("request conflicted with a concurrent one, retry it")
 )
@@ -0,0 +1,137 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	EventUserCreated          = "user.created"
+	EventUserEmailVerified    = "user.email_verified"
+	EventUserEmailChanged     = "user.email_changed"
+	EventEmailChangeRequested = "user.email_change_requested"
+	EventUserStatusChanged    = "user.status_changed"
+	EventUserDeleted          = "user.deleted"
+	EventWaitlistAdmitted     = "waitlist.admitted"
+	EventNewDeviceLogin       = "user.new_device_login"
+)
+
+type Event interface {
+	EventType() string
+	AggregateID() uuid.UUID
+}
+
+type UserCreated struct {
+	UserID uuid.UUID
+	Email  string
+}
+
+func (e UserCreated) EventType() string      { return EventUserCreated }
+func (e UserCreated) AggregateID() uuid.UUID { return e.UserID }
+
+type UserEmailVerified struct {
+	UserID uuid.UUID
+	Email  string
+}
+
+func (e UserEmailVerified) EventType() string      { return EventUserEmailVerified }
+func (e UserEmailVerified) AggregateID() uuid.UUID { return e.UserID }
+
+// UserEmailChanged is sent to the old address. Unless the change is itself a
+// revert, the address can revert it until RevertExpiresAt with a token
+// delivered as a SecretMessage.
+type UserEmailChanged struct {
+	UserID          uuid.UUID
+	OldEmail        string
+	NewEmail        string
+	RevertExpiresAt time.Time
+}
+
+func (e UserEmailChanged) EventType() string      { return EventUserEmailChanged }
+func (e UserEmailChanged) AggregateID() uuid.UUID { return e.UserID }
+
+// EmailChangeRequested tells that a code confirming the change was sent to
+// the new address, as a SecretMessage.
+type EmailChangeRequested struct {
+	UserID    uuid.UUID
+	NewEmail  string
+	ExpiresAt time.Time
+}
+
+func (e EmailChangeRequested) EventType() string      { return EventEmailChangeRequested }
+func (e EmailChangeRequested) AggregateID() uuid.UUID { return e.UserID }
+
+type UserDeleted struct {
+	UserID uuid.UUID
+}
+
+func (e UserDeleted) EventType() string      { return EventUserDeleted }
+func (e UserDeleted) AggregateID() uuid.UUID { return e.UserID }
+
+// UserStatusChanged tells other services to hide or show the user again.
+type UserStatusChanged struct {
+	UserID uuid.UUID
+	Status AccountStatus
+	Until  *time.Time
+}
+
+func (e UserStatusChanged) EventType() string      { return EventUserStatusChanged }
+func (e UserStatusChanged) AggregateID() uuid.UUID { return e.UserID }
+
+// WaitlistAdmitted tells that an admitted waitlist entry was sent an invite
+// code, as a SecretMessage.
+type WaitlistAdmitted struct {
+	EntryID   uuid.UUID
+	Email     string
+	ExpiresAt time.Time
+}
+
+func (e WaitlistAdmitted) EventType() string      { return EventWaitlistAdmitted }
+func (e WaitlistAdmitted) AggregateID() uuid.UUID { return e.EntryID }
+
+// NewDeviceLogin warns the user of a login from a device or country not seen
+// in their earlier logins.
+type NewDeviceLogin struct {
+	UserID    uuid.UUID
+	Email     string
+	IP        string
+	UserAgent string
+	Country   string
+	City      string
+	At        time.Time
+}
+
+func (e NewDeviceLogin) EventType() string      { return EventNewDeviceLogin }
+func (e NewDeviceLogin) AggregateID() uuid.UUID { return e.UserID }
+
+const (
+	SecretEmailChangeCode   = "email_change_code"
+	SecretEmailChangeRevert = "email_change_revert"
+	SecretWaitlistInvite    = "waitlist_invite"
+	SecretPasswordReset     = "password_reset"
+)
+
+// SecretMessage delivers a code or token to the address it proves, through
+// the Notifier. Unlike events, it is never stored or published, as anyone
+// reading it could take over the account. Invites of waitlist entries, which
+// have no account yet, carry the EntryID instead of the UserID.
+type SecretMessage struct {
+	Kind      string
+	UserID    uuid.UUID
+	EntryID   uuid.UUID
+	Email     string
+	Secret    string
+	ExpiresAt time.Time
+}
+
+// OutboxMessage is an encoded event waiting in the outbox to be relayed to the
+// message broker.
+type OutboxMessage struct {
+	ID          uuid.UUID `db:"id"`
+	AggregateID uuid.UUID `db:"aggregate_id"`
+	EventType   string    `db:"event_type"`
+	Payload     []byte    `db:"payload"`
+	Attempts    int       `db:"attempts"`
+	CreatedAt   time.Time `db:"created_at"`
+}
@@ -0,0 +1,106 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserDataExport is everything the auth service stores about a user. Left
+// out are the hashes of the password and of the codes and tokens sent to the
+// user, which reveal nothing but can be attacked, and the idempotency records
+// and outbox messages, which are short-lived copies of the data below.
+type UserDataExport struct {
+	GeneratedAt  time.Time           `json:"generated_at"`
+	Account      AccountExport       `json:"account"`
+	Roles        []string            `json:"roles"`
+	LoginHistory []SessionExport     `json:"login_history"`
+	Logins       []LoginExport       `json:"logins"`
+	Consents     []ConsentExport     `json:"consents"`
+	EmailChanges []EmailChangeExport `json:"email_changes"`
+	// BannedIdentifiers are the email and addresses a ban of the account kept
+	// from signing up again.
+	BannedIdentifiers []BannedIdentifierExport `json:"banned_identifiers"`
+	// AuditEvents are the recorded actions of the user and of admins on the
+	// account, newest first, including its bans and reinstatements.
+	AuditEvents []AuditEventExport `json:"audit_events"`
+	// Waitlist is the entry of the email of the account, if it joined the waitlist.
+	Waitlist *WaitlistExport `json:"waitlist,omitempty"`
+}
+
+type AccountExport struct {
+	ID              uuid.UUID     `json:"id"`
+	Email           string        `json:"email"`
+	EmailVerifiedAt *time.Time    `json:"email_verified_at,omitempty"`
+	CreatedAt       time.Time     `json:"created_at"`
+	DeletedAt       *time.Time    `json:"deleted_at,omitempty"`
+	Status          AccountStatus `json:"status"`
+	StatusReason    string        `json:"status_reason,omitempty"`
+	StatusChangedAt *time.Time    `json:"status_changed_at,omitempty"`
+	StatusUntil     *time.Time    `json:"status_until,omitempty"`
+	// AgeAttestedAt is when the user passed the age gate; the date of birth
+	// they gave is not stored.
+	AgeAttestedAt    *time.Time `json:"age_attested_at,omitempty"`
+	AgePolicyVersion string     `json:"age_policy_version,omitempty"`
+}
+
+type SessionExport struct {
+	ID         uuid.UUID  `json:"id"`
+	IP         string     `json:"ip"`
+	UserAgent  string     `json:"user_agent"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+type LoginExport struct {
+	SessionID uuid.UUID `json:"session_id"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Country   string    `json:"country,omitempty"`
+	City      string    `json:"city,omitempty"`
+	NewDevice bool      `json:"new_device"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ConsentExport struct {
+	Document   string    `json:"document"`
+	Version    string    `json:"version"`
+	AcceptedAt time.Time `json:"accepted_at"`
+	IP         string    `json:"ip"`
+}
+
+type WaitlistExport struct {
+	Email      string     `json:"email"`
+	JoinedAt   time.Time  `json:"joined_at"`
+	AdmittedAt *time.Time `json:"admitted_at,omitempty"`
+}
+
+type EmailChangeExport struct {
+	OldEmail        string     `json:"old_email"`
+	NewEmail        string     `json:"new_email"`
+	CreatedAt       time.Time  `json:"created_at"`
+	ExpiresAt       time.Time  `json:"expires_at"`
+	ConfirmedAt     *time.Time `json:"confirmed_at,omitempty"`
+	RevertExpiresAt *time.Time `json:"revert_expires_at,omitempty"`
+	RevertedAt      *time.Time `json:"reverted_at,omitempty"`
+}
+
+type BannedIdentifierExport struct {
+	Kind      string     `json:"kind"`
+	Value     string     `json:"value"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// AuditEventExport leaves out who the admin acting on the account was.
+type AuditEventExport struct {
+	Action    string            `json:"action"`
+	Outcome   string            `json:"outcome"`
+	ByAdmin   bool              `json:"by_admin"`
+	IP        string            `json:"ip"`
+	UserAgent string            `json:"user_agent"`
+	Details   map[string]string `json:"details,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+}
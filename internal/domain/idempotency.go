@@ -0,0 +1,24 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// IdempotencyOperationSignUp scopes the idempotency keys of SignUp.
+const IdempotencyOperationSignUp = "sign_up"
+
+// IdempotencyRecord ties a request made with an idempotency key to the user
+// it signed up, so that a retry with the same key until ExpiresAt is answered
+// for that user instead of failing. RequestHash tells a retry apart from
+// another request reusing the key. No tokens are stored; a retry starts a new
+// session.
+type IdempotencyRecord struct {
+	Operation   string    `db:"operation"`
+	Key         string    `db:"key"`
+	RequestHash string    `db:"request_hash"`
+	UserID      uuid.UUID `db:"user_id"`
+	CreatedAt   time.Time `db:"created_at"`
+	ExpiresAt   time.Time `db:"expires_at"`
+}
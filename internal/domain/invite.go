@@ -0,0 +1,43 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RegistrationMode throttles sign-ups while the service launches city by city.
+type RegistrationMode string
+
+const (
+	RegistrationOpen RegistrationMode = "open"
+	// RegistrationInviteOnly requires an invite code to sign up.
+	RegistrationInviteOnly RegistrationMode = "invite_only"
+	// RegistrationWaitlist requires an invite code too, but anyone can join
+	// the waitlist and is sent one when admitted.
+	RegistrationWaitlist RegistrationMode = "waitlist"
+)
+
+// InviteCode lets up to MaxUses users sign up while registration is gated.
+// Only the hash of the code is stored; Code is filled in when it is created.
+type InviteCode struct {
+	ID        uuid.UUID  `db:"id"`
+	CodeHash  string     `db:"code_hash"`
+	MaxUses   int        `db:"max_uses"`
+	Uses      int        `db:"uses"`
+	CreatedBy *uuid.UUID `db:"created_by"`
+	CreatedAt time.Time  `db:"created_at"`
+	ExpiresAt *time.Time `db:"expires_at"`
+	Code      string     `db:"-"`
+}
+
+// WaitlistEntry is someone waiting to be sent an invite code. Admitting them
+// creates a single-use code, which the notification service sends to Email.
+type WaitlistEntry struct {
+	ID             uuid.UUID  `db:"id"`
+	Email          string     `db:"email"`
+	EmailCanonical string     `db:"email_canonical"`
+	CreatedAt      time.Time  `db:"created_at"`
+	AdmittedAt     *time.Time `db:"admitted_at"`
+	InviteCodeID   *uuid.UUID `db:"invite_code_id"`
+}
@@ -0,0 +1,58 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Login is a successful sign-up or login, kept so users can review where
+// their account is used. DeviceFingerprint is the hash of the device ID the
+// client sent, or of its user agent if it sent none.
+type Login struct {
+	Seq               int64     `db:"seq"`
+	ID                uuid.UUID `db:"id"`
+	UserID            uuid.UUID `db:"user_id"`
+	SessionID         uuid.UUID `db:"session_id"`
+	DeviceFingerprint string    `db:"device_fingerprint"`
+	IP                string    `db:"ip"`
+	UserAgent         string    `db:"user_agent"`
+	Country           string    `db:"country"`
+	City              string    `db:"city"`
+	NewDevice         bool      `db:"new_device"`
+	CreatedAt         time.Time `db:"created_at"`
+}
+
+// GeoLocation is the coarse location of an IP address. Its fields are empty
+// when the address is not in the database.
+type GeoLocation struct {
+	// Country is an ISO 3166-1 alpha-2 code.
+	Country string
+	City    string
+}
+
+// LoginOrigins tells whether the device and country of a login were seen in
+// the earlier logins of the user.
+type LoginOrigins struct {
+	HasLogins    bool
+	KnownDevice  bool
+	KnownCountry bool
+}
+
+// Unfamiliar reports whether a login from country should alert the user. The
+// first login sets the baseline, and logins without a known country are only
+// compared by device.
+func (o LoginOrigins) Unfamiliar(country string) bool {
+	return o.HasLogins && (!o.KnownDevice || (country != "" && !o.KnownCountry))
+}
+
+type LoginFilter struct {
+	UserID    uuid.UUID
+	BeforeSeq int64
+	Limit     int
+}
+
+type LoginPage struct {
+	Logins     []Login
+	NextBefore int64
+}
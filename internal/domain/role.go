@@ -0,0 +1,14 @@
+package domain
+
+// Roles seeded by the migrations. Every new user is granted RoleUser, and
+// every guest RoleGuest until they sign up.
+const (
+	RoleGuest     = "guest"
+	RoleUser      = "user"
+	RolePremium   = "premium"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// ScopeAdmin is the permission required to call the admin service.
+const ScopeAdmin = "admin"
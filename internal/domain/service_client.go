@@ -0,0 +1,29 @@
+package domain
+
+import (
+	"time"
+)
+
+// ServiceClient is an internal service registered to obtain access tokens with
+// the OAuth2 client_credentials grant. Only the hash of its secret is stored.
+type ServiceClient struct {
+	ID         string     `db:"id"`
+	Name       string     `db:"name"`
+	SecretHash string     `db:"secret_hash"`
+	Scopes     []string   `db:"scopes"`
+	CreatedAt  time.Time  `db:"created_at"`
+	DisabledAt *time.Time `db:"disabled_at"`
+}
+
+type ClientCredentials struct {
+	ClientID     string `validate:"required"`
+	ClientSecret string `validate:"required"`
+	// Scopes requested for the token. All granted scopes are issued if empty.
+	Scopes []string
+}
+
+type ServiceToken struct {
+	AccessToken string
+	ExpiresIn   time.Duration
+	Scopes      []string
+}
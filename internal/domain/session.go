@@ -0,0 +1,33 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session is created on every sign-up or login and backs the refresh token
+// issued with it. Only the hash of the current refresh token is stored.
+type Session struct {
+	ID               uuid.UUID  `db:"id"`
+	UserID           uuid.UUID  `db:"user_id"`
+	RefreshTokenHash string     `db:"refresh_token_hash"`
+	IP               string     `db:"ip"`
+	UserAgent        string     `db:"user_agent"`
+	CreatedAt        time.Time  `db:"created_at"`
+	LastUsedAt       time.Time  `db:"last_used_at"`
+	ExpiresAt        time.Time  `db:"expires_at"`
+	RevokedAt        *time.Time `db:"revoked_at"`
+}
+
+func (s *Session) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// ClientInfo describes where a request came from. DeviceID is an optional
+// identifier the app keeps for the installation.
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+	DeviceID  string
+}
@@ -0,0 +1,76 @@
+package domain
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AccountStatus is the moderation state of an account.
+type AccountStatus string
+
+const (
+	StatusActive    AccountStatus = "active"
+	StatusSuspended AccountStatus = "suspended"
+	StatusBanned    AccountStatus = "banned"
+	// StatusDeleted is never stored, it is reported for soft-deleted users.
+	StatusDeleted AccountStatus = "deleted"
+)
+
+// StatusChange is a moderation decision about an account. Until is optional,
+// once it passes the account is active again.
+type StatusChange struct {
+	Status  AccountStatus
+	Reason  string
+	ActorID *uuid.UUID
+	At      time.Time
+	Until   *time.Time
+}
+
+// StatusAt returns the status of the user at now.
+func (u *User) StatusAt(now time.Time) AccountStatus {
+	switch {
+	case u.DeletedAt != nil:
+		return StatusDeleted
+	case u.Status == "" || u.StatusUntil != nil && !now.Before(*u.StatusUntil):
+		return StatusActive
+	}
+	return u.Status
+}
+
+// CheckStatus rejects a suspended or banned user. The reason is meant for
+// staff and is not part of the error.
+func (u *User) CheckStatus(now time.Time) error {
+	var err error
+	switch u.StatusAt(now) {
+	case StatusSuspended:
+		err = ErrAccountSuspended
+	case StatusBanned:
+		err = ErrAccountBanned
+	default:
+		return nil
+	}
+	if u.StatusUntil != nil {
+		return fmt.Errorf("%w until %s", err, u.StatusUntil.UTC().Format(time.RFC3339))
+	}
+	return err
+}
+
+const (
+	// IdentifierEmail is the kind of banned identifiers holding canonical emails.
+	IdentifierEmail = "email"
+	// IdentifierIP is the kind of banned identifiers holding the addresses the
+	// account signed in from. They keep guests from being created there.
+	IdentifierIP = "ip"
+)
+
+// BannedIdentifier blocks signing up again with an identifier of a banned
+// account. It outlives the account, so a ban can't be evaded by deleting it.
+type BannedIdentifier struct {
+	Kind      string     `db:"kind"`
+	Value     string     `db:"value"`
+	UserID    uuid.UUID  `db:"user_id"`
+	CreatedAt time.Time  `db:"created_at"`
+	ExpiresAt *time.Time `db:"expires_at"`
+}
@@ -0,0 +1,35 @@
+package domain
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestUser_CheckStatus(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	later, earlier := now.Add(time.Hour), now.Add(-time.Hour)
+	tests := []struct {
+		name       string
+		user       User
+		wantStatus AccountStatus
+		wantErr    error
+	}{
+		{name: "active", user: User{Status: StatusActive}, wantStatus: StatusActive},
+		{name: "not stored", user: User{}, wantStatus: StatusActive},
+		{name: "suspended", user: User{Status: StatusSuspended, StatusUntil: &later}, wantStatus: StatusSuspended, wantErr: ErrAccountSuspended},
+		{name: "suspension over", user: User{Status: StatusSuspended, StatusUntil: &earlier}, wantStatus: StatusActive},
+		{name: "banned", user: User{Status: StatusBanned}, wantStatus: StatusBanned, wantErr: ErrAccountBanned},
+		{name: "deleted", user: User{Status: StatusBanned, DeletedAt: &earlier}, wantStatus: StatusDeleted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.user.StatusAt(now); got != tt.wantStatus {
+				t.Errorf("StatusAt() = %s, want %s", got, tt.wantStatus)
+			}
+			if err := tt.user.CheckStatus(now); !errors.Is(err, tt.wantErr) {
+				t.Errorf("CheckStatus() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -6,4 +6,7 @@ type Token struct {
 	Id           uuid.UUID `json:"id" validate:"required"`
 	AccessToken  string    `json:"access_token" validate:"required,jwt"`
 	RefreshToken string    `json:"refresh_token" validate:"required,jwt"`
+	// PendingConsents are the current document versions the user must accept
+	// with AcceptTerms. Tokens are issued anyway so that they can.
+	PendingConsents []DocumentVersion `json:"pending_consents,omitempty"`
 }
@@ -0,0 +1,19 @@
+package domain
+
+// IsolationLevel of a transaction. The zero value is the default of the
+// database, which is read committed for Postgres.
+type IsolationLevel string
+
+const (
+	ReadCommitted  IsolationLevel = "read committed"
+	RepeatableRead IsolationLevel = "repeatable read"
+	Serializable   IsolationLevel = "serializable"
+)
+
+// TxOptions configure a transaction. A transaction aborted by a serialization
+// failure or a deadlock is run again up to Retries times, so it must have no
+// effects outside the database.
+type TxOptions struct {
+	Isolation IsolationLevel
+	Retries   int
+}
@@ -1,11 +1,41 @@
 package domain
 
-import "github.com/google/uuid"
+import (
+	"bytes"
+	"time"
+
+	"github.com/google/uuid"
+)
 
 type User struct {
-	ID       uuid.UUID `db:"id" validate:"required"`
-	Email    string    `db:"email" validate:"required,email"`
-	Password string    `db:"password" validate:"required,min=8"`
+	ID                    uuid.UUID     `db:"id" validate:"required"`
+	Email                 string        `db:"email" validate:"required,email"`
+	EmailCanonical        string        `db:"email_canonical"`
+	Password              string        `db:"password" validate:"required,min=8"`
+	CreatedAt             time.Time     `db:"created_at"`
+	DeletedAt             *time.Time    `db:"deleted_at"`
+	PurgeAfter            *time.Time    `db:"purge_after"`
+	DisabledAt            *time.Time    `db:"disabled_at"`
+	Status                AccountStatus `db:"status"`
+	StatusReason          string        `db:"status_reason"`
+	StatusActorID         *uuid.UUID    `db:"status_actor_id"`
+	StatusChangedAt       *time.Time    `db:"status_changed_at"`
+	StatusUntil           *time.Time    `db:"status_until"`
+	PasswordResetRequired bool          `db:"password_reset_required"`
+	// AgeAttestedAt is when the user passed the age gate of AgePolicyVersion
+	// by giving their date of birth. Accounts older than the gate have neither.
+	AgeAttestedAt    *time.Time `db:"age_attested_at"`
+	AgePolicyVersion string     `db:"age_policy_version"`
+	// EmailVerifiedAt is when the user last proved to receive mail at Email.
+	EmailVerifiedAt *time.Time `db:"email_verified_at"`
+	// Guest users have neither an email nor a password until they sign up,
+	// which keeps their ID.
+	Guest bool `db:"guest"`
+	// TokenVersion is bumped when claims embedded in tokens change, which
+	// invalidates the access tokens issued before.
+	TokenVersion int      `db:"token_version"`
+	Roles        []string `db:"-"`
+	Permissions  []string `db:"-"`
 }
 
 type LoginCredentials struct {
@@ -13,6 +43,89 @@ type LoginCredentials struct {
 	Password string `json:"password" validate:"required,min=8"`
 }
 
+// Registration is what a user signs up with. The date of birth is only
+// checked against the AgePolicy, the attestation is stored instead of it.
+type Registration struct {
+	LoginCredentials
+	DateOfBirth time.Time
+	// Country is the ISO 3166-1 alpha-2 code of the country the user lives in.
+	Country string
+	// Accepted must hold the current versions of the ConsentPolicy.
+	Accepted []DocumentVersion
+	// InviteCode is required unless registration is open.
+	InviteCode string
+	// GuestToken is the access token of a guest signing up, who keeps their ID.
+	GuestToken string
+}
+
+// GuestRegistration is what a guest attests before onboarding. Guests pass
+// the same age gate as users signing up.
+type GuestRegistration struct {
+	DateOfBirth time.Time
+	// Country is the ISO 3166-1 alpha-2 code of the country the guest lives in.
+	Country string
+}
+
 type UserID struct {
 	ID uuid.UUID `db:"id"`
 }
+
+// UserSearch matches EmailPrefix against the canonical emails. The users are
+// ordered by canonical email and ID, since guests and deleted users may share one.
+type UserSearch struct {
+	EmailPrefix string
+	After       UserCursor
+	Limit       int
+}
+
+// UserCursor is the position of a user in the search order. The zero value
+// comes before every user.
+type UserCursor struct {
+	EmailCanonical string
+	ID             uuid.UUID
+}
+
+// Before tells whether the cursor comes before the user.
+func (c UserCursor) Before(u User) bool {
+	if c.EmailCanonical != u.EmailCanonical {
+		return c.EmailCanonical < u.EmailCanonical
+	}
+	return bytes.Compare(c.ID[:], u.ID[:]) < 0
+}
+
+type UserPage struct {
+	Users []User
+	// NextAfter is nil on the last page.
+	NextAfter *UserCursor
+}
+
+// PasswordReset is a one-time token allowing the user to set a new password.
+// Only the hash of the token is stored; Token is filled in when it is issued.
+type PasswordReset struct {
+	TokenHash string     `db:"token_hash"`
+	UserID    uuid.UUID  `db:"user_id"`
+	CreatedAt time.Time  `db:"created_at"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	UsedAt    *time.Time `db:"used_at"`
+	Token     string     `db:"-"`
+}
+
+// EmailChange is a request to change the email of a user. It is confirmed
+// with a code sent to the new address, after which the previous address can
+// revert it with a token sent to it. Only hashes of the code and token are
+// stored.
+type EmailChange struct {
+	ID                uuid.UUID  `db:"id"`
+	UserID            uuid.UUID  `db:"user_id"`
+	OldEmail          string     `db:"old_email"`
+	NewEmail          string     `db:"new_email"`
+	NewEmailCanonical string     `db:"new_email_canonical"`
+	CodeHash          string     `db:"code_hash"`
+	Attempts          int        `db:"attempts"`
+	CreatedAt         time.Time  `db:"created_at"`
+	ExpiresAt         time.Time  `db:"expires_at"`
+	ConfirmedAt       *time.Time `db:"confirmed_at"`
+	RevertTokenHash   *string    `db:"revert_token_hash"`
+	RevertExpiresAt   *time.Time `db:"revert_expires_at"`
+	RevertedAt        *time.Time `db:"reverted_at"`
+}
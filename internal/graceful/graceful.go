@@ -3,22 +3,41 @@ package graceful
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
 )
 
 func CaptureSignal(ctx context.Context, sigQuit chan os.Signal) func() error {
-	signal.Ignore(syscall.SIGHUP, syscall.SIGPIPE)
+	signal.Ignore(syscall.SIGPIPE)
 	signal.Notify(sigQuit, syscall.SIGINT, syscall.SIGTERM)
 	return func() error {
 		select {
 		case s := <-sigQuit:
-			log.Printf("captured signal: %v\n", s)
+			slog.Info("captured signal", slog.String("signal", s.String()))
 			return fmt.Errorf("captured signal: %v", s)
 		case <-ctx.Done():
 			return nil
 		}
 	}
 }
+
+// CaptureReload calls reload on every SIGHUP until ctx is done. Servers keep
+// running, so open connections are not dropped.
+func CaptureReload(reload func()) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		sigHup := make(chan os.Signal, 1)
+		signal.Notify(sigHup, syscall.SIGHUP)
+		defer signal.Stop(sigHup)
+		for {
+			select {
+			case <-sigHup:
+				slog.Info("captured signal", slog.String("signal", syscall.SIGHUP.String()))
+				reload()
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+}
@@ -1,6 +1,11 @@
 package hash
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"golang.org/x/crypto/bcrypt"
+)
 
 func HashPassword(password string) string {
 	bytes, _ := bcrypt.GenerateFromPassword([]byte(password), 5)
@@ -13,3 +18,11 @@ func CheckPasswordHash(password string, hash string) bool {
 
 	return err == nil
 }
+
+// HashToken returns a hex-encoded SHA-256 of a token. Tokens are high-entropy,
+// so a fast hash is enough to avoid storing them in plain text.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,55 @@
+package logger
+
+import (
+	"context"
+	"sync"
+)
+
+type requestInfoKey struct{}
+
+// RequestInfo holds per-request values that are attached to every log line
+// written for a request. UserID is filled in by handlers once the user is known.
+type RequestInfo struct {
+	mu        sync.RWMutex
+	requestID string
+	userID    string
+}
+
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, &RequestInfo{requestID: requestID})
+}
+
+func FromContext(ctx context.Context) *RequestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(*RequestInfo)
+	return info
+}
+
+func RequestID(ctx context.Context) string {
+	info := FromContext(ctx)
+	if info == nil {
+		return ""
+	}
+	return info.requestID
+}
+
+func UserID(ctx context.Context) string {
+	info := FromContext(ctx)
+	if info == nil {
+		return ""
+	}
+	info.mu.RLock()
+	defer info.mu.RUnlock()
+	return info.userID
+}
+
+// SetUserID records the authenticated user for the request, if the context
+// carries request info.
+func SetUserID(ctx context.Context, userID string) {
+	info := FromContext(ctx)
+	if info == nil {
+		return
+	}
+	info.mu.Lock()
+	defer info.mu.Unlock()
+	info.userID = userID
+}
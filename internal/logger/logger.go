@@ -0,0 +1,24 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// New builds a JSON logger writing to w at the given level, which can be
+// changed while the logger is in use. Every record passes through the
+// redaction layer before it is encoded.
+func New(w io.Writer, level *slog.LevelVar) *slog.Logger {
+	handler := slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})
+	return slog.New(NewRedactHandler(handler))
+}
+
+func ParseLevel(level string) (slog.Level, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(strings.TrimSpace(level))); err != nil {
+		return 0, fmt.Errorf("parse log level %q: %w", level, err)
+	}
+	return lvl, nil
+}
@@ -0,0 +1,233 @@
+package grpc
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/soulmate-dating/auth/internal/app"
+	"github.com/soulmate-dating/auth/internal/domain"
+	"github.com/soulmate-dating/auth/internal/logger"
+	"github.com/soulmate-dating/auth/pkg/authpb"
+)
+
+const (
+	authorizationHeader = "authorization"
+	bearerPrefix        = "bearer "
+)
+
+type actorKey struct{}
+
+type AdminService struct {
+	authpb.UnimplementedAdminServiceServer
+	admin app.Admin
+}
+
+func NewAdminService(a app.Admin) authpb.AdminServiceServer {
+	return &AdminService{admin: a}
+}
+
+// UnaryAdminAuthInterceptor authenticates the staff member calling the admin
+// service and stores their user ID in the context as the actor.
+func UnaryAdminAuthInterceptor(admin app.Admin) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context,
+		req interface{},
+		_ *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+
+		token := bearerToken(ctx)
+		if token == "" {
+			return nil, status.Error(codes.Unauthenticated, "missing bearer token")
+		}
+		claims, err := admin.AuthenticateAdmin(ctx, token)
+		if err != nil {
+			return nil, statusError(err)
+		}
+		logger.SetUserID(ctx, claims.UserID.String())
+		return handler(context.WithValue(ctx, actorKey{}, claims.UserID), req)
+	}
+}
+
+func bearerToken(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	header := firstValue(md, authorizationHeader)
+	if len(header) < len(bearerPrefix) || !strings.EqualFold(header[:len(bearerPrefix)], bearerPrefix) {
+		return ""
+	}
+	return strings.TrimSpace(header[len(bearerPrefix):])
+}
+
+func actorFromContext(ctx context.Context) uuid.UUID {
+	actor, _ := ctx.Value(actorKey{}).(uuid.UUID)
+	return actor
+}
+
+func (s *AdminService) GetUser(ctx context.Context, request *authpb.GetUserRequest) (*authpb.AdminUser, error) {
+	id, err := parseID(request.GetId())
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.admin.GetUser(ctx, actorFromContext(ctx), id)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return AdminUserResponse(user), nil
+}
+
+func (s *AdminService) SearchUsers(ctx context.Context, request *authpb.SearchUsersRequest) (*authpb.SearchUsersResponse, error) {
+	after, err := decodeUserCursor(request.GetPageToken())
+	if err != nil {
+		return nil, err
+	}
+	page, err := s.admin.SearchUsers(ctx, actorFromContext(ctx), domain.UserSearch{
+		EmailPrefix: request.GetEmailPrefix(),
+		After:       after,
+		Limit:       int(request.GetPageSize()),
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return SearchUsersSuccessResponse(page), nil
+}
+
+func (s *AdminService) DisableUser(ctx context.Context, request *authpb.UserActionRequest) (*authpb.AdminUser, error) {
+	return s.userAction(ctx, request, s.admin.DisableUser)
+}
+
+func (s *AdminService) EnableUser(ctx context.Context, request *authpb.UserActionRequest) (*authpb.AdminUser, error) {
+	return s.userAction(ctx, request, s.admin.EnableUser)
+}
+
+func (s *AdminService) SuspendUser(ctx context.Context, request *authpb.ModerationRequest) (*authpb.AdminUser, error) {
+	return s.moderate(ctx, request, s.admin.SuspendUser)
+}
+
+func (s *AdminService) BanUser(ctx context.Context, request *authpb.ModerationRequest) (*authpb.AdminUser, error) {
+	return s.moderate(ctx, request, s.admin.BanUser)
+}
+
+func (s *AdminService) ReinstateUser(ctx context.Context, request *authpb.UserActionRequest) (*authpb.AdminUser, error) {
+	return s.userAction(ctx, request, s.admin.ReinstateUser)
+}
+
+func (s *AdminService) ForceLogout(ctx context.Context, request *authpb.UserActionRequest) (*authpb.AdminUser, error) {
+	return s.userAction(ctx, request, s.admin.ForceLogout)
+}
+
+func (s *AdminService) ForcePasswordReset(ctx context.Context, request *authpb.UserActionRequest) (*authpb.AdminUser, error) {
+	return s.userAction(ctx, request, s.admin.ForcePasswordReset)
+}
+
+func (s *AdminService) SetRoles(ctx context.Context, request *authpb.SetRolesRequest) (*authpb.AdminUser, error) {
+	id, err := parseID(request.GetId())
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.admin.SetRoles(ctx, actorFromContext(ctx), id, request.GetRoles())
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return AdminUserResponse(user), nil
+}
+
+func (s *AdminService) CreateInviteCodes(ctx context.Context, request *authpb.CreateInviteCodesRequest) (*authpb.CreateInviteCodesResponse, error) {
+	var expiresAt *time.Time
+	if request.GetExpiresAt() != nil {
+		t := request.GetExpiresAt().AsTime()
+		expiresAt = &t
+	}
+	codes, err := s.admin.CreateInviteCodes(ctx, actorFromContext(ctx), int(request.GetCount()), int(request.GetMaxUses()), expiresAt)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return InviteCodesResponse(codes), nil
+}
+
+func (s *AdminService) AdmitWaitlist(ctx context.Context, request *authpb.AdmitWaitlistRequest) (*authpb.AdmitWaitlistResponse, error) {
+	entries, err := s.admin.AdmitWaitlist(ctx, actorFromContext(ctx), int(request.GetCount()))
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return AdmitWaitlistSuccessResponse(entries), nil
+}
+
+func (s *AdminService) ListAuditEvents(ctx context.Context, request *authpb.ListAuditEventsRequest) (*authpb.ListAuditEventsResponse, error) {
+	filter := domain.AuditFilter{Limit: int(request.GetPageSize())}
+	if request.GetUserId() != "" {
+		id, err := parseID(request.GetUserId())
+		if err != nil {
+			return nil, err
+		}
+		filter.UserID = &id
+	}
+	if request.GetFrom() != nil {
+		filter.From = request.GetFrom().AsTime()
+	}
+	if request.GetTo() != nil {
+		filter.To = request.GetTo().AsTime()
+	}
+	before, err := parseSeqPageToken(request.GetPageToken())
+	if err != nil {
+		return nil, err
+	}
+	filter.BeforeSeq = before
+	page, err := s.admin.ListAuditEvents(ctx, actorFromContext(ctx), filter)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return ListAuditEventsSuccessResponse(page), nil
+}
+
+func (s *AdminService) VerifyAuditLog(ctx context.Context, _ *authpb.VerifyAuditLogRequest) (*authpb.VerifyAuditLogResponse, error) {
+	result, err := s.admin.VerifyAuditLog(ctx, actorFromContext(ctx))
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &authpb.VerifyAuditLogResponse{
+		Valid:       result.Valid,
+		Checked:     result.Checked,
+		BrokenAtSeq: result.BrokenAtSeq,
+		Reason:      result.Reason,
+	}, nil
+}
+
+func (s *AdminService) userAction(
+	ctx context.Context, request *authpb.UserActionRequest,
+	action func(ctx context.Context, actor, id uuid.UUID, reason string) (*domain.User, error),
+) (*authpb.AdminUser, error) {
+	id, err := parseID(request.GetId())
+	if err != nil {
+		return nil, err
+	}
+	user, err := action(ctx, actorFromContext(ctx), id, request.GetReason())
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return AdminUserResponse(user), nil
+}
+
+func (s *AdminService) moderate(
+	ctx context.Context, request *authpb.ModerationRequest,
+	action func(ctx context.Context, actor, id uuid.UUID, reason string, until *time.Time) (*domain.User, error),
+) (*authpb.AdminUser, error) {
+	id, err := parseID(request.GetId())
+	if err != nil {
+		return nil, err
+	}
+	var until *time.Time
+	if request.GetUntil() != nil {
+		t := request.GetUntil().AsTime()
+		until = &t
+	}
+	user, err := action(ctx, actorFromContext(ctx), id, request.GetReason(), until)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return AdminUserResponse(user), nil
+}
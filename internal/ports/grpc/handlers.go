@@ -2,56 +2,200 @@ package grpc
 
 import (
 	"context"
+	"strings"
 
-	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/metadata"
 
+	"github.com/soulmate-dating/auth/internal/app"
 	"github.com/soulmate-dating/auth/internal/domain"
+	"github.com/soulmate-dating/auth/internal/logger"
+	"github.com/soulmate-dating/auth/pkg/authpb"
 )
 
-func (s *AuthService) SignUp(ctx context.Context, request *SignUpRequest) (*TokenResponse, error) {
-	token, err := s.app.SignUp(ctx, domain.LoginCredentials{
-		Email:    request.GetEmail(),
-		Password: request.GetPassword(),
+func (s *AuthService) SignUp(ctx context.Context, request *authpb.SignUpRequest) (*authpb.TokenResponse, error) {
+	dateOfBirth, err := parseDate(request.GetDateOfBirth())
+	if err != nil {
+		return nil, err
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx = app.WithIdempotencyKey(ctx, firstValue(md, idempotencyKeyHeader))
+	token, err := s.app.SignUp(ctx, domain.Registration{
+		LoginCredentials: domain.LoginCredentials{
+			Email:    request.GetEmail(),
+			Password: request.GetPassword(),
+		},
+		DateOfBirth: dateOfBirth,
+		Country:     request.GetCountry(),
+		Accepted:    parseDocumentVersions(request.GetAcceptedDocuments()),
+		InviteCode:  request.GetInviteCode(),
+		GuestToken:  request.GetGuestToken(),
 	})
 	if err != nil {
-		return nil, status.Error(GetErrorCode(err), err.Error())
+		return nil, statusError(err)
 	}
+	logger.SetUserID(ctx, token.Id.String())
 	return TokenSuccessResponse(token), nil
 }
 
-func (s *AuthService) Login(ctx context.Context, request *LoginRequest) (*TokenResponse, error) {
+func (s *AuthService) CreateGuest(ctx context.Context, request *authpb.CreateGuestRequest) (*authpb.TokenResponse, error) {
+	dateOfBirth, err := parseDate(request.GetDateOfBirth())
+	if err != nil {
+		return nil, err
+	}
+	token, err := s.app.CreateGuest(ctx, domain.GuestRegistration{
+		DateOfBirth: dateOfBirth,
+		Country:     request.GetCountry(),
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+	logger.SetUserID(ctx, token.Id.String())
+	return TokenSuccessResponse(token), nil
+}
+
+func (s *AuthService) Login(ctx context.Context, request *authpb.LoginRequest) (*authpb.TokenResponse, error) {
 	token, err := s.app.Login(ctx, domain.LoginCredentials{
 		Email:    request.GetEmail(),
 		Password: request.GetPassword(),
 	})
 	if err != nil {
-		return nil, status.Error(GetErrorCode(err), err.Error())
+		return nil, statusError(err)
 	}
+	logger.SetUserID(ctx, token.Id.String())
 	return TokenSuccessResponse(token), nil
 }
 
-func (s *AuthService) Logout(ctx context.Context, request *LogoutRequest) (*UserResponse, error) {
+func (s *AuthService) Logout(ctx context.Context, request *authpb.LogoutRequest) (*authpb.UserResponse, error) {
 	id, err := s.app.Logout(ctx, request.GetAccessToken())
 	if err != nil {
-		return nil, status.Error(GetErrorCode(err), err.Error())
+		return nil, statusError(err)
+	}
+	logger.SetUserID(ctx, id)
+	return &authpb.UserResponse{Id: id}, nil
+}
+
+func (s *AuthService) Validate(ctx context.Context, request *authpb.ValidateRequest) (*authpb.UserResponse, error) {
+	claims, err := s.app.Validate(ctx, request.GetAccessToken(), request.GetScope())
+	if err != nil {
+		return nil, statusError(err)
+	}
+	logger.SetUserID(ctx, claims.Subject)
+	return ClaimsResponse(claims), nil
+}
+
+func (s *AuthService) ValidateMany(ctx context.Context, request *authpb.ValidateManyRequest) (*authpb.ValidateManyResponse, error) {
+	results, err := s.app.ValidateMany(ctx, request.GetAccessTokens(), request.GetScope())
+	if err != nil {
+		return nil, statusError(err)
 	}
-	return &UserResponse{Id: id}, nil
+	return ValidateManySuccessResponse(results), nil
 }
 
-func (s *AuthService) Validate(ctx context.Context, request *ValidateRequest) (*UserResponse, error) {
-	id, err := s.app.Validate(ctx, request.GetAccessToken())
+func (s *AuthService) IssueServiceToken(ctx context.Context, request *authpb.IssueServiceTokenRequest) (*authpb.ServiceTokenResponse, error) {
+	token, err := s.app.IssueServiceToken(ctx, domain.ClientCredentials{
+		ClientID:     request.GetClientId(),
+		ClientSecret: request.GetClientSecret(),
+		Scopes:       strings.Fields(request.GetScope()),
+	})
 	if err != nil {
-		return nil, status.Error(GetErrorCode(err), err.Error())
+		return nil, statusError(err)
 	}
-	return &UserResponse{Id: id}, nil
+	return ServiceTokenSuccessResponse(token), nil
+}
+
+func (s *AuthService) GetVerificationKeys(_ context.Context, _ *authpb.GetVerificationKeysRequest) (*authpb.VerificationKeysResponse, error) {
+	return VerificationKeysSuccessResponse(s.app.VerificationKeys()), nil
 }
 
-func (s *AuthService) Refresh(ctx context.Context, request *RefreshRequest) (*TokenResponse, error) {
+func (s *AuthService) Refresh(ctx context.Context, request *authpb.RefreshRequest) (*authpb.TokenResponse, error) {
 	token, err := s.app.Refresh(ctx, request.GetRefreshToken())
 	if err != nil {
-		return nil, status.Error(GetErrorCode(err), err.Error())
+		return nil, statusError(err)
 	}
+	logger.SetUserID(ctx, token.Id.String())
 	return TokenSuccessResponse(token), nil
 }
 
-func (s *AuthService) mustEmbedUnimplementedAuthServiceServer() {}
+func (s *AuthService) DeleteAccount(ctx context.Context, request *authpb.DeleteAccountRequest) (*authpb.DeleteAccountResponse, error) {
+	user, err := s.app.DeleteAccount(ctx, request.GetAccessToken(), request.GetPassword())
+	if err != nil {
+		return nil, statusError(err)
+	}
+	logger.SetUserID(ctx, user.ID.String())
+	return DeleteAccountSuccessResponse(user), nil
+}
+
+func (s *AuthService) ExportMyData(ctx context.Context, request *authpb.ExportMyDataRequest) (*authpb.ExportMyDataResponse, error) {
+	export, err := s.app.ExportMyData(ctx, request.GetAccessToken())
+	if err != nil {
+		return nil, statusError(err)
+	}
+	logger.SetUserID(ctx, export.Account.ID.String())
+	return ExportSuccessResponse(export)
+}
+
+func (s *AuthService) ListLoginHistory(ctx context.Context, request *authpb.ListLoginHistoryRequest) (*authpb.ListLoginHistoryResponse, error) {
+	before, err := parseSeqPageToken(request.GetPageToken())
+	if err != nil {
+		return nil, err
+	}
+	page, err := s.app.ListLoginHistory(ctx, request.GetAccessToken(), domain.LoginFilter{
+		BeforeSeq: before,
+		Limit:     int(request.GetPageSize()),
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return ListLoginHistorySuccessResponse(page), nil
+}
+
+func (s *AuthService) ResetPassword(ctx context.Context, request *authpb.ResetPasswordRequest) (*authpb.UserResponse, error) {
+	id, err := s.app.ResetPassword(ctx, request.GetResetToken(), request.GetNewPassword())
+	if err != nil {
+		return nil, statusError(err)
+	}
+	logger.SetUserID(ctx, id)
+	return &authpb.UserResponse{Id: id}, nil
+}
+
+func (s *AuthService) RequestEmailChange(ctx context.Context, request *authpb.RequestEmailChangeRequest) (*authpb.RequestEmailChangeResponse, error) {
+	change, err := s.app.RequestEmailChange(ctx, request.GetAccessToken(), request.GetPassword(), request.GetNewEmail())
+	if err != nil {
+		return nil, statusError(err)
+	}
+	logger.SetUserID(ctx, change.UserID.String())
+	return EmailChangeSuccessResponse(change), nil
+}
+
+func (s *AuthService) ConfirmEmailChange(ctx context.Context, request *authpb.ConfirmEmailChangeRequest) (*authpb.UserResponse, error) {
+	user, err := s.app.ConfirmEmailChange(ctx, request.GetAccessToken(), request.GetCode())
+	if err != nil {
+		return nil, statusError(err)
+	}
+	logger.SetUserID(ctx, user.ID.String())
+	return &authpb.UserResponse{Id: user.ID.String(), Email: user.Email}, nil
+}
+
+func (s *AuthService) RevertEmailChange(ctx context.Context, request *authpb.RevertEmailChangeRequest) (*authpb.PasswordResetResponse, error) {
+	reset, err := s.app.RevertEmailChange(ctx, request.GetRevertToken())
+	if err != nil {
+		return nil, statusError(err)
+	}
+	logger.SetUserID(ctx, reset.UserID.String())
+	return PasswordResetSuccessResponse(reset), nil
+}
+
+func (s *AuthService) AcceptTerms(ctx context.Context, request *authpb.AcceptTermsRequest) (*authpb.AcceptTermsResponse, error) {
+	pending, err := s.app.AcceptTerms(ctx, request.GetAccessToken(), parseDocumentVersions(request.GetDocuments()))
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &authpb.AcceptTermsResponse{ConsentRequired: documentVersionsResponse(pending)}, nil
+}
+
+func (s *AuthService) JoinWaitlist(ctx context.Context, request *authpb.JoinWaitlistRequest) (*authpb.JoinWaitlistResponse, error) {
+	if err := s.app.JoinWaitlist(ctx, request.GetEmail()); err != nil {
+		return nil, statusError(err)
+	}
+	return &authpb.JoinWaitlistResponse{Email: request.GetEmail()}, nil
+}
@@ -1,34 +1,415 @@
 package grpc
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/soulmate-dating/auth/internal/adapters/jwt"
+	"github.com/soulmate-dating/auth/internal/app"
 	"github.com/soulmate-dating/auth/internal/domain"
+	"github.com/soulmate-dating/auth/pkg/authpb"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+const exportContentType = "application/json"
+
 var ErrMissingArgument = errors.New("required argument is missing")
 
-func TokenSuccessResponse(p *domain.Token) *TokenResponse {
-	return &TokenResponse{
-		Id:           p.Id.String(),
-		AccessToken:  p.AccessToken,
-		RefreshToken: p.RefreshToken,
+func TokenSuccessResponse(p *domain.Token) *authpb.TokenResponse {
+	return &authpb.TokenResponse{
+		Id:              p.Id.String(),
+		AccessToken:     p.AccessToken,
+		RefreshToken:    p.RefreshToken,
+		ConsentRequired: documentVersionsResponse(p.PendingConsents),
+	}
+}
+
+func documentVersionsResponse(versions []domain.DocumentVersion) []*authpb.DocumentVersion {
+	response := make([]*authpb.DocumentVersion, 0, len(versions))
+	for _, v := range versions {
+		response = append(response, &authpb.DocumentVersion{Document: v.Document, Version: v.Version})
+	}
+	return response
+}
+
+func parseDocumentVersions(versions []*authpb.DocumentVersion) []domain.DocumentVersion {
+	parsed := make([]domain.DocumentVersion, 0, len(versions))
+	for _, v := range versions {
+		parsed = append(parsed, domain.DocumentVersion{Document: v.GetDocument(), Version: v.GetVersion()})
+	}
+	return parsed
+}
+
+func DeleteAccountSuccessResponse(u *domain.User) *authpb.DeleteAccountResponse {
+	response := &authpb.DeleteAccountResponse{Id: u.ID.String()}
+	if u.PurgeAfter != nil {
+		response.PurgeAfter = timestamppb.New(*u.PurgeAfter)
+	}
+	return response
+}
+
+func ExportSuccessResponse(e *domain.UserDataExport) (*authpb.ExportMyDataResponse, error) {
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to encode export: %v", err)
+	}
+	return &authpb.ExportMyDataResponse{ContentType: exportContentType, Data: data}, nil
+}
+
+func AdminUserResponse(u *domain.User) *authpb.AdminUser {
+	return &authpb.AdminUser{
+		Id:                    u.ID.String(),
+		Email:                 u.Email,
+		CreatedAt:             timestamppb.New(u.CreatedAt),
+		DisabledAt:            optionalTimestamp(u.DisabledAt),
+		DeletedAt:             optionalTimestamp(u.DeletedAt),
+		PasswordResetRequired: u.PasswordResetRequired,
+		Roles:                 u.Roles,
+		Status:                string(u.StatusAt(time.Now())),
+		StatusReason:          u.StatusReason,
+		StatusActorId:         optionalID(u.StatusActorID),
+		StatusChangedAt:       optionalTimestamp(u.StatusChangedAt),
+		StatusUntil:           optionalTimestamp(u.StatusUntil),
+		AgeAttestedAt:         optionalTimestamp(u.AgeAttestedAt),
+		AgePolicyVersion:      u.AgePolicyVersion,
+		Guest:                 u.Guest,
+	}
+}
+
+func InviteCodesResponse(codes []domain.InviteCode) *authpb.CreateInviteCodesResponse {
+	response := &authpb.CreateInviteCodesResponse{Codes: make([]*authpb.InviteCode, 0, len(codes))}
+	for _, c := range codes {
+		response.Codes = append(response.Codes, &authpb.InviteCode{
+			Id:        c.ID.String(),
+			Code:      c.Code,
+			MaxUses:   int32(c.MaxUses),
+			ExpiresAt: optionalTimestamp(c.ExpiresAt),
+		})
+	}
+	return response
+}
+
+func AdmitWaitlistSuccessResponse(entries []domain.WaitlistEntry) *authpb.AdmitWaitlistResponse {
+	response := &authpb.AdmitWaitlistResponse{Entries: make([]*authpb.WaitlistEntry, 0, len(entries))}
+	for _, e := range entries {
+		response.Entries = append(response.Entries, &authpb.WaitlistEntry{
+			Id:           e.ID.String(),
+			Email:        e.Email,
+			JoinedAt:     timestamppb.New(e.CreatedAt),
+			AdmittedAt:   optionalTimestamp(e.AdmittedAt),
+			InviteCodeId: optionalID(e.InviteCodeID),
+		})
+	}
+	return response
+}
+
+func SearchUsersSuccessResponse(p *domain.UserPage) *authpb.SearchUsersResponse {
+	response := &authpb.SearchUsersResponse{Users: make([]*authpb.AdminUser, 0, len(p.Users))}
+	for i := range p.Users {
+		response.Users = append(response.Users, AdminUserResponse(&p.Users[i]))
+	}
+	if p.NextAfter != nil {
+		response.NextPageToken = encodeUserCursor(*p.NextAfter)
+	}
+	return response
+}
+
+func EmailChangeSuccessResponse(c *domain.EmailChange) *authpb.RequestEmailChangeResponse {
+	return &authpb.RequestEmailChangeResponse{
+		Id:        c.UserID.String(),
+		NewEmail:  c.NewEmail,
+		ExpiresAt: timestamppb.New(c.ExpiresAt),
+	}
+}
+
+func PasswordResetSuccessResponse(r *domain.PasswordReset) *authpb.PasswordResetResponse {
+	return &authpb.PasswordResetResponse{
+		Id:         r.UserID.String(),
+		ResetToken: r.Token,
+		ExpiresAt:  timestamppb.New(r.ExpiresAt),
+	}
+}
+
+func ClaimsResponse(c *domain.Claims) *authpb.UserResponse {
+	response := &authpb.UserResponse{
+		Roles:         c.Roles,
+		Scopes:        c.Scopes(),
+		Subject:       c.Subject,
+		Email:         c.Email,
+		AgeVerified:   c.AgeVerified,
+		EmailVerified: c.EmailVerified,
+		Guest:         c.Guest,
+		IssuedAt:      unixTimestamp(c.IssuedAt),
+		ExpiresAt:     unixTimestamp(c.ExpiresAt),
+		Issuer:        c.Issuer,
+	}
+	if c.IsService() {
+		response.ClientId = c.ClientID
+	} else {
+		response.Id = c.UserID.String()
+		response.SessionId = c.SessionId.String()
+	}
+	return response
+}
+
+func ServiceTokenSuccessResponse(t *domain.ServiceToken) *authpb.ServiceTokenResponse {
+	return &authpb.ServiceTokenResponse{
+		AccessToken: t.AccessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(t.ExpiresIn.Seconds()),
+		Scope:       strings.Join(t.Scopes, " "),
+	}
+}
+
+func ValidateManySuccessResponse(results []app.ValidationResult) *authpb.ValidateManyResponse {
+	response := &authpb.ValidateManyResponse{Results: make([]*authpb.ValidationResult, 0, len(results))}
+	for _, r := range results {
+		if r.Err != nil {
+			response.Results = append(response.Results, &authpb.ValidationResult{
+				Code:  uint32(GetErrorCode(r.Err)),
+				Error: r.Err.Error(),
+			})
+			continue
+		}
+		response.Results = append(response.Results, &authpb.ValidationResult{
+			Valid: true,
+			User:  ClaimsResponse(r.Claims),
+		})
+	}
+	return response
+}
+
+func VerificationKeysSuccessResponse(keys jwt.JWKS) *authpb.VerificationKeysResponse {
+	response := &authpb.VerificationKeysResponse{Keys: make([]*authpb.JSONWebKey, 0, len(keys.Keys))}
+	for _, k := range keys.Keys {
+		response.Keys = append(response.Keys, &authpb.JSONWebKey{
+			Kty: k.Kty,
+			Use: k.Use,
+			Alg: k.Alg,
+			Kid: k.Kid,
+			N:   k.N,
+			E:   k.E,
+		})
+	}
+	return response
+}
+
+func unixTimestamp(seconds int64) *timestamppb.Timestamp {
+	if seconds == 0 {
+		return nil
+	}
+	return timestamppb.New(time.Unix(seconds, 0))
+}
+
+func ListAuditEventsSuccessResponse(p *domain.AuditPage) *authpb.ListAuditEventsResponse {
+	response := &authpb.ListAuditEventsResponse{Events: make([]*authpb.AuditEvent, 0, len(p.Events))}
+	for _, e := range p.Events {
+		response.Events = append(response.Events, &authpb.AuditEvent{
+			Seq:       e.Seq,
+			Id:        e.ID.String(),
+			ActorId:   optionalID(e.ActorID),
+			SubjectId: optionalID(e.SubjectID),
+			Action:    e.Action,
+			Outcome:   e.Outcome,
+			Ip:        e.IP,
+			UserAgent: e.UserAgent,
+			Details:   e.Details,
+			CreatedAt: timestamppb.New(e.CreatedAt),
+			PrevHash:  e.PrevHash,
+			Hash:      e.Hash,
+		})
+	}
+	if p.NextBefore != 0 {
+		response.NextPageToken = strconv.FormatInt(p.NextBefore, 10)
+	}
+	return response
+}
+
+func ListLoginHistorySuccessResponse(p *domain.LoginPage) *authpb.ListLoginHistoryResponse {
+	response := &authpb.ListLoginHistoryResponse{Logins: make([]*authpb.LoginRecord, 0, len(p.Logins))}
+	for _, l := range p.Logins {
+		response.Logins = append(response.Logins, &authpb.LoginRecord{
+			Id:        l.ID.String(),
+			SessionId: l.SessionID.String(),
+			Ip:        l.IP,
+			UserAgent: l.UserAgent,
+			Country:   l.Country,
+			City:      l.City,
+			NewDevice: l.NewDevice,
+			CreatedAt: timestamppb.New(l.CreatedAt),
+		})
+	}
+	if p.NextBefore != 0 {
+		response.NextPageToken = strconv.FormatInt(p.NextBefore, 10)
+	}
+	return response
+}
+
+func optionalID(id *uuid.UUID) string {
+	if id == nil {
+		return ""
+	}
+	return id.String()
+}
+
+func optionalTimestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+func parseID(id string) (uuid.UUID, error) {
+	if id == "" {
+		return uuid.UUID{}, status.Error(codes.InvalidArgument, ErrMissingArgument.Error())
+	}
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return uuid.UUID{}, status.Errorf(codes.InvalidArgument, "invalid id: %v", err)
+	}
+	return parsed, nil
+}
+
+// parseDate parses a YYYY-MM-DD date. An empty one is left zero for the
+// application to reject.
+func parseDate(date string) (time.Time, error) {
+	if date == "" {
+		return time.Time{}, nil
+	}
+	parsed, err := time.Parse(time.DateOnly, date)
+	if err != nil {
+		return time.Time{}, status.Errorf(codes.InvalidArgument, "invalid date %q, want YYYY-MM-DD", date)
+	}
+	return parsed, nil
+}
+
+// parseSeqPageToken parses the token of pages ordered by a sequence number.
+// An empty one starts at the newest entry.
+func parseSeqPageToken(token string) (int64, error) {
+	if token == "" {
+		return 0, nil
+	}
+	before, err := strconv.ParseInt(token, 10, 64)
+	if err != nil {
+		return 0, status.Error(codes.InvalidArgument, "invalid page token")
+	}
+	return before, nil
+}
+
+// encodeUserCursor encodes the cursor as the ID followed by the canonical
+// email, which is opaque to the clients.
+func encodeUserCursor(c domain.UserCursor) string {
+	return base64.RawURLEncoding.EncodeToString(append(c.ID[:], c.EmailCanonical...))
+}
+
+// decodeUserCursor parses the token of pages of users. An empty one starts at
+// the first user.
+func decodeUserCursor(token string) (domain.UserCursor, error) {
+	if token == "" {
+		return domain.UserCursor{}, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(raw) < len(uuid.UUID{}) {
+		return domain.UserCursor{}, status.Error(codes.InvalidArgument, "invalid page token")
+	}
+	id, _ := uuid.FromBytes(raw[:len(uuid.UUID{})])
+	return domain.UserCursor{EmailCanonical: string(raw[len(uuid.UUID{}):]), ID: id}, nil
+}
+
+// errorReasons tell errors sharing a status code apart. They are reported in
+// an ErrorInfo detail of the status.
+var errorReasons = []struct {
+	err    error
+	reason string
+}{
+	{domain.ErrAccountSuspended, "ACCOUNT_SUSPENDED"},
+	{domain.ErrAccountBanned, "ACCOUNT_BANNED"},
+	{domain.ErrIdentifierBanned, "IDENTIFIER_BANNED"},
+	{domain.ErrUnderage, "UNDERAGE"},
+	{domain.ErrConsentRequired, "CONSENT_REQUIRED"},
+	{domain.ErrInviteRequired, "INVITE_REQUIRED"},
+	{domain.ErrInvalidInviteCode, "INVALID_INVITE_CODE"},
+	{domain.ErrWaitlistClosed, "WAITLIST_CLOSED"},
+	{domain.ErrRateLimited, "RATE_LIMITED"},
+	{domain.ErrNotGuest, "NOT_GUEST"},
+	{domain.ErrIdempotencyKeyReused, "IDEMPOTENCY_KEY_REUSED"},
+}
+
+const errorDomain = "auth.soulmate-dating"
+
+// statusError converts an error of the application to a status error.
+func statusError(err error) error {
+	st := status.New(GetErrorCode(err), err.Error())
+	for _, r := range errorReasons {
+		if !errors.Is(err, r.err) {
+			continue
+		}
+		if detailed, derr := st.WithDetails(&errdetails.ErrorInfo{Reason: r.reason, Domain: errorDomain}); derr == nil {
+			st = detailed
+		}
+		break
 	}
+	return st.Err()
 }
 
 func GetErrorCode(err error) codes.Code {
 	switch {
-	case errors.As(err, &validator.ValidationErrors{}) || errors.Is(err, domain.ErrFailedToParseClaims):
+	case errors.As(err, &validator.ValidationErrors{}) ||
+		errors.Is(err, domain.ErrFailedToParseClaims) ||
+		errors.Is(err, domain.ErrInvalidEmail) ||
+		errors.Is(err, domain.ErrUnknownRole) ||
+		errors.Is(err, domain.ErrBatchTooLarge) ||
+		errors.Is(err, domain.ErrInvalidScope) ||
+		errors.Is(err, domain.ErrMissingReason) ||
+		errors.Is(err, domain.ErrInvalidExpiry) ||
+		errors.Is(err, domain.ErrInvalidDateOfBirth) ||
+		errors.Is(err, domain.ErrUnknownDocumentVersion) ||
+		errors.Is(err, domain.ErrInvalidIdempotencyKey):
 		return codes.InvalidArgument
 	case errors.Is(err, domain.ErrUserNotFound):
 		return codes.NotFound
 	case errors.Is(err, domain.ErrAlreadyExists):
 		return codes.AlreadyExists
+	case errors.Is(err, domain.ErrUserDisabled) ||
+		errors.Is(err, domain.ErrAccountSuspended) ||
+		errors.Is(err, domain.ErrAccountBanned) ||
+		errors.Is(err, domain.ErrIdentifierBanned) ||
+		errors.Is(err, domain.ErrInsufficientScope) ||
+		errors.Is(err, domain.ErrServiceToken):
+		return codes.PermissionDenied
+	case errors.Is(err, domain.ErrPasswordResetNeeded) ||
+		errors.Is(err, domain.ErrUnderage) ||
+		errors.Is(err, domain.ErrConsentRequired) ||
+		errors.Is(err, domain.ErrInviteRequired) ||
+		errors.Is(err, domain.ErrInvalidInviteCode) ||
+		errors.Is(err, domain.ErrWaitlistClosed) ||
+		errors.Is(err, domain.ErrNotGuest) ||
+		errors.Is(err, domain.ErrIdempotencyKeyReused):
+		return codes.FailedPrecondition
 	case errors.Is(err, domain.ErrInvalidToken) ||
 		errors.Is(err, domain.ErrWrongPassword) ||
-		errors.Is(err, domain.ErrExpiredToken):
+		errors.Is(err, domain.ErrExpiredToken) ||
+		errors.Is(err, domain.ErrSessionRevoked) ||
+		errors.Is(err, domain.ErrRefreshTokenReused) ||
+		errors.Is(err, domain.ErrInvalidResetToken) ||
+		errors.Is(err, domain.ErrInvalidEmailCode) ||
+		errors.Is(err, domain.ErrInvalidRevertToken) ||
+		errors.Is(err, domain.ErrTokenOutdated) ||
+		errors.Is(err, domain.ErrInvalidClient):
 		return codes.Unauthenticated
+	case errors.Is(err, domain.ErrConcurrentUpdate):
+		return codes.Aborted
+	case errors.Is(err, domain.ErrRateLimited):
+		return codes.ResourceExhausted
 	}
 	return codes.Internal
 }
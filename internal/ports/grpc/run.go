@@ -2,46 +2,127 @@ package grpc
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"net"
+	nethttp "net/http"
+	"net/netip"
 	"os"
 
 	grpcProm "github.com/grpc-ecosystem/go-grpc-prometheus"
 	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 
 	"github.com/soulmate-dating/auth/internal/app"
 	"github.com/soulmate-dating/auth/internal/config"
 	"github.com/soulmate-dating/auth/internal/graceful"
 	"github.com/soulmate-dating/auth/internal/ports/http"
+	"github.com/soulmate-dating/auth/internal/tlsreload"
+	"github.com/soulmate-dating/auth/pkg/authpb"
 )
 
-func Run(ctx context.Context, cfg config.Config, app app.App) {
+func Run(ctx context.Context, cfg config.Config, app app.App, admin app.Admin, jobs ...func(ctx context.Context) error) {
 	lis, err := net.Listen(cfg.API.Network, cfg.API.Address)
 	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
+		slog.Error("failed to listen", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	var reloaders []*tlsreload.Reloader
+	withTLS := func(cfg config.TLS) *tlsreload.Reloader {
+		r, err := tlsreload.New(cfg)
+		if err != nil {
+			slog.Error("failed to load tls certificate", slog.Any("error", err))
+			os.Exit(1)
+		}
+		if r != nil {
+			reloaders = append(reloaders, r)
+		}
+		return r
 	}
 
 	svc := NewService(app)
 	grpcServer := grpc.NewServer(
-		grpc.ChainUnaryInterceptor(
-			UnaryLoggerInterceptor,
-			UnaryRecoveryInterceptor(),
-		),
-		grpc.StreamInterceptor(grpcProm.StreamServerInterceptor),
-		grpc.UnaryInterceptor(grpcProm.UnaryServerInterceptor),
+		append(serverCredentials(withTLS(cfg.API.TLS)),
+			grpc.ChainUnaryInterceptor(
+				UnaryLoggerInterceptor(slog.Default()),
+				UnaryClientInfoInterceptor(trustedProxies(cfg.API.TrustedProxies)),
+				UnaryRecoveryInterceptor(slog.Default()),
+			),
+			grpc.StreamInterceptor(grpcProm.StreamServerInterceptor),
+			grpc.UnaryInterceptor(grpcProm.UnaryServerInterceptor),
+		)...,
 	)
-	RegisterAuthServiceServer(grpcServer, svc)
+	authpb.RegisterAuthServiceServer(grpcServer, svc)
 	grpcProm.Register(grpcServer)
-	s := http.NewServer(cfg.Metrics.Address)
+	var httpServers []*nethttp.Server
+	withHTTP := func(s *nethttp.Server, cfg config.TLS) {
+		if r := withTLS(cfg); r != nil {
+			s.TLSConfig = r.Config()
+		}
+		httpServers = append(httpServers, s)
+	}
+	if cfg.HTTP.Address != "" {
+		withHTTP(http.NewMetricsServer(cfg.Metrics.Address, nil, nil), cfg.Metrics.TLS)
+		withHTTP(http.NewServer(cfg.HTTP.Address, app, trustedProxies(cfg.API.TrustedProxies)), cfg.HTTP.TLS)
+	} else {
+		withHTTP(http.NewMetricsServer(cfg.Metrics.Address, app, trustedProxies(cfg.API.TrustedProxies)), cfg.Metrics.TLS)
+	}
 	eg, ctx := errgroup.WithContext(ctx)
 	sigQuit := make(chan os.Signal, 1)
 	eg.Go(graceful.CaptureSignal(ctx, sigQuit))
 	eg.Go(RunGRPCServerGracefully(ctx, lis, grpcServer))
-	eg.Go(http.RunServer(ctx, s))
+	for _, s := range httpServers {
+		eg.Go(http.RunServer(ctx, s))
+	}
+	if cfg.AdminAPI.Address != "" {
+		adminLis, err := net.Listen(cfg.AdminAPI.Network, cfg.AdminAPI.Address)
+		if err != nil {
+			slog.Error("failed to listen", slog.Any("error", err))
+			os.Exit(1)
+		}
+		eg.Go(RunGRPCServerGracefully(ctx, adminLis, newAdminServer(admin, withTLS(cfg.AdminAPI.TLS), trustedProxies(cfg.AdminAPI.TrustedProxies))))
+	}
+	for _, r := range reloaders {
+		r := r
+		eg.Go(func() error { return r.Run(ctx) })
+	}
+	for _, job := range jobs {
+		job := job
+		eg.Go(func() error { return job(ctx) })
+	}
 
 	if err := eg.Wait(); err != nil {
-		log.Printf("gracefully shutting down the servers: %s\n", err.Error())
+		slog.Info("gracefully shutting down the servers", slog.Any("reason", err))
+	}
+	slog.Info("servers were successfully shutdown")
+}
+
+func newAdminServer(admin app.Admin, tls *tlsreload.Reloader, trustedProxies []netip.Prefix) *grpc.Server {
+	server := grpc.NewServer(
+		append(serverCredentials(tls),
+			grpc.ChainUnaryInterceptor(
+				UnaryLoggerInterceptor(slog.Default()),
+				UnaryClientInfoInterceptor(trustedProxies),
+				UnaryRecoveryInterceptor(slog.Default()),
+				UnaryAdminAuthInterceptor(admin),
+			),
+		)...,
+	)
+	authpb.RegisterAdminServiceServer(server, NewAdminService(admin))
+	return server
+}
+
+// trustedProxies parses the CIDRs config.Validate already checked.
+func trustedProxies(cidrs []string) []netip.Prefix {
+	prefixes, _ := config.ParseTrustedProxies("", cidrs)
+	return prefixes
+}
+
+// serverCredentials returns the options serving TLS, or none for plaintext.
+func serverCredentials(tls *tlsreload.Reloader) []grpc.ServerOption {
+	if tls == nil {
+		return nil
 	}
-	log.Println("servers were successfully shutdown")
+	return []grpc.ServerOption{grpc.Creds(credentials.NewTLS(tls.Config()))}
 }
@@ -3,48 +3,177 @@ package grpc
 import (
 	"context"
 	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"runtime/debug"
+	"strings"
+	"time"
+
 	grpcRecovery "github.com/grpc-ecosystem/go-grpc-middleware/recovery"
-	"github.com/soulmate-dating/auth/internal/app"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
-	"log"
-	"net"
-	"runtime/debug"
-	"time"
+
+	"github.com/soulmate-dating/auth/internal/app"
+	"github.com/soulmate-dating/auth/internal/domain"
+	"github.com/soulmate-dating/auth/internal/logger"
+	"github.com/soulmate-dating/auth/pkg/authpb"
+)
+
+const (
+	requestIDHeader    = "x-request-id"
+	forwardedForHeader = "x-forwarded-for"
+	realIPHeader       = "x-real-ip"
+	gatewayAgentHeader = "grpcgateway-user-agent"
+	userAgentHeader    = "user-agent"
+	deviceIDHeader     = "x-device-id"
+	// idempotencyKeyHeader makes a retried SignUp return the response of the first call.
+	idempotencyKeyHeader = "idempotency-key"
 )
 
 type AuthService struct {
+	authpb.UnimplementedAuthServiceServer
 	app app.App
 }
 
-func NewService(a app.App) AuthServiceServer {
+func NewService(a app.App) authpb.AuthServiceServer {
 	service := &AuthService{app: a}
 	return service
 }
 
-func UnaryLoggerInterceptor(ctx context.Context,
-	req interface{},
-	info *grpc.UnaryServerInfo,
-	handler grpc.UnaryHandler) (interface{}, error) {
+func UnaryLoggerInterceptor(l *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+
+		requestID := incomingRequestID(ctx)
+		ctx = logger.WithRequestID(ctx, requestID)
+		_ = grpc.SetHeader(ctx, metadata.Pairs(requestIDHeader, requestID))
 
-	start := time.Now()
-	log.Printf("-- received request -- | protocol: GRPC | method: %s", info.FullMethod)
+		start := time.Now()
+		h, err := handler(ctx, req)
+		latency := time.Since(start)
 
-	h, err := handler(ctx, req)
+		code := status.Code(err)
+		attrs := []slog.Attr{
+			slog.String("protocol", "grpc"),
+			slog.String("request_id", requestID),
+			slog.String("method", info.FullMethod),
+			// Keys naming a code are redacted, as codes are secrets in this service.
+			slog.String("status", code.String()),
+			slog.Duration("latency", latency),
+		}
+		if userID := logger.UserID(ctx); userID != "" {
+			attrs = append(attrs, slog.String("user_id", userID))
+		}
+		level := slog.LevelInfo
+		if err != nil {
+			attrs = append(attrs, slog.Any("error", err))
+			level = slog.LevelWarn
+			if code == codes.Internal || code == codes.Unknown {
+				level = slog.LevelError
+			}
+		}
+		l.LogAttrs(ctx, level, "handled request", attrs...)
 
-	latency := time.Since(start)
-	log.Printf("-- handled request -- | protocol: GRPC | latency: %+v | method: %s | error: (%v)\n",
-		latency, info.FullMethod, err)
+		return h, err
+	}
+}
+
+func incomingRequestID(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if requestID := firstValue(md, requestIDHeader); requestID != "" {
+		return requestID
+	}
+	return domain.NewUUID().String()
+}
 
-	return h, err
+// UnaryClientInfoInterceptor resolves the caller's IP, user agent and device ID.
+// The IP forwarded in X-Forwarded-For or X-Real-IP is only honoured if the
+// connection comes from one of trustedProxies, as anyone else could forge it.
+func UnaryClientInfoInterceptor(trustedProxies []netip.Prefix) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context,
+		req interface{},
+		_ *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+
+		md, _ := metadata.FromIncomingContext(ctx)
+		info := domain.ClientInfo{
+			IP:        clientIP(ctx, md, trustedProxies),
+			UserAgent: firstValue(md, gatewayAgentHeader),
+			DeviceID:  firstValue(md, deviceIDHeader),
+		}
+		if info.UserAgent == "" {
+			info.UserAgent = firstValue(md, userAgentHeader)
+		}
+		return handler(app.WithClientInfo(ctx, info), req)
+	}
+}
+
+// clientIP returns the address of the peer unless it is a trusted proxy. Then
+// it is the last address of X-Forwarded-For not of a trusted proxy, as every
+// proxy appends the address it received the request from, or X-Real-IP.
+func clientIP(ctx context.Context, md metadata.MD, trustedProxies []netip.Prefix) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	ip := p.Addr.String()
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	if !isTrustedProxy(ip, trustedProxies) {
+		return ip
+	}
+	if forwarded := firstValue(md, forwardedForHeader); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip = strings.TrimSpace(hops[i])
+			if !isTrustedProxy(ip, trustedProxies) {
+				break
+			}
+		}
+		return ip
+	}
+	if realIP := firstValue(md, realIPHeader); realIP != "" {
+		return realIP
+	}
+	return ip
+}
+
+func isTrustedProxy(ip string, trustedProxies []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
 }
 
-func UnaryRecoveryInterceptor() grpc.UnaryServerInterceptor {
+func UnaryRecoveryInterceptor(l *slog.Logger) grpc.UnaryServerInterceptor {
 	stackTraceLogger := grpcRecovery.WithRecoveryHandlerContext(
 		func(ctx context.Context, p interface{}) error {
-			fmt.Print("\n\n")
-			log.Printf("[PANIC] %s\n%s\n", p, string(debug.Stack()))
+			l.ErrorContext(ctx, "recovered from panic",
+				slog.String("request_id", logger.RequestID(ctx)),
+				slog.Any("panic", p),
+				slog.String("stack", string(debug.Stack())),
+			)
 			return status.Errorf(codes.Internal, "%s", p)
 		},
 	)
@@ -53,8 +182,8 @@ func UnaryRecoveryInterceptor() grpc.UnaryServerInterceptor {
 
 func RunGRPCServerGracefully(ctx context.Context, lis net.Listener, server *grpc.Server) func() error {
 	return func() error {
-		log.Printf("starting grpc server, listening on %s\n", lis.Addr())
-		defer log.Printf("close grpc server listening on %s\n", lis.Addr())
+		slog.Info("starting grpc server", slog.String("address", lis.Addr().String()))
+		defer slog.Info("close grpc server", slog.String("address", lis.Addr().String()))
 
 		errCh := make(chan error)
 
@@ -0,0 +1,680 @@
+package grpc_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/soulmate-dating/auth/internal/adapters/jwt"
+	"github.com/soulmate-dating/auth/internal/adapters/memory"
+	"github.com/soulmate-dating/auth/internal/app"
+	"github.com/soulmate-dating/auth/internal/config"
+	"github.com/soulmate-dating/auth/internal/domain"
+	"github.com/soulmate-dating/auth/internal/hash"
+	authgrpc "github.com/soulmate-dating/auth/internal/ports/grpc"
+	"github.com/soulmate-dating/auth/pkg/authpb"
+)
+
+const (
+	testPassword     = "correct-horse-battery"
+	testClientID     = "feed"
+	testClientSecret = "feed-client-secret"
+)
+
+type testServer struct {
+	auth  authpb.AuthServiceClient
+	admin authpb.AdminServiceClient
+	repo  *memory.Repo
+}
+
+// newTestServer serves the auth and admin services of an in-memory
+// Application over bufconn, with the interceptors of the real servers.
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	repo := memory.NewRepo()
+	repo.AddServiceClient(domain.ServiceClient{
+		ID:         testClientID,
+		SecretHash: hash.HashToken(testClientSecret),
+		Scopes:     []string{"profile:read"},
+	})
+	a := app.NewWithDependencies(app.Dependencies{
+		Repository: repo,
+		Sessions:   repo,
+		Clients:    repo,
+		Outbox:     repo,
+		AuditLog:   repo,
+		Logins:     repo,
+		TxManager:  repo,
+		JWT: jwt.NewWrapper(jwt.Config{
+			Issuer:                      "auth-test",
+			Audience:                    "api-test",
+			SecretKey:                   "access-secret-for-tests-only-0123456789",
+			RefreshSecretKey:            "refresh-secret-for-tests-only-0123456789",
+			AccessTokenExpiration:       time.Hour,
+			RefreshTokenExpiration:      24 * time.Hour,
+			ServiceTokenExpiration:      time.Minute,
+			GuestAccessTokenExpiration:  time.Minute,
+			GuestRefreshTokenExpiration: time.Hour,
+		}),
+	}, config.Account{
+		DeletionGracePeriod:  time.Hour,
+		PurgeInterval:        time.Hour,
+		PasswordResetTTL:     time.Hour,
+		EmailChangeCodeTTL:   time.Hour,
+		EmailChangeRevertTTL: time.Hour,
+		MinimumAge:           18,
+		AgePolicyVersion:     "test-1",
+		TermsVersion:         "terms-1",
+		PrivacyPolicyVersion: "privacy-1",
+		RegistrationMode:     "open",
+		WaitlistInviteTTL:    time.Hour,
+		IdempotencyKeyTTL:    time.Hour,
+		RateLimitWindow:      time.Hour,
+		WaitlistRateLimit:    10,
+		GuestRateLimit:       10,
+		GuestTTL:             24 * time.Hour,
+	})
+
+	l := slog.New(slog.NewTextHandler(testWriter{t}, nil))
+	interceptors := []grpc.UnaryServerInterceptor{
+		authgrpc.UnaryLoggerInterceptor(l),
+		authgrpc.UnaryClientInfoInterceptor(nil),
+		authgrpc.UnaryRecoveryInterceptor(l),
+	}
+	authServer := grpc.NewServer(grpc.ChainUnaryInterceptor(interceptors...))
+	authpb.RegisterAuthServiceServer(authServer, authgrpc.NewService(a))
+	adminServer := grpc.NewServer(grpc.ChainUnaryInterceptor(append(interceptors, authgrpc.UnaryAdminAuthInterceptor(a))...))
+	authpb.RegisterAdminServiceServer(adminServer, authgrpc.NewAdminService(a))
+
+	return &testServer{
+		auth:  authpb.NewAuthServiceClient(serve(t, authServer)),
+		admin: authpb.NewAdminServiceClient(serve(t, adminServer)),
+		repo:  repo,
+	}
+}
+
+func serve(t *testing.T, server *grpc.Server) *grpc.ClientConn {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	go func() { _ = server.Serve(lis) }()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+type testWriter struct{ t *testing.T }
+
+func (w testWriter) Write(p []byte) (int, error) {
+	w.t.Log(string(p))
+	return len(p), nil
+}
+
+func (s *testServer) signUp(t *testing.T, email string) *authpb.TokenResponse {
+	t.Helper()
+	resp, err := s.auth.SignUp(context.Background(), signUpRequest(email))
+	if err != nil {
+		t.Fatalf("SignUp(%s): %v", email, err)
+	}
+	return resp
+}
+
+// signUpRequest signs up an adult living in Germany who accepts the current documents.
+func signUpRequest(email string) *authpb.SignUpRequest {
+	return &authpb.SignUpRequest{
+		Email:       email,
+		Password:    testPassword,
+		DateOfBirth: "1990-05-17",
+		Country:     "DE",
+		AcceptedDocuments: []*authpb.DocumentVersion{
+			{Document: domain.DocumentTerms, Version: "terms-1"},
+			{Document: domain.DocumentPrivacyPolicy, Version: "privacy-1"},
+		},
+	}
+}
+
+func withBearer(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+func TestAuthService_ErrorCodes(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	user := s.signUp(t, "user@example.com")
+	revoked := s.signUp(t, "revoked@example.com")
+	if _, err := s.auth.Logout(ctx, &authpb.LogoutRequest{AccessToken: revoked.AccessToken}); err != nil {
+		t.Fatal(err)
+	}
+	service, err := s.auth.IssueServiceToken(ctx, &authpb.IssueServiceTokenRequest{ClientId: testClientID, ClientSecret: testClientSecret})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		call func() error
+		want codes.Code
+	}{
+		{"sign up with existing email", func() error {
+			_, err := s.auth.SignUp(ctx, signUpRequest("user@example.com"))
+			return err
+		}, codes.AlreadyExists},
+		{"sign up with invalid email", func() error {
+			_, err := s.auth.SignUp(ctx, signUpRequest("user"))
+			return err
+		}, codes.InvalidArgument},
+		{"sign up with malformed date of birth", func() error {
+			_, err := s.auth.SignUp(ctx, &authpb.SignUpRequest{Email: "new@example.com", Password: testPassword, DateOfBirth: "17.05.1990", Country: "DE"})
+			return err
+		}, codes.InvalidArgument},
+		{"sign up underage", func() error {
+			dateOfBirth := time.Now().AddDate(-17, 0, 0).Format(time.DateOnly)
+			_, err := s.auth.SignUp(ctx, &authpb.SignUpRequest{Email: "new@example.com", Password: testPassword, DateOfBirth: dateOfBirth, Country: "DE"})
+			return err
+		}, codes.FailedPrecondition},
+		{"sign up without consent", func() error {
+			request := signUpRequest("new@example.com")
+			request.AcceptedDocuments = nil
+			_, err := s.auth.SignUp(ctx, request)
+			return err
+		}, codes.FailedPrecondition},
+		{"sign up with the token of a user as guest", func() error {
+			request := signUpRequest("new@example.com")
+			request.GuestToken = user.AccessToken
+			_, err := s.auth.SignUp(ctx, request)
+			return err
+		}, codes.FailedPrecondition},
+		{"accept outdated terms", func() error {
+			_, err := s.auth.AcceptTerms(ctx, &authpb.AcceptTermsRequest{
+				AccessToken: user.AccessToken,
+				Documents:   []*authpb.DocumentVersion{{Document: domain.DocumentTerms, Version: "terms-0"}},
+			})
+			return err
+		}, codes.InvalidArgument},
+		{"accept current terms", func() error {
+			resp, err := s.auth.AcceptTerms(ctx, &authpb.AcceptTermsRequest{
+				AccessToken: user.AccessToken,
+				Documents:   []*authpb.DocumentVersion{{Document: domain.DocumentTerms, Version: "terms-1"}},
+			})
+			if err == nil && len(resp.GetConsentRequired()) != 0 {
+				return fmt.Errorf("consent required for %v", resp.GetConsentRequired())
+			}
+			return err
+		}, codes.OK},
+		{"join closed waitlist", func() error {
+			_, err := s.auth.JoinWaitlist(ctx, &authpb.JoinWaitlistRequest{Email: "new@example.com"})
+			return err
+		}, codes.FailedPrecondition},
+		{"login", func() error {
+			_, err := s.auth.Login(ctx, &authpb.LoginRequest{Email: "user@example.com", Password: testPassword})
+			return err
+		}, codes.OK},
+		{"login of unknown user", func() error {
+			_, err := s.auth.Login(ctx, &authpb.LoginRequest{Email: "nobody@example.com", Password: testPassword})
+			return err
+		}, codes.NotFound},
+		{"login with wrong password", func() error {
+			_, err := s.auth.Login(ctx, &authpb.LoginRequest{Email: "user@example.com", Password: "wrong-password"})
+			return err
+		}, codes.Unauthenticated},
+		{"validate", func() error {
+			resp, err := s.auth.Validate(ctx, &authpb.ValidateRequest{AccessToken: user.AccessToken, Scope: "profile:read"})
+			if err == nil && !resp.GetAgeVerified() {
+				return errors.New("claims lack the age gate")
+			}
+			return err
+		}, codes.OK},
+		{"validate without scope", func() error {
+			_, err := s.auth.Validate(ctx, &authpb.ValidateRequest{AccessToken: user.AccessToken, Scope: domain.ScopeAdmin})
+			return err
+		}, codes.PermissionDenied},
+		{"validate refresh token", func() error {
+			_, err := s.auth.Validate(ctx, &authpb.ValidateRequest{AccessToken: user.RefreshToken})
+			return err
+		}, codes.Unauthenticated},
+		{"validate revoked token", func() error {
+			_, err := s.auth.Validate(ctx, &authpb.ValidateRequest{AccessToken: revoked.AccessToken})
+			return err
+		}, codes.Unauthenticated},
+		{"validate too many tokens", func() error {
+			_, err := s.auth.ValidateMany(ctx, &authpb.ValidateManyRequest{AccessTokens: make([]string, 101)})
+			return err
+		}, codes.InvalidArgument},
+		{"refresh revoked session", func() error {
+			_, err := s.auth.Refresh(ctx, &authpb.RefreshRequest{RefreshToken: revoked.RefreshToken})
+			return err
+		}, codes.Unauthenticated},
+		{"logout with service token", func() error {
+			_, err := s.auth.Logout(ctx, &authpb.LogoutRequest{AccessToken: service.AccessToken})
+			return err
+		}, codes.PermissionDenied},
+		{"issue service token with wrong secret", func() error {
+			_, err := s.auth.IssueServiceToken(ctx, &authpb.IssueServiceTokenRequest{ClientId: testClientID, ClientSecret: "guess"})
+			return err
+		}, codes.Unauthenticated},
+		{"issue service token with foreign scope", func() error {
+			_, err := s.auth.IssueServiceToken(ctx, &authpb.IssueServiceTokenRequest{ClientId: testClientID, ClientSecret: testClientSecret, Scope: "admin"})
+			return err
+		}, codes.InvalidArgument},
+		{"reset password with unknown token", func() error {
+			_, err := s.auth.ResetPassword(ctx, &authpb.ResetPasswordRequest{ResetToken: "unknown", NewPassword: "a-new-password"})
+			return err
+		}, codes.Unauthenticated},
+		{"delete account with wrong password", func() error {
+			_, err := s.auth.DeleteAccount(ctx, &authpb.DeleteAccountRequest{AccessToken: user.AccessToken, Password: "wrong-password"})
+			return err
+		}, codes.Unauthenticated},
+		{"admin call without token", func() error {
+			_, err := s.admin.GetUser(ctx, &authpb.GetUserRequest{Id: user.Id})
+			return err
+		}, codes.Unauthenticated},
+		{"admin call by regular user", func() error {
+			_, err := s.admin.GetUser(withBearer(user.AccessToken), &authpb.GetUserRequest{Id: user.Id})
+			return err
+		}, codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := status.Code(tt.call()); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthService_CreateGuest(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	guest, err := s.auth.CreateGuest(ctx, &authpb.CreateGuestRequest{DateOfBirth: "1990-05-17", Country: "DE"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := s.auth.Validate(ctx, &authpb.ValidateRequest{AccessToken: guest.AccessToken})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !claims.GetGuest() || claims.GetId() != guest.Id {
+		t.Errorf("claims = %v, want those of the guest", claims)
+	}
+
+	request := signUpRequest("guest@example.com")
+	request.GuestToken = guest.AccessToken
+	user, err := s.auth.SignUp(ctx, request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Id != guest.Id {
+		t.Errorf("signed up as %s, want the guest %s", user.Id, guest.Id)
+	}
+	claims, err = s.auth.Validate(ctx, &authpb.ValidateRequest{AccessToken: user.AccessToken})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.GetGuest() || claims.GetEmail() != "guest@example.com" {
+		t.Errorf("claims = %v, want those of the signed up user", claims)
+	}
+}
+
+func TestAuthService_SignUpIdempotency(t *testing.T) {
+	s := newTestServer(t)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "idempotency-key", "retry-1")
+	first, err := s.auth.SignUp(ctx, signUpRequest("user@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	retried, err := s.auth.SignUp(ctx, signUpRequest("user@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retried.Id != first.Id || retried.RefreshToken == first.RefreshToken {
+		t.Errorf("retry returned %v, want new tokens of %s", retried, first.Id)
+	}
+
+	_, err = s.auth.SignUp(ctx, signUpRequest("other@example.com"))
+	if got := status.Code(err); got != codes.FailedPrecondition {
+		t.Errorf("reusing the key got %s, want %s", got, codes.FailedPrecondition)
+	}
+}
+
+func TestAuthService_ListLoginHistory(t *testing.T) {
+	s := newTestServer(t)
+	token := s.signUp(t, "user@example.com")
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-device-id", "tablet", "user-agent", "Glimpse/2.1")
+	if _, err := s.auth.Login(ctx, &authpb.LoginRequest{Email: "user@example.com", Password: testPassword}); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := s.auth.ListLoginHistory(context.Background(), &authpb.ListLoginHistoryRequest{
+		AccessToken: token.AccessToken,
+		PageSize:    1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history.GetLogins()) != 1 || !history.GetLogins()[0].GetNewDevice() || history.GetNextPageToken() == "" {
+		t.Fatalf("history = %v, want the login from the new device and a next page", history)
+	}
+	history, err = s.auth.ListLoginHistory(context.Background(), &authpb.ListLoginHistoryRequest{
+		AccessToken: token.AccessToken,
+		PageToken:   history.GetNextPageToken(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history.GetLogins()) != 1 || history.GetLogins()[0].GetNewDevice() || history.GetNextPageToken() != "" {
+		t.Errorf("history = %v, want the sign-up only", history)
+	}
+
+	_, err = s.auth.ListLoginHistory(context.Background(), &authpb.ListLoginHistoryRequest{
+		AccessToken: token.AccessToken,
+		PageToken:   "page-2",
+	})
+	if got := status.Code(err); got != codes.InvalidArgument {
+		t.Errorf("invalid page token got %s, want %s", got, codes.InvalidArgument)
+	}
+}
+
+func TestAuthService_SessionLifecycle(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	token := s.signUp(t, "user@example.com")
+
+	user, err := s.auth.Validate(ctx, &authpb.ValidateRequest{AccessToken: token.AccessToken})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.GetId() != token.GetId() || user.GetEmail() != "user@example.com" || user.GetSessionId() == "" {
+		t.Errorf("validate = %v", user)
+	}
+	refreshed, err := s.auth.Refresh(ctx, &authpb.RefreshRequest{RefreshToken: token.RefreshToken})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.auth.Logout(ctx, &authpb.LogoutRequest{AccessToken: refreshed.AccessToken}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.auth.Validate(ctx, &authpb.ValidateRequest{AccessToken: refreshed.AccessToken})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("validate after logout: %v", err)
+	}
+}
+
+func TestAdminService_SetRoles(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	admin := s.signUp(t, "admin@example.com")
+	user := s.signUp(t, "user@example.com")
+	adminID := uuid.MustParse(admin.Id)
+	if err := s.repo.SetUserRoles(ctx, adminID, []string{domain.RoleAdmin}); err != nil {
+		t.Fatal(err)
+	}
+	adminCtx := withBearer(admin.AccessToken)
+
+	tests := []struct {
+		name  string
+		roles []string
+		want  codes.Code
+	}{
+		{"known roles", []string{domain.RolePremium, domain.RoleUser}, codes.OK},
+		{"unknown role", []string{"superuser"}, codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := s.admin.SetRoles(adminCtx, &authpb.SetRolesRequest{Id: user.Id, Roles: tt.roles})
+			if got := status.Code(err); got != tt.want {
+				t.Fatalf("got %s, want %s: %v", got, tt.want, err)
+			}
+			if tt.want == codes.OK && fmt.Sprint(resp.GetRoles()) != fmt.Sprint(tt.roles) {
+				t.Errorf("roles = %v, want %v", resp.GetRoles(), tt.roles)
+			}
+		})
+	}
+}
+
+func TestAdminService_RequiresAdmin(t *testing.T) {
+	s := newTestServer(t)
+	user := s.signUp(t, "user@example.com")
+
+	// A member must not grant themselves the admin role.
+	_, err := s.admin.SetRoles(withBearer(user.AccessToken), &authpb.SetRolesRequest{Id: user.Id, Roles: []string{domain.RoleAdmin}})
+	if got := status.Code(err); got != codes.PermissionDenied {
+		t.Fatalf("got %s, want %s: %v", got, codes.PermissionDenied, err)
+	}
+	roles, err := s.repo.GetUserRoles(context.Background(), uuid.MustParse(user.Id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slices.Contains(roles, domain.RoleAdmin) {
+		t.Errorf("roles = %v, the member became an admin", roles)
+	}
+}
+
+func TestAdminService_SearchUsers(t *testing.T) {
+	s := newTestServer(t)
+	admin := s.signUp(t, "admin@example.com")
+	if err := s.repo.SetUserRoles(context.Background(), uuid.MustParse(admin.Id), []string{domain.RoleAdmin}); err != nil {
+		t.Fatal(err)
+	}
+	adminCtx := withBearer(admin.AccessToken)
+	for _, email := range []string{"anna@example.com", "anton@example.com", "antonia@example.com"} {
+		s.signUp(t, email)
+	}
+
+	// The page token carries the position on to the next page.
+	var emails []string
+	request := &authpb.SearchUsersRequest{EmailPrefix: "an", PageSize: 2}
+	for {
+		resp, err := s.admin.SearchUsers(adminCtx, request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, u := range resp.GetUsers() {
+			emails = append(emails, u.GetEmail())
+		}
+		if resp.GetNextPageToken() == "" {
+			break
+		}
+		request.PageToken = resp.GetNextPageToken()
+	}
+	if want := []string{"anna@example.com", "anton@example.com", "antonia@example.com"}; !slices.Equal(emails, want) {
+		t.Errorf("emails = %v, want %v", emails, want)
+	}
+
+	_, err := s.admin.SearchUsers(adminCtx, &authpb.SearchUsersRequest{PageToken: "short"})
+	if got := status.Code(err); got != codes.InvalidArgument {
+		t.Errorf("got %s for an invalid page token, want %s: %v", got, codes.InvalidArgument, err)
+	}
+}
+
+func TestAdminService_CreateInviteCodes(t *testing.T) {
+	s := newTestServer(t)
+	admin := s.signUp(t, "admin@example.com")
+	if err := s.repo.SetUserRoles(context.Background(), uuid.MustParse(admin.Id), []string{domain.RoleAdmin}); err != nil {
+		t.Fatal(err)
+	}
+	adminCtx := withBearer(admin.AccessToken)
+
+	tests := []struct {
+		name    string
+		request *authpb.CreateInviteCodesRequest
+		want    codes.Code
+	}{
+		{"batch", &authpb.CreateInviteCodesRequest{Count: 3, MaxUses: 5, ExpiresAt: timestamppb.New(time.Now().Add(time.Hour))}, codes.OK},
+		{"batch too large", &authpb.CreateInviteCodesRequest{Count: 101}, codes.InvalidArgument},
+		{"expired", &authpb.CreateInviteCodesRequest{Count: 1, ExpiresAt: timestamppb.New(time.Now().Add(-time.Hour))}, codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := s.admin.CreateInviteCodes(adminCtx, tt.request)
+			if got := status.Code(err); got != tt.want {
+				t.Fatalf("got %s, want %s: %v", got, tt.want, err)
+			}
+			if tt.want != codes.OK {
+				return
+			}
+			if len(resp.GetCodes()) != int(tt.request.GetCount()) {
+				t.Fatalf("got %d codes, want %d", len(resp.GetCodes()), tt.request.GetCount())
+			}
+			for _, code := range resp.GetCodes() {
+				if code.GetCode() == "" || code.GetMaxUses() != tt.request.GetMaxUses() || !code.GetExpiresAt().AsTime().Equal(tt.request.GetExpiresAt().AsTime()) {
+					t.Errorf("code = %v, want one matching %v", code, tt.request)
+				}
+			}
+		})
+	}
+}
+
+func TestAdminService_BanUser(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	admin := s.signUp(t, "admin@example.com")
+	user := s.signUp(t, "user@example.com")
+	if err := s.repo.SetUserRoles(ctx, uuid.MustParse(admin.Id), []string{domain.RoleAdmin}); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := s.admin.BanUser(withBearer(admin.AccessToken), &authpb.ModerationRequest{Id: user.Id, Reason: "romance scam"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.GetStatus() != string(domain.StatusBanned) || resp.GetStatusActorId() != admin.Id {
+		t.Errorf("status = %s by %s, want banned by the admin", resp.GetStatus(), resp.GetStatusActorId())
+	}
+
+	tests := []struct {
+		name       string
+		call       func() error
+		wantReason string
+	}{
+		{"login", func() error {
+			_, err := s.auth.Login(ctx, &authpb.LoginRequest{Email: "user@example.com", Password: testPassword})
+			return err
+		}, "ACCOUNT_BANNED"},
+		{"sign up again", func() error {
+			_, err := s.auth.SignUp(ctx, signUpRequest("User@Example.com"))
+			return err
+		}, "IDENTIFIER_BANNED"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := status.Convert(tt.call())
+			if st.Code() != codes.PermissionDenied {
+				t.Fatalf("got %s, want %s: %v", st.Code(), codes.PermissionDenied, st.Err())
+			}
+			var reason string
+			for _, d := range st.Details() {
+				if info, ok := d.(*errdetails.ErrorInfo); ok {
+					reason = info.GetReason()
+				}
+			}
+			if reason != tt.wantReason {
+				t.Errorf("reason = %q, want %q", reason, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestGetErrorCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want codes.Code
+	}{
+		{validator.ValidationErrors{}, codes.InvalidArgument},
+		{domain.ErrUnknownRole, codes.InvalidArgument},
+		{domain.ErrBatchTooLarge, codes.InvalidArgument},
+		{domain.ErrInvalidScope, codes.InvalidArgument},
+		{domain.ErrUserNotFound, codes.NotFound},
+		{domain.ErrAlreadyExists, codes.AlreadyExists},
+		{domain.ErrUserDisabled, codes.PermissionDenied},
+		{domain.ErrAccountBanned, codes.PermissionDenied},
+		{domain.ErrMissingReason, codes.InvalidArgument},
+		{domain.ErrInvalidDateOfBirth, codes.InvalidArgument},
+		{domain.ErrUnderage, codes.FailedPrecondition},
+		{domain.ErrConsentRequired, codes.FailedPrecondition},
+		{domain.ErrInviteRequired, codes.FailedPrecondition},
+		{domain.ErrInvalidInviteCode, codes.FailedPrecondition},
+		{domain.ErrWaitlistClosed, codes.FailedPrecondition},
+		{domain.ErrRateLimited, codes.ResourceExhausted},
+		{domain.ErrNotGuest, codes.FailedPrecondition},
+		{domain.ErrIdempotencyKeyReused, codes.FailedPrecondition},
+		{domain.ErrInvalidIdempotencyKey, codes.InvalidArgument},
+		{domain.ErrInsufficientScope, codes.PermissionDenied},
+		{domain.ErrServiceToken, codes.PermissionDenied},
+		{domain.ErrPasswordResetNeeded, codes.FailedPrecondition},
+		{domain.ErrInvalidToken, codes.Unauthenticated},
+		{domain.ErrExpiredToken, codes.Unauthenticated},
+		{domain.ErrSessionRevoked, codes.Unauthenticated},
+		{domain.ErrRefreshTokenReused, codes.Unauthenticated},
+		{domain.ErrInvalidClient, codes.Unauthenticated},
+		{domain.ErrConcurrentUpdate, codes.Aborted},
+		{fmt.Errorf("failed to signup: %w", domain.ErrAlreadyExists), codes.AlreadyExists},
+		{errors.New("connection refused"), codes.Internal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			if got := authgrpc.GetErrorCode(tt.err); got != tt.want {
+				t.Errorf("GetErrorCode(%v) = %s, want %s", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnaryClientInfoInterceptor(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	tests := []struct {
+		name   string
+		peer   string
+		header []string
+		want   string
+	}{
+		{"direct", "203.0.113.7:5000", nil, "203.0.113.7"},
+		{"forged by an untrusted peer", "203.0.113.7:5000", []string{"x-forwarded-for", "198.51.100.1"}, "203.0.113.7"},
+		{"forwarded by a trusted proxy", "10.0.0.2:5000", []string{"x-forwarded-for", "198.51.100.1"}, "198.51.100.1"},
+		{"chain of trusted proxies", "10.0.0.2:5000", []string{"x-forwarded-for", "192.0.2.9, 198.51.100.1, 10.0.0.3"}, "198.51.100.1"},
+		{"real ip of a trusted proxy", "10.0.0.2:5000", []string{"x-real-ip", "198.51.100.1"}, "198.51.100.1"},
+		{"trusted proxy without headers", "10.0.0.2:5000", nil, "10.0.0.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: net.TCPAddrFromAddrPort(netip.MustParseAddrPort(tt.peer))})
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(tt.header...))
+			var got domain.ClientInfo
+			_, err := authgrpc.UnaryClientInfoInterceptor(trusted)(ctx, nil, &grpc.UnaryServerInfo{},
+				func(ctx context.Context, _ interface{}) (interface{}, error) {
+					got = app.ClientInfoFromContext(ctx)
+					return nil, nil
+				})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.IP != tt.want {
+				t.Errorf("IP = %s, want %s", got.IP, tt.want)
+			}
+		})
+	}
+}
@@ -4,25 +4,72 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"github.com/labstack/echo/v4"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/netip"
 	"time"
 
+	"github.com/labstack/echo/v4"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/soulmate-dating/auth/internal/app"
 )
 
-func NewServer(addr string) *http.Server {
+// NewServer serves the OAuth token endpoint and the JWKS. Forwarded client
+// addresses are only honoured from trustedProxies.
+func NewServer(addr string, a app.App, trustedProxies []netip.Prefix) *http.Server {
+	server := echo.New()
+	server.IPExtractor = ipExtractor(trustedProxies)
+	routeAPI(server, a)
+	return &http.Server{Addr: addr, Handler: server}
+}
+
+// NewMetricsServer serves the Prometheus metrics. If a is not nil, it also
+// serves the routes of NewServer.
+func NewMetricsServer(addr string, a app.App, trustedProxies []netip.Prefix) *http.Server {
 	server := echo.New()
-	s := &http.Server{Addr: addr, Handler: server}
+	server.IPExtractor = ipExtractor(trustedProxies)
 	server.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
-	return s
+	if a != nil {
+		routeAPI(server, a)
+	}
+	return &http.Server{Addr: addr, Handler: server}
+}
+
+// ipExtractor locates callers by their connection unless it comes from a
+// trusted proxy, like the gRPC API. Then the client is the last address of
+// X-Forwarded-For not of a trusted proxy, or X-Real-IP. Unlike the defaults
+// of echo, private networks are not trusted.
+func ipExtractor(trustedProxies []netip.Prefix) echo.IPExtractor {
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, prefix := range trustedProxies {
+		options = append(options, echo.TrustIPRange(&net.IPNet{
+			IP:   prefix.Addr().AsSlice(),
+			Mask: net.CIDRMask(prefix.Bits(), prefix.Addr().BitLen()),
+		}))
+	}
+	forwardedFor, realIP := echo.ExtractIPFromXFFHeader(options...), echo.ExtractIPFromRealIPHeader(options...)
+	return func(r *http.Request) string {
+		if r.Header.Get(echo.HeaderXForwardedFor) != "" {
+			return forwardedFor(r)
+		}
+		return realIP(r)
+	}
+}
+
+func routeAPI(server *echo.Echo, a app.App) {
+	server.POST("/oauth/token", tokenHandler(a))
+	server.GET("/.well-known/jwks.json", func(c echo.Context) error {
+		c.Response().Header().Set("Cache-Control", "public, max-age=300")
+		return c.JSON(http.StatusOK, a.VerificationKeys())
+	})
 }
 
 func RunServer(ctx context.Context, server *http.Server) func() error {
 	return func() error {
-		log.Printf("starting http server, listening on %s\n", server.Addr)
-		defer log.Printf("close http server listening on %s\n", server.Addr)
+		slog.Info("starting http server", slog.String("address", server.Addr))
+		defer slog.Info("close http server", slog.String("address", server.Addr))
 
 		errCh := make(chan error)
 
@@ -31,14 +78,19 @@ func RunServer(ctx context.Context, server *http.Server) func() error {
 			defer cancel()
 
 			if err := server.Shutdown(shCtx); err != nil {
-				log.Printf("can't close http server listening on %s: %s", server.Addr, err.Error())
+				slog.Error("can't close http server", slog.String("address", server.Addr), slog.Any("error", err))
 			}
 
 			close(errCh)
 		}()
 
 		go func() {
-			if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			serve := server.ListenAndServe
+			if server.TLSConfig != nil {
+				// The certificate comes from TLSConfig.GetCertificate.
+				serve = func() error { return server.ListenAndServeTLS("", "") }
+			}
+			if err := serve(); !errors.Is(err, http.ErrServerClosed) {
 				errCh <- err
 			}
 		}()
@@ -0,0 +1,38 @@
+package http
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestIPExtractor(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	tests := []struct {
+		name   string
+		peer   string
+		header []string
+		want   string
+	}{
+		{"direct", "203.0.113.7:5000", nil, "203.0.113.7"},
+		{"forged by an untrusted peer", "203.0.113.7:5000", []string{"X-Forwarded-For", "198.51.100.1"}, "203.0.113.7"},
+		{"real ip forged by an untrusted peer", "203.0.113.7:5000", []string{"X-Real-Ip", "198.51.100.1"}, "203.0.113.7"},
+		{"untrusted private peer", "192.168.1.5:5000", []string{"X-Forwarded-For", "198.51.100.1"}, "192.168.1.5"},
+		{"forwarded by a trusted proxy", "10.0.0.2:5000", []string{"X-Forwarded-For", "198.51.100.1"}, "198.51.100.1"},
+		{"chain of trusted proxies", "10.0.0.2:5000", []string{"X-Forwarded-For", "192.0.2.9, 198.51.100.1, 10.0.0.3"}, "198.51.100.1"},
+		{"real ip of a trusted proxy", "10.0.0.2:5000", []string{"X-Real-Ip", "198.51.100.1"}, "198.51.100.1"},
+		{"trusted proxy without headers", "10.0.0.2:5000", nil, "10.0.0.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/oauth/token", nil)
+			r.RemoteAddr = tt.peer
+			for i := 0; i+1 < len(tt.header); i += 2 {
+				r.Header.Set(tt.header[i], tt.header[i+1])
+			}
+			if got := ipExtractor(trusted)(r); got != tt.want {
+				t.Errorf("IP = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
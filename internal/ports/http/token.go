@@ -0,0 +1,73 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/soulmate-dating/auth/internal/app"
+	"github.com/soulmate-dating/auth/internal/domain"
+)
+
+const grantTypeClientCredentials = "client_credentials"
+
+// tokenResponse and tokenError are the bodies defined by RFC 6749 sections 5.1 and 5.2.
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope,omitempty"`
+}
+
+type tokenError struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+// tokenHandler serves the OAuth2 token endpoint. Only the client_credentials
+// grant is supported; clients authenticate with HTTP Basic or with
+// client_id and client_secret form parameters.
+func tokenHandler(a app.App) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		c.Response().Header().Set("Cache-Control", "no-store")
+		if grant := c.FormValue("grant_type"); grant != grantTypeClientCredentials {
+			return c.JSON(http.StatusBadRequest, tokenError{
+				Error:       "unsupported_grant_type",
+				Description: "only the client_credentials grant is supported",
+			})
+		}
+		clientID, clientSecret, basic := c.Request().BasicAuth()
+		if !basic {
+			clientID, clientSecret = c.FormValue("client_id"), c.FormValue("client_secret")
+		}
+
+		ctx := app.WithClientInfo(c.Request().Context(), domain.ClientInfo{
+			IP:        c.RealIP(),
+			UserAgent: c.Request().UserAgent(),
+		})
+		token, err := a.IssueServiceToken(ctx, domain.ClientCredentials{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			Scopes:       strings.Fields(c.FormValue("scope")),
+		})
+		switch {
+		case errors.Is(err, domain.ErrInvalidClient):
+			if basic {
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Basic realm="token"`)
+			}
+			return c.JSON(http.StatusUnauthorized, tokenError{Error: "invalid_client"})
+		case errors.Is(err, domain.ErrInvalidScope):
+			return c.JSON(http.StatusBadRequest, tokenError{Error: "invalid_scope", Description: err.Error()})
+		case err != nil:
+			return err
+		}
+		return c.JSON(http.StatusOK, tokenResponse{
+			AccessToken: token.AccessToken,
+			TokenType:   "Bearer",
+			ExpiresIn:   int64(token.ExpiresIn.Seconds()),
+			Scope:       strings.Join(token.Scopes, " "),
+		})
+	}
+}
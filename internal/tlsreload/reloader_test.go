@@ -0,0 +1,300 @@
+package tlsreload
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/soulmate-dating/auth/internal/config"
+)
+
+// issuer signs test certificates, or itself if it is the CA.
+type issuer struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+var serial int64
+
+func newCert(t *testing.T, parent *issuer, name string, usage x509.ExtKeyUsage) *issuer {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial++
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{usage}
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &issuer{cert: cert, key: key}
+}
+
+func newCA(t *testing.T, name string) *issuer {
+	t.Helper()
+	return newCert(t, nil, name, 0)
+}
+
+func (i *issuer) certPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: i.cert.Raw})
+}
+
+func (i *issuer) keyPEM(t *testing.T) []byte {
+	t.Helper()
+	der, err := x509.MarshalECPrivateKey(i.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+func (i *issuer) tlsCert() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{i.cert.Raw}, PrivateKey: i.key}
+}
+
+// writeFile writes data to path with a modification time that changes on every call.
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	serial++
+	modTime := time.Now().Add(time.Duration(serial) * time.Second)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type testFiles struct {
+	cfg config.TLS
+}
+
+func newTestFiles(t *testing.T, server *issuer, clientCA *issuer) testFiles {
+	t.Helper()
+	dir := t.TempDir()
+	f := testFiles{cfg: config.TLS{
+		CertFile:       filepath.Join(dir, "tls.crt"),
+		KeyFile:        filepath.Join(dir, "tls.key"),
+		ReloadInterval: 10 * time.Millisecond,
+	}}
+	f.writeServer(t, server)
+	if clientCA != nil {
+		f.cfg.ClientCAFile = filepath.Join(dir, "ca.crt")
+		f.writeClientCA(t, clientCA)
+	}
+	return f
+}
+
+func (f testFiles) writeServer(t *testing.T, server *issuer) {
+	writeFile(t, f.cfg.CertFile, server.certPEM())
+	writeFile(t, f.cfg.KeyFile, server.keyPEM(t))
+}
+
+func (f testFiles) writeClientCA(t *testing.T, ca *issuer) {
+	writeFile(t, f.cfg.ClientCAFile, ca.certPEM())
+}
+
+// handshake connects a client presenting clientCert to a server using cfg and
+// returns the certificate the server presented.
+func handshake(t *testing.T, cfg *tls.Config, serverCA *issuer, clientCert *tls.Certificate) (*x509.Certificate, error) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		defer conn.Close()
+		// Reading lets the server see the alert of a client rejecting it.
+		serverConn := tls.Server(conn, cfg)
+		err = serverConn.Handshake()
+		if err == nil {
+			_, err = serverConn.Read(make([]byte, 1))
+		}
+		serverErr <- err
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(serverCA.cert)
+	clientCfg := &tls.Config{RootCAs: roots, ServerName: "localhost"}
+	if clientCert != nil {
+		clientCfg.Certificates = []tls.Certificate{*clientCert}
+	}
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second}, "tcp", lis.Addr().String(), clientCfg)
+	if err != nil {
+		return nil, err
+	}
+	// The server verifies the client after the client finished its handshake
+	// in TLS 1.3, so wait for its verdict.
+	defer conn.Close()
+	if _, err := conn.Write([]byte{0}); err != nil {
+		return nil, err
+	}
+	if err := <-serverErr; err != nil {
+		return nil, err
+	}
+	return conn.ConnectionState().PeerCertificates[0], nil
+}
+
+func TestNew_Disabled(t *testing.T) {
+	r, err := New(config.TLS{})
+	if r != nil || err != nil {
+		t.Fatalf("New() = %v, %v, want nil, nil", r, err)
+	}
+}
+
+func TestNew_InvalidFiles(t *testing.T) {
+	ca := newCA(t, "ca")
+	f := newTestFiles(t, newCert(t, ca, "server", x509.ExtKeyUsageServerAuth), ca)
+	writeFile(t, f.cfg.ClientCAFile, []byte("not a certificate"))
+	if _, err := New(f.cfg); err == nil {
+		t.Error("New() accepted a client ca without certificates")
+	}
+	f.cfg.KeyFile += ".missing"
+	if _, err := New(f.cfg); err == nil {
+		t.Error("New() accepted a missing key")
+	}
+}
+
+func TestReloader_ReloadsCertificate(t *testing.T) {
+	ca := newCA(t, "ca")
+	first, second := newCert(t, ca, "first", x509.ExtKeyUsageServerAuth), newCert(t, ca, "second", x509.ExtKeyUsageServerAuth)
+	f := newTestFiles(t, first, nil)
+	r, err := New(f.cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := r.Config()
+	if cfg.ClientAuth != tls.NoClientCert {
+		t.Errorf("ClientAuth = %v without a client ca", cfg.ClientAuth)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- r.Run(ctx) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Run() error = %v", err)
+		}
+	}()
+
+	presented := func() string {
+		t.Helper()
+		cert, err := handshake(t, cfg, ca, nil)
+		if err != nil {
+			t.Fatalf("handshake: %v", err)
+		}
+		return cert.Subject.CommonName
+	}
+	waitFor := func(want string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for got := presented(); got != want; got = presented() {
+			if time.Now().After(deadline) {
+				t.Fatalf("server presents %s, want %s", got, want)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	if got := presented(); got != "first" {
+		t.Fatalf("server presents %s, want first", got)
+	}
+	f.writeServer(t, second)
+	waitFor("second")
+
+	// A broken key keeps the previous certificate until the files are fixed.
+	writeFile(t, f.cfg.KeyFile, []byte("broken"))
+	time.Sleep(50 * time.Millisecond)
+	if got := presented(); got != "second" {
+		t.Errorf("server presents %s after a failed reload, want second", got)
+	}
+	f.writeServer(t, first)
+	waitFor("first")
+}
+
+func TestReloader_VerifiesClients(t *testing.T) {
+	ca, otherCA := newCA(t, "ca"), newCA(t, "other ca")
+	server := newCert(t, ca, "server", x509.ExtKeyUsageServerAuth)
+	client := newCert(t, ca, "client", x509.ExtKeyUsageClientAuth).tlsCert()
+	otherClient := newCert(t, otherCA, "other client", x509.ExtKeyUsageClientAuth).tlsCert()
+	serverCertAsClient := server.tlsCert()
+	f := newTestFiles(t, server, ca)
+	r, err := New(f.cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := r.Config()
+
+	tests := []struct {
+		name    string
+		cert    *tls.Certificate
+		wantErr bool
+	}{
+		{name: "issued by the client ca", cert: &client},
+		{name: "no certificate", wantErr: true},
+		{name: "issued by another ca", cert: &otherClient, wantErr: true},
+		{name: "not for client auth", cert: &serverCertAsClient, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := handshake(t, cfg, ca, tt.cert); (err != nil) != tt.wantErr {
+				t.Errorf("handshake error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("client ca reloaded", func(t *testing.T) {
+		f.writeClientCA(t, otherCA)
+		if !r.changed() {
+			t.Fatal("the new client ca is not noticed")
+		}
+		if err := r.load(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := handshake(t, cfg, ca, &client); err == nil {
+			t.Error("client of the replaced ca is accepted")
+		}
+		if _, err := handshake(t, cfg, ca, &otherClient); err != nil {
+			t.Errorf("client of the new ca is rejected: %v", err)
+		}
+	})
+}
@@ -0,0 +1,231 @@
+// Package authclient lets services authenticate callers with access tokens
+// issued by the auth service.
+//
+// Access tokens signed with an RSA key are verified locally with the public
+// keys published by the auth service, which are cached and refreshed when an
+// unknown key ID shows up. Local verification cannot notice that a session was
+// revoked, the account suspended or banned, or its claims outdated, so it is
+// only trusted for tokens issued within Config.MaxLocalAge. Older tokens, and
+// tokens that cannot be verified locally, are checked with the Validate RPC,
+// which knows about all of that. Set Config.RemoteOnly where even MaxLocalAge
+// of staleness is too much.
+package authclient
+
+import (
+	"context"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/soulmate-dating/auth/internal/adapters/jwt"
+	"github.com/soulmate-dating/auth/internal/domain"
+	"github.com/soulmate-dating/auth/pkg/authpb"
+)
+
+const (
+	defaultLeeway      = 30 * time.Second
+	defaultKeyTTL      = 10 * time.Minute
+	defaultMaxLocalAge = 5 * time.Minute
+)
+
+// ErrInvalidToken is returned for tokens that are malformed, forged, expired,
+// revoked or lack the required scope.
+var ErrInvalidToken = errors.New("invalid access token")
+
+type Config struct {
+	// Issuer and Audience must match JWT_ISSUER and JWT_AUDIENCE of the auth service.
+	Issuer   string
+	Audience string
+	// Leeway is the tolerated clock skew, 30s by default.
+	Leeway time.Duration
+	// KeyTTL is how long verification keys are cached, 10m by default.
+	KeyTTL time.Duration
+	// MaxLocalAge bounds how long after its issue a token is verified
+	// locally, and so how long a revoked token may still be accepted. Older
+	// tokens are checked with the Validate RPC. It is 5m by default.
+	MaxLocalAge time.Duration
+	// RemoteOnly disables local verification, so that every token is checked
+	// with the Validate RPC.
+	RemoteOnly bool
+}
+
+// Claims describes the user or service client an access token was issued to.
+type Claims struct {
+	Subject string
+	// UserID is zero for service tokens.
+	UserID uuid.UUID
+	// ClientID is only set for service tokens.
+	ClientID  string
+	Email     string
+	SessionID uuid.UUID
+	Roles     []string
+	Scopes    []string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	// AgeVerified tells the user passed the age gate at sign-up.
+	AgeVerified bool
+	// EmailVerified tells the user proved to receive mail at Email.
+	EmailVerified bool
+	// Guest tells the user has not signed up yet.
+	Guest bool
+}
+
+func (c *Claims) IsService() bool {
+	return c.ClientID != ""
+}
+
+func (c *Claims) HasScope(scope string) bool {
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type Client struct {
+	rpc         authpb.AuthServiceClient
+	verifier    *jwt.Verifier
+	keys        *keyCache
+	maxLocalAge time.Duration
+	remoteOnly  bool
+	now         func() time.Time
+}
+
+// New creates a client talking to the auth service over conn.
+func New(conn grpc.ClientConnInterface, cfg Config) *Client {
+	if cfg.Leeway == 0 {
+		cfg.Leeway = defaultLeeway
+	}
+	if cfg.KeyTTL == 0 {
+		cfg.KeyTTL = defaultKeyTTL
+	}
+	if cfg.MaxLocalAge == 0 {
+		cfg.MaxLocalAge = defaultMaxLocalAge
+	}
+	c := &Client{
+		rpc:         authpb.NewAuthServiceClient(conn),
+		verifier:    jwt.NewVerifier(cfg.Issuer, cfg.Audience, cfg.Leeway),
+		maxLocalAge: cfg.MaxLocalAge,
+		remoteOnly:  cfg.RemoteOnly,
+		now:         time.Now,
+	}
+	c.keys = newKeyCache(c.fetchKeys, cfg.KeyTTL)
+	return c
+}
+
+// Verify authenticates the access token. If scope is not empty, the token
+// must also grant it.
+func (c *Client) Verify(ctx context.Context, token, scope string) (*Claims, error) {
+	if !c.remoteOnly {
+		claims, err := c.verifyLocally(ctx, token)
+		switch {
+		case err == nil && c.now().Sub(claims.IssuedAt) <= c.maxLocalAge:
+			if scope != "" && !claims.HasScope(scope) {
+				return nil, fmt.Errorf("%w: missing scope %s", ErrInvalidToken, scope)
+			}
+			return claims, nil
+		case err != nil && !errors.Is(err, jwt.ErrUnknownKey):
+			return nil, err
+		}
+	}
+	return c.verifyRemotely(ctx, token, scope)
+}
+
+func (c *Client) verifyLocally(ctx context.Context, token string) (*Claims, error) {
+	claims, err := c.verifier.VerifyAccessToken(token, func(kid string) (*rsa.PublicKey, error) {
+		return c.keys.get(ctx, kid)
+	})
+	if err != nil {
+		if errors.Is(err, jwt.ErrUnknownKey) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	return fromDomainClaims(claims), nil
+}
+
+func (c *Client) verifyRemotely(ctx context.Context, token, scope string) (*Claims, error) {
+	response, err := c.rpc.Validate(ctx, &authpb.ValidateRequest{AccessToken: token, Scope: scope})
+	if err != nil {
+		switch status.Code(err) {
+		case codes.Unauthenticated, codes.PermissionDenied, codes.InvalidArgument:
+			return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+		}
+		return nil, fmt.Errorf("validate token: %w", err)
+	}
+	return fromUserResponse(response)
+}
+
+func (c *Client) fetchKeys(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	response, err := c.rpc.GetVerificationKeys(ctx, &authpb.GetVerificationKeysRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("get verification keys: %w", err)
+	}
+	keys := make(map[string]*rsa.PublicKey, len(response.GetKeys()))
+	for _, k := range response.GetKeys() {
+		key, err := jwt.JWK{
+			Kty: k.GetKty(),
+			Use: k.GetUse(),
+			Alg: k.GetAlg(),
+			Kid: k.GetKid(),
+			N:   k.GetN(),
+			E:   k.GetE(),
+		}.PublicKey()
+		if err != nil {
+			return nil, fmt.Errorf("parse key %s: %w", k.GetKid(), err)
+		}
+		keys[k.GetKid()] = key
+	}
+	return keys, nil
+}
+
+func fromDomainClaims(c *domain.Claims) *Claims {
+	return &Claims{
+		Subject:       c.Subject,
+		UserID:        c.UserID,
+		ClientID:      c.ClientID,
+		Email:         c.Email,
+		SessionID:     c.SessionId,
+		Roles:         c.Roles,
+		Scopes:        c.Scopes(),
+		IssuedAt:      time.Unix(c.IssuedAt, 0),
+		ExpiresAt:     time.Unix(c.ExpiresAt, 0),
+		AgeVerified:   c.AgeVerified,
+		EmailVerified: c.EmailVerified,
+		Guest:         c.Guest,
+	}
+}
+
+func fromUserResponse(r *authpb.UserResponse) (*Claims, error) {
+	claims := &Claims{
+		Subject:       r.GetSubject(),
+		ClientID:      r.GetClientId(),
+		Email:         r.GetEmail(),
+		Roles:         r.GetRoles(),
+		Scopes:        r.GetScopes(),
+		IssuedAt:      r.GetIssuedAt().AsTime(),
+		ExpiresAt:     r.GetExpiresAt().AsTime(),
+		AgeVerified:   r.GetAgeVerified(),
+		EmailVerified: r.GetEmailVerified(),
+		Guest:         r.GetGuest(),
+	}
+	var err error
+	if r.GetId() != "" {
+		if claims.UserID, err = uuid.Parse(r.GetId()); err != nil {
+			return nil, fmt.Errorf("parse user id: %w", err)
+		}
+	}
+	if r.GetSessionId() != "" {
+		if claims.SessionID, err = uuid.Parse(r.GetSessionId()); err != nil {
+			return nil, fmt.Errorf("parse session id: %w", err)
+		}
+	}
+	return claims, nil
+}
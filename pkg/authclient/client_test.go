@@ -0,0 +1,238 @@
+package authclient
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/soulmate-dating/auth/internal/adapters/jwt"
+	"github.com/soulmate-dating/auth/internal/adapters/memory"
+	"github.com/soulmate-dating/auth/internal/app"
+	"github.com/soulmate-dating/auth/internal/config"
+	"github.com/soulmate-dating/auth/internal/domain"
+	authgrpc "github.com/soulmate-dating/auth/internal/ports/grpc"
+	"github.com/soulmate-dating/auth/pkg/authpb"
+)
+
+const (
+	testIssuer   = "auth-test"
+	testAudience = "api-test"
+)
+
+// testAuthService serves the RPCs the client calls with the service of an
+// in-memory Application, which can be replaced to rotate its key.
+type testAuthService struct {
+	authpb.UnimplementedAuthServiceServer
+
+	mu          sync.Mutex
+	service     authpb.AuthServiceServer
+	validations int
+	keyFetches  int
+}
+
+func (s *testAuthService) use(a *app.Application) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.service = authgrpc.NewService(a)
+}
+
+func (s *testAuthService) Validate(ctx context.Context, request *authpb.ValidateRequest) (*authpb.UserResponse, error) {
+	s.mu.Lock()
+	s.validations++
+	service := s.service
+	s.mu.Unlock()
+	return service.Validate(ctx, request)
+}
+
+func (s *testAuthService) GetVerificationKeys(ctx context.Context, request *authpb.GetVerificationKeysRequest) (*authpb.VerificationKeysResponse, error) {
+	s.mu.Lock()
+	s.keyFetches++
+	service := s.service
+	s.mu.Unlock()
+	return service.GetVerificationKeys(ctx, request)
+}
+
+func (s *testAuthService) calls() (validations, keyFetches int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.validations, s.keyFetches
+}
+
+func newTestApp(repo *memory.Repo, key *rsa.PrivateKey, previous ...*rsa.PublicKey) *app.Application {
+	return app.NewWithDependencies(app.Dependencies{
+		Repository: repo,
+		Sessions:   repo,
+		Clients:    repo,
+		Outbox:     repo,
+		AuditLog:   repo,
+		Logins:     repo,
+		TxManager:  repo,
+		JWT: jwt.NewWrapper(jwt.Config{
+			Issuer:                      testIssuer,
+			Audience:                    testAudience,
+			SecretKey:                   "access-secret-for-tests-only-0123456789",
+			RefreshSecretKey:            "refresh-secret-for-tests-only-0123456789",
+			AccessTokenExpiration:       time.Hour,
+			RefreshTokenExpiration:      24 * time.Hour,
+			ServiceTokenExpiration:      time.Minute,
+			GuestAccessTokenExpiration:  time.Minute,
+			GuestRefreshTokenExpiration: time.Hour,
+			AccessKey:                   key,
+			PreviousAccessKeys:          previous,
+		}),
+	}, config.Account{
+		DeletionGracePeriod:  time.Hour,
+		PurgeInterval:        time.Hour,
+		PasswordResetTTL:     time.Hour,
+		EmailChangeCodeTTL:   time.Hour,
+		EmailChangeRevertTTL: time.Hour,
+		MinimumAge:           18,
+		AgePolicyVersion:     "test-1",
+		TermsVersion:         "terms-1",
+		PrivacyPolicyVersion: "privacy-1",
+		RegistrationMode:     "open",
+		WaitlistInviteTTL:    time.Hour,
+		IdempotencyKeyTTL:    time.Hour,
+		RateLimitWindow:      time.Hour,
+		WaitlistRateLimit:    10,
+		GuestRateLimit:       10,
+		GuestTTL:             24 * time.Hour,
+	})
+}
+
+func newTestKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// dial serves service over bufconn and returns a connection to it.
+func dial(t *testing.T, service authpb.AuthServiceServer) *grpc.ClientConn {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	authpb.RegisterAuthServiceServer(server, service)
+	go func() { _ = server.Serve(lis) }()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func signUp(t *testing.T, a *app.Application, email string) *domain.Token {
+	t.Helper()
+	token, err := a.SignUp(context.Background(), domain.Registration{
+		LoginCredentials: domain.LoginCredentials{Email: email, Password: "correct-horse-battery"},
+		DateOfBirth:      time.Date(1990, time.May, 17, 0, 0, 0, 0, time.UTC),
+		Country:          "DE",
+		Accepted: []domain.DocumentVersion{
+			{Document: domain.DocumentTerms, Version: "terms-1"},
+			{Document: domain.DocumentPrivacyPolicy, Version: "privacy-1"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestClient_Verify(t *testing.T) {
+	tests := []struct {
+		name            string
+		cfg             Config
+		age             time.Duration
+		logout          bool
+		scope           string
+		wantErr         error
+		wantValidations int
+	}{
+		{name: "fresh token is verified locally"},
+		{name: "scope granted", scope: "profile:read"},
+		{name: "scope missing", scope: "admin", wantErr: ErrInvalidToken},
+		// Revocation goes unnoticed for at most MaxLocalAge.
+		{name: "revoked fresh token", logout: true},
+		{name: "revoked old token", age: 6 * time.Minute, logout: true, wantErr: ErrInvalidToken, wantValidations: 1},
+		{name: "old token", age: 6 * time.Minute, wantValidations: 1},
+		{name: "remote only", cfg: Config{RemoteOnly: true}, wantValidations: 1},
+		{name: "remote only and revoked", cfg: Config{RemoteOnly: true}, logout: true, wantErr: ErrInvalidToken, wantValidations: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTestApp(memory.NewRepo(), newTestKey(t))
+			service := &testAuthService{}
+			service.use(a)
+			cfg := tt.cfg
+			cfg.Issuer, cfg.Audience = testIssuer, testAudience
+			c := New(dial(t, service), cfg)
+			c.now = func() time.Time { return time.Now().Add(tt.age) }
+			token := signUp(t, a, "user@example.com")
+			if tt.logout {
+				if _, err := a.Logout(context.Background(), token.AccessToken); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			claims, err := c.Verify(context.Background(), token.AccessToken, tt.scope)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (claims.UserID != token.Id || claims.Email != "user@example.com") {
+				t.Errorf("claims = %s %s, want %s", claims.UserID, claims.Email, token.Id)
+			}
+			if validations, _ := service.calls(); validations != tt.wantValidations {
+				t.Errorf("%d Validate calls, want %d", validations, tt.wantValidations)
+			}
+		})
+	}
+}
+
+func TestClient_VerifyAfterKeyRotation(t *testing.T) {
+	repo := memory.NewRepo()
+	oldKey, newKey := newTestKey(t), newTestKey(t)
+	before := newTestApp(repo, oldKey)
+	service := &testAuthService{}
+	service.use(before)
+	c := New(dial(t, service), Config{Issuer: testIssuer, Audience: testAudience})
+	ctx := context.Background()
+	oldToken := signUp(t, before, "old@example.com")
+	if _, err := c.Verify(ctx, oldToken.AccessToken, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	rotated := newTestApp(repo, newKey, &oldKey.PublicKey)
+	service.use(rotated)
+	newToken := signUp(t, rotated, "new@example.com")
+	// The unknown kid of the new key is only fetched once the minimum refresh interval passed.
+	c.keys.now = func() time.Time { return time.Now().Add(time.Minute) }
+	for name, token := range map[string]string{"old": oldToken.AccessToken, "new": newToken.AccessToken} {
+		if _, err := c.Verify(ctx, token, ""); err != nil {
+			t.Errorf("Verify(%s) error = %v", name, err)
+		}
+	}
+	validations, keyFetches := service.calls()
+	if validations != 0 || keyFetches != 2 {
+		t.Errorf("%d Validate calls and %d key fetches, want 0 and 2", validations, keyFetches)
+	}
+	if _, err := rotated.Validate(ctx, oldToken.AccessToken, ""); err != nil {
+		t.Errorf("the auth service rejects tokens of the previous key: %v", err)
+	}
+}
@@ -0,0 +1,30 @@
+package authclient
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+type claimsKey struct{}
+
+// NewContext returns a copy of ctx carrying the claims of the authenticated caller.
+func NewContext(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// FromContext returns the claims stored by the interceptors and middleware.
+func FromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*Claims)
+	return claims, ok
+}
+
+// UserIDFromContext returns the ID of the authenticated user. It reports false
+// for unauthenticated requests and for service clients.
+func UserIDFromContext(ctx context.Context) (uuid.UUID, bool) {
+	claims, ok := FromContext(ctx)
+	if !ok || claims.IsService() {
+		return uuid.UUID{}, false
+	}
+	return claims.UserID, true
+}
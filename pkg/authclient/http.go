@@ -0,0 +1,60 @@
+package authclient
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Middleware authenticates the bearer token in the Authorization header of
+// net/http requests and stores its claims in the request context.
+func Middleware(c *Client, opts ...Option) func(http.Handler) http.Handler {
+	o := newOptions(opts)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, code, err := c.authenticateHTTP(r, o.scope)
+			if err != nil {
+				if code == http.StatusUnauthorized {
+					w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				}
+				http.Error(w, err.Error(), code)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), claims)))
+		})
+	}
+}
+
+// EchoMiddleware is Middleware for echo.
+func EchoMiddleware(c *Client, opts ...Option) echo.MiddlewareFunc {
+	o := newOptions(opts)
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			claims, code, err := c.authenticateHTTP(ctx.Request(), o.scope)
+			if err != nil {
+				if code == http.StatusUnauthorized {
+					ctx.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+				}
+				return echo.NewHTTPError(code, err.Error())
+			}
+			ctx.SetRequest(ctx.Request().WithContext(NewContext(ctx.Request().Context(), claims)))
+			return next(ctx)
+		}
+	}
+}
+
+func (c *Client) authenticateHTTP(r *http.Request, scope string) (*Claims, int, error) {
+	token, ok := bearerToken(r.Header.Get("Authorization"))
+	if !ok {
+		return nil, http.StatusUnauthorized, errors.New("missing bearer token")
+	}
+	claims, err := c.Verify(r.Context(), token, scope)
+	if err != nil {
+		if errors.Is(err, ErrInvalidToken) {
+			return nil, http.StatusUnauthorized, err
+		}
+		return nil, http.StatusServiceUnavailable, err
+	}
+	return claims, http.StatusOK, nil
+}
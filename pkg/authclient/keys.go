@@ -0,0 +1,61 @@
+package authclient
+
+import (
+	"context"
+	"crypto/rsa"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/soulmate-dating/auth/internal/adapters/jwt"
+)
+
+// minKeyRefreshInterval keeps tokens with made-up key IDs from turning every
+// request into a key fetch.
+const minKeyRefreshInterval = 30 * time.Second
+
+// keyCache holds the verification keys of the auth service. Keys are fetched
+// again when they are older than ttl or a token refers to an unknown key.
+type keyCache struct {
+	fetch func(ctx context.Context) (map[string]*rsa.PublicKey, error)
+	ttl   time.Duration
+	now   func() time.Time
+
+	mu          sync.Mutex
+	keys        map[string]*rsa.PublicKey
+	fetchedAt   time.Time
+	lastAttempt time.Time
+}
+
+func newKeyCache(fetch func(ctx context.Context) (map[string]*rsa.PublicKey, error), ttl time.Duration) *keyCache {
+	return &keyCache{fetch: fetch, ttl: ttl, now: time.Now}
+}
+
+// get returns the key with the given kid. A cached key is still used if it
+// cannot be refreshed, so that an unavailable auth service does not fail
+// verification of tokens that were valid a moment ago.
+func (c *keyCache) get(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	key, ok := c.keys[kid]
+	if ok && now.Sub(c.fetchedAt) < c.ttl {
+		return key, nil
+	}
+	if now.Sub(c.lastAttempt) >= minKeyRefreshInterval {
+		c.lastAttempt = now
+		keys, err := c.fetch(ctx)
+		if err != nil && !ok {
+			return nil, fmt.Errorf("%w: %w", jwt.ErrUnknownKey, err)
+		}
+		if err == nil {
+			c.keys, c.fetchedAt = keys, now
+			key, ok = keys[kid]
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: kid %q", jwt.ErrUnknownKey, kid)
+	}
+	return key, nil
+}
@@ -0,0 +1,69 @@
+package authclient
+
+import (
+	"context"
+	"crypto/rsa"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/soulmate-dating/auth/internal/adapters/jwt"
+)
+
+func TestKeyCache(t *testing.T) {
+	first, second := &rsa.PublicKey{E: 3}, &rsa.PublicKey{E: 65537}
+	published := map[string]*rsa.PublicKey{"first": first}
+	var fetches int
+	var fetchErr error
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	cache := newKeyCache(func(context.Context) (map[string]*rsa.PublicKey, error) {
+		fetches++
+		return published, fetchErr
+	}, 10*time.Minute)
+	cache.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	steps := []struct {
+		name        string
+		after       time.Duration
+		kid         string
+		want        *rsa.PublicKey
+		wantFetches int
+	}{
+		{"first use", 0, "first", first, 1},
+		{"cached", time.Second, "first", first, 1},
+		// A made-up kid must not turn every request into a fetch.
+		{"unknown kid right after a fetch", 10 * time.Second, "second", nil, 1},
+		{"unknown kid after the minimum interval", 30 * time.Second, "second", second, 2},
+		{"known kid after the minimum interval", 30 * time.Second, "first", first, 2},
+		{"expired", 10 * time.Minute, "first", first, 3},
+	}
+	for _, step := range steps {
+		now = now.Add(step.after)
+		if step.name == "unknown kid right after a fetch" {
+			published = map[string]*rsa.PublicKey{"first": first, "second": second}
+		}
+		key, err := cache.get(ctx, step.kid)
+		if step.want == nil {
+			if !errors.Is(err, jwt.ErrUnknownKey) {
+				t.Errorf("%s: error = %v, want %v", step.name, err, jwt.ErrUnknownKey)
+			}
+		} else if err != nil || key != step.want {
+			t.Errorf("%s: got %v, %v", step.name, key, err)
+		}
+		if fetches != step.wantFetches {
+			t.Errorf("%s: %d fetches, want %d", step.name, fetches, step.wantFetches)
+		}
+	}
+
+	// Cached keys outlive an auth service that can't be reached.
+	now = now.Add(time.Hour)
+	fetchErr = errors.New("connection refused")
+	if key, err := cache.get(ctx, "first"); err != nil || key != first {
+		t.Errorf("stale key: got %v, %v", key, err)
+	}
+	now = now.Add(time.Minute)
+	if _, err := cache.get(ctx, "third"); !errors.Is(err, jwt.ErrUnknownKey) {
+		t.Errorf("unknown kid while unreachable: error = %v, want %v", err, jwt.ErrUnknownKey)
+	}
+}
@@ -0,0 +1,34 @@
+package authclient
+
+type options struct {
+	scope  string
+	public map[string]struct{}
+}
+
+// Option configures the interceptors and middleware.
+type Option func(*options)
+
+// WithScope requires every authenticated request to carry the scope.
+func WithScope(scope string) Option {
+	return func(o *options) {
+		o.scope = scope
+	}
+}
+
+// WithPublicMethods lets the listed full gRPC method names, such as
+// "/grpc.health.v1.Health/Check", through without a token.
+func WithPublicMethods(methods ...string) Option {
+	return func(o *options) {
+		for _, m := range methods {
+			o.public[m] = struct{}{}
+		}
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{public: map[string]struct{}{}}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
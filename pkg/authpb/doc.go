@@ -0,0 +1,3 @@
+// Package authpb is the gRPC API of the auth service, generated from
+// auth.proto. The server implements it and clients such as authclient call it.
+package authpb
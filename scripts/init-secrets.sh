@@ -0,0 +1,18 @@
+#!/bin/sh
+# Creates the secret files docker-compose.yml and cmd/main/.env.example read,
+# keeping any that already exist. Run it from anywhere before the first start.
+set -eu
+
+dir="$(cd "$(dirname "$0")/.." && pwd)/secrets"
+mkdir -p "$dir"
+chmod 700 "$dir"
+
+for name in postgres_password jwt_access_secret jwt_refresh_secret; do
+	file="$dir/$name"
+	if [ -s "$file" ]; then
+		echo "keeping $file"
+		continue
+	fi
+	(umask 077 && openssl rand -hex 32 >"$file")
+	echo "created $file"
+done